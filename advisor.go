@@ -0,0 +1,211 @@
+package mgodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// an index proposed for a frequent query shape
+type IndexSuggestion struct {
+	Collection string   `json:"collection"`
+	Key        []string `json:"key"`
+	Shape      string   `json:"shape"`
+	Count      int64    `json:"count"`
+}
+
+// Command returns the suggestion as a mongo shell createIndex command
+func (s IndexSuggestion) Command() string {
+	parts := make([]string, 0, len(s.Key))
+	for _, key := range s.Key {
+		order := 1
+		if strings.HasPrefix(key, "-") {
+			key, order = key[1:], -1
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", strconv.Quote(key), order))
+	}
+	return fmt.Sprintf("db.%s.createIndex({%s})", s.Collection, strings.Join(parts, ", "))
+}
+
+// SuggestIndexes proposes indexes for the query shapes captured by EnableQueryStats
+// which no existing index serves, the most frequent shapes first.
+// keys follow the equality, then range rule, sorts are not captured and need a manual review
+// for example:
+// suggestions, _ := SuggestIndexes()
+// for _, s := range suggestions {
+// fmt.Println(s.Command())
+// }
+func (db *Database) SuggestIndexes() ([]IndexSuggestion, error) {
+	indexes := make(map[string][]mgo.Index)
+	seen := make(map[string]bool)
+	var result []IndexSuggestion
+
+	for _, stat := range db.QueryStats() {
+		key := shapeIndexKey(stat.Shape)
+		if len(key) == 0 {
+			continue
+		}
+		id := stat.Collection + " " + strings.Join(key, ",")
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		existing, ok := indexes[stat.Collection]
+		if !ok {
+			err := db.Execute(func(sess *mgo.Session) error {
+				var err error
+				existing, err = sess.DB("").C(stat.Collection).Indexes()
+				return err
+			})
+			if err != nil {
+				db.logWith(Fields{
+					"collection": stat.Collection,
+					"err":        err,
+				}).Error("suggest indexes error: database operate fail")
+				return nil, err
+			}
+			indexes[stat.Collection] = existing
+		}
+		if indexCovers(existing, key) {
+			continue
+		}
+
+		result = append(result, IndexSuggestion{
+			Collection: stat.Collection,
+			Key:        key,
+			Shape:      stat.Shape,
+			Count:      stat.Count,
+		})
+	}
+	return result, nil
+}
+
+func SuggestIndexes() ([]IndexSuggestion, error) {
+	return _db.SuggestIndexes()
+}
+
+// shapeIndexKey returns the index key serving a query shape,
+// equality fields sorted by name then range fields, nil if none
+func shapeIndexKey(shape string) []string {
+	var query interface{}
+	if err := json.Unmarshal(shapeJSON(shape), &query); err != nil {
+		return nil
+	}
+	// aggregation: the leading $match
+	if stages, ok := query.([]interface{}); ok {
+		if len(stages) == 0 {
+			return nil
+		}
+		stage, _ := stages[0].(map[string]interface{})
+		query = stage["$match"]
+	}
+	doc, ok := query.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var equality, ranges []string
+	collectFields(doc, &equality, &ranges)
+	if len(equality) == 0 && len(ranges) == 0 {
+		return nil
+	}
+	sort.Strings(equality)
+	sort.Strings(ranges)
+	// _id is always indexed
+	if len(equality) == 1 && equality[0] == "_id" && len(ranges) == 0 {
+		return nil
+	}
+	return append(equality, ranges...)
+}
+
+func collectFields(doc map[string]interface{}, equality *[]string, ranges *[]string) {
+	for field, value := range doc {
+		if field == "$and" {
+			items, _ := value.([]interface{})
+			for _, item := range items {
+				if sub, ok := item.(map[string]interface{}); ok {
+					collectFields(sub, equality, ranges)
+				}
+			}
+			continue
+		}
+		// $or, $where, $expr... cannot be served by one compound index
+		if strings.HasPrefix(field, "$") {
+			continue
+		}
+
+		cond, ok := value.(map[string]interface{})
+		if !ok || !isOperatorDoc(cond) {
+			if !containsString(*equality, field) {
+				*equality = append(*equality, field)
+			}
+			continue
+		}
+		_, eq := cond["$eq"]
+		_, in := cond["$in"]
+		if (eq || in) && len(cond) == 1 {
+			if !containsString(*equality, field) {
+				*equality = append(*equality, field)
+			}
+		} else if !containsString(*ranges, field) {
+			*ranges = append(*ranges, field)
+		}
+	}
+}
+
+func isOperatorDoc(doc map[string]interface{}) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) > 0
+}
+
+// shapeJSON turns the placeholders of a shape into json nulls
+func shapeJSON(shape string) []byte {
+	var buf bytes.Buffer
+	quoted, escaped := false, false
+	for _, c := range shape {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == '?':
+			buf.WriteString("null")
+			continue
+		}
+		buf.WriteRune(c)
+	}
+	return buf.Bytes()
+}
+
+// indexCovers reports whether an index starts with the fields of key, in any order
+func indexCovers(indexes []mgo.Index, key []string) bool {
+	for _, index := range indexes {
+		if len(index.Key) < len(key) {
+			continue
+		}
+		fields := make([]string, 0, len(key))
+		for _, k := range index.Key[:len(key)] {
+			fields = append(fields, strings.TrimLeft(k, "-+"))
+		}
+		sorted := append([]string(nil), fields...)
+		sort.Strings(sorted)
+		want := append([]string(nil), key...)
+		sort.Strings(want)
+		if strings.Join(sorted, ",") == strings.Join(want, ",") {
+			return true
+		}
+	}
+	return false
+}
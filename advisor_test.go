@@ -0,0 +1,37 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestShapeIndexKey(t *testing.T) {
+	shape := NormalizeQuery(bson.M{"price": bson.M{"$gt": 1}, "name": "a", "ownerId": bson.M{"$in": []int{1, 2}}})
+	assert.Equal(t, []string{"name", "ownerId", "price"}, shapeIndexKey(shape))
+
+	shape = NormalizeQuery(bson.M{"$and": []bson.M{{"name": "a"}, {"created": bson.M{"$lt": 1}}}})
+	assert.Equal(t, []string{"name", "created"}, shapeIndexKey(shape))
+
+	shape = NormalizeQuery([]bson.M{{"$match": bson.M{"name": "a?"}}, {"$group": bson.M{"_id": "$name"}}})
+	assert.Equal(t, []string{"name"}, shapeIndexKey(shape))
+
+	assert.Nil(t, shapeIndexKey(NormalizeQuery(bson.M{"_id": 1})))
+	assert.Nil(t, shapeIndexKey(NormalizeQuery(bson.M{"$or": []bson.M{{"name": "a"}}})))
+	assert.Nil(t, shapeIndexKey(NormalizeQuery(nil)))
+}
+
+func TestIndexSuggestionCommand(t *testing.T) {
+	s := IndexSuggestion{Collection: "car", Key: []string{"name", "-price"}}
+	assert.Equal(t, `db.car.createIndex({"name": 1, "price": -1})`, s.Command())
+}
+
+func TestIndexCovers(t *testing.T) {
+	indexes := []mgo.Index{{Key: []string{"ownerId", "name", "-price"}}}
+	assert.True(t, indexCovers(indexes, []string{"name", "ownerId"}))
+	assert.True(t, indexCovers(indexes, []string{"name", "ownerId", "price"}))
+	assert.False(t, indexCovers(indexes, []string{"name"}))
+	assert.False(t, indexCovers(indexes, []string{"name", "ownerId", "price", "created"}))
+}
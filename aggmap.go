@@ -0,0 +1,81 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrAggregateMapShape = errors.New("aggregate map rows must hold _id and exactly one other field")
+)
+
+// AggregateMap runs piplines on the collection of model and returns its rows as a map,
+// keyed by _id, of their one other field, for $group results without a struct to receive them
+// for example:
+// totals, err := AggregateMap[int64, int](&Car{}, []bson.M{
+// {"$group": bson.M{"_id": "$ownerId", "totalPrice": bson.M{"$sum": "$price"}}},
+// })
+func AggregateMap[K comparable, V any](model interface{}, piplines interface{}) (map[K]V, error) {
+	piplines = buildPipeline(piplines)
+	if err := validateModel(model); err != nil {
+		return nil, err
+	}
+	if err := _db.applyPipelinePolicy(context.Background(), model, &piplines); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("aggregate map db error: policy denied")
+		return nil, err
+	}
+
+	collection := GetCollectionName(model)
+	rows := []bson.RawD{}
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(&rows)
+	})
+	_db.observe(context.Background(), "aggregate", collection, piplines, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"piplines":   piplines,
+			"err":        err,
+		}).Error("aggregate map db error: database operate fail")
+		return nil, err
+	}
+	return rowsToMap[K, V](rows)
+}
+
+func rowsToMap[K comparable, V any](rows []bson.RawD) (map[K]V, error) {
+	result := make(map[K]V, len(rows))
+	for _, row := range rows {
+		if len(row) != 2 {
+			return nil, ErrAggregateMapShape
+		}
+		keyElem, valueElem := row[0], row[1]
+		if keyElem.Name != "_id" {
+			keyElem, valueElem = valueElem, keyElem
+		}
+		if keyElem.Name != "_id" {
+			return nil, ErrAggregateMapShape
+		}
+		var key K
+		var value V
+		if err := keyElem.Value.Unmarshal(&key); err != nil {
+			return nil, err
+		}
+		if err := valueElem.Value.Unmarshal(&value); err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
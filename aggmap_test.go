@@ -0,0 +1,35 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func rawRows(t *testing.T, docs ...bson.D) []bson.RawD {
+	rows := []bson.RawD{}
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		assert.NoError(t, err)
+		row := bson.RawD{}
+		assert.NoError(t, bson.Unmarshal(data, &row))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestRowsToMap(t *testing.T) {
+	rows := rawRows(t,
+		bson.D{{Name: "_id", Value: int64(1)}, {Name: "totalPrice", Value: 30}},
+		bson.D{{Name: "totalPrice", Value: 5}, {Name: "_id", Value: int64(2)}},
+	)
+	result, err := rowsToMap[int64, int](rows)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]int{1: 30, 2: 5}, result)
+
+	_, err = rowsToMap[int64, int](rawRows(t, bson.D{{Name: "_id", Value: 1}}))
+	assert.Equal(t, ErrAggregateMapShape, err)
+	_, err = rowsToMap[int64, int](rawRows(t, bson.D{{Name: "a", Value: 1}, {Name: "b", Value: 2}}))
+	assert.Equal(t, ErrAggregateMapShape, err)
+}
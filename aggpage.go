@@ -0,0 +1,67 @@
+package mgodb
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// stages which keep one output record per input record, so paginating
+// before them returns the same page as paginating after them
+var rowPreservingStages = map[string]bool{
+	"$lookup":      true,
+	"$graphLookup": true,
+	"$project":     true,
+	"$addFields":   true,
+	"$set":         true,
+	"$unset":       true,
+	"$replaceRoot": true,
+	"$replaceWith": true,
+}
+
+// PagePipeline appends the $skip and $limit of page (starting from 1) to piplines.
+// when the stages from the first $lookup on keep one record per input record,
+// the page is cut before the $lookup, so only pageSize records are joined.
+// $sort, $match, $unwind or $group after the $lookup keep the pagination at the end
+// for example:
+// PagePipeline([]bson.M{{"$match": query}, {"$sort": bson.M{"created": -1}}, {"$lookup": lookup}}, 2, 20)
+// returns $match, $sort, $skip 20, $limit 20, $lookup
+func PagePipeline(piplines []bson.M, page int, pageSize int) []bson.M {
+	if page < 1 {
+		page = 1
+	}
+	paging := []bson.M{{"$skip": (page - 1) * pageSize}, {"$limit": pageSize}}
+
+	cut := len(piplines)
+	for i := len(piplines) - 1; i >= 0; i-- {
+		if !preservesRows(piplines[i]) {
+			break
+		}
+		if _, ok := piplines[i]["$lookup"]; ok {
+			cut = i
+		} else if _, ok := piplines[i]["$graphLookup"]; ok {
+			cut = i
+		}
+	}
+
+	result := make([]bson.M, 0, len(piplines)+len(paging))
+	result = append(result, piplines[:cut]...)
+	result = append(result, paging...)
+	return append(result, piplines[cut:]...)
+}
+
+func preservesRows(stage bson.M) bool {
+	if len(stage) != 1 {
+		return false
+	}
+	for name := range stage {
+		return rowPreservingStages[name]
+	}
+	return false
+}
+
+// AggregatePage runs piplines and returns one page of the results,
+// pagination is moved before the $lookup stages when possible, see PagePipeline
+// for example:
+// AggregatePage(&result, []bson.M{{"$match": query}, {"$sort": sort}, {"$lookup": lookup}}, 1, 20)
+func AggregatePage(result interface{}, piplines []bson.M, page int, pageSize int) error {
+	return Aggregate(result, PagePipeline(piplines, page, pageSize))
+}
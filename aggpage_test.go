@@ -0,0 +1,24 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestPagePipeline(t *testing.T) {
+	match := bson.M{"$match": bson.M{"price": 1}}
+	sort := bson.M{"$sort": bson.M{"created": -1}}
+	lookup := bson.M{"$lookup": bson.M{"from": "owner"}}
+	project := bson.M{"$project": bson.M{"owner": 1}}
+	skip, limit := bson.M{"$skip": 20}, bson.M{"$limit": 20}
+
+	assert.Equal(t, []bson.M{match, sort, skip, limit, lookup, project},
+		PagePipeline([]bson.M{match, sort, lookup, project}, 2, 20))
+	assert.Equal(t, []bson.M{match, lookup, sort, skip, limit},
+		PagePipeline([]bson.M{match, lookup, sort}, 2, 20))
+	assert.Equal(t, []bson.M{match, lookup, {"$unwind": "$owner"}, skip, limit},
+		PagePipeline([]bson.M{match, lookup, {"$unwind": "$owner"}}, 2, 20))
+	assert.Equal(t, []bson.M{{"$skip": 0}, limit}, PagePipeline(nil, 0, 20))
+}
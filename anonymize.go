@@ -0,0 +1,119 @@
+package mgodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Anonymizer replaces the value of a field
+type Anonymizer func(value interface{}) interface{}
+
+// AnonymizeRules maps dotted field paths to their anonymizer, a path crossing an
+// array of documents applies to each of them
+type AnonymizeRules map[string]Anonymizer
+
+// HashValue replaces a value by the hex sha256 of salt and the value, equal values
+// stay equal so joins and unique indexes still work
+func HashValue(salt string) Anonymizer {
+	return func(value interface{}) interface{} {
+		sum := sha256.Sum256([]byte(salt + fmt.Sprint(value)))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// MaskValue replaces all but the last keep characters of a string value by '*'
+func MaskValue(keep int) Anonymizer {
+	return func(value interface{}) interface{} {
+		s, ok := value.(string)
+		if !ok {
+			return value
+		}
+		runes := []rune(s)
+		for i := 0; i < len(runes)-keep; i++ {
+			runes[i] = '*'
+		}
+		return string(runes)
+	}
+}
+
+// FakeValue replaces a value by the one fn generates
+func FakeValue(fn func() interface{}) Anonymizer {
+	return func(value interface{}) interface{} {
+		return fn()
+	}
+}
+
+// RemoveValue drops the field
+func RemoveValue() Anonymizer {
+	return nil
+}
+
+// Anonymize applies rules to doc in place, missing fields are left missing
+func Anonymize(doc bson.M, rules AnonymizeRules) {
+	for path, rule := range rules {
+		anonymizePath(doc, strings.Split(path, "."), rule)
+	}
+}
+
+func anonymizePath(value interface{}, keys []string, rule Anonymizer) {
+	switch v := value.(type) {
+	case bson.M:
+		current, ok := v[keys[0]]
+		if !ok {
+			return
+		}
+		if len(keys) > 1 {
+			anonymizePath(current, keys[1:], rule)
+			return
+		}
+		if rule == nil {
+			delete(v, keys[0])
+			return
+		}
+		v[keys[0]] = rule(current)
+	case []interface{}:
+		for _, item := range v {
+			anonymizePath(item, keys, rule)
+		}
+	}
+}
+
+// CopyCollection copies the records of model to the same collection of the database
+// of dst, another cluster's session, with rules applied, replacing the records with the same _id.
+// returns the number of copied records
+// for example:
+// staging, _ := mgo.Dial(stagingURI)
+// CopyCollection(&User{}, staging, AnonymizeRules{"email": HashValue(salt)})
+func CopyCollection(model interface{}, dst *mgo.Session, rules AnonymizeRules) (int, error) {
+	if err := validateModel(model); err != nil {
+		return 0, err
+	}
+
+	collection := GetCollectionName(model)
+	target := dst.DB("").C(collection)
+	var copied int
+	start := time.Now()
+	err := Execute(func(sess *mgo.Session) error {
+		var err error
+		copied, err = bulkCopy(sess.DB("").C(collection).Find(nil).Iter(), target, func(doc bson.M) {
+			Anonymize(doc, rules)
+		})
+		return err
+	})
+	_db.observe(context.Background(), "copy", collection, nil, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"copied":     copied,
+			"err":        err,
+		}).Error("copy collection db error: database operate fail")
+	}
+	return copied, err
+}
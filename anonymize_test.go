@@ -0,0 +1,33 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestAnonymize(t *testing.T) {
+	doc := bson.M{
+		"email":   "a@b.com",
+		"phone":   "13800138000",
+		"name":    "xx",
+		"token":   "secret",
+		"address": []interface{}{bson.M{"street": "main"}, bson.M{"street": "second"}},
+	}
+	Anonymize(doc, AnonymizeRules{
+		"email":          HashValue("salt"),
+		"phone":          MaskValue(4),
+		"name":           FakeValue(func() interface{} { return "fake" }),
+		"token":          RemoveValue(),
+		"address.street": MaskValue(0),
+		"missing":        MaskValue(0),
+	})
+	assert.Equal(t, HashValue("salt")("a@b.com"), doc["email"])
+	assert.NotEqual(t, HashValue("other")("a@b.com"), doc["email"])
+	assert.Equal(t, "*******8000", doc["phone"])
+	assert.Equal(t, "fake", doc["name"])
+	assert.NotContains(t, doc, "token")
+	assert.NotContains(t, doc, "missing")
+	assert.Equal(t, bson.M{"street": "******"}, doc["address"].([]interface{})[1])
+}
@@ -0,0 +1,65 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type appNameKey struct{}
+
+type appName struct {
+	sync.RWMutex
+	name string
+}
+
+// SetAppName sets the name reads of this database are attributed to in the server logs and
+// the profiler, where it shows as the comment of its find queries, with the metadata of WithMeta.
+// the driver predates handshake client metadata, so connections themselves stay anonymous
+// for example:
+// SetAppName("order-service")
+func (db *Database) SetAppName(name string) {
+	db.appName.Lock()
+	defer db.appName.Unlock()
+	db.appName.name = name
+}
+
+func SetAppName(name string) {
+	_db.SetAppName(name)
+}
+
+// WithAppName returns a copy of ctx whose reads are attributed to name instead of
+// the name of SetAppName, for a client or a job sharing the database
+func WithAppName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, appNameKey{}, name)
+}
+
+// appNameOf returns the app name reads under ctx are attributed to, "" if none
+func (db *Database) appNameOf(ctx context.Context) string {
+	if name, ok := ctx.Value(appNameKey{}).(string); ok {
+		return name
+	}
+	db.appName.RLock()
+	defer db.appName.RUnlock()
+	return db.appName.name
+}
+
+// attribute comments q with the app name and the metadata of ctx (see WithMeta),
+// a query keeps a single comment
+func (db *Database) attribute(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if comment := db.commentOf(ctx); comment != "" {
+		return q.Comment(comment)
+	}
+	return q
+}
+
+// commentOf returns the query comment of ctx, the app name followed by the metadata
+// for example: "order-service actorId=1 requestId=abc"
+func (db *Database) commentOf(ctx context.Context) string {
+	name, meta := db.appNameOf(ctx), MetaComment(ctx)
+	if name == "" || meta == "" {
+		return name + meta
+	}
+	return name + " " + meta
+}
@@ -0,0 +1,21 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppName(t *testing.T) {
+	db := &Database{}
+	assert.Equal(t, "", db.appNameOf(context.Background()))
+	db.SetAppName("order-service")
+	assert.Equal(t, "order-service", db.appNameOf(context.Background()))
+	assert.Equal(t, "report-job", db.appNameOf(WithAppName(context.Background(), "report-job")))
+
+	assert.Equal(t, "order-service", db.commentOf(context.Background()))
+	assert.Equal(t, "order-service actorId=1", db.commentOf(WithMeta(context.Background(), "actorId", 1)))
+	db.SetAppName("")
+	assert.Equal(t, "actorId=1", db.commentOf(WithMeta(context.Background(), "actorId", 1)))
+}
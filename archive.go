@@ -0,0 +1,196 @@
+package mgodb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// records removed per query once archived
+const archiveBatchSize = 1000
+
+// ArchiveSink is the cold storage archives are written to and restored from,
+// see DirSink and S3Sink
+type ArchiveSink interface {
+	// Create returns a writer of the archive name, the archive must be durable once it is closed
+	Create(name string) (io.WriteCloser, error)
+	// Open returns a reader of the archive name
+	Open(name string) (io.ReadCloser, error)
+}
+
+// DirSink keeps archives as files of a local directory
+type DirSink struct {
+	Dir string
+}
+
+func (s DirSink) Create(name string) (io.WriteCloser, error) {
+	path := filepath.Join(s.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+func (s DirSink) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, name))
+}
+
+// Archive writes the records of model matching selector to the archive name of sink,
+// as gzip compressed extended JSON lines, then removes them once the archive is closed.
+// a record is only removed as archived: unchanged since according to its version field
+// (see UpsertMerge) when model has one, and still matching selector. the records changed
+// meanwhile are kept, a restore of the archive would replace them with the archived version.
+// returns the number of removed records
+// for example:
+// Archive(&Order{}, bson.M{"created": bson.M{"$lt": cutoff}}, DirSink{"/backup"}, "order/2020-01.json.gz")
+func Archive(model interface{}, selector bson.M, sink ArchiveSink, name string) (int, error) {
+	if err := validateModel(model); err != nil {
+		return 0, err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("archive db error: model is read-only")
+		return 0, err
+	}
+
+	collection := GetCollectionName(model)
+	version := versionField(model)
+	start := time.Now()
+	archived := []bson.M{}
+	err := Execute(func(sess *mgo.Session) error {
+		w, err := sink.Create(name)
+		if err != nil {
+			return err
+		}
+		zw := gzip.NewWriter(w)
+		iter := sess.DB("").C(collection).Find(selector).Iter()
+		doc := bson.M{}
+		for iter.Next(&doc) {
+			// the encoder ends the line
+			line, err := bson.MarshalJSON(doc)
+			if err == nil {
+				_, err = zw.Write(line)
+			}
+			if err != nil {
+				iter.Close()
+				w.Close()
+				return err
+			}
+			archived = append(archived, archivedKey(doc, version))
+			doc = bson.M{}
+		}
+		if err := iter.Close(); err != nil {
+			w.Close()
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+	_db.observe(context.Background(), "archive", collection, selector, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"archive":    name,
+			"err":        err,
+		}).Error("archive db error: write archive fail")
+		return 0, err
+	}
+
+	// only the archived records are removed, even if others match by now
+	removed := 0
+	for i := 0; i < len(archived); i += archiveBatchSize {
+		end := i + archiveBatchSize
+		if end > len(archived) {
+			end = len(archived)
+		}
+		cond := bson.M{"$and": []interface{}{selector, bson.M{"$or": archived[i:end]}}}
+		err = _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+			info, err := sess.DB("").C(collection).RemoveAll(cond)
+			if info != nil {
+				removed += info.Removed
+			}
+			return err
+		})
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"archive":    name,
+				"err":        err,
+			}).Error("archive db error: remove archived records fail")
+			return removed, err
+		}
+	}
+	if removed < len(archived) {
+		logWith(Fields{
+			"collection": collection,
+			"archive":    name,
+			"archived":   len(archived),
+			"removed":    removed,
+		}).Info("archive kept the records changed since archived")
+	}
+	return removed, nil
+}
+
+// archivedKey matches the archived version of doc, by its version field when there is one
+func archivedKey(doc bson.M, version string) bson.M {
+	if version == "" {
+		return bson.M{"_id": doc["_id"]}
+	}
+	return bson.M{"_id": doc["_id"], version: doc[version]}
+}
+
+// RestoreArchive inserts back the records of the archive name of sink into the collection
+// of model, replacing the records with the same _id, so a restore can be run again.
+// returns the number of restored records
+func RestoreArchive(model interface{}, sink ArchiveSink, name string) (int, error) {
+	if err := validateModel(model); err != nil {
+		return 0, err
+	}
+
+	r, err := sink.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	collection := GetCollectionName(model)
+	restored := 0
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		doc := bson.M{}
+		if err := bson.UnmarshalJSON(scanner.Bytes(), &doc); err != nil {
+			return restored, err
+		}
+		err := _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+			_, err := sess.DB("").C(collection).UpsertId(doc["_id"], doc)
+			return err
+		})
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"archive":    name,
+				"err":        err,
+			}).Error("restore archive db error: database operate fail")
+			return restored, err
+		}
+		restored++
+	}
+	return restored, scanner.Err()
+}
@@ -0,0 +1,35 @@
+package mgodb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDirSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgodb-archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := DirSink{Dir: dir}
+	w, err := sink.Create("car/2020.json.gz")
+	assert.NoError(t, err)
+	w.Write([]byte("data"))
+	assert.NoError(t, w.Close())
+
+	r, err := sink.Open("car/2020.json.gz")
+	assert.NoError(t, err)
+	defer r.Close()
+	data, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestArchivedKey(t *testing.T) {
+	doc := bson.M{"_id": 1, "updated": 5, "name": "a"}
+	assert.Equal(t, bson.M{"_id": 1, "updated": 5}, archivedKey(doc, "updated"))
+	assert.Equal(t, bson.M{"_id": 1}, archivedKey(doc, ""))
+	assert.Equal(t, "", versionField(&fieldsInner{}))
+}
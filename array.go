@@ -0,0 +1,80 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidLength = errors.New("max length must be positive")
+)
+
+// find one record with only a page of the embedded array field,
+// a negative skip counts from the end of the array.
+// like FindOne, no record found is not an error, model is left as is
+// for example:
+// post := &Post{}
+// FindSlice(post, bson.M{"postId": 1}, "comments", 20, 10)
+func FindSlice(model interface{}, query interface{}, field string, skip int, limit int) error {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"query": query,
+			"field": field,
+			"err":   err,
+		}).Error("find slice db error: validate model fail")
+		return err
+	}
+	if err := _db.applyPolicy(context.Background(), model, ActionFind, &query); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("find slice db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	projection := bson.M{field: bson.M{"$slice": []int{skip, limit}}}
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		q, err := _db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		return q.Select(projection).One(model)
+	})
+	_db.observe(context.Background(), "findOne", collection, query, start, err)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		logWith(Fields{
+			"model":      model,
+			"query":      query,
+			"field":      field,
+			"skip":       skip,
+			"limit":      limit,
+			"collection": collection,
+			"err":        err,
+		}).Error("find slice db error: database operate fail")
+	}
+
+	return err
+}
+
+// append items to the embedded array field of one record,
+// keeping only the latest maxLen items
+// for example:
+// post := &Post{}
+// PushBounded(post, bson.M{"postId": 1}, "comments", []interface{}{comment}, 100)
+func PushBounded(model interface{}, selector interface{}, field string, items []interface{}, maxLen int) error {
+	if maxLen <= 0 {
+		return ErrInvalidLength
+	}
+	update := bson.M{"$push": bson.M{field: bson.M{"$each": items, "$slice": -maxLen}}}
+	return UpdateOne(model, selector, update)
+}
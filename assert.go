@@ -0,0 +1,162 @@
+package mgodb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrAssertionFailed = errors.New("startup assertion failed")
+)
+
+// AssertionSpec lists what the collection of a model must look like, see Assert
+type AssertionSpec struct {
+	// the collection must exist
+	Exists bool
+	// indexes which must be present, keys as in mgo.Index, for example []string{"-created", "name"}
+	Indexes [][]string
+	// the validator of the collection must be the $jsonSchema of the model, see ApplyJSONSchema
+	Validator bool
+	// the collection must hold at least this many documents
+	MinCount int
+}
+
+// AssertionError reports every failed assertion of a collection
+type AssertionError struct {
+	Collection string
+	Failures   []string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("mgodb: %s: %s: %s", ErrAssertionFailed, e.Collection, strings.Join(e.Failures, "; "))
+}
+
+func (e *AssertionError) Unwrap() error {
+	return ErrAssertionFailed
+}
+
+// Assert checks the collection of model against spec, to run at startup so that a
+// misconfigured environment fails fast before taking traffic. returns an *AssertionError
+// listing every failed assertion, or the error of the database
+// for example:
+// if err := Assert(&Car{}, AssertionSpec{Exists: true, Indexes: [][]string{{"carId"}}, MinCount: 1}); err != nil {
+// log.Fatal(err)
+// }
+func (db *Database) Assert(model interface{}, spec AssertionSpec) error {
+	if err := validateModel(model); err != nil {
+		db.logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("assert error: validate model fail")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	report := &AssertionError{Collection: collection}
+	err := db.Execute(func(sess *mgo.Session) error {
+		names, err := sess.DB("").CollectionNames()
+		if err != nil {
+			return err
+		}
+		if !containsString(names, collection) {
+			if spec.Exists || len(spec.Indexes) > 0 || spec.Validator || spec.MinCount > 0 {
+				report.Failures = append(report.Failures, "collection does not exist")
+			}
+			return nil
+		}
+
+		if len(spec.Indexes) > 0 {
+			indexes, err := sess.DB("").C(collection).Indexes()
+			if err != nil {
+				return err
+			}
+			for _, key := range spec.Indexes {
+				if !hasIndex(indexes, key) {
+					report.Failures = append(report.Failures, fmt.Sprintf("index %v missing", key))
+				}
+			}
+		}
+
+		if spec.Validator {
+			match, err := validatorMatches(sess, collection, bson.M{"$jsonSchema": JSONSchema(model)})
+			if err != nil {
+				return err
+			}
+			if !match {
+				report.Failures = append(report.Failures, "validator differs from the model schema")
+			}
+		}
+
+		if spec.MinCount > 0 {
+			n, err := sess.DB("").C(collection).Count()
+			if err != nil {
+				return err
+			}
+			if n < spec.MinCount {
+				report.Failures = append(report.Failures, fmt.Sprintf("%d documents, want at least %d", n, spec.MinCount))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.logWith(Fields{
+			"collection": collection,
+			"err":        err,
+		}).Error("assert error: database operate fail")
+		return err
+	}
+	if len(report.Failures) > 0 {
+		db.logWith(Fields{
+			"collection": collection,
+			"failures":   report.Failures,
+		}).Error("assert error: assertion failed")
+		return report
+	}
+	return nil
+}
+
+func Assert(model interface{}, spec AssertionSpec) error {
+	return _db.Assert(model, spec)
+}
+
+// hasIndex reports whether an index has exactly key
+func hasIndex(indexes []mgo.Index, key []string) bool {
+	for _, index := range indexes {
+		if strings.Join(index.Key, ",") == strings.Join(key, ",") {
+			return true
+		}
+	}
+	return false
+}
+
+// validatorMatches compares the validator of collection with validator,
+// both decoded alike so that key order does not matter
+func validatorMatches(sess *mgo.Session, collection string, validator bson.M) (bool, error) {
+	var result struct {
+		Cursor struct {
+			FirstBatch []struct {
+				Options struct {
+					Validator bson.M `bson:"validator"`
+				} `bson:"options"`
+			} `bson:"firstBatch"`
+		} `bson:"cursor"`
+	}
+	err := sess.DB("").Run(bson.D{
+		{Name: "listCollections", Value: 1},
+		{Name: "filter", Value: bson.M{"name": collection}},
+	}, &result)
+	if err != nil || len(result.Cursor.FirstBatch) == 0 {
+		return false, err
+	}
+
+	var want bson.M
+	if err := remarshal(validator, &want); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(result.Cursor.FirstBatch[0].Options.Validator, want), nil
+}
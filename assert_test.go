@@ -0,0 +1,22 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestHasIndex(t *testing.T) {
+	indexes := []mgo.Index{{Key: []string{"_id"}}, {Key: []string{"-created", "name"}}}
+	assert.True(t, hasIndex(indexes, []string{"-created", "name"}))
+	assert.False(t, hasIndex(indexes, []string{"created", "name"}))
+	assert.False(t, hasIndex(indexes, []string{"-created"}))
+}
+
+func TestAssertionError(t *testing.T) {
+	err := &AssertionError{Collection: "fields_inner", Failures: []string{"index [carId] missing", "0 documents, want at least 1"}}
+	assert.True(t, errors.Is(err, ErrAssertionFailed))
+	assert.Equal(t, "mgodb: startup assertion failed: fields_inner: index [carId] missing; 0 documents, want at least 1", err.Error())
+}
@@ -0,0 +1,148 @@
+package mgodb
+
+import (
+	"errors"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// helpers for schemaless map[string]interface{} sections like Car.Remark,
+// keys are validated so user supplied keys cannot inject operators or paths
+
+var (
+	ErrInvalidAttrKey = errors.New("attribute key must not be empty, start with $ or contain a dot")
+)
+
+// AttrPath returns the dot path of key inside field
+// for example:
+// AttrPath("remark", "color") returns "remark.color"
+func AttrPath(field string, key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "$") || strings.Contains(key, ".") || strings.ContainsRune(key, 0) {
+		return "", ErrInvalidAttrKey
+	}
+	return field + "." + key, nil
+}
+
+// AttrQuery returns a query matching records whose attribute key equals value
+// for example:
+// query, err := AttrQuery("remark", "color", "red")
+// Find(&result, query, 1, 10, nil)
+func AttrQuery(field string, key string, value interface{}) (bson.M, error) {
+	path, err := AttrPath(field, key)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{path: value}, nil
+}
+
+// set attributes of one record without replacing the others,
+// nested maps are flattened into dot paths, every key is validated like by AttrPath
+// for example:
+// car := &Car{}
+// SetAttrs(car, bson.M{"carId": 1}, "remark", map[string]interface{}{"color": "red"})
+func SetAttrs(model interface{}, selector interface{}, field string, attrs map[string]interface{}) error {
+	set := bson.M{}
+	if err := attrPaths(set, field, attrs); err != nil {
+		return err
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return UpdateOne(model, selector, bson.M{"$set": set})
+}
+
+// remove attributes of one record
+// for example:
+// car := &Car{}
+// UnsetAttrs(car, bson.M{"carId": 1}, "remark", "color", "size")
+func UnsetAttrs(model interface{}, selector interface{}, field string, keys ...string) error {
+	unset := bson.M{}
+	for _, key := range keys {
+		path, err := AttrPath(field, key)
+		if err != nil {
+			return err
+		}
+		unset[path] = ""
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+	return UpdateOne(model, selector, bson.M{"$unset": unset})
+}
+
+// FlattenAttrs flattens nested maps into dot path keys
+// for example:
+// FlattenAttrs(map[string]interface{}{"size": bson.M{"w": 1}})
+// returns map[string]interface{}{"size.w": 1}
+func FlattenAttrs(attrs map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	flattenAttrs(result, "", attrs)
+	return result
+}
+
+func flattenAttrs(result map[string]interface{}, prefix string, attrs map[string]interface{}) {
+	for key, value := range attrs {
+		switch sub := value.(type) {
+		case bson.M:
+			flattenAttrs(result, prefix+key+".", sub)
+		case map[string]interface{}:
+			flattenAttrs(result, prefix+key+".", sub)
+		default:
+			result[prefix+key] = value
+		}
+	}
+}
+
+// attrPaths flattens attrs into the dot paths of set below field, validating every key
+// before it is joined, so a dotted key cannot pass for a nested one
+func attrPaths(set bson.M, field string, attrs map[string]interface{}) error {
+	for key, value := range attrs {
+		path, err := AttrPath(field, key)
+		if err != nil {
+			return err
+		}
+		switch sub := value.(type) {
+		case bson.M:
+			err = attrPaths(set, path, sub)
+		case map[string]interface{}:
+			err = attrPaths(set, path, sub)
+		default:
+			set[path] = value
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index declared attribute keys so queries into the schemaless field can use them
+// for example:
+// IndexAttrs(&Car{}, "remark", "color", "size")
+func IndexAttrs(model interface{}, field string, keys ...string) error {
+	if err := validateModel(model); err != nil {
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	for _, key := range keys {
+		path, err := AttrPath(field, key)
+		if err != nil {
+			return err
+		}
+		err = Execute(func(sess *mgo.Session) error {
+			return sess.DB("").C(collection).EnsureIndex(mgo.Index{Key: []string{path}, Background: true, Sparse: true})
+		})
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"path":       path,
+				"err":        err,
+			}).Error("index attrs db error: database operate fail")
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestAttrs(t *testing.T) {
+	path, err := AttrPath("remark", "color")
+	assert.Nil(t, err)
+	assert.Equal(t, "remark.color", path)
+	for _, key := range []string{"", "$where", "a.b"} {
+		_, err = AttrPath("remark", key)
+		assert.Equal(t, ErrInvalidAttrKey, err)
+	}
+
+	query, err := AttrQuery("remark", "color", "red")
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"remark.color": "red"}, query)
+
+	flat := FlattenAttrs(map[string]interface{}{"color": "red", "size": bson.M{"w": 1, "h": map[string]interface{}{"cm": 2}}})
+	assert.Equal(t, map[string]interface{}{"color": "red", "size.w": 1, "size.h.cm": 2}, flat)
+
+	set := bson.M{}
+	assert.Nil(t, attrPaths(set, "remark", map[string]interface{}{"color": "red", "size": bson.M{"w": 1}}))
+	assert.Equal(t, bson.M{"remark.color": "red", "remark.size.w": 1}, set)
+	for _, attrs := range []map[string]interface{}{
+		{"a.b": 1},
+		{"size": bson.M{"$gt": 1}},
+		{"size": map[string]interface{}{"w.h": 1}},
+	} {
+		assert.Equal(t, ErrInvalidAttrKey, attrPaths(bson.M{}, "remark", attrs))
+	}
+}
@@ -0,0 +1,209 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collection keeping the progress of batch jobs
+const checkpointCollection = "mgodb_checkpoint"
+
+// progress of a batch job, stored in the checkpoint collection
+type Checkpoint struct {
+	Name      string      `json:"name" bson:"_id"`
+	LastId    interface{} `json:"lastId" bson:"lastId"`
+	Processed int         `json:"processed" bson:"processed"`
+	Updated   time.Time   `json:"updated" bson:"updated"`
+}
+
+// handles one batch of a backfill, batch is a pointer to a slice of the model type
+type BackfillFunc func(batch interface{}) error
+
+func loadCheckpoint(name string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Name: name}
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		return sess.DB("").C(checkpointCollection).FindId(name).One(checkpoint)
+	})
+	if err == mgo.ErrNotFound {
+		return checkpoint, nil
+	}
+	return checkpoint, err
+}
+
+func saveCheckpoint(checkpoint *Checkpoint) error {
+	checkpoint.Updated = time.Now().UTC()
+	return Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(checkpointCollection).UpsertId(checkpoint.Name, checkpoint)
+		return err
+	})
+}
+
+func removeCheckpoint(name string) error {
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(checkpointCollection).RemoveId(name)
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// iterate the records matching query in _id order and pass them to fn batch by batch,
+// at most rateLimit records per second (unlimited when rateLimit <= 0).
+// the progress is checkpointed after every batch, so running the same backfill
+// again after a crash resumes from the last finished batch;
+// the checkpoint is removed once the backfill completes.
+// the checkpoint is named after the collection and query, see BackfillNamed
+// for example:
+// fixPrice := func(batch interface{}) error { cars := *batch.(*[]*Car); ... }
+// processed, err := Backfill(&Car{}, bson.M{"price": 0}, 500, 2000, fixPrice)
+func Backfill(model interface{}, query interface{}, batchSize int, rateLimit int, fn BackfillFunc) (int, error) {
+	return BackfillNamed("", model, query, batchSize, rateLimit, fn)
+}
+
+// BackfillNamed is like Backfill with the checkpoint of the job name, for distinct jobs
+// running the same query or a query whose values change between runs (time.Now())
+// for example:
+// processed, err := BackfillNamed("fix-price-2020", &Car{}, bson.M{"price": 0}, 500, 2000, fixPrice)
+func BackfillNamed(job string, model interface{}, query interface{}, batchSize int, rateLimit int, fn BackfillFunc) (int, error) {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"query": query,
+			"err":   err,
+		}).Error("backfill error: validate model fail")
+		return 0, err
+	}
+	if batchSize <= 0 {
+		return 0, ErrBatchSize
+	}
+
+	collection := GetCollectionName(model)
+	name, err := backfillName(collection, job, query)
+	if err != nil {
+		return 0, err
+	}
+	// the checkpoint is named after the query of the caller
+	if err := _db.applyPolicy(context.Background(), model, ActionFind, &query); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("backfill error: policy denied")
+		return 0, err
+	}
+	checkpoint, err := loadCheckpoint(name)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"checkpoint": name,
+			"err":        err,
+		}).Error("backfill error: load checkpoint fail")
+		return 0, err
+	}
+	if checkpoint.Processed > 0 {
+		logWith(Fields{
+			"collection": collection,
+			"checkpoint": name,
+			"processed":  checkpoint.Processed,
+		}).Info("backfill resume from checkpoint")
+	}
+
+	start := time.Now()
+	processed := 0
+	sliceType := reflect.SliceOf(reflect.TypeOf(model))
+	for {
+		selector := query
+		if checkpoint.LastId != nil {
+			selector = bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$gt": checkpoint.LastId}}}}
+		}
+
+		var raws []bson.Raw
+		err := ExecuteIdempotent(func(sess *mgo.Session) error {
+			q, err := _db.query(sess, collection, selector)
+			if err != nil {
+				return err
+			}
+			return q.Sort("_id").Limit(batchSize).All(&raws)
+		})
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"checkpoint": name,
+				"err":        err,
+			}).Error("backfill error: database operate fail")
+			return processed, err
+		}
+		if len(raws) == 0 {
+			break
+		}
+
+		// decode the batch into model type, remember the last _id
+		batch := reflect.New(sliceType)
+		for _, raw := range raws {
+			doc := reflect.New(reflect.TypeOf(model).Elem())
+			if err := raw.Unmarshal(doc.Interface()); err != nil {
+				return processed, err
+			}
+			batch.Elem().Set(reflect.Append(batch.Elem(), doc))
+		}
+		var last struct {
+			Id interface{} `bson:"_id"`
+		}
+		if err := raws[len(raws)-1].Unmarshal(&last); err != nil {
+			return processed, err
+		}
+
+		if err := fn(batch.Interface()); err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"checkpoint": name,
+				"processed":  processed,
+				"err":        err,
+			}).Error("backfill error: batch fail")
+			return processed, err
+		}
+
+		processed += len(raws)
+		checkpoint.LastId = last.Id
+		checkpoint.Processed += len(raws)
+		if err := saveCheckpoint(checkpoint); err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"checkpoint": name,
+				"err":        err,
+			}).Error("backfill error: save checkpoint fail")
+			return processed, err
+		}
+		logWith(Fields{
+			"collection": collection,
+			"checkpoint": name,
+			"processed":  checkpoint.Processed,
+		}).Info("backfill progress")
+
+		// rate limit
+		if rateLimit > 0 {
+			expect := time.Duration(float64(processed) / float64(rateLimit) * float64(time.Second))
+			if wait := expect - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+
+	return processed, removeCheckpoint(name)
+}
+
+// the checkpoint name of a backfill, the job name or stable for the same collection and query
+func backfillName(collection string, job string, query interface{}) (string, error) {
+	if job != "" {
+		return "backfill:" + collection + ":" + job, nil
+	}
+	key, err := queryKey(query)
+	if err != nil {
+		return "", err
+	}
+	return "backfill:" + collection + ":" + key, nil
+}
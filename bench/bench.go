@@ -0,0 +1,231 @@
+// Package bench drives configurable mixes of operations against the cluster mgodb is
+// initialized on, and reports throughput and latency percentiles, to validate
+// pool and timeout settings before production changes.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/mulansoft/mgodb"
+)
+
+// collection used when Options.Collection is empty
+const DefaultCollection = "mgodb_bench"
+
+// Options of a run, zero values take the defaults
+type Options struct {
+	Collection  string        // collection the documents go to, DefaultCollection by default
+	Concurrency int           // concurrent workers, 10 by default
+	Duration    time.Duration // length of the run, 10s by default
+	Ops         int           // stops after this many operations when positive
+	ReadRatio   float64       // share of reads in [0, 1], the rest are writes, 0.8 by default
+	WriteOnly   bool          // runs writes only, as a zero ReadRatio means the default
+	DocSize     int           // payload bytes of a written document, 256 by default
+	Keys        int           // distinct documents read and written, 10000 by default
+	Drop        bool          // drops the collection at the end of the run
+}
+
+func (o Options) withDefaults() Options {
+	if o.Collection == "" {
+		o.Collection = DefaultCollection
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 10
+	}
+	if o.Duration <= 0 {
+		o.Duration = 10 * time.Second
+	}
+	if o.WriteOnly {
+		o.ReadRatio = 0
+	} else if o.ReadRatio <= 0 {
+		o.ReadRatio = 0.8
+	}
+	if o.ReadRatio > 1 {
+		o.ReadRatio = 1
+	}
+	if o.DocSize <= 0 {
+		o.DocSize = 256
+	}
+	if o.Keys <= 0 {
+		o.Keys = 10000
+	}
+	return o
+}
+
+// latency statistics of one kind of operation
+type Stats struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	Mean   time.Duration `json:"mean"`
+	P50    time.Duration `json:"p50"`
+	P95    time.Duration `json:"p95"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+}
+
+// result of a run
+type Report struct {
+	Options    Options       `json:"options"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Throughput float64       `json:"throughput"` // operations per second
+	Reads      Stats         `json:"reads"`
+	Writes     Stats         `json:"writes"`
+}
+
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d workers, %.0f%% reads, %d bytes documents, %s: %.1f ops/s\n",
+		r.Options.Concurrency, r.Options.ReadRatio*100, r.Options.DocSize, r.Elapsed.Round(time.Millisecond), r.Throughput)
+	for _, item := range []struct {
+		name  string
+		stats Stats
+	}{{"reads", r.Reads}, {"writes", r.Writes}} {
+		fmt.Fprintf(&buf, "%-6s count=%d errors=%d mean=%s p50=%s p95=%s p99=%s max=%s\n",
+			item.name, item.stats.Count, item.stats.Errors, item.stats.Mean, item.stats.P50,
+			item.stats.P95, item.stats.P99, item.stats.Max)
+	}
+	return buf.String()
+}
+
+type benchDoc struct {
+	Id      int       `bson:"_id"`
+	Payload []byte    `bson:"payload"`
+	Updated time.Time `bson:"updated"`
+}
+
+// samples of one kind of operation
+type recorder struct {
+	sync.Mutex
+	samples []time.Duration
+	errors  int64
+}
+
+func (r *recorder) add(elapsed time.Duration, err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.samples = append(r.samples, elapsed)
+	if err != nil {
+		r.errors++
+	}
+}
+
+func (r *recorder) stats() Stats {
+	r.Lock()
+	defer r.Unlock()
+	stats := Stats{Count: int64(len(r.samples)), Errors: r.errors}
+	if len(r.samples) == 0 {
+		return stats
+	}
+	sort.Slice(r.samples, func(i, j int) bool { return r.samples[i] < r.samples[j] })
+	var total time.Duration
+	for _, sample := range r.samples {
+		total += sample
+	}
+	stats.Mean = total / time.Duration(len(r.samples))
+	stats.P50 = percentile(r.samples, 50)
+	stats.P95 = percentile(r.samples, 95)
+	stats.P99 = percentile(r.samples, 99)
+	stats.Max = r.samples[len(r.samples)-1]
+	return stats
+}
+
+// percentile of sorted samples, p in [0, 100]
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p + 99) / 100
+	if idx > 0 {
+		idx--
+	}
+	return sorted[idx]
+}
+
+// Run drives the operations of opts through the mgodb pool until the duration
+// elapses, the operation count is reached or ctx is done.
+// reads look a random document up by id, a missing one is not an error,
+// writes upsert a random document with a payload of DocSize bytes.
+// mgodb must be initialized, with the pool and timeout settings to validate
+// for example:
+// mgodb.Init(uri, 50, 3*time.Second)
+// report, err := bench.Run(ctx, bench.Options{Concurrency: 200, ReadRatio: 0.9})
+// fmt.Print(report)
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	opts = opts.withDefaults()
+	// the duration only stops the loop, operations in flight at its end complete on ctx
+	stop, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	reads, writes := &recorder{}, &recorder{}
+	var issued int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			payload := make([]byte, opts.DocSize)
+			for stop.Err() == nil {
+				if opts.Ops > 0 && atomic.AddInt64(&issued, 1) > int64(opts.Ops) {
+					return
+				}
+				key := r.Intn(opts.Keys)
+				if r.Float64() < opts.ReadRatio {
+					began := time.Now()
+					err := read(ctx, opts.Collection, key)
+					reads.add(time.Since(began), err)
+				} else {
+					r.Read(payload)
+					began := time.Now()
+					err := write(ctx, opts.Collection, key, payload)
+					writes.add(time.Since(began), err)
+				}
+			}
+		}(time.Now().UnixNano() + int64(w))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := &Report{Options: opts, Elapsed: elapsed, Reads: reads.stats(), Writes: writes.stats()}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Reads.Count+report.Writes.Count) / elapsed.Seconds()
+	}
+	if opts.Drop {
+		err := mgodb.Execute(func(sess *mgo.Session) error {
+			return sess.DB("").C(opts.Collection).DropCollection()
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func read(ctx context.Context, collection string, key int) error {
+	err := mgodb.ExecuteContext(ctx, func(sess *mgo.Session) error {
+		doc := benchDoc{}
+		return sess.DB("").C(collection).FindId(key).One(&doc)
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func write(ctx context.Context, collection string, key int, payload []byte) error {
+	return mgodb.ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).UpsertId(key, bson.M{"$set": bson.M{
+			"payload": payload,
+			"updated": time.Now().UTC(),
+		}})
+		return err
+	})
+}
@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsWithDefaults(t *testing.T) {
+	opts := Options{}.withDefaults()
+	assert.Equal(t, DefaultCollection, opts.Collection)
+	assert.Equal(t, 10, opts.Concurrency)
+	assert.Equal(t, 0.8, opts.ReadRatio)
+
+	opts = Options{WriteOnly: true, ReadRatio: 0.5}.withDefaults()
+	assert.Equal(t, 0.0, opts.ReadRatio)
+	opts = Options{ReadRatio: 2}.withDefaults()
+	assert.Equal(t, 1.0, opts.ReadRatio)
+}
+
+func TestRecorderStats(t *testing.T) {
+	r := &recorder{}
+	for i := 100; i >= 1; i-- {
+		r.add(time.Duration(i)*time.Millisecond, nil)
+	}
+	r.add(time.Second, errors.New("timeout"))
+
+	stats := r.stats()
+	assert.Equal(t, int64(101), stats.Count)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, 51*time.Millisecond, stats.P50)
+	assert.Equal(t, 96*time.Millisecond, stats.P95)
+	assert.Equal(t, time.Second, stats.Max)
+	assert.Equal(t, Stats{}, (&recorder{}).stats())
+}
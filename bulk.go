@@ -0,0 +1,286 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// kinds of bulk operations
+const (
+	BulkInsert = "insert"
+	BulkUpdate = "update"
+	BulkUpsert = "upsert"
+	BulkRemove = "remove"
+)
+
+// BulkOpError is the error of one operation of a bulk write,
+// Index is its position in the order operations were added
+type BulkOpError struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	Err   error  `json:"-"`
+}
+
+// BulkResult reports a bulk write. the counters by kind count the operations which
+// did not fail, Matched and Modified are only reported by the server when none failed
+type BulkResult struct {
+	Inserted int           `json:"inserted"`
+	Updated  int           `json:"updated"`
+	Upserted int           `json:"upserted"`
+	Removed  int           `json:"removed"`
+	Matched  int           `json:"matched"`
+	Modified int           `json:"modified"`
+	Errors   []BulkOpError `json:"errors"`
+}
+
+type bulkOp struct {
+	kind     string
+	all      bool
+	selector interface{}
+	doc      interface{}
+}
+
+// BulkWriter collects mixed write operations on the collection of one model and submits
+// them as a single bulk write. operations are prepared as their single record
+// counterparts (defaults, hooks, timestamps, policy, immutable fields, transformers),
+// the first preparation error is returned by Run
+type BulkWriter struct {
+	db        *Database
+	ctx       context.Context
+	model     interface{}
+	unordered bool
+	ops       []bulkOp
+	err       error
+}
+
+// Bulk returns a bulk writer for the collection of model, ordered by default:
+// the first failing operation stops the remaining ones
+// for example:
+// result, err := Bulk(&Car{}).
+// Insert(car).
+// Update(bson.M{"carId": 1}, bson.M{"$set": bson.M{"price": 100}}).
+// Remove(bson.M{"carId": 2}).
+// Unordered().
+// Run()
+func (db *Database) Bulk(model interface{}) *BulkWriter {
+	return db.BulkContext(context.Background(), model)
+}
+
+// BulkContext is like Bulk, ctx bounds the wait for a session and the operation
+func (db *Database) BulkContext(ctx context.Context, model interface{}) *BulkWriter {
+	b := &BulkWriter{db: db, ctx: ctx, model: model}
+	if err := validateModel(model); err != nil {
+		b.err = err
+	} else {
+		b.err = db.checkWritable(model)
+	}
+	return b
+}
+
+func Bulk(model interface{}) *BulkWriter {
+	return _db.Bulk(model)
+}
+
+func BulkContext(ctx context.Context, model interface{}) *BulkWriter {
+	return _db.BulkContext(ctx, model)
+}
+
+// Unordered lets the server run every operation, failing or not, in any order
+func (b *BulkWriter) Unordered() *BulkWriter {
+	b.unordered = true
+	return b
+}
+
+// Insert adds the insert of docs, models of the bulk type
+func (b *BulkWriter) Insert(docs ...interface{}) *BulkWriter {
+	for _, doc := range docs {
+		if b.err == nil {
+			b.err = b.db.prepareInsert(b.ctx, doc)
+		}
+		b.ops = append(b.ops, bulkOp{kind: BulkInsert, doc: doc})
+	}
+	return b
+}
+
+// Update adds the update of the first record matching selector
+func (b *BulkWriter) Update(selector interface{}, update interface{}) *BulkWriter {
+	return b.update(BulkUpdate, false, selector, update)
+}
+
+// UpdateAll adds the update of every record matching selector
+func (b *BulkWriter) UpdateAll(selector interface{}, update interface{}) *BulkWriter {
+	return b.update(BulkUpdate, true, selector, update)
+}
+
+// Upsert adds the update of the record matching selector, inserted when missing
+func (b *BulkWriter) Upsert(selector interface{}, update interface{}) *BulkWriter {
+	return b.update(BulkUpsert, false, selector, update)
+}
+
+func (b *BulkWriter) update(kind string, all bool, selector interface{}, update interface{}) *BulkWriter {
+	if b.err == nil {
+		action := ActionUpdate
+		if kind == BulkUpsert {
+			action = ActionUpsert
+		}
+		b.err = b.db.applyPolicy(b.ctx, b.model, action, &selector)
+	}
+	if b.err == nil {
+		update, b.err = b.db.guardImmutable(b.model, update)
+	}
+	if b.err == nil {
+		update, b.err = b.db.transformUpdate(b.model, update)
+	}
+	if b.err == nil {
+		b.err = beforeUpdate(b.model, selector, update)
+	}
+	b.ops = append(b.ops, bulkOp{kind: kind, all: all, selector: selector, doc: update})
+	return b
+}
+
+// Remove adds the removal of the first record matching selector
+func (b *BulkWriter) Remove(selector interface{}) *BulkWriter {
+	return b.remove(false, selector)
+}
+
+// RemoveAll adds the removal of every record matching selector
+func (b *BulkWriter) RemoveAll(selector interface{}) *BulkWriter {
+	return b.remove(true, selector)
+}
+
+func (b *BulkWriter) remove(all bool, selector interface{}) *BulkWriter {
+	if b.err == nil {
+		b.err = b.db.applyPolicy(b.ctx, b.model, ActionRemove, &selector)
+	}
+	b.ops = append(b.ops, bulkOp{kind: BulkRemove, all: all, selector: selector})
+	return b
+}
+
+// Run submits the operations. on failure the error is returned along with a result
+// whose Errors locate the failed operations
+func (b *BulkWriter) Run() (*BulkResult, error) {
+	result := &BulkResult{}
+	if b.err != nil {
+		b.db.logWith(Fields{
+			"model": b.model,
+			"err":   b.err,
+		}).Error("bulk db error: prepare operation fail")
+		return result, b.err
+	}
+	if len(b.ops) == 0 {
+		return result, nil
+	}
+
+	collection := GetCollectionName(b.model)
+	var info *mgo.BulkResult
+	start := time.Now()
+	err := b.db.executeWrite(b.ctx, collection, func(sess *mgo.Session) error {
+		bulk := sess.DB("").C(collection).Bulk()
+		if b.unordered {
+			bulk.Unordered()
+		}
+		for _, op := range b.ops {
+			switch {
+			case op.kind == BulkInsert:
+				bulk.Insert(op.doc)
+			case op.kind == BulkUpsert:
+				bulk.Upsert(op.selector, op.doc)
+			case op.kind == BulkUpdate && op.all:
+				bulk.UpdateAll(op.selector, op.doc)
+			case op.kind == BulkUpdate:
+				bulk.Update(op.selector, op.doc)
+			case op.kind == BulkRemove && op.all:
+				bulk.RemoveAll(op.selector)
+			default:
+				bulk.Remove(op.selector)
+			}
+		}
+		var err error
+		info, err = bulk.Run()
+		return err
+	})
+	b.db.observe(b.ctx, "bulk", collection, nil, start, err)
+
+	if info != nil {
+		result.Matched, result.Modified = info.Matched, info.Modified
+	}
+	b.count(result, err)
+	if err != nil {
+		b.db.logWith(Fields{
+			"collection": collection,
+			"ops":        len(b.ops),
+			"err":        err,
+		}).Error("bulk db error: database operate fail")
+		return result, err
+	}
+	return result, nil
+}
+
+// count fills the counters and errors of result from the error of the bulk write
+func (b *BulkWriter) count(result *BulkResult, err error) {
+	failed := make(map[int]bool)
+	// without positions nothing is known to have succeeded
+	stop := len(b.ops)
+	if err != nil {
+		bulkErr, ok := err.(*mgo.BulkError)
+		if !ok {
+			stop = 0
+		} else {
+			for _, c := range bulkErr.Cases() {
+				if c.Index < 0 || c.Index >= len(b.ops) {
+					stop = 0
+					continue
+				}
+				failed[c.Index] = true
+				result.Errors = append(result.Errors, BulkOpError{Index: c.Index, Op: b.ops[c.Index].kind, Err: c.Err})
+				// ordered writes stop at the first failure
+				if !b.unordered && c.Index < stop {
+					stop = c.Index
+				}
+			}
+		}
+	}
+
+	for i := 0; i < stop; i++ {
+		if failed[i] {
+			continue
+		}
+		switch b.ops[i].kind {
+		case BulkInsert:
+			result.Inserted++
+		case BulkUpdate:
+			result.Updated++
+		case BulkUpsert:
+			result.Upserted++
+		case BulkRemove:
+			result.Removed++
+		}
+	}
+}
+
+// prepareInsert applies to a model what Insert does before writing it
+func (db *Database) prepareInsert(ctx context.Context, model interface{}) error {
+	if err := validateModel(model); err != nil {
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionInsert, nil); err != nil {
+		return err
+	}
+	if _, err := db.applyDefaults(ctx, model); err != nil {
+		return err
+	}
+	if err := beforeInsert(model); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if field := reflect.ValueOf(model).Elem().FieldByName("Updated"); field.CanSet() {
+		field.Set(reflect.ValueOf(now))
+	}
+	if field := reflect.ValueOf(model).Elem().FieldByName("Created"); field.CanSet() {
+		field.Set(reflect.ValueOf(now))
+	}
+	return db.beforeWrite(GetCollectionName(model), model)
+}
@@ -0,0 +1,41 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestBulkCount(t *testing.T) {
+	b := (&Database{}).Bulk(&fieldsInner{}).
+		Insert(&fieldsInner{CarId: 1}, &fieldsInner{CarId: 2}).
+		Update(bson.M{"carId": 1}, bson.M{"$set": bson.M{"carId": 3}}).
+		Upsert(bson.M{"carId": 4}, bson.M{"$set": bson.M{"carId": 4}}).
+		RemoveAll(bson.M{"carId": 2})
+	assert.Nil(t, b.err)
+	assert.Equal(t, 5, len(b.ops))
+
+	result := &BulkResult{}
+	b.count(result, nil)
+	assert.Equal(t, &BulkResult{Inserted: 2, Updated: 1, Upserted: 1, Removed: 1}, result)
+
+	// no positions, nothing is known to have succeeded
+	result = &BulkResult{}
+	b.count(result, errors.New("network"))
+	assert.Equal(t, &BulkResult{}, result)
+}
+
+func TestBulkPrepare(t *testing.T) {
+	db := &Database{}
+	_, err := db.Bulk(fieldsInner{}).Insert(&fieldsInner{}).Run()
+	assert.Equal(t, ErrModelNotPtr, err)
+
+	_, err = db.Bulk(&immutableModel{}).Update(bson.M{}, bson.M{"$set": bson.M{"carId": 1}}).Run()
+	assert.IsType(t, &ImmutableFieldError{}, err)
+
+	result, err := db.Bulk(&fieldsInner{}).Run()
+	assert.Nil(t, err)
+	assert.Equal(t, &BulkResult{}, result)
+}
@@ -0,0 +1,112 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// entries kept per cache, beyond it the expired ones are dropped, then all of them
+const cachedSize = 10000
+
+type cachedEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Cache keeps the results of a read function, see Cached
+type Cache[A any, V any] struct {
+	sync.Mutex
+	load       func(ctx context.Context, args A) (V, error)
+	ttl        time.Duration
+	keyFn      func(A) string
+	generation uint64
+	entries    map[string]cachedEntry[V]
+	flights    flightGroup[V]
+}
+
+// Cached wraps load, typically a repository read running Find or Aggregate, with a cache
+// of its results for ttl, keyed by keyFn of its arguments (cacheKey when nil).
+// when a key is missing or expired, one call runs load and the concurrent calls of
+// the key wait for its result instead of reaching the database too, errors are not cached.
+// every call site makes its own cache with its own ttl.
+// cached values are shared, callers must not modify them
+// for example:
+// topCars := Cached(func(ctx context.Context, city string) ([]CarOwner, error) {
+// rows := []CarOwner{}
+// return rows, AggregateContext(ctx, &rows, topCarsPipeline(city))
+// }, time.Minute, nil)
+// rows, err := topCars.Get(ctx, "paris")
+func Cached[A any, V any](load func(ctx context.Context, args A) (V, error), ttl time.Duration, keyFn func(A) string) *Cache[A, V] {
+	return &Cache[A, V]{
+		load:    load,
+		ttl:     ttl,
+		keyFn:   keyFn,
+		entries: make(map[string]cachedEntry[V]),
+	}
+}
+
+// Get returns the cached result of args, loading it when missing or expired.
+// the load in flight runs with the ctx of the caller which started it
+func (c *Cache[A, V]) Get(ctx context.Context, args A) (V, error) {
+	key := c.key(args)
+	c.Lock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	return c.flights.do(key, func() (V, error) {
+		value, err := c.load(ctx, args)
+		if err == nil {
+			c.store(key, value, generation)
+		}
+		return value, err
+	})
+}
+
+// Invalidate drops the cached result of args, after a write which changed it
+func (c *Cache[A, V]) Invalidate(args A) {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	delete(c.entries, c.key(args))
+}
+
+// Purge drops every cached result
+func (c *Cache[A, V]) Purge() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.entries = make(map[string]cachedEntry[V])
+}
+
+// store caches value, unless an invalidation happened since generation
+func (c *Cache[A, V]) store(key string, value V, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.generation != generation {
+		return
+	}
+	now := time.Now()
+	if len(c.entries) >= cachedSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= cachedSize {
+			c.entries = make(map[string]cachedEntry[V])
+		}
+	}
+	c.entries[key] = cachedEntry[V]{value: value, expires: now.Add(c.ttl)}
+}
+
+func (c *Cache[A, V]) key(args A) string {
+	if c.keyFn != nil {
+		return c.keyFn(args)
+	}
+	return cacheKey(args)
+}
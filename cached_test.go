@@ -0,0 +1,72 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCached(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	cache := Cached(func(ctx context.Context, carId int64) ([]fieldsInner, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []fieldsInner{{CarId: carId}}, nil
+	}, time.Hour, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows, err := cache.Get(context.Background(), 7)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(7), rows[0].CarId)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, err := cache.Get(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	cache.Invalidate(7)
+	_, err = cache.Get(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCachedExpiry(t *testing.T) {
+	var calls int32
+	fail := errors.New("boom")
+	cache := Cached(func(ctx context.Context, key string) (int32, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if key == "fail" {
+			return 0, fail
+		}
+		return n, nil
+	}, 10*time.Millisecond, func(key string) string { return key })
+
+	n, _ := cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(1), n)
+	n, _ = cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(1), n)
+	time.Sleep(20 * time.Millisecond)
+	n, _ = cache.Get(context.Background(), "a")
+	assert.Equal(t, int32(2), n)
+
+	_, err := cache.Get(context.Background(), "fail")
+	assert.Equal(t, fail, err)
+	_, err = cache.Get(context.Background(), "fail")
+	assert.Equal(t, fail, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
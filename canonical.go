@@ -0,0 +1,76 @@
+package mgodb
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// canonical returns doc with its maps, embedded ones included, turned into
+// documents of sorted keys: mgo encodes maps in random order
+func canonical(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case bson.M:
+		return sortedDoc(v)
+	case map[string]interface{}:
+		return sortedDoc(v)
+	case bson.D:
+		d := make(bson.D, len(v))
+		for i, elem := range v {
+			d[i] = bson.DocElem{Name: elem.Name, Value: canonical(elem.Value)}
+		}
+		return d
+	case []bson.M:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = sortedDoc(item)
+		}
+		return items
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = canonical(item)
+		}
+		return items
+	}
+	return doc
+}
+
+func sortedDoc(m map[string]interface{}) bson.D {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	d := make(bson.D, len(keys))
+	for i, key := range keys {
+		d[i] = bson.DocElem{Name: key, Value: canonical(m[key])}
+	}
+	return d
+}
+
+// queryKey returns the md5 of the canonical encoding of query,
+// equal for equal queries whatever the order of their keys
+func queryKey(query interface{}) (string, error) {
+	data, err := bson.Marshal(bson.D{{Name: "q", Value: canonical(query)}})
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheKey keys the caches of queries and arguments, documents by queryKey and
+// other values, which bson may not encode whole, by their fmt output
+func cacheKey(value interface{}) string {
+	switch value.(type) {
+	case bson.M, map[string]interface{}, bson.D, []bson.M, []interface{}:
+		if key, err := queryKey(value); err == nil {
+			return key
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,48 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestQueryKey(t *testing.T) {
+	query := bson.M{"a": 1, "b": bson.M{"c": 2, "d": []interface{}{bson.M{"e": 3, "f": 4}}}, "g": 5, "h": 6}
+	key, err := queryKey(query)
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		same := bson.M{"h": 6, "g": 5, "b": bson.M{"d": []interface{}{map[string]interface{}{"f": 4, "e": 3}}, "c": 2}, "a": 1}
+		other, err := queryKey(same)
+		assert.Nil(t, err)
+		assert.Equal(t, key, other)
+	}
+
+	other, err := queryKey(bson.M{"a": 2})
+	assert.Nil(t, err)
+	assert.NotEqual(t, key, other)
+
+	_, err = queryKey(func() {})
+	assert.NotNil(t, err)
+}
+
+func TestCacheKey(t *testing.T) {
+	assert.Equal(t, cacheKey(bson.M{"a": 1, "b": bson.M{"c": 2, "d": 3}}), cacheKey(bson.M{"b": bson.M{"d": 3, "c": 2}, "a": 1}))
+	assert.NotEqual(t, cacheKey(bson.M{"a": 1}), cacheKey(bson.M{"a": 2}))
+	// bson skips unexported fields, fmt does not
+	type args struct{ city string }
+	assert.NotEqual(t, cacheKey(args{"paris"}), cacheKey(args{"rome"}))
+	assert.Equal(t, "paris", cacheKey("paris"))
+}
+
+func TestBackfillName(t *testing.T) {
+	name, err := backfillName("car", "", bson.M{"price": 0, "name": "x"})
+	assert.Nil(t, err)
+	other, err := backfillName("car", "", bson.M{"name": "x", "price": 0})
+	assert.Nil(t, err)
+	assert.Equal(t, name, other)
+
+	name, err = backfillName("car", "fix-price", bson.M{"price": 0})
+	assert.Nil(t, err)
+	assert.Equal(t, "backfill:car:fix-price", name)
+}
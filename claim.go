@@ -0,0 +1,128 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// fields of a claimed record
+const (
+	ClaimOwnerField   = "claimedBy"
+	ClaimExpiresField = "claimExpires"
+)
+
+var (
+	ErrInvalidClaim = errors.New("claim requires an owner, a positive count and a positive ttl")
+)
+
+// claimable matches the records of query nobody claimed, or whose claim expired
+func claimable(query interface{}, now time.Time) bson.M {
+	free := bson.M{"$or": []bson.M{
+		{ClaimExpiresField: bson.M{"$exists": false}},
+		{ClaimExpiresField: bson.M{"$lt": now}},
+	}}
+	if m, ok := query.(bson.M); query == nil || ok && len(m) == 0 {
+		return free
+	}
+	return bson.M{"$and": []interface{}{query, free}}
+}
+
+// Claim marks up to n records matching query as claimed by owner until ttl expires,
+// each one atomically by findAndModify, and loads them into results.
+// a record whose claim expired can be claimed again, so owner must finish its
+// work, or renew the claim, within ttl.
+// returns the number of claimed records
+// for example:
+// jobs := []*Job{}
+// n, err := Claim(&jobs, &Job{}, bson.M{"status": "ready"}, 10, workerId, time.Minute)
+func Claim(results interface{}, model interface{}, query bson.M, n int, owner string, ttl time.Duration) (int, error) {
+	if err := validateSlice(results); err != nil {
+		logWith(Fields{
+			"results": results,
+			"err":     err,
+		}).Error("claim db error: validate model fail")
+		return 0, err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("claim db error: model is read-only")
+		return 0, err
+	}
+	if owner == "" || n <= 0 || ttl <= 0 {
+		return 0, ErrInvalidClaim
+	}
+	var selector interface{} = query
+	if err := _db.applyPolicy(context.Background(), model, ActionUpdate, &selector); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("claim db error: policy denied")
+		return 0, err
+	}
+
+	slice := reflect.ValueOf(results).Elem()
+	elemType := slice.Type().Elem()
+	itemType := elemType
+	if itemType.Kind() == reflect.Ptr {
+		itemType = itemType.Elem()
+	}
+	collection := GetCollectionName(model)
+	start := time.Now()
+	claimed := 0
+	err := _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+		c := sess.DB("").C(collection)
+		for claimed < n {
+			now := time.Now().UTC()
+			change := mgo.Change{
+				Update:    bson.M{"$set": bson.M{ClaimOwnerField: owner, ClaimExpiresField: now.Add(ttl)}},
+				ReturnNew: true,
+			}
+			item := reflect.New(itemType)
+			if _, err := c.Find(claimable(selector, now)).Apply(change, item.Interface()); err != nil {
+				if err == mgo.ErrNotFound {
+					return nil
+				}
+				return err
+			}
+			if elemType.Kind() == reflect.Ptr {
+				slice.Set(reflect.Append(slice, item))
+			} else {
+				slice.Set(reflect.Append(slice, item.Elem()))
+			}
+			claimed++
+		}
+		return nil
+	})
+	_db.observe(context.Background(), "claim", collection, query, start, err)
+	if err != nil {
+		logWith(Fields{
+			"model":      model,
+			"query":      query,
+			"owner":      owner,
+			"collection": collection,
+			"err":        err,
+		}).Error("claim db error: database operate fail")
+	}
+	if claimed > 0 {
+		_db.afterDecode(results)
+	}
+	return claimed, err
+}
+
+// ReleaseClaims releases the claims of owner on the records matching selector,
+// returns the number of released records
+func ReleaseClaims(model interface{}, selector bson.M, owner string) (int, error) {
+	query := bson.M{}
+	for key, value := range selector {
+		query[key] = value
+	}
+	query[ClaimOwnerField] = owner
+	return UpdateAll(model, query, bson.M{"$unset": bson.M{ClaimOwnerField: "", ClaimExpiresField: ""}})
+}
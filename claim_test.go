@@ -0,0 +1,23 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestClaimable(t *testing.T) {
+	now := time.Now()
+	free := bson.M{"$or": []bson.M{
+		{ClaimExpiresField: bson.M{"$exists": false}},
+		{ClaimExpiresField: bson.M{"$lt": now}},
+	}}
+	assert.Equal(t, free, claimable(nil, now))
+	assert.Equal(t, free, claimable(bson.M{}, now))
+	assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"status": "ready"}, free}}, claimable(bson.M{"status": "ready"}, now))
+	// the $and and $or of the caller are kept
+	and := bson.M{"$and": []interface{}{bson.M{"a": 1}}, "$or": []bson.M{{"b": 1}}}
+	assert.Equal(t, bson.M{"$and": []interface{}{and, free}}, claimable(and, now))
+}
@@ -0,0 +1,100 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type coalescing struct {
+	sync.RWMutex
+	collections map[string]bool
+	flights     flightGroup[bson.Raw]
+}
+
+// EnableCoalescing turns request coalescing for the collection of model on or off:
+// concurrent FindOne calls with the same query share one round trip, every caller
+// decoding the shared document, which protects hot keys during traffic spikes
+// for example:
+// EnableCoalescing(&Car{}, true)
+func (db *Database) EnableCoalescing(model interface{}, enabled bool) {
+	collection := GetCollectionName(model)
+	db.coalescing.Lock()
+	defer db.coalescing.Unlock()
+	if !enabled {
+		delete(db.coalescing.collections, collection)
+		return
+	}
+	if db.coalescing.collections == nil {
+		db.coalescing.collections = make(map[string]bool)
+	}
+	db.coalescing.collections[collection] = true
+}
+
+func EnableCoalescing(model interface{}, enabled bool) {
+	_db.EnableCoalescing(model, enabled)
+}
+
+// readCoalesced runs the single document read f into model, shared with the
+// identical reads in flight when the collection enabled coalescing.
+// the read in flight runs with the ctx of the caller which started it
+func (db *Database) readCoalesced(ctx context.Context, collection string, query interface{}, model interface{}, f func(sess *mgo.Session, result interface{}) error) error {
+	db.coalescing.RLock()
+	enabled := db.coalescing.collections[collection]
+	db.coalescing.RUnlock()
+	// a pinned read must not share the read of another request
+	if !enabled || db.Pinned(ctx) {
+		return db.readHedged(ctx, collection, model, f)
+	}
+
+	key := collection + " " + cacheKey(query)
+	raw, err := db.coalescing.flights.do(key, func() (bson.Raw, error) {
+		raw := bson.Raw{}
+		err := db.readHedged(ctx, collection, &raw, f)
+		return raw, err
+	})
+	if err != nil {
+		return err
+	}
+	return raw.Unmarshal(model)
+}
+
+// a call in flight and its result
+type flight[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+// flightGroup runs one call per key at a time, callers of a key in flight wait for its result
+type flightGroup[V any] struct {
+	sync.Mutex
+	calls map[string]*flight[V]
+}
+
+func (g *flightGroup[V]) do(key string, fn func() (V, error)) (V, error) {
+	g.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &flight[V]{}
+	call.wg.Add(1)
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[V])
+	}
+	g.calls[key] = call
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		delete(g.calls, key)
+		g.Unlock()
+		call.wg.Done()
+	}()
+	call.value, call.err = fn()
+	return call.value, call.err
+}
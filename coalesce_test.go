@@ -0,0 +1,56 @@
+package mgodb
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestEnableCoalescing(t *testing.T) {
+	db := new(Database)
+	db.EnableCoalescing(&fieldsInner{}, true)
+	assert.True(t, db.coalescing.collections["fields_inner"])
+	db.EnableCoalescing(&fieldsInner{}, false)
+	assert.False(t, db.coalescing.collections["fields_inner"])
+}
+
+func TestFlightGroup(t *testing.T) {
+	g := &flightGroup[bson.Raw]{}
+	doc, _ := bson.Marshal(bson.M{"carId": 1})
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (bson.Raw, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return bson.Raw{Kind: 3, Data: doc}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]fieldsInner, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			raw, err := g.do("key", fn)
+			assert.NoError(t, err)
+			assert.NoError(t, raw.Unmarshal(&results[i]))
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	for _, result := range results {
+		assert.Equal(t, int64(1), result.CarId)
+	}
+	assert.Empty(t, g.calls)
+
+	// the next call runs again
+	g.do("key", fn)
+	assert.Equal(t, int32(2), calls)
+}
@@ -0,0 +1,259 @@
+package mgodb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid database config")
+)
+
+// database config read by InitFromEnv and InitFromFile,
+// durations are strings like "30s" in files and env vars
+type Config struct {
+	// mongodb connection string, required
+	URI string `json:"uri" yaml:"uri"`
+	// sessions in the pool, the concurrent of Init, default 128
+	PoolSize int `json:"poolSize" yaml:"poolSize"`
+	// socket timeout, default 30s
+	Timeout string `json:"timeout" yaml:"timeout"`
+	// dial timeout, default 10s
+	DialTimeout string `json:"dialTimeout" yaml:"dialTimeout"`
+	// read mode: primary, primaryPreferred, secondary, secondaryPreferred, nearest,
+	// eventual or monotonic, default eventual
+	ReadMode string `json:"readMode" yaml:"readMode"`
+	// write concern: a number of members or a tag like "majority", default the server one
+	WriteConcern string `json:"writeConcern" yaml:"writeConcern"`
+	Journal      bool   `json:"journal" yaml:"journal"`
+	// write concern timeout
+	WriteTimeout string    `json:"writeTimeout" yaml:"writeTimeout"`
+	TLS          TLSConfig `json:"tls" yaml:"tls"`
+}
+
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled" yaml:"enabled"`
+	CAFile             string `json:"caFile" yaml:"caFile"`
+	CertFile           string `json:"certFile" yaml:"certFile"`
+	KeyFile            string `json:"keyFile" yaml:"keyFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+var readModes = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primarypreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondarypreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+	"eventual":           mgo.Eventual,
+	"monotonic":          mgo.Monotonic,
+	"strong":             mgo.Strong,
+}
+
+// ConfigFromEnv reads the config from the env vars:
+// MGODB_URI, MGODB_POOL_SIZE, MGODB_TIMEOUT, MGODB_DIAL_TIMEOUT, MGODB_READ_MODE,
+// MGODB_WRITE_CONCERN, MGODB_JOURNAL, MGODB_WRITE_TIMEOUT, MGODB_TLS,
+// MGODB_TLS_CA_FILE, MGODB_TLS_CERT_FILE, MGODB_TLS_KEY_FILE and MGODB_TLS_INSECURE
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		URI:          os.Getenv("MGODB_URI"),
+		Timeout:      os.Getenv("MGODB_TIMEOUT"),
+		DialTimeout:  os.Getenv("MGODB_DIAL_TIMEOUT"),
+		ReadMode:     os.Getenv("MGODB_READ_MODE"),
+		WriteConcern: os.Getenv("MGODB_WRITE_CONCERN"),
+		WriteTimeout: os.Getenv("MGODB_WRITE_TIMEOUT"),
+		TLS: TLSConfig{
+			CAFile:   os.Getenv("MGODB_TLS_CA_FILE"),
+			CertFile: os.Getenv("MGODB_TLS_CERT_FILE"),
+			KeyFile:  os.Getenv("MGODB_TLS_KEY_FILE"),
+		},
+	}
+
+	var err error
+	if env := os.Getenv("MGODB_POOL_SIZE"); env != "" {
+		if cfg.PoolSize, err = strconv.Atoi(env); err != nil {
+			return cfg, fmt.Errorf("%w: MGODB_POOL_SIZE %q", ErrInvalidConfig, env)
+		}
+	}
+	bools := map[string]*bool{
+		"MGODB_JOURNAL":      &cfg.Journal,
+		"MGODB_TLS":          &cfg.TLS.Enabled,
+		"MGODB_TLS_INSECURE": &cfg.TLS.InsecureSkipVerify,
+	}
+	for name, value := range bools {
+		if env := os.Getenv(name); env != "" {
+			if *value, err = strconv.ParseBool(env); err != nil {
+				return cfg, fmt.Errorf("%w: %s %q", ErrInvalidConfig, name, env)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// ConfigFromFile reads the config from a json, or yaml (.yaml, .yml) file
+func ConfigFromFile(path string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return cfg, nil
+}
+
+// InitFromEnv initializes the database from the env vars, see ConfigFromEnv
+// for example:
+// MGODB_URI=mongodb://127.0.0.1:27017/test MGODB_POOL_SIZE=64 ./server
+func (db *Database) InitFromEnv() error {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	return db.InitConfig(cfg)
+}
+
+// InitFromFile initializes the database from a config file, see ConfigFromFile
+// for example:
+// InitFromFile("conf/mongodb.yaml")
+func (db *Database) InitFromFile(path string) error {
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		return err
+	}
+	return db.InitConfig(cfg)
+}
+
+// InitConfig initializes the database from cfg, unlike Init it returns
+// the connection error instead of exiting
+func (db *Database) InitConfig(cfg Config) error {
+	if cfg.URI == "" {
+		return fmt.Errorf("%w: uri is required", ErrInvalidConfig)
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 128
+	}
+	timeout, err := parseConfigDuration("timeout", cfg.Timeout, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	dialTimeout, err := parseConfigDuration("dialTimeout", cfg.DialTimeout, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	writeTimeout, err := parseConfigDuration("writeTimeout", cfg.WriteTimeout, 0)
+	if err != nil {
+		return err
+	}
+	mode, ok := mgo.Eventual, true
+	if cfg.ReadMode != "" {
+		if mode, ok = readModes[strings.ToLower(cfg.ReadMode)]; !ok {
+			return fmt.Errorf("%w: readMode %q", ErrInvalidConfig, cfg.ReadMode)
+		}
+	}
+
+	info, err := mgo.ParseURL(cfg.URI)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	info.Timeout = dialTimeout
+	if cfg.TLS.Enabled {
+		tlsConfig, err := cfg.TLS.config()
+		if err != nil {
+			return err
+		}
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+	}
+
+	sess, err := mgo.DialWithInfo(info)
+	if err != nil {
+		db.logWith(Fields{
+			"addr": redactURI(cfg.URI),
+			"err":  err,
+		}).Error("mongodb: cannot connect")
+		return err
+	}
+
+	sess.SetMode(mode, true)
+	if cfg.WriteConcern != "" || cfg.Journal || writeTimeout > 0 {
+		safe := &mgo.Safe{J: cfg.Journal, WTimeout: int(writeTimeout / time.Millisecond)}
+		if w, err := strconv.Atoi(cfg.WriteConcern); err == nil {
+			safe.W = w
+		} else {
+			safe.WMode = cfg.WriteConcern
+		}
+		sess.SetSafe(safe)
+	}
+
+	db.latch = make(chan *mgo.Session, cfg.PoolSize)
+	db.setup(sess, cfg.URI, timeout)
+	return nil
+}
+
+func (c TLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificate in %s", ErrInvalidConfig, c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func parseConfigDuration(name string, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q", ErrInvalidConfig, name, value)
+	}
+	return d, nil
+}
+
+func InitFromEnv() error {
+	return _db.InitFromEnv()
+}
+
+func InitFromFile(path string) error {
+	return _db.InitFromFile(path)
+}
+
+func InitConfig(cfg Config) error {
+	return _db.InitConfig(cfg)
+}
@@ -0,0 +1,54 @@
+package mgodb
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "mongodb.yaml")
+	ioutil.WriteFile(yamlPath, []byte("uri: mongodb://127.0.0.1/test\npoolSize: 64\ntimeout: 5s\ntls:\n  enabled: true\n"), 0644)
+	cfg, err := ConfigFromFile(yamlPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "mongodb://127.0.0.1/test", cfg.URI)
+	assert.Equal(t, 64, cfg.PoolSize)
+	assert.Equal(t, "5s", cfg.Timeout)
+	assert.True(t, cfg.TLS.Enabled)
+
+	jsonPath := filepath.Join(dir, "mongodb.json")
+	ioutil.WriteFile(jsonPath, []byte(`{"uri": "mongodb://127.0.0.1/test", "writeConcern": "majority"}`), 0644)
+	cfg, err = ConfigFromFile(jsonPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "majority", cfg.WriteConcern)
+
+	ioutil.WriteFile(jsonPath, []byte(`{`), 0644)
+	_, err = ConfigFromFile(jsonPath)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("MGODB_URI", "mongodb://127.0.0.1/test")
+	t.Setenv("MGODB_POOL_SIZE", "32")
+	t.Setenv("MGODB_JOURNAL", "true")
+	cfg, err := ConfigFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, "mongodb://127.0.0.1/test", cfg.URI)
+	assert.Equal(t, 32, cfg.PoolSize)
+	assert.True(t, cfg.Journal)
+
+	t.Setenv("MGODB_POOL_SIZE", "many")
+	_, err = ConfigFromEnv()
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestInitConfigInvalid(t *testing.T) {
+	db := new(Database)
+	assert.True(t, errors.Is(db.InitConfig(Config{}), ErrInvalidConfig))
+	assert.True(t, errors.Is(db.InitConfig(Config{URI: "mongodb://127.0.0.1/test", Timeout: "soon"}), ErrInvalidConfig))
+	assert.True(t, errors.Is(db.InitConfig(Config{URI: "mongodb://127.0.0.1/test", ReadMode: "fastest"}), ErrInvalidConfig))
+}
@@ -0,0 +1,148 @@
+package mgodb
+
+import (
+	"errors"
+	"math"
+	"reflect"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidRule = errors.New("consistency rule requires Model, Field and Ref")
+)
+
+// referential rule: every Field value of Model records matching Query
+// must exist as RefField (defaults to Field) of a Ref record
+// for example, every carOwner.carId must exist in car:
+// ConsistencyRule{Name: "carOwner.carId", Model: &CarOwner{}, Field: "carId", Ref: &Car{}}
+type ConsistencyRule struct {
+	Name     string
+	Model    interface{}
+	Field    string
+	Ref      interface{}
+	RefField string
+	Query    interface{}
+}
+
+// a record breaking a consistency rule
+type Violation struct {
+	Rule       string      `json:"rule"`
+	Collection string      `json:"collection"`
+	Id         interface{} `json:"id"`
+	Value      interface{} `json:"value"`
+}
+
+// check the rules batch by batch and pass every violation to fn as soon as it is found,
+// returns the number of violations
+// for example:
+// n, err := CheckConsistency(rules, 1000, func(v Violation) {...})
+func CheckConsistency(rules []ConsistencyRule, batchSize int, fn func(Violation)) (int, error) {
+	if batchSize <= 0 {
+		return 0, ErrBatchSize
+	}
+
+	total := 0
+	for _, rule := range rules {
+		n, err := checkRule(rule, batchSize, fn)
+		total += n
+		if err != nil {
+			logWith(Fields{
+				"rule": rule.Name,
+				"err":  err,
+			}).Error("check consistency error: database operate fail")
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func checkRule(rule ConsistencyRule, batchSize int, fn func(Violation)) (int, error) {
+	if rule.Model == nil || rule.Ref == nil || rule.Field == "" {
+		return 0, ErrInvalidRule
+	}
+	refField := rule.RefField
+	if refField == "" {
+		refField = rule.Field
+	}
+	query := rule.Query
+	if query == nil {
+		query = bson.M{}
+	}
+
+	collection := GetCollectionName(rule.Model)
+	refCollection := GetCollectionName(rule.Ref)
+	count := 0
+	var lastId interface{}
+	for {
+		selector := query
+		if lastId != nil {
+			selector = bson.M{"$and": []interface{}{query, bson.M{"_id": bson.M{"$gt": lastId}}}}
+		}
+
+		var docs []bson.M
+		err := ExecuteIdempotent(func(sess *mgo.Session) error {
+			return sess.DB("").C(collection).Find(selector).Select(bson.M{"_id": 1, rule.Field: 1}).
+				Sort("_id").Limit(batchSize).All(&docs)
+		})
+		if err != nil || len(docs) == 0 {
+			return count, err
+		}
+		lastId = docs[len(docs)-1]["_id"]
+
+		values := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			if value := lookupPath(doc, rule.Field); isComparable(value) {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		var found []interface{}
+		err = ExecuteIdempotent(func(sess *mgo.Session) error {
+			return sess.DB("").C(refCollection).Find(bson.M{refField: bson.M{"$in": values}}).Distinct(refField, &found)
+		})
+		if err != nil {
+			return count, err
+		}
+		exists := make(map[interface{}]bool, len(found))
+		for _, value := range found {
+			if isComparable(value) {
+				exists[refKey(value)] = true
+			}
+		}
+
+		for _, doc := range docs {
+			value := lookupPath(doc, rule.Field)
+			if !isComparable(value) || exists[refKey(value)] {
+				continue
+			}
+			count++
+			fn(Violation{Rule: rule.Name, Collection: collection, Id: doc["_id"], Value: value})
+		}
+	}
+}
+
+// whether value can be a map key, embedded documents and arrays are not checked
+func isComparable(value interface{}) bool {
+	return value != nil && reflect.TypeOf(value).Comparable()
+}
+
+// refKey keys value among the found references, numbers compare by value
+// like on the server, an int32 1 references an int64 1
+func refKey(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+	}
+	return value
+}
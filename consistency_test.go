@@ -0,0 +1,15 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefKey(t *testing.T) {
+	assert.Equal(t, refKey(int64(1)), refKey(int32(1)))
+	assert.Equal(t, refKey(int64(1)), refKey(1))
+	assert.Equal(t, refKey(int64(1)), refKey(1.0))
+	assert.Equal(t, 1.5, refKey(1.5))
+	assert.Equal(t, "1", refKey("1"))
+}
@@ -0,0 +1,92 @@
+package mgodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CountBy counts the records of the collection of model matching query by the value of field,
+// in one $group round trip. records missing field are counted under nil,
+// array values, which cannot be map keys, under their text
+// for example:
+// counts, err := CountBy(&Order{}, bson.M{"userId": 1}, "status")
+// counts["paid"]
+func (db *Database) CountBy(model interface{}, query interface{}, field string) (map[interface{}]int64, error) {
+	return db.CountByContext(context.Background(), model, query, field)
+}
+
+// CountByContext is like CountBy, ctx bounds the wait for a session and the operation
+func (db *Database) CountByContext(ctx context.Context, model interface{}, query interface{}, field string) (map[interface{}]int64, error) {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("count by db error: validate model fail")
+		return nil, err
+	}
+	if query == nil {
+		query = bson.M{}
+	}
+	var piplines interface{} = []bson.M{
+		{"$match": query},
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+	}
+	if err := db.applyPipelinePolicy(ctx, model, &piplines); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("count by db error: policy denied")
+		return nil, err
+	}
+
+	collection := GetCollectionName(model)
+	rows := []struct {
+		Value interface{} `bson:"_id"`
+		Count int64       `bson:"count"`
+	}{}
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		pipe, err := db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(&rows)
+	})
+	db.observe(ctx, "countBy", collection, piplines, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"query":      query,
+			"field":      field,
+			"err":        err,
+		}).Error("count by db error: database operate fail")
+		return nil, err
+	}
+
+	counts := make(map[interface{}]int64, len(rows))
+	for _, row := range rows {
+		counts[countKey(row.Value)] += row.Count
+	}
+	return counts, nil
+}
+
+// countKey returns value, or its text when it cannot be a map key
+func countKey(value interface{}) interface{} {
+	if value != nil && !reflect.TypeOf(value).Comparable() {
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+func CountBy(model interface{}, query interface{}, field string) (map[interface{}]int64, error) {
+	return _db.CountBy(model, query, field)
+}
+
+func CountByContext(ctx context.Context, model interface{}, query interface{}, field string) (map[interface{}]int64, error) {
+	return _db.CountByContext(ctx, model, query, field)
+}
@@ -0,0 +1,14 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountKey(t *testing.T) {
+	assert.Equal(t, "paid", countKey("paid"))
+	assert.Equal(t, 1, countKey(1))
+	assert.Nil(t, countKey(nil))
+	assert.Equal(t, "[a b]", countKey([]interface{}{"a", "b"}))
+}
@@ -0,0 +1,173 @@
+package mgodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const counterCollection = "mgodb_counter"
+
+// granularity of counter buckets
+type CounterUnit string
+
+const (
+	CounterMinute CounterUnit = "minute"
+	CounterHour   CounterUnit = "hour"
+	CounterDay    CounterUnit = "day"
+)
+
+var counterUnits = []CounterUnit{CounterMinute, CounterHour, CounterDay}
+
+var (
+	ErrInvalidCounterUnit = errors.New("counter unit must be minute, hour or day")
+)
+
+// truncate returns the start of the bucket of t, in UTC
+func (u CounterUnit) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch u {
+	case CounterMinute:
+		return t.Truncate(time.Minute)
+	case CounterHour:
+		return t.Truncate(time.Hour)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func (u CounterUnit) next(t time.Time) time.Time {
+	switch u {
+	case CounterMinute:
+		return t.Add(time.Minute)
+	case CounterHour:
+		return t.Add(time.Hour)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func (u CounterUnit) valid() bool {
+	return u == CounterMinute || u == CounterHour || u == CounterDay
+}
+
+// a counter bucket document
+type counterDoc struct {
+	Name  string      `bson:"name"`
+	Unit  CounterUnit `bson:"unit"`
+	At    time.Time   `bson:"at"`
+	Count int64       `bson:"count"`
+}
+
+// count of one bucket
+type CounterPoint struct {
+	At    time.Time `json:"at"`
+	Count int64     `json:"count"`
+}
+
+// named counters pre-aggregated into minute, hour and day bucket documents
+type CounterStore struct {
+	db *Database
+}
+
+// Counters returns the counter store
+// for example:
+// db.Counters().Incr("signup", 1)
+// points, err := db.Counters().Range("signup", db.CounterHour, time.Now().Add(-24*time.Hour), time.Now())
+func (db *Database) Counters() *CounterStore {
+	return &CounterStore{db: db}
+}
+
+func Counters() *CounterStore {
+	return _db.Counters()
+}
+
+// EnsureIndexes creates the index used by Range and Total
+func (s *CounterStore) EnsureIndexes() error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(counterCollection).EnsureIndex(mgo.Index{Key: []string{"name", "unit", "at"}, Background: true})
+	})
+}
+
+// Incr adds n to counter name in its minute, hour and day buckets of now
+func (s *CounterStore) Incr(name string, n int64) error {
+	return s.IncrAt(name, n, time.Now())
+}
+
+// IncrAt adds n to counter name in its minute, hour and day buckets of at
+func (s *CounterStore) IncrAt(name string, n int64, at time.Time) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		bulk := sess.DB("").C(counterCollection).Bulk()
+		bulk.Unordered()
+		for _, unit := range counterUnits {
+			start := unit.truncate(at)
+			bulk.Upsert(bson.M{"_id": counterId(name, unit, start)}, bson.M{
+				"$inc":         bson.M{"count": n},
+				"$setOnInsert": bson.M{"name": name, "unit": unit, "at": start},
+			})
+		}
+		_, err := bulk.Run()
+		return err
+	})
+	if err != nil {
+		logWith(Fields{
+			"name": name,
+			"err":  err,
+		}).Error("counter db error: incr fail")
+	}
+	return err
+}
+
+// Range returns the buckets of unit of counter name from the bucket of from
+// up to the bucket of to, both included, buckets without any count included as 0
+func (s *CounterStore) Range(name string, unit CounterUnit, from time.Time, to time.Time) ([]CounterPoint, error) {
+	if !unit.valid() {
+		return nil, ErrInvalidCounterUnit
+	}
+	from, to = unit.truncate(from), unit.truncate(to)
+	docs := []counterDoc{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(counterCollection).Find(bson.M{
+			"name": name,
+			"unit": unit,
+			"at":   bson.M{"$gte": from, "$lte": to},
+		}).All(&docs)
+	})
+	if err != nil {
+		logWith(Fields{
+			"name": name,
+			"err":  err,
+		}).Error("counter db error: range fail")
+		return nil, err
+	}
+	return fillCounterRange(docs, unit, from, to), nil
+}
+
+// Total returns the sum of the buckets Range returns
+func (s *CounterStore) Total(name string, unit CounterUnit, from time.Time, to time.Time) (int64, error) {
+	points, err := s.Range(name, unit, from, to)
+	total := int64(0)
+	for _, point := range points {
+		total += point.Count
+	}
+	return total, err
+}
+
+func fillCounterRange(docs []counterDoc, unit CounterUnit, from time.Time, to time.Time) []CounterPoint {
+	counts := make(map[int64]int64, len(docs))
+	for _, doc := range docs {
+		counts[doc.At.Unix()] += doc.Count
+	}
+	points := []CounterPoint{}
+	for at := from; !at.After(to); at = unit.next(at) {
+		points = append(points, CounterPoint{At: at, Count: counts[at.Unix()]})
+	}
+	return points
+}
+
+func counterId(name string, unit CounterUnit, start time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", name, unit, start.Unix())
+}
@@ -0,0 +1,28 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterUnit(t *testing.T) {
+	at := time.Date(2020, 3, 4, 10, 25, 30, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, 3, 4, 10, 25, 0, 0, time.UTC), CounterMinute.truncate(at))
+	assert.Equal(t, time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC), CounterHour.truncate(at))
+	assert.Equal(t, time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC), CounterDay.truncate(at))
+	assert.False(t, CounterUnit("week").valid())
+	assert.Equal(t, "signup:hour:1583316000", counterId("signup", CounterHour, CounterHour.truncate(at)))
+}
+
+func TestFillCounterRange(t *testing.T) {
+	from := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	docs := []counterDoc{{Name: "signup", Unit: CounterHour, At: from.Add(time.Hour), Count: 3}}
+	points := fillCounterRange(docs, CounterHour, from, from.Add(2*time.Hour))
+	assert.Equal(t, []CounterPoint{
+		{At: from, Count: 0},
+		{At: from.Add(time.Hour), Count: 3},
+		{At: from.Add(2 * time.Hour), Count: 0},
+	}, points)
+}
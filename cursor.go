@@ -0,0 +1,121 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// counters of the server side cursors opened by streaming reads
+type CursorStats struct {
+	// cursors not closed yet
+	Open int `json:"open"`
+	// age of the oldest open cursor, a growing value points at a leak
+	Oldest time.Duration `json:"oldest"`
+	Opened int64         `json:"opened"`
+	Closed int64         `json:"closed"`
+	// cursors killed because their context was done before they were closed
+	Abandoned int64 `json:"abandoned"`
+}
+
+type cursorTracker struct {
+	sync.Mutex
+	open      map[*trackedCursor]struct{}
+	opened    int64
+	closed    int64
+	abandoned int64
+}
+
+// trackedCursor closes its iterator, which kills the server side cursor,
+// when its context is done before the reader closed it
+type trackedCursor struct {
+	*mgo.Iter
+	collection string
+	started    time.Time
+	tracker    *cursorTracker
+	once       sync.Once
+	stop       chan struct{}
+}
+
+// trackCursor registers iter until it is closed, iter is killed when ctx is done first
+func (db *Database) trackCursor(ctx context.Context, collection string, iter *mgo.Iter) *trackedCursor {
+	cursor := &trackedCursor{
+		Iter:       iter,
+		collection: collection,
+		started:    time.Now(),
+		tracker:    &db.cursors,
+		stop:       make(chan struct{}),
+	}
+	db.cursors.Lock()
+	if db.cursors.open == nil {
+		db.cursors.open = make(map[*trackedCursor]struct{})
+	}
+	db.cursors.open[cursor] = struct{}{}
+	db.cursors.opened++
+	db.cursors.Unlock()
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				if cursor.untrack(true) {
+					db.logContext(ctx, Fields{
+						"collection": collection,
+						"err":        ctx.Err(),
+					}).Warn("mongodb: cursor abandoned, killed")
+					cursor.Iter.Close()
+				}
+			case <-cursor.stop:
+			}
+		}()
+	}
+	return cursor
+}
+
+// untrack removes the cursor once, reports whether this call did
+func (c *trackedCursor) untrack(abandoned bool) bool {
+	done := false
+	c.once.Do(func() {
+		done = true
+		close(c.stop)
+		c.tracker.Lock()
+		delete(c.tracker.open, c)
+		if abandoned {
+			c.tracker.abandoned++
+		} else {
+			c.tracker.closed++
+		}
+		c.tracker.Unlock()
+	})
+	return done
+}
+
+// Close kills the server side cursor when it is not exhausted and returns the iteration error
+func (c *trackedCursor) Close() error {
+	c.untrack(false)
+	return c.Iter.Close()
+}
+
+// Cursors returns the counters of the cursors opened by streaming reads
+func (db *Database) Cursors() CursorStats {
+	db.cursors.Lock()
+	defer db.cursors.Unlock()
+	stats := CursorStats{
+		Open:      len(db.cursors.open),
+		Opened:    db.cursors.opened,
+		Closed:    db.cursors.closed,
+		Abandoned: db.cursors.abandoned,
+	}
+	for cursor := range db.cursors.open {
+		if age := time.Since(cursor.started); age > stats.Oldest {
+			stats.Oldest = age
+		}
+	}
+	return stats
+}
+
+func Cursors() CursorStats {
+	return _db.Cursors()
+}
@@ -0,0 +1,31 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestTrackCursor(t *testing.T) {
+	db := &Database{}
+	cursor := db.trackCursor(context.Background(), "car", &mgo.Iter{})
+	assert.Equal(t, 1, db.Cursors().Open)
+	assert.Nil(t, cursor.Close())
+	assert.Nil(t, cursor.Close())
+	stats := db.Cursors()
+	assert.Equal(t, 0, stats.Open)
+	assert.Equal(t, int64(1), stats.Opened)
+	assert.Equal(t, int64(1), stats.Closed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cursor = db.trackCursor(ctx, "car", &mgo.Iter{})
+	cancel()
+	assert.Eventually(t, func() bool { return db.Cursors().Abandoned == 1 }, time.Second, time.Millisecond)
+	assert.Nil(t, cursor.Close())
+	stats = db.Cursors()
+	assert.Equal(t, 0, stats.Open)
+	assert.Equal(t, int64(1), stats.Closed)
+}
@@ -1,13 +1,15 @@
 package mgodb
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
@@ -15,8 +17,38 @@ import (
 )
 
 type Database struct {
-	session *mgo.Session
-	latch   chan *mgo.Session
+	// replaced by a failover, see InitFailover
+	session    atomic.Pointer[mgo.Session]
+	failover   failoverWatch
+	latch      chan *mgo.Session
+	stats      queryStats
+	nplusone   nplusoneDetector
+	metrics    metricsFilter
+	size       sizeGuard
+	decode     decodeOptions
+	times      timeOptions
+	denorm     denormRules
+	partitions partitions
+	overload   overloadGuard
+	hedging    hedging
+	readOnly   readOnlyModels
+	policy     policyHolder
+	recorder   recorderHolder
+	coalescing coalescing
+	negative   negativeCache
+	flags      FlagStore
+	upgrades   schemaUpgrades
+	serverJS   serverJS
+	cursors    cursorTracker
+	immutable  immutableGuard
+	transforms transformers
+	appName    appName
+	dual       dualWrite
+
+	timeout   time.Duration
+	telemetry bool
+	// set by SetLogger, nil for the no-op logger
+	logger atomic.Pointer[Logger]
 }
 
 func (db *Database) Init(addr string, concurrent int, timeout time.Duration) {
@@ -24,31 +56,144 @@ func (db *Database) Init(addr string, concurrent int, timeout time.Duration) {
 	db.latch = make(chan *mgo.Session, concurrent)
 	sess, err := mgo.Dial(addr)
 	if err != nil {
-		log.Println("mongodb: cannot connect to - ", addr, err)
+		// the no-op logger would exit without a word
+		if db.logger.Load() == nil {
+			fmt.Fprintf(os.Stderr, "mongodb: cannot connect to %s: %v\n", redactURI(addr), err)
+		}
+		db.logWith(Fields{
+			"addr": redactURI(addr),
+			"err":  err,
+		}).Error("mongodb: cannot connect")
 		os.Exit(-1)
 	}
 
 	// set params
 	sess.SetMode(mgo.Eventual, true)
+	db.setup(sess, addr, timeout)
+}
+
+// New connects to uri and returns a database independent of the package level one,
+// to talk to several clusters from one process or to inject a database into services.
+// it logs through the logger of the package level database, see SetLogger
+// for example:
+// reports, err := New("mongodb://127.0.0.1:27017/reports", 16, 10*time.Second)
+// err = reports.Find(&rows, bson.M{"day": day}, 1, 20, nil)
+func New(uri string, concurrent int, timeout time.Duration) (*Database, error) {
+	sess, err := mgo.DialWithTimeout(uri, timeout)
+	if err != nil {
+		_db.logWith(Fields{
+			"addr": redactURI(uri),
+			"err":  err,
+		}).Error("mongodb: cannot connect")
+		return nil, err
+	}
+	sess.SetMode(mgo.Eventual, true)
+
+	db := &Database{latch: make(chan *mgo.Session, concurrent)}
+	db.logger.Store(_db.logger.Load())
+	db.setup(sess, uri, timeout)
+	return db, nil
+}
+
+// Default returns the package level database, which the functions of the package use
+func Default() *Database {
+	return &_db
+}
+
+// Close waits for the sessions in use and closes all of them
+func (db *Database) Close() {
+	db.failover.stop()
+	db.flags.close()
+	db.returnPartitions()
+	for k := 0; k < cap(db.latch); k++ {
+		sess := <-db.latch
+		sess.Close()
+	}
+	if sess := db.session.Load(); sess != nil {
+		sess.Close()
+	}
+}
+
+// setup takes sess as the session of db and fills the latch with its copies
+func (db *Database) setup(sess *mgo.Session, addr string, timeout time.Duration) {
 	sess.SetSocketTimeout(timeout)
 	sess.SetCursorTimeout(0)
-	db.session = sess
+	db.session.Store(sess)
+	db.timeout = timeout
 
 	for k := 0; k < cap(db.latch); k++ {
 		db.latch <- sess.Copy()
 	}
+
+	if db.telemetry {
+		db.logTelemetry(addr)
+	}
 }
 
 func (db *Database) Execute(f func(sess *mgo.Session) error) error {
+	return db.execute(context.Background(), f)
+}
+
+func (db *Database) execute(ctx context.Context, f func(sess *mgo.Session) error) error {
+	// reads after a write of ctx must see it
+	if p := db.pinnedOf(ctx); p != nil {
+		return db.executePinned(ctx, p, false, f)
+	}
+
 	// latch control
-	sess := <-db.latch
-	defer func() {
-		db.latch <- sess
-	}()
+	sess, release, err := db.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
 	sess.Refresh()
 	return f(sess)
 }
 
+// executeWrite runs the write f on collection by ExecuteWriteContext, the writes of mgodb
+// to model collections go through it. the cached misses of collection are dropped after f whatever its result,
+// a failed write may have applied
+func (db *Database) executeWrite(ctx context.Context, collection string, f func(sess *mgo.Session) error) error {
+	err := db.ExecuteWriteContext(ctx, f)
+	db.forgetMisses(collection)
+	return err
+}
+
+// ExecuteIdempotent is like Execute, but when the primary steps down it
+// refreshes the session topology and retries f once.
+// only use it for operations which are safe to run twice
+func (db *Database) ExecuteIdempotent(f func(sess *mgo.Session) error) error {
+	return db.ExecuteIdempotentContext(context.Background(), f)
+}
+
+// ExecuteIdempotentContext is like ExecuteIdempotent, but the retry is
+// skipped when ctx is done or its retry budget is spent, see WithRetryBudget
+func (db *Database) ExecuteIdempotentContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p := db.pinnedOf(ctx); p != nil {
+		return db.executePinned(ctx, p, false, f)
+	}
+
+	// latch control
+	sess, release, err := db.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	sess.Refresh()
+	err = f(sess)
+	if isStepdownError(err) && takeRetry(ctx) {
+		db.logContext(ctx, Fields{
+			"err": err,
+		}).Warn("mongodb: primary stepdown, retry once")
+		sess.Refresh()
+		err = f(sess)
+	}
+	return err
+}
+
 var (
 	_db Database
 )
@@ -61,24 +206,66 @@ func Execute(f func(sess *mgo.Session) error) error {
 	return _db.Execute(f)
 }
 
+func ExecuteIdempotent(f func(sess *mgo.Session) error) error {
+	return _db.ExecuteIdempotent(f)
+}
+
+func ExecuteIdempotentContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	return _db.ExecuteIdempotentContext(ctx, f)
+}
+
 var (
 	ErrModelNotPtr        = errors.New("model is not pointer")
 	ErrModelToPtr         = errors.New("model point to another pointer")
 	ErrResultNotSliceAddr = errors.New("result argument must be a slice address")
 )
 
-// insert one record
+// insert one record, opts override the write concern for this call
 // for example:
 // user := &User{UserId: 1, Name: "xx"}
 // Insert(user)
-func Insert(model interface{}) error {
+// Insert(payment, WMajority())
+func (db *Database) Insert(model interface{}, opts ...CallOption) error {
+	return db.InsertContext(WithOptions(context.Background(), opts...), model)
+}
+
+// InsertContext is like Insert, ctx bounds the wait for a session and the operation
+func (db *Database) InsertContext(ctx context.Context, model interface{}) error {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model": model,
 			"err":   err,
 		}).Error("insert db error: model validate fail")
 		return err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("insert db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionInsert, nil); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("insert db error: policy denied")
+		return err
+	}
+	if _, err := db.applyDefaults(ctx, model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("insert db error: apply defaults fail")
+		return err
+	}
+	if err := beforeInsert(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("insert db error: before insert hook fail")
+		return err
+	}
 
 	updatedField := reflect.ValueOf(model).Elem().FieldByName("Updated")
 	if updatedField.CanSet() {
@@ -90,37 +277,84 @@ func Insert(model interface{}) error {
 	}
 
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
+	if err := db.beforeWrite(collection, model); err != nil {
+		return err
+	}
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		return sess.DB("").C(collection).Insert(model)
 	})
 	if err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"collection": collection,
 			"err":        err,
 		}).Error("insert db error: database operate fail")
 		return err
 	}
+	db.mirror(ctx, "insert", collection, nil, func(backend Backend) error {
+		return backend.Insert(ctx, collection, model)
+	})
 
 	return nil
 }
 
+func Insert(model interface{}, opts ...CallOption) error {
+	return _db.Insert(model, opts...)
+}
+
+func InsertContext(ctx context.Context, model interface{}) error {
+	return _db.InsertContext(ctx, model)
+}
+
 // insert many records
 // for example:
 // data := []*User{user1, user2, user3}
 // InsertMany(data)
-func InsertMany(docs []interface{}) error {
+func (db *Database) InsertMany(docs []interface{}, opts ...CallOption) error {
+	return db.InsertManyContext(WithOptions(context.Background(), opts...), docs)
+}
+
+// InsertManyContext is like InsertMany, ctx bounds the wait for a session and the operation
+func (db *Database) InsertManyContext(ctx context.Context, docs []interface{}) error {
 	if err := validateSlice(&docs); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"docs": docs,
 			"err":  err,
 		}).Error("insert db error: docs invalid")
 		return err
 	}
+	if err := db.checkWritable(docs[0]); err != nil {
+		db.logContext(ctx, Fields{
+			"docs": docs,
+			"err":  err,
+		}).Error("insert db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, docs[0], ActionInsert, nil); err != nil {
+		db.logContext(ctx, Fields{
+			"docs": docs,
+			"err":  err,
+		}).Error("insert db error: policy denied")
+		return err
+	}
 
 	val := reflect.ValueOf(docs)
 	for i := 0; i < val.Len(); i++ {
 		model := val.Index(i).Interface()
+		if _, err := db.applyDefaults(ctx, model); err != nil {
+			db.logContext(ctx, Fields{
+				"model": model,
+				"err":   err,
+			}).Error("insert db error: apply defaults fail")
+			return err
+		}
+		if err := beforeInsert(model); err != nil {
+			db.logContext(ctx, Fields{
+				"model": model,
+				"err":   err,
+			}).Error("insert db error: before insert hook fail")
+			return err
+		}
 		updatedField := reflect.ValueOf(model).Elem().FieldByName("Updated")
 		if updatedField.CanSet() {
 			updatedField.Set(reflect.ValueOf(time.Now().UTC()))
@@ -132,63 +366,163 @@ func InsertMany(docs []interface{}) error {
 	}
 
 	collection := GetCollectionName(docs[0])
-	err := Execute(func(sess *mgo.Session) error {
+	for _, doc := range docs {
+		if err := db.beforeWrite(collection, doc); err != nil {
+			return err
+		}
+	}
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		return sess.DB("").C(collection).Insert(docs...)
 	})
 	if err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"docs":       docs,
 			"collection": collection,
 			"err":        err,
 		}).Error("insert db error: database operate fail")
 		return err
 	}
+	db.mirror(ctx, "insertMany", collection, nil, func(backend Backend) error {
+		return backend.Insert(ctx, collection, docs...)
+	})
 
 	return nil
 }
 
-// find one record
+func InsertMany(docs []interface{}, opts ...CallOption) error {
+	return _db.InsertMany(docs, opts...)
+}
+
+func InsertManyContext(ctx context.Context, docs []interface{}) error {
+	return _db.InsertManyContext(ctx, docs)
+}
+
+// find one record, opts override the read mode for this call
 // for example:
 // user := &User{}
 // FindOne(user, bson.M{"name": "xxx"})
-func FindOne(model interface{}, query interface{}) error {
+// FindOne(user, bson.M{"name": "xxx"}, ReadSecondary())
+func (db *Database) FindOne(model interface{}, query interface{}, opts ...CallOption) error {
+	return db.FindOneContext(WithOptions(context.Background(), opts...), model, query)
+}
+
+// FindOneContext is like FindOne, ctx bounds the wait for a session and the operation
+func (db *Database) FindOneContext(ctx context.Context, model interface{}, query interface{}) error {
+	_, err := db.findOne(ctx, model, query, nil)
+	return err
+}
+
+// FindOneOrNil is like FindOne, found reports whether a record matched query,
+// a record not found is not an error
+// for example:
+// user := &User{}
+// found, err := FindOneOrNil(user, bson.M{"name": "xxx"})
+func (db *Database) FindOneOrNil(model interface{}, query interface{}) (bool, error) {
+	return db.findOne(context.Background(), model, query, nil)
+}
+
+// FindOneOrNilContext is like FindOneOrNil, ctx bounds the wait for a session and the operation
+func (db *Database) FindOneOrNilContext(ctx context.Context, model interface{}, query interface{}) (bool, error) {
+	return db.findOne(ctx, model, query, nil)
+}
+
+func (db *Database) findOne(ctx context.Context, model interface{}, query interface{}, projection interface{}) (bool, error) {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model": model,
 			"query": query,
 			"err":   err,
 		}).Error("find db error: model validate fail")
-		return err
+		return false, err
+	}
+	if err := db.applyPolicy(ctx, model, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("find db error: policy denied")
+		return false, err
 	}
 
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
-		return sess.DB("").C(collection).Find(query).One(model)
-	})
+	missed, generation := db.cachedMiss(collection, query)
+	if missed {
+		return false, nil
+	}
+	start := time.Now()
+	var err error
+	if projection != nil {
+		// partial records are neither shared nor written back
+		err = db.readHedged(ctx, collection, model, func(sess *mgo.Session, model interface{}) error {
+			q, err := db.query(sess, collection, query)
+			if err != nil {
+				return err
+			}
+			return db.oneSelected(sess, collection, db.attribute(ctx, q.Select(projection)), model)
+		})
+	} else {
+		writer := db.upgradeWriterOf(ctx, model)
+		err = db.readCoalesced(ctx, collection, query, model, func(sess *mgo.Session, model interface{}) error {
+			q, err := db.query(sess, collection, query)
+			if err != nil {
+				return err
+			}
+			return db.oneUpgraded(sess, collection, db.attribute(ctx, q), model, writer)
+		})
+	}
+	db.observe(ctx, "findOne", collection, query, start, err)
 	if err != nil && err == mgo.ErrNotFound {
-		return nil
+		db.cacheMiss(collection, query, generation)
+		return false, nil
+	}
+	if err == nil {
+		if projection == nil {
+			db.compareRead(collection, query, model)
+		}
+		db.afterDecode(model)
+		err = afterFind(model)
 	}
 
 	if err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"query":      query,
 			"collection": collection,
 			"err":        err,
 		}).Error("find db error: database operate fail")
-		return err
+		return false, err
 	}
 
-	return err
+	return true, nil
+}
+
+func FindOne(model interface{}, query interface{}, opts ...CallOption) error {
+	return _db.FindOne(model, query, opts...)
+}
+
+func FindOneContext(ctx context.Context, model interface{}, query interface{}) error {
+	return _db.FindOneContext(ctx, model, query)
+}
+
+func FindOneOrNil(model interface{}, query interface{}) (bool, error) {
+	return _db.FindOneOrNil(model, query)
+}
+
+func FindOneOrNilContext(ctx context.Context, model interface{}, query interface{}) (bool, error) {
+	return _db.FindOneOrNilContext(ctx, model, query)
 }
 
 // update one record
 // for example
 // user := &User{}
 // UpdateOne(user, bson.M{"name": "xx"}, bson.M{"$set": bson.M{...}})
-func UpdateOne(model interface{}, selector interface{}, update interface{}) error {
+func (db *Database) UpdateOne(model interface{}, selector interface{}, update interface{}, opts ...CallOption) error {
+	return db.UpdateOneContext(WithOptions(context.Background(), opts...), model, selector, update)
+}
+
+// UpdateOneContext is like UpdateOne, ctx bounds the wait for a session and the operation
+func (db *Database) UpdateOneContext(ctx context.Context, model interface{}, selector interface{}, update interface{}) error {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":    model,
 			"selector": selector,
 			"update":   update,
@@ -196,13 +530,56 @@ func UpdateOne(model interface{}, selector interface{}, update interface{}) erro
 		}).Error("update db error: validate model fail")
 		return err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionUpdate, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update db error: policy denied")
+		return err
+	}
+	guarded, err := db.guardImmutable(model, update)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model":  model,
+			"update": update,
+			"err":    err,
+		}).Error("update db error: immutable field")
+		return err
+	}
+	update = guarded
+	if update, err = db.transformUpdate(model, update); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update db error: transform fail")
+		return err
+	}
+	if err := beforeUpdate(model, selector, update); err != nil {
+		db.logContext(ctx, Fields{
+			"model":    model,
+			"selector": selector,
+			"update":   update,
+			"err":      err,
+		}).Error("update db error: before update hook fail")
+		return err
+	}
 
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
+	pending := db.prepareDenorm(ctx, collection, selector, update, 1)
+	start := time.Now()
+	err = db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		return sess.DB("").C(collection).Update(selector, update)
 	})
+	db.observe(ctx, "update", collection, selector, start, err)
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"selector":   selector,
 			"update":     update,
@@ -210,131 +587,442 @@ func UpdateOne(model interface{}, selector interface{}, update interface{}) erro
 			"err":        err,
 		}).Error("update db error: database operate fail")
 	}
+	if err == nil {
+		db.propagate(ctx, pending)
+		db.mirror(ctx, "update", collection, selector, func(backend Backend) error {
+			return backend.Update(ctx, collection, selector, update, false)
+		})
+	}
 
 	return err
 }
 
-// upsert one record
+func UpdateOne(model interface{}, selector interface{}, update interface{}, opts ...CallOption) error {
+	return _db.UpdateOne(model, selector, update, opts...)
+}
+
+func UpdateOneContext(ctx context.Context, model interface{}, selector interface{}, update interface{}) error {
+	return _db.UpdateOneContext(ctx, model, selector, update)
+}
+
+// upsert one record atomically, the defaulted and immutable fields and the Created
+// timestamp are only written when the record is inserted, see UpsertOneOnInsert.
+// a soft deleted record matching selector is upserted too
 // for example
 // user := &User{"name":"xxx", "pwd": "xx"}
 // user.UserId = 1
 // UpsertOne(user, bson.M{"name": "xx"})
-func UpsertOne(model interface{}, selector interface{}) error {
+func (db *Database) UpsertOne(model interface{}, selector interface{}, opts ...CallOption) error {
+	return db.UpsertOneContext(WithOptions(context.Background(), opts...), model, selector)
+}
+
+// UpsertOneContext is like UpsertOne, ctx bounds the wait for a session and the operation
+func (db *Database) UpsertOneContext(ctx context.Context, model interface{}, selector interface{}) error {
+	return db.upsertOne(ctx, model, selector, nil)
+}
+
+func UpsertOne(model interface{}, selector interface{}, opts ...CallOption) error {
+	return _db.UpsertOne(model, selector, opts...)
+}
+
+func UpsertOneContext(ctx context.Context, model interface{}, selector interface{}) error {
+	return _db.UpsertOneContext(ctx, model, selector)
+}
+
+// upsert one record atomically, setOnInsert fields, the defaulted and immutable fields
+// and the Created timestamp are only written when the record is inserted,
+// all other fields are always set
+// for example
+// user := &User{"name":"xxx", "pwd": "xx"}
+// UpsertOneOnInsert(user, bson.M{"name": "xx"}, bson.M{"score": 100})
+func (db *Database) UpsertOneOnInsert(model interface{}, selector interface{}, setOnInsert bson.M) error {
+	return db.UpsertOneOnInsertContext(context.Background(), model, selector, setOnInsert)
+}
+
+// UpsertOneOnInsertContext is like UpsertOneOnInsert, ctx bounds the wait for a session and the operation
+func (db *Database) UpsertOneOnInsertContext(ctx context.Context, model interface{}, selector interface{}, setOnInsert bson.M) error {
+	return db.upsertOne(ctx, model, selector, setOnInsert)
+}
+
+// upsertOne upserts model atomically, the fields of setOnInsert, the defaulted and
+// immutable fields and the Created timestamp are only written when the record is inserted
+func (db *Database) upsertOne(ctx context.Context, model interface{}, selector interface{}, setOnInsert bson.M) error {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
-			"model":    model,
-			"selector": selector,
-			"err":      err,
+		db.logContext(ctx, Fields{
+			"model":       model,
+			"selector":    selector,
+			"setOnInsert": setOnInsert,
+			"err":         err,
 		}).Error("upsert db error: validate model fail")
 		return err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionUpsert, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert db error: policy denied")
+		return err
+	}
+	defaulted, err := db.applyDefaults(ctx, model)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert db error: apply defaults fail")
+		return err
+	}
 
+	now := time.Now().UTC()
 	updatedField := reflect.ValueOf(model).Elem().FieldByName("Updated")
 	if updatedField.CanSet() {
-		updatedField.Set(reflect.ValueOf(time.Now().UTC()))
+		updatedField.Set(reflect.ValueOf(now))
 	}
 
-	update := bson.M{"$set": model}
-	err := UpdateOne(model, selector, update)
-	if err == mgo.ErrNotFound {
-		err = Insert(model)
+	collection := GetCollectionName(model)
+	if err := db.beforeWrite(collection, model); err != nil {
+		return err
 	}
-	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
-			"model":    model,
-			"selector": selector,
-			"err":      err,
+	set := bson.M{}
+	if err := convertToBsonM(model, &set); err != nil {
+		return err
+	}
+	onInsert := bson.M{}
+	for key, value := range setOnInsert {
+		onInsert[key] = value
+	}
+	if field, ok := reflect.TypeOf(model).Elem().FieldByName("Created"); ok {
+		if name, _ := bsonName(field); name != "" {
+			onInsert[name] = now
+		}
+	}
+	db.normalizeTimes(onInsert)
+	if id, ok := set["_id"]; ok {
+		onInsert["_id"] = id
+	}
+	for key := range onInsert {
+		delete(set, key)
+	}
+	// defaults only fill records being created, immutable fields are never updated
+	for _, path := range append(defaulted, immutableFields(model)...) {
+		moveOnInsert(set, onInsert, path)
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+	pending := db.prepareDenorm(ctx, collection, selector, update, 1)
+	start := time.Now()
+	err = db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).Upsert(selector, update)
+		return err
+	})
+	db.observe(ctx, "upsert", collection, selector, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model":      model,
+			"selector":   selector,
+			"update":     update,
+			"collection": collection,
+			"err":        err,
 		}).Error("upsert db error: database operate fail")
 	}
+	if err == nil {
+		db.propagate(ctx, pending)
+		db.mirror(ctx, "upsert", collection, selector, func(backend Backend) error {
+			return backend.Upsert(ctx, collection, selector, update)
+		})
+	}
 
 	return err
 }
 
+// moveOnInsert moves the value at path of set into onInsert, the embedded
+// documents of set holding path are split into the paths of their fields
+func moveOnInsert(set bson.M, onInsert bson.M, path string) {
+	if value, ok := set[path]; ok {
+		onInsert[path] = value
+		delete(set, path)
+		return
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] != '.' {
+			continue
+		}
+		parent, ok := set[path[:i]].(bson.M)
+		if !ok {
+			continue
+		}
+		delete(set, path[:i])
+		for key, value := range parent {
+			set[path[:i]+"."+key] = value
+		}
+		moveOnInsert(set, onInsert, path)
+		return
+	}
+}
+
+func UpsertOneOnInsert(model interface{}, selector interface{}, setOnInsert bson.M) error {
+	return _db.UpsertOneOnInsert(model, selector, setOnInsert)
+}
+
+func UpsertOneOnInsertContext(ctx context.Context, model interface{}, selector interface{}, setOnInsert bson.M) error {
+	return _db.UpsertOneOnInsertContext(ctx, model, selector, setOnInsert)
+}
+
 // remove one record
 // for example:
 // user := &User{}
 // RemoveOne(user, bson.M{"name": "xx"})
-func RemoveOne(model interface{}, selector interface{}) error {
+func (db *Database) RemoveOne(model interface{}, selector interface{}, opts ...CallOption) error {
+	return db.RemoveOneContext(WithOptions(context.Background(), opts...), model, selector)
+}
+
+// RemoveOneContext is like RemoveOne, ctx bounds the wait for a session and the operation
+func (db *Database) RemoveOneContext(ctx context.Context, model interface{}, selector interface{}) error {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":    model,
 			"selector": selector,
 			"err":      err,
 		}).Error("delete db error: validate model fail")
 		return err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("delete db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionRemove, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("delete db error: policy denied")
+		return err
+	}
+	if field := softDeleteField(model); field != "" && !isUnscoped(ctx) {
+		err := db.softRemove(ctx, model, selector, field, false)
+		if err != nil && err != mgo.ErrNotFound {
+			db.logContext(ctx, Fields{
+				"model":    model,
+				"selector": selector,
+				"err":      err,
+			}).Error("delete db error: soft delete fail")
+		}
+		if err == nil {
+			err = afterRemove(model, selector)
+		}
+		return err
+	}
 
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
+	start := time.Now()
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		return sess.DB("").C(collection).Remove(selector)
 	})
+	db.observe(ctx, "remove", collection, selector, start, err)
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"selector":   selector,
 			"collection": collection,
 			"err":        err,
 		}).Error("delete db error: database operate fail")
 	}
+	if err == nil {
+		db.mirror(ctx, "remove", collection, selector, func(backend Backend) error {
+			return backend.Remove(ctx, collection, selector, false)
+		})
+		err = afterRemove(model, selector)
+	}
 
 	return err
 }
 
+func RemoveOne(model interface{}, selector interface{}, opts ...CallOption) error {
+	return _db.RemoveOne(model, selector, opts...)
+}
+
+func RemoveOneContext(ctx context.Context, model interface{}, selector interface{}) error {
+	return _db.RemoveOneContext(ctx, model, selector)
+}
+
 // remove all record
 // for example:
 // user := &User{}
 // RemoveAll(user, bson.M{"name": "xx"})
-func RemoveAll(model interface{}, selector interface{}) error {
+func (db *Database) RemoveAll(model interface{}, selector interface{}, opts ...CallOption) error {
+	return db.RemoveAllContext(WithOptions(context.Background(), opts...), model, selector)
+}
+
+// RemoveAllContext is like RemoveAll, ctx bounds the wait for a session and the operation
+func (db *Database) RemoveAllContext(ctx context.Context, model interface{}, selector interface{}) error {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":    model,
 			"selector": selector,
 			"err":      err,
 		}).Error("delete all db error: validate model fail")
 		return err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("delete all db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionRemove, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("delete db error: policy denied")
+		return err
+	}
+	if field := softDeleteField(model); field != "" && !isUnscoped(ctx) {
+		err := db.softRemove(ctx, model, selector, field, true)
+		if err != nil && err != mgo.ErrNotFound {
+			db.logContext(ctx, Fields{
+				"model":    model,
+				"selector": selector,
+				"err":      err,
+			}).Error("delete all db error: soft delete fail")
+		}
+		return err
+	}
 
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
+	start := time.Now()
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		_, err := sess.DB("").C(collection).RemoveAll(selector)
 		return err
 	})
+	db.observe(ctx, "removeAll", collection, selector, start, err)
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"selector":   selector,
 			"collection": collection,
 			"err":        err,
 		}).Error("delete all db error: database operate fail")
 	}
+	if err == nil {
+		db.mirror(ctx, "removeAll", collection, selector, func(backend Backend) error {
+			return backend.Remove(ctx, collection, selector, true)
+		})
+	}
 
 	return err
 }
 
+func RemoveAll(model interface{}, selector interface{}, opts ...CallOption) error {
+	return _db.RemoveAll(model, selector, opts...)
+}
+
+func RemoveAllContext(ctx context.Context, model interface{}, selector interface{}) error {
+	return _db.RemoveAllContext(ctx, model, selector)
+}
+
 // for example:
 // result := []*User{}
 // Find(&result, bson.M{...}, 1, 15, []string{...})
-func Find(result interface{}, query interface{}, page int, pageSize int, sorts []string) error {
+// Find(&result, bson.M{...}, 1, 15, nil, ReadSecondary())
+func (db *Database) Find(result interface{}, query interface{}, page int, pageSize int, sorts []string, opts ...CallOption) error {
+	return db.FindContext(WithOptions(context.Background(), opts...), result, query, page, pageSize, sorts)
+}
+
+// FindContext is like Find, ctx bounds the wait for a session and the operation
+func (db *Database) FindContext(ctx context.Context, result interface{}, query interface{}, page int, pageSize int, sorts []string) error {
+	return db.find(ctx, result, query, FindOptions{Page: page, PageSize: pageSize, Sorts: sorts})
+}
+
+// FindWith is like Find with its options gathered in opts, which also selects fields
+// for example:
+// cars := []*Car{}
+// FindWith(&cars, bson.M{"price": bson.M{"$gt": 100}}, FindOptions{Page: 1, PageSize: 20, Select: bson.M{"name": 1}})
+func (db *Database) FindWith(result interface{}, query interface{}, opts FindOptions) error {
+	return db.find(context.Background(), result, query, opts)
+}
+
+// FindWithContext is like FindWith, ctx bounds the wait for a session and the operation
+func (db *Database) FindWithContext(ctx context.Context, result interface{}, query interface{}, opts FindOptions) error {
+	return db.find(ctx, result, query, opts)
+}
+
+func (db *Database) find(ctx context.Context, result interface{}, query interface{}, opts FindOptions) error {
+	page, pageSize, sorts := opts.Page, opts.PageSize, opts.Sorts
 	if err := validateSlice(result); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"result": result,
 			"query":  query,
 			"err":    err,
 		}).Error("search db error: validate model fail")
 		return err
 	}
+	if err := db.applyPolicy(ctx, result, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find db error: policy denied")
+		return err
+	}
+
+	// per model default sort and maximum page size
+	if len(sorts) == 0 {
+		sorts = getDefaultSort(result)
+	}
+	page, pageSize = capPage(page, pageSize, getMaxPageSize(result))
 
 	collection := GetCollectionName(result)
 	skip := (page - 1) * pageSize
-	err := Execute(func(sess *mgo.Session) error {
-		if page < 0 && pageSize < 0 {
-			return sess.DB("").C(collection).Find(query).Sort(sorts...).All(result)
-		} else {
-			return sess.DB("").C(collection).Find(query).Skip(skip).Limit(pageSize).Sort(sorts...).All(result)
+	writer := db.upgradeWriterOf(ctx, result)
+	start := time.Now()
+	err := db.readHedged(ctx, collection, result, func(sess *mgo.Session, result interface{}) error {
+		q, err := db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		q = db.attribute(ctx, q.Sort(sorts...))
+		if page >= 0 || pageSize >= 0 {
+			q = q.Skip(skip).Limit(pageSize)
+		}
+		if opts.Select != nil {
+			return db.allSelected(sess, collection, q.Select(opts.Select), result)
 		}
+		return db.allUpgraded(sess, collection, q, result, writer)
 	})
+	db.observe(ctx, "find", collection, query, start, err)
+	if decodeErr, ok := err.(*DecodeError); ok {
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"query":      query,
+			"failures":   len(decodeErr.Failures),
+			"err":        err,
+		}).Warn("search db error: records skipped")
+		db.afterDecode(result)
+		if err := afterFind(result); err != nil {
+			return err
+		}
+		return decodeErr
+	}
+	if err == nil {
+		db.afterDecode(result)
+		err = afterFind(result)
+	}
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"result":   result,
 			"query":    query,
 			"page":     page,
@@ -347,44 +1035,171 @@ func Find(result interface{}, query interface{}, page int, pageSize int, sorts [
 	return err
 }
 
+func Find(result interface{}, query interface{}, page int, pageSize int, sorts []string, opts ...CallOption) error {
+	return _db.Find(result, query, page, pageSize, sorts, opts...)
+}
+
+func FindWith(result interface{}, query interface{}, opts FindOptions) error {
+	return _db.FindWith(result, query, opts)
+}
+
+func FindWithContext(ctx context.Context, result interface{}, query interface{}, opts FindOptions) error {
+	return _db.FindWithContext(ctx, result, query, opts)
+}
+
+func FindContext(ctx context.Context, result interface{}, query interface{}, page int, pageSize int, sorts []string) error {
+	return _db.FindContext(ctx, result, query, page, pageSize, sorts)
+}
+
 // for example:
 // user := &User{}
 // Count(user, bson.M{...})
-func Count(model interface{}, query interface{}) int {
+func (db *Database) Count(model interface{}, query interface{}, opts ...CallOption) int {
+	count, _ := db.CountContext(WithOptions(context.Background(), opts...), model, query)
+	return count
+}
+
+// CountContext is like Count, ctx bounds the wait for a session and the operation.
+// unlike Count it returns the error, a cancelled count is not a count of 0
+func (db *Database) CountContext(ctx context.Context, model interface{}, query interface{}) (int, error) {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model": model,
 			"query": query,
 			"err":   err,
 		}).Error("count db error: validate model fail")
-		return 0
+		return 0, err
+	}
+	if err := db.applyPolicy(ctx, model, ActionCount, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("count db error: policy denied")
+		return 0, err
 	}
 
 	count := 0
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) (err error) {
-		count, err = sess.DB("").C(collection).Find(query).Count()
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		q, err := db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		count, err = q.Count()
 		return err
 	})
+	db.observe(ctx, "count", collection, query, start, err)
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"query":      query,
 			"collection": collection,
 			"err":        err,
 		}).Error("count db error: database operate fail")
-		return 0
+		return 0, err
 	}
 
-	return count
+	return count, nil
+}
+
+func Count(model interface{}, query interface{}, opts ...CallOption) int {
+	return _db.Count(model, query, opts...)
+}
+
+func CountContext(ctx context.Context, model interface{}, query interface{}) (int, error) {
+	return _db.CountContext(ctx, model, query)
+}
+
+// count several queries by one $facet aggregation
+// for example:
+// user := &User{}
+// CountMany(user, map[string]bson.M{"active": bson.M{...}, "banned": bson.M{...}})
+// returns map[string]int{"active": 10, "banned": 2}
+func (db *Database) CountMany(model interface{}, queries map[string]bson.M) (map[string]int, error) {
+	return db.CountManyContext(context.Background(), model, queries)
+}
+
+// CountManyContext is like CountMany, ctx bounds the wait for a session and the operation
+func (db *Database) CountManyContext(ctx context.Context, model interface{}, queries map[string]bson.M) (map[string]int, error) {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model":   model,
+			"queries": queries,
+			"err":     err,
+		}).Error("count many db error: validate model fail")
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(queries))
+	if len(queries) == 0 {
+		return counts, nil
+	}
+	facet := bson.M{}
+	for name, query := range queries {
+		var selector interface{} = query
+		if err := db.applyPolicy(ctx, model, ActionCount, &selector); err != nil {
+			db.logContext(ctx, Fields{
+				"model": model,
+				"err":   err,
+			}).Error("count many db error: policy denied")
+			return nil, err
+		}
+		facet[name] = []bson.M{{"$match": selector}, {"$count": "n"}}
+		counts[name] = 0
+	}
+
+	var result map[string][]struct {
+		N int `bson:"n"`
+	}
+	collection := GetCollectionName(model)
+	pipeline := []bson.M{{"$facet": facet}}
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		pipe, err := db.pipe(sess, collection, pipeline)
+		if err != nil {
+			return err
+		}
+		return pipe.One(&result)
+	})
+	db.observe(ctx, "countMany", collection, pipeline, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model":      model,
+			"queries":    queries,
+			"collection": collection,
+			"err":        err,
+		}).Error("count many db error: database operate fail")
+		return nil, err
+	}
+
+	for name, items := range result {
+		if len(items) > 0 {
+			counts[name] = items[0].N
+		}
+	}
+	return counts, nil
+}
+
+func CountMany(model interface{}, queries map[string]bson.M) (map[string]int, error) {
+	return _db.CountMany(model, queries)
+}
+
+func CountManyContext(ctx context.Context, model interface{}, queries map[string]bson.M) (map[string]int, error) {
+	return _db.CountManyContext(ctx, model, queries)
 }
 
 // for example:
 // user := &User{}
 // UpdateAll(user, bson.M{...}, bson.M{"$set": bson.M{...}})
-func UpdateAll(model interface{}, selector interface{}, update interface{}) (int, error) {
+func (db *Database) UpdateAll(model interface{}, selector interface{}, update interface{}, opts ...CallOption) (int, error) {
+	return db.UpdateAllContext(WithOptions(context.Background(), opts...), model, selector, update)
+}
+
+// UpdateAllContext is like UpdateAll, ctx bounds the wait for a session and the operation
+func (db *Database) UpdateAllContext(ctx context.Context, model interface{}, selector interface{}, update interface{}) (int, error) {
 	if err := validateModel(model); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":    model,
 			"selector": selector,
 			"update":   update,
@@ -392,6 +1207,37 @@ func UpdateAll(model interface{}, selector interface{}, update interface{}) (int
 		}).Error("update all db error: validate model fail")
 		return 0, err
 	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update all db error: model is read-only")
+		return 0, err
+	}
+	if err := db.applyPolicy(ctx, model, ActionUpdate, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update all db error: policy denied")
+		return 0, err
+	}
+	guarded, err := db.guardImmutable(model, update)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model":  model,
+			"update": update,
+			"err":    err,
+		}).Error("update all db error: immutable field")
+		return 0, err
+	}
+	update = guarded
+	if update, err = db.transformUpdate(model, update); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("update all db error: transform fail")
+		return 0, err
+	}
 
 	updatedField := reflect.ValueOf(model).Elem().FieldByName("Updated")
 	if updatedField.CanSet() {
@@ -400,15 +1246,18 @@ func UpdateAll(model interface{}, selector interface{}, update interface{}) (int
 
 	count := 0
 	collection := GetCollectionName(model)
-	err := Execute(func(sess *mgo.Session) error {
+	pending := db.prepareDenorm(ctx, collection, selector, update, 0)
+	start := time.Now()
+	err = db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
 		info, err := sess.DB("").C(collection).UpdateAll(selector, update)
 		if !IsNil(info) {
 			count = info.Updated
 		}
 		return err
 	})
+	db.observe(ctx, "updateAll", collection, selector, start, err)
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"model":      model,
 			"selector":   selector,
 			"update":     update,
@@ -417,26 +1266,62 @@ func UpdateAll(model interface{}, selector interface{}, update interface{}) (int
 		}).Error("update all db error: database operate fail")
 		return 0, err
 	}
+	if err == nil && count > 0 {
+		db.propagate(ctx, pending)
+		db.mirror(ctx, "updateAll", collection, selector, func(backend Backend) error {
+			return backend.Update(ctx, collection, selector, update, true)
+		})
+	}
 
 	return count, err
 }
 
-func Aggregate(result interface{}, piplines interface{}) error {
+func UpdateAll(model interface{}, selector interface{}, update interface{}, opts ...CallOption) (int, error) {
+	return _db.UpdateAll(model, selector, update, opts...)
+}
+
+func UpdateAllContext(ctx context.Context, model interface{}, selector interface{}, update interface{}) (int, error) {
+	return _db.UpdateAllContext(ctx, model, selector, update)
+}
+
+func (db *Database) Aggregate(result interface{}, piplines interface{}, opts ...CallOption) error {
+	return db.AggregateContext(WithOptions(context.Background(), opts...), result, piplines)
+}
+
+// AggregateContext is like Aggregate, ctx bounds the wait for a session and the operation
+func (db *Database) AggregateContext(ctx context.Context, result interface{}, piplines interface{}) error {
+	piplines = buildPipeline(piplines)
 	if err := validateSlice(result); err != nil {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"result":   result,
 			"piplines": piplines,
 			"err":      err,
 		}).Error("aggregate db error: validate model fail")
 		return err
 	}
+	if err := db.applyPipelinePolicy(ctx, result, &piplines); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("aggregate db error: policy denied")
+		return err
+	}
 
 	collection := GetCollectionName(result)
-	err := Execute(func(sess *mgo.Session) error {
-		return sess.DB("").C(collection).Pipe(piplines).All(result)
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		pipe, err := db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(result)
 	})
+	db.observe(ctx, "aggregate", collection, piplines, start, err)
+	if err == nil {
+		db.afterDecode(result)
+	}
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		db.logContext(ctx, Fields{
 			"result":   result,
 			"piplines": piplines,
 			"err":      err,
@@ -446,6 +1331,32 @@ func Aggregate(result interface{}, piplines interface{}) error {
 	return err
 }
 
+func Aggregate(result interface{}, piplines interface{}, opts ...CallOption) error {
+	return _db.Aggregate(result, piplines, opts...)
+}
+
+func AggregateContext(ctx context.Context, result interface{}, piplines interface{}) error {
+	return _db.AggregateContext(ctx, result, piplines)
+}
+
+// beforeWrite prepares a document before it is written
+func (db *Database) beforeWrite(collection string, doc interface{}) error {
+	if err := db.transformModel(doc); err != nil {
+		return err
+	}
+	db.normalizeTimes(doc)
+	return db.checkSize(collection, doc)
+}
+
+// convert a model into a document by a bson round trip
+func convertToBsonM(model interface{}, doc *bson.M) error {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, doc)
+}
+
 func validateModel(model interface{}) error {
 	val := reflect.ValueOf(model)
 	typ := reflect.Indirect(val).Type()
@@ -500,6 +1411,52 @@ func GetCollectionName(data interface{}) string {
 	return snakeString(typ.Elem().Name())
 }
 
+// 获取默认排序, model可以定义DefaultSort() []string
+func getDefaultSort(data interface{}) []string {
+	if vals := callModelMethod(data, "DefaultSort"); len(vals) > 0 {
+		if sorts, ok := vals[0].Interface().([]string); ok {
+			return sorts
+		}
+	}
+	return nil
+}
+
+// capPage bounds a page by max, the maximum page size of the model (0 for none):
+// a pageSize of 0, which mongodb reads as no limit, or below is max too
+func capPage(page int, pageSize int, max int) (int, int) {
+	if max <= 0 {
+		return page, pageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > max {
+		pageSize = max
+	}
+	return page, pageSize
+}
+
+// 获取最大分页大小, model可以定义MaxPageSize() int
+func getMaxPageSize(data interface{}) int {
+	if vals := callModelMethod(data, "MaxPageSize"); len(vals) > 0 && vals[0].Kind() == reflect.Int {
+		return int(vals[0].Int())
+	}
+	return 0
+}
+
+// call a method without arguments on a zero value of the model type, nil if not defined
+func callModelMethod(data interface{}, name string) []reflect.Value {
+	typ := reflect.TypeOf(data)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	fun := reflect.New(typ).MethodByName(name)
+	if !fun.IsValid() || fun.Type().NumIn() != 0 {
+		return nil
+	}
+	return fun.Call([]reflect.Value{})
+}
+
 // snake string, XxYy to xx_yy , XxYY to xx_yy
 func snakeString(s string) string {
 	data := make([]byte, 0, len(s)*2)
@@ -519,11 +1476,11 @@ func snakeString(s string) string {
 }
 
 func DropDatabase() error {
-	err := Execute(func(sess *mgo.Session) error {
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
 		return sess.DB("").DropDatabase()
 	})
 	if err != nil && err != mgo.ErrNotFound {
-		log.WithFields(log.Fields{
+		logWith(Fields{
 			"err": err,
 		}).Error("DropDatabase error: database operate fail")
 		return err
@@ -1,12 +1,15 @@
 package mgodb_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,6 +38,14 @@ type Car struct {
 	Created time.Time   `json:"created" bson:"created"`
 }
 
+func (m Order) DefaultSort() []string {
+	return []string{"-created"}
+}
+
+func (m Order) MaxPageSize() int {
+	return 2
+}
+
 type CarOverview struct {
 	Car `json:",inline" bson:",inline"`
 	TotalPrice int `json:"totalPrice" bson:"totalPrice"`
@@ -50,12 +61,21 @@ type Owner struct {
 }
 
 type CarOwner struct {
-	OwnerId int64   `json:"ownerId" bson:"ownerId"`
-	CarId   int64   `json:"carId" bson:"carId"`
-	Cars    []Car   `bson:"cars,omitempty"`
+	OwnerId   int64   `json:"ownerId" bson:"ownerId"`
+	OwnerName string  `json:"ownerName" bson:"ownerName,omitempty"`
+	CarId     int64   `json:"carId" bson:"carId"`
+	Cars    []Car   `bson:"cars,omitempty" mgodb:"preload,localField=carId"`
 	Owners  []Owner `bson:"owners,omitempty"`
 }
 
+type Order struct {
+	OrderId int64     `json:"orderId" bson:"orderId"`
+	CarId   int64     `json:"carId" bson:"carId"`
+	State   string    `json:"state" bson:"state" mgodb:"state"`
+	Updated time.Time `json:"updated" bson:"updated"`
+	Created time.Time `json:"created" bson:"created"`
+}
+
 func NewCar() *Car {
 	obj := new(Car)
 	obj.CarId = getUUID()
@@ -70,6 +90,7 @@ func initDatabase() {
 	}
 
 	log.Info("mongodb: ", mongodb)
+	db.SetLogger(db.LogrusLogger{})
 	db.Init(mongodb, 128, 30*time.Second)
 }
 
@@ -153,6 +174,70 @@ func TestAggregate(t *testing.T) {
 	}
 }
 
+func TestAggregatePipeline(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+	owner := &Owner{OwnerId: getUUID(), Name: "Simi"}
+	throwFail(t, db.Insert(owner))
+	throwFail(t, db.Insert(&CarOwner{CarId: car.CarId, OwnerId: owner.OwnerId}))
+
+	pipeline := db.Pipeline().
+		Match(bson.M{"ownerId": owner.OwnerId}).
+		Lookup("car", "carId", "carId", "cars").
+		Lookup("owner", "ownerId", "ownerId", "owners")
+	resp := make([]*CarOwner, 0)
+	throwFail(t, db.Aggregate(&resp, pipeline))
+	assert.Equal(t, 1, len(resp))
+	assert.Equal(t, car.Name, resp[0].Cars[0].Name)
+	assert.Equal(t, owner.Name, resp[0].Owners[0].Name)
+}
+
+func TestPreload(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name = "大众高尔夫"
+	car.Price = 90000
+	db.Insert(car)
+
+	co := new(CarOwner)
+	co.CarId = car.CarId
+	co.OwnerId = getUUID()
+	db.Insert(co)
+
+	resp := make([]*CarOwner, 0)
+	err := db.FindPreload(&resp, bson.M{"ownerId": co.OwnerId}, 1, 10, nil, "cars")
+	throwFail(t, err)
+	assert.Equal(t, 1, len(resp))
+	assert.Equal(t, 1, len(resp[0].Cars))
+	assert.Equal(t, car.Name, resp[0].Cars[0].Name)
+}
+
+func TestAggregateChan(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name = "本田思域"
+	db.Insert(car)
+
+	pipeline := []bson.M{{"$match": bson.M{"name": car.Name}}}
+	docs, errc := db.AggregateChan(context.Background(), &Car{}, pipeline)
+	count := 0
+	for doc := range docs {
+		assert.Equal(t, car.Name, doc.(*Car).Name)
+		count++
+	}
+	throwFail(t, <-errc)
+	assert.NotEqual(t, 0, count)
+
+	// a consumer stopping early cancels, the producer ends
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errc = db.AggregateChan(ctx, &Car{}, pipeline)
+	cancel()
+	for range docs {
+	}
+	assert.Equal(t, context.Canceled, <-errc)
+}
+
 func TestAggregate2(t *testing.T) {
 	initDatabase()
 	// new car
@@ -290,6 +375,39 @@ func TestUpsertOne(t *testing.T) {
 	}
 }
 
+func TestCountMany(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name = "count many"
+	car.Price = 10
+	db.Insert(car)
+
+	counts, err := db.CountMany(&Car{}, map[string]bson.M{
+		"named":   {"name": car.Name},
+		"missing": {"name": "count many", "price": -1},
+	})
+	throwFail(t, err)
+	assert.Equal(t, db.Count(&Car{}, bson.M{"name": car.Name}), counts["named"])
+	assert.Equal(t, 0, counts["missing"])
+}
+
+func TestUpsertOneOnInsert(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name = "upsert on insert"
+	err := db.UpsertOneOnInsert(car, bson.M{"carId": car.CarId}, bson.M{"price": 100})
+	throwFail(t, err)
+
+	car.Price = 200
+	err = db.UpsertOneOnInsert(car, bson.M{"carId": car.CarId}, bson.M{"price": 100})
+	throwFail(t, err)
+
+	obj := new(Car)
+	throwFail(t, db.FindOne(obj, bson.M{"carId": car.CarId}))
+	assert.Equal(t, 100, obj.Price)
+	assert.False(t, obj.Created.IsZero())
+}
+
 func TestInsertMany(t *testing.T) {
 	initDatabase()
 
@@ -318,10 +436,1357 @@ func TestInsertMany(t *testing.T) {
 	}
 }
 
+func TestRenameField(t *testing.T) {
+	initDatabase()
+	co := new(CarOwner)
+	co.CarId = getUUID()
+	co.OwnerId = getUUID()
+	db.Insert(co)
+
+	_, err := db.RenameField(&CarOwner{}, "ownerId", "userId", 2)
+	throwFail(t, err)
+	assert.Equal(t, 0, db.Count(&CarOwner{}, bson.M{"ownerId": bson.M{"$exists": true}}))
+
+	_, err = db.RenameField(&CarOwner{}, "userId", "ownerId", 2)
+	throwFail(t, err)
+	assert.Equal(t, 1, db.Count(&CarOwner{}, bson.M{"ownerId": co.OwnerId}))
+}
+
+func TestBackfill(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name = "backfill"
+	db.Insert(car)
+
+	processed, err := db.Backfill(&Car{}, bson.M{"name": "backfill"}, 10, 0, func(batch interface{}) error {
+		for _, item := range *batch.(*[]*Car) {
+			if err := db.UpdateOne(item, bson.M{"carId": item.CarId}, bson.M{"$set": bson.M{"price": 1}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	throwFail(t, err)
+	assert.NotEqual(t, 0, processed)
+	assert.Equal(t, 0, db.Count(&Car{}, bson.M{"name": "backfill", "price": 0}))
+}
+
+func TestBuildIndexOnline(t *testing.T) {
+	initDatabase()
+	finished, name := false, ""
+	err := db.BuildIndexOnline(&Car{}, mgo.Index{Key: []string{"name", "-price"}}, func(p db.IndexProgress) {
+		t.Logf("index progress: %v", p)
+		finished, name = p.Finished, p.Index
+	})
+	throwFail(t, err)
+	assert.True(t, finished)
+	assert.Equal(t, "name_1_price_-1", name)
+}
+
+func TestCheckConsistency(t *testing.T) {
+	initDatabase()
+	co := new(CarOwner)
+	co.CarId = getUUID()
+	co.OwnerId = getUUID()
+	db.Insert(co)
+
+	rules := []db.ConsistencyRule{
+		{Name: "carOwner.carId", Model: &CarOwner{}, Field: "carId", Ref: &Car{}, Query: bson.M{"ownerId": co.OwnerId}},
+	}
+	violations := make([]db.Violation, 0)
+	n, err := db.CheckConsistency(rules, 100, func(v db.Violation) {
+		violations = append(violations, v)
+	})
+	throwFail(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, co.CarId, violations[0].Value)
+}
+
+func TestTransition(t *testing.T) {
+	initDatabase()
+	order := new(Order)
+	order.OrderId = getUUID()
+	order.State = "created"
+	db.Insert(order)
+
+	selector := bson.M{"orderId": order.OrderId}
+	err := db.Transition(order, selector, []string{"created"}, "paid", bson.M{"carId": 1})
+	throwFail(t, err)
+	assert.Equal(t, "paid", order.State)
+	assert.Equal(t, int64(1), order.CarId)
+
+	err = db.Transition(order, selector, []string{"created"}, "paid", nil)
+	assert.Equal(t, db.ErrInvalidTransition, err)
+	err = db.Transition(order, bson.M{"orderId": -1}, []string{"created"}, "paid", nil)
+	assert.Equal(t, mgo.ErrNotFound, err)
+}
+
+func TestDecrementIfAtLeast(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Price = 3
+	db.Insert(car)
+
+	selector := bson.M{"carId": car.CarId}
+	remaining, err := db.DecrementIfAtLeast(car, selector, "price", 2)
+	throwFail(t, err)
+	assert.Equal(t, int64(1), remaining)
+	assert.Equal(t, 1, car.Price)
+
+	_, err = db.DecrementIfAtLeast(car, selector, "price", 2)
+	assert.Equal(t, db.ErrInsufficient, err)
+}
+
+func TestArraySlice(t *testing.T) {
+	initDatabase()
+	co := new(CarOwner)
+	co.OwnerId = getUUID()
+	db.Insert(co)
+
+	selector := bson.M{"ownerId": co.OwnerId}
+	for i := 0; i < 5; i++ {
+		car := NewCar()
+		car.Price = i
+		throwFail(t, db.PushBounded(co, selector, "cars", []interface{}{car}, 3))
+	}
+
+	obj := new(CarOwner)
+	throwFail(t, db.FindSlice(obj, selector, "cars", 1, 10))
+	assert.Equal(t, 2, len(obj.Cars))
+	assert.Equal(t, 3, obj.Cars[0].Price)
+
+	// like FindOne, no record is not an error
+	obj = new(CarOwner)
+	throwFail(t, db.FindSlice(obj, bson.M{"ownerId": getUUID()}, "cars", 0, 10))
+	assert.Equal(t, int64(0), obj.OwnerId)
+}
+
+func TestFindDefaults(t *testing.T) {
+	initDatabase()
+	for i := 0; i < 3; i++ {
+		order := new(Order)
+		order.OrderId = getUUID()
+		db.Insert(order)
+	}
+
+	result := []*Order{}
+	err := db.Find(&result, bson.M{}, -1, -1, nil)
+	throwFail(t, err)
+	assert.Equal(t, 2, len(result))
+	assert.False(t, result[0].Created.Before(result[1].Created))
+}
+
+func TestDenormRule(t *testing.T) {
+	initDatabase()
+	owner := new(Owner)
+	owner.OwnerId = getUUID()
+	owner.Name = "Simi"
+	db.Insert(owner)
+	co := new(CarOwner)
+	co.OwnerId = owner.OwnerId
+	co.OwnerName = owner.Name
+	db.Insert(co)
+
+	db.RegisterDenormRule(db.DenormRule{
+		Source: &Owner{}, SourceKey: "ownerId", SourceField: "name", Target: &CarOwner{}, TargetField: "ownerName",
+	})
+	err := db.UpdateOne(owner, bson.M{"ownerId": owner.OwnerId}, bson.M{"$set": bson.M{"name": "Tom"}})
+	throwFail(t, err)
+
+	obj := new(CarOwner)
+	throwFail(t, db.FindOne(obj, bson.M{"ownerId": owner.OwnerId}))
+	assert.Equal(t, "Tom", obj.OwnerName)
+
+	// the update changes the field its selector matches on
+	_, err = db.UpdateAll(owner, bson.M{"ownerId": owner.OwnerId, "name": "Tom"}, bson.M{"$set": bson.M{"name": "Jerry"}})
+	throwFail(t, err)
+	obj = new(CarOwner)
+	throwFail(t, db.FindOne(obj, bson.M{"ownerId": owner.OwnerId}))
+	assert.Equal(t, "Jerry", obj.OwnerName)
+}
+
+func TestTwoPhaseCommit(t *testing.T) {
+	initDatabase()
+	from := NewCar()
+	from.Price = 100
+	db.Insert(from)
+	to := NewCar()
+	db.Insert(to)
+
+	_, err := db.TwoPhaseCommit(
+		db.TwoPhaseOp{Model: from, Selector: bson.M{"carId": from.CarId},
+			Update: bson.M{"$inc": bson.M{"price": -30}}, Rollback: bson.M{"$inc": bson.M{"price": 30}}},
+		db.TwoPhaseOp{Model: to, Selector: bson.M{"carId": to.CarId},
+			Update: bson.M{"$inc": bson.M{"price": 30}}, Rollback: bson.M{"$inc": bson.M{"price": -30}}},
+	)
+	throwFail(t, err)
+
+	obj := NewCar()
+	throwFail(t, db.FindOne(obj, bson.M{"carId": to.CarId}))
+	assert.Equal(t, 30, obj.Price)
+
+	// the second record does not exist, the first one is rolled back
+	_, err = db.TwoPhaseCommit(
+		db.TwoPhaseOp{Model: from, Selector: bson.M{"carId": from.CarId},
+			Update: bson.M{"$inc": bson.M{"price": -30}}, Rollback: bson.M{"$inc": bson.M{"price": 30}}},
+		db.TwoPhaseOp{Model: to, Selector: bson.M{"carId": getUUID()},
+			Update: bson.M{"$inc": bson.M{"price": 30}}, Rollback: bson.M{"$inc": bson.M{"price": -30}}},
+	)
+	assert.Equal(t, db.ErrTwoPhaseCancelled, err)
+	throwFail(t, db.FindOne(obj, bson.M{"carId": from.CarId}))
+	assert.Equal(t, 70, obj.Price)
+
+	// the second update fails on a record of the same collection,
+	// only the first record is rolled back, by its own rollback
+	_, err = db.TwoPhaseCommit(
+		db.TwoPhaseOp{Model: from, Selector: bson.M{"carId": from.CarId},
+			Update: bson.M{"$inc": bson.M{"price": -30}}, Rollback: bson.M{"$inc": bson.M{"price": 30}}},
+		db.TwoPhaseOp{Model: to, Selector: bson.M{"carId": to.CarId},
+			Update: bson.M{"$inc": bson.M{"name": 30}}, Rollback: bson.M{"$inc": bson.M{"price": -100}}},
+	)
+	assert.Equal(t, db.ErrTwoPhaseCancelled, err)
+	throwFail(t, db.FindOne(obj, bson.M{"carId": from.CarId}))
+	assert.Equal(t, 70, obj.Price)
+	assert.Equal(t, 1, db.Count(obj, bson.M{"carId": from.CarId, "pendingTransactions": bson.M{"$size": 0}}))
+	throwFail(t, db.FindOne(obj, bson.M{"carId": to.CarId}))
+	assert.Equal(t, 30, obj.Price)
+}
+
+func TestPinning(t *testing.T) {
+	initDatabase()
+	ctx, release := db.WithPinning(context.Background())
+	defer release()
+
+	car := NewCar()
+	err := db.ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+		return sess.DB("").C(car.CollectionName()).Insert(car)
+	})
+	throwFail(t, err)
+	assert.True(t, db.Pinned(ctx))
+
+	obj := NewCar()
+	err = db.ExecuteContext(ctx, func(sess *mgo.Session) error {
+		return sess.DB("").C(car.CollectionName()).Find(bson.M{"carId": car.CarId}).One(obj)
+	})
+	throwFail(t, err)
+	assert.Equal(t, car.CarId, obj.CarId)
+}
+
+func TestPinnedReads(t *testing.T) {
+	initDatabase()
+	ctx, release := db.WithPinning(context.Background())
+	defer release()
+
+	car := NewCar()
+	car.Name = "pinned"
+	throwFail(t, db.InsertContext(ctx, car))
+	assert.True(t, db.Pinned(ctx))
+
+	obj := &Car{}
+	throwFail(t, db.FindOneContext(ctx, obj, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.Name, obj.Name)
+
+	cars := []*Car{}
+	throwFail(t, db.FindContext(ctx, &cars, bson.M{"carId": car.CarId}, 1, 10, nil))
+	assert.Len(t, cars, 1)
+
+	count, err := db.CountContext(ctx, &Car{}, bson.M{"carId": car.CarId})
+	throwFail(t, err)
+	assert.Equal(t, 1, count)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = db.CountContext(cancelled, &Car{}, bson.M{"carId": car.CarId})
+	assert.NotNil(t, err)
+}
+
+func TestPercentiles(t *testing.T) {
+	initDatabase()
+	for i := 1; i <= 5; i++ {
+		car := NewCar()
+		car.Name = "percentile"
+		car.Price = i * 10
+		db.Insert(car)
+	}
+
+	values, err := db.Percentiles(&Car{}, bson.M{"name": "percentile"}, "price", 0, 0.5, 1)
+	throwFail(t, err)
+	assert.Equal(t, []float64{10, 30, 50}, values)
+
+	median, err := db.Median(&Car{}, bson.M{"name": "percentile"}, "price")
+	throwFail(t, err)
+	assert.Equal(t, float64(30), median)
+}
+
+func TestAggregatePage(t *testing.T) {
+	initDatabase()
+	for i := 0; i < 3; i++ {
+		car := NewCar()
+		car.Name = "aggregatePage"
+		car.Price = i
+		db.Insert(car)
+	}
+
+	result := []*CarOverview{}
+	err := db.AggregatePage(&result, []bson.M{
+		{"$match": bson.M{"name": "aggregatePage"}},
+		{"$sort": bson.M{"price": 1}},
+		{"$lookup": bson.M{"from": "car_owner", "localField": "carId", "foreignField": "cars.carId", "as": "owners"}},
+	}, 2, 2)
+	throwFail(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, 2, result[0].Price)
+}
+
+func TestWarmup(t *testing.T) {
+	initDatabase()
+	throwFail(t, db.Warmup(&Car{}, &CarOwner{}))
+}
+
+func TestReadOnlyModel(t *testing.T) {
+	initDatabase()
+	db.SetReadOnly(&Owner{}, true)
+	defer db.SetReadOnly(&Owner{}, false)
+
+	owner := new(Owner)
+	owner.OwnerId = getUUID()
+	assert.Equal(t, db.ErrReadOnlyModel, db.Insert(owner))
+	assert.Equal(t, db.ErrReadOnlyModel, db.RemoveOne(owner, bson.M{"ownerId": owner.OwnerId}))
+	throwFail(t, db.FindOne(owner, bson.M{"ownerId": owner.OwnerId}))
+}
+
+func TestClaim(t *testing.T) {
+	initDatabase()
+	for i := 0; i < 3; i++ {
+		car := NewCar()
+		car.Name = "claim"
+		db.Insert(car)
+	}
+
+	cars := []*Car{}
+	n, err := db.Claim(&cars, &Car{}, bson.M{"name": "claim"}, 2, "worker1", time.Minute)
+	throwFail(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, len(cars))
+
+	others := []*Car{}
+	n, err = db.Claim(&others, &Car{}, bson.M{"name": "claim"}, 5, "worker2", time.Minute)
+	throwFail(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = db.ReleaseClaims(&Car{}, bson.M{"name": "claim"}, "worker1")
+	throwFail(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestLease(t *testing.T) {
+	initDatabase()
+	key := fmt.Sprintf("lease-%d", getUUID())
+	a, b := db.Lease(key, time.Minute), db.Lease(key, time.Minute)
+
+	throwFail(t, a.Acquire())
+	assert.Equal(t, db.ErrLeaseHeld, b.Acquire())
+	throwFail(t, a.Renew())
+	assert.Equal(t, db.ErrLeaseLost, b.Renew())
+
+	throwFail(t, a.Release())
+	throwFail(t, b.Acquire())
+}
+
+func TestSeed(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("seed-%d", getUUID())
+	n, err := db.Seed(&Car{}, 1200, db.SeedRules{
+		"name":  name,
+		"carId": func(i int) interface{} { return int64(i) },
+	})
+	throwFail(t, err)
+	assert.Equal(t, 1200, n)
+
+	assert.Equal(t, 1200, db.Count(&Car{}, bson.M{"name": name}))
+}
+
+func TestCoalescing(t *testing.T) {
+	initDatabase()
+	db.EnableCoalescing(&Car{}, true)
+	defer db.EnableCoalescing(&Car{}, false)
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found := &Car{}
+			throwFail(t, db.FindOne(found, bson.M{"carId": car.CarId}))
+			assert.Equal(t, car.Name, found.Name)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTokenStore(t *testing.T) {
+	initDatabase()
+	store := db.Tokens(db.TokenOptions{TTL: time.Minute, Sliding: true})
+	throwFail(t, store.EnsureIndexes())
+
+	subject := fmt.Sprintf("user-%d", getUUID())
+	token, err := store.Create(subject, bson.M{"role": "admin"})
+	throwFail(t, err)
+
+	found, err := store.Validate(token.Id)
+	throwFail(t, err)
+	assert.Equal(t, token.Id, found.Id)
+	assert.Equal(t, subject, found.Subject)
+	assert.Equal(t, "admin", found.Data["role"])
+	assert.False(t, found.Expires.Before(token.Expires))
+	// only the hash of the token is stored
+	plain := 0
+	throwFail(t, db.Execute(func(sess *mgo.Session) (err error) {
+		plain, err = sess.DB("").C("mgodb_token").FindId(token.Id).Count()
+		return err
+	}))
+	assert.Equal(t, 0, plain)
+
+	throwFail(t, store.Revoke(token.Id))
+	_, err = store.Validate(token.Id)
+	assert.Equal(t, db.ErrInvalidToken, err)
+
+	store.Create(subject, nil)
+	store.Create(subject, nil)
+	n, err := store.RevokeAll(subject)
+	throwFail(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestFlags(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("flag-%d", getUUID())
+	throwFail(t, db.Flags().Set(db.Flag{Name: name, Users: []string{"tester"}}))
+	assert.True(t, db.Flags().Enabled(name, "tester"))
+	assert.False(t, db.Flags().Enabled(name, "user"))
+
+	throwFail(t, db.Flags().Set(db.Flag{Name: name, Enabled: true}))
+	assert.False(t, db.Flags().Enabled(name, "user"))
+	throwFail(t, db.Flags().Set(db.Flag{Name: name, Enabled: true, Rollout: 100}))
+	assert.True(t, db.Flags().Enabled(name, "user"))
+
+	throwFail(t, db.Flags().Delete(name))
+	assert.False(t, db.Flags().Enabled(name, "user"))
+}
+
+func TestCounters(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("counter-%d", getUUID())
+	at := time.Date(2020, 3, 4, 10, 25, 0, 0, time.UTC)
+	throwFail(t, db.Counters().IncrAt(name, 2, at))
+	throwFail(t, db.Counters().IncrAt(name, 3, at.Add(time.Hour)))
+
+	points, err := db.Counters().Range(name, db.CounterHour, at, at.Add(2*time.Hour))
+	throwFail(t, err)
+	assert.Equal(t, 3, len(points))
+	assert.Equal(t, int64(2), points[0].Count)
+	assert.Equal(t, int64(3), points[1].Count)
+
+	total, err := db.Counters().Total(name, db.CounterDay, at, at)
+	throwFail(t, err)
+	assert.Equal(t, int64(5), total)
+}
+
+func TestArchive(t *testing.T) {
+	initDatabase()
+	dir, err := ioutil.TempDir("", "mgodb-archive")
+	throwFail(t, err)
+	defer os.RemoveAll(dir)
+
+	name := fmt.Sprintf("archive-%d", getUUID())
+	for i := 0; i < 3; i++ {
+		car := NewCar()
+		car.Name = name
+		throwFail(t, db.Insert(car))
+	}
+
+	sink := db.DirSink{Dir: dir}
+	n, err := db.Archive(&Car{}, bson.M{"name": name}, sink, name+".json.gz")
+	throwFail(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 0, db.Count(&Car{}, bson.M{"name": name}))
+
+	n, err = db.RestoreArchive(&Car{}, sink, name+".json.gz")
+	throwFail(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3, db.Count(&Car{}, bson.M{"name": name}))
+}
+
+func TestExportImport(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	var buf bytes.Buffer
+	manifest, err := db.Export(&buf, key, &Car{})
+	throwFail(t, err)
+	assert.Equal(t, "car", manifest.Collections[0].Name)
+
+	_, err = db.VerifyExport(bytes.NewReader(buf.Bytes()), key)
+	throwFail(t, err)
+	db.RemoveOne(&Car{}, bson.M{"carId": car.CarId})
+	_, err = db.Import(bytes.NewReader(buf.Bytes()), key)
+	throwFail(t, err)
+	assert.Equal(t, 1, db.Count(&Car{}, bson.M{"carId": car.CarId}))
+}
+
+func TestSyncCollections(t *testing.T) {
+	initDatabase()
+	src, err := mgo.Dial("mongodb://127.0.0.1:27017/test")
+	throwFail(t, err)
+	defer src.Close()
+	dst, err := mgo.Dial("mongodb://127.0.0.1:27017/test_sync")
+	throwFail(t, err)
+	defer dst.Close()
+
+	since := time.Now().UTC().Add(-time.Second)
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+
+	checkpoint, n, err := db.SyncCollections(src, dst, &Car{}, since)
+	throwFail(t, err)
+	assert.True(t, n >= 1)
+	assert.True(t, checkpoint.After(since))
+	count, err := dst.DB("").C("car").Find(bson.M{"carId": car.CarId}).Count()
+	throwFail(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestSyncWatch(t *testing.T) {
+	initDatabase()
+	dst, err := mgo.Dial("mongodb://127.0.0.1:27017/test_sync")
+	throwFail(t, err)
+	defer dst.Close()
+
+	w, err := db.SyncWatch(dst, &Car{})
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 40573 {
+		t.Skip("watch needs a replica set")
+	}
+	throwFail(t, err)
+	defer w.Close()
+
+	car := NewCar()
+	synced := func(want int) bool {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+			count, err := dst.DB("").C("car").Find(bson.M{"carId": car.CarId}).Count()
+			throwFail(t, err)
+			if count == want {
+				return true
+			}
+		}
+		return false
+	}
+	throwFail(t, db.Insert(car))
+	assert.True(t, synced(1))
+	throwFail(t, db.RemoveOne(&Car{}, bson.M{"carId": car.CarId}))
+	assert.True(t, synced(0))
+	assert.Nil(t, w.Close())
+}
+
+func TestUpsertMerge(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	merge := func(current interface{}, incoming interface{}) error {
+		cur, in := current.(*Car), incoming.(*Car)
+		cur.Price += in.Price
+		return nil
+	}
+	throwFail(t, db.UpsertMerge(car, bson.M{"carId": car.CarId}, merge))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := &Car{}
+			in.CarId, in.Name, in.Price = car.CarId, car.Name, 1
+			throwFail(t, db.UpsertMerge(in, bson.M{"carId": car.CarId}, merge))
+		}()
+	}
+	wg.Wait()
+
+	found := &Car{}
+	throwFail(t, db.FindOne(found, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.Price+3, found.Price)
+}
+
+type Truck struct {
+	TruckId int64  `bson:"truckId"`
+	Name    string `bson:"name"`
+}
+
+func TestLazyUpgrade(t *testing.T) {
+	initDatabase()
+	truckId := getUUID()
+	err := db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C("truck").Insert(bson.M{"truckId": truckId, "model": "old"})
+	})
+	throwFail(t, err)
+
+	db.RegisterUpgrade(&Truck{}, 0, func(doc bson.M) error {
+		doc["name"] = doc["model"]
+		delete(doc, "model")
+		return nil
+	})
+	db.SetUpgradeWriteBack(&Truck{}, true)
+
+	trucks := []Truck{}
+	throwFail(t, db.Find(&trucks, bson.M{"truckId": truckId}, -1, -1, nil))
+	assert.Equal(t, 1, len(trucks))
+	assert.Equal(t, "old", trucks[0].Name)
+
+	raw := bson.M{}
+	err = db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C("truck").Find(bson.M{"truckId": truckId}).One(&raw)
+	})
+	throwFail(t, err)
+	assert.Equal(t, 1, raw[db.SchemaVersionField])
+	assert.Equal(t, "old", raw["name"])
+}
+
+func TestFindSubset(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Name, car.Price, car.Remark = "subset", 10, "remark"
+	throwFail(t, db.Insert(car))
+
+	cars := []MinCar{}
+	assert.Equal(t, bson.M{"_id": 0, "carId": 1, "name": 1, "price": 1}, db.ProjectionOf[MinCar]())
+	throwFail(t, db.FindSubset(&cars, &Car{}, bson.M{"carId": car.CarId}, nil))
+	assert.Equal(t, []MinCar{{CarId: car.CarId, Name: "subset", Price: 10}}, cars)
+}
+
+func TestContextCRUD(t *testing.T) {
+	initDatabase()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	car := NewCar()
+	throwFail(t, db.InsertContext(ctx, car))
+
+	found := &Car{}
+	throwFail(t, db.FindOneContext(ctx, found, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.CarId, found.CarId)
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	assert.Equal(t, context.Canceled, db.FindOneContext(canceled, &Car{}, bson.M{"carId": car.CarId}))
+	assert.Equal(t, context.Canceled, db.RemoveOneContext(canceled, &Car{}, bson.M{"carId": car.CarId}))
+}
+
+func TestAggregateMap(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("aggmap-%d", getUUID())
+	for _, price := range []int{1, 2, 3} {
+		car := NewCar()
+		car.Name, car.Price = name, price
+		throwFail(t, db.Insert(car))
+	}
+
+	totals, err := db.AggregateMap[string, int](&Car{}, []bson.M{
+		{"$match": bson.M{"name": name}},
+		{"$group": bson.M{"_id": "$name", "totalPrice": bson.M{"$sum": "$price"}}},
+	})
+	throwFail(t, err)
+	assert.Equal(t, map[string]int{name: 6}, totals)
+}
+
+func TestNew(t *testing.T) {
+	initDatabase()
+	other, err := db.New("mongodb://127.0.0.1:27017/test_other", 4, 10*time.Second)
+	throwFail(t, err)
+	defer other.Close()
+
+	car := NewCar()
+	throwFail(t, other.Insert(car))
+	found := &Car{}
+	throwFail(t, other.FindOne(found, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.CarId, found.CarId)
+	assert.Equal(t, 0, db.Count(&Car{}, bson.M{"carId": car.CarId}))
+	assert.Equal(t, db.Count(&Car{}, bson.M{}), db.Default().Count(&Car{}, bson.M{}))
+}
+
+func TestFindAcross(t *testing.T) {
+	initDatabase()
+	carId := getUUID()
+	car := NewCar()
+	car.CarId = carId
+	throwFail(t, db.Insert(car))
+	throwFail(t, db.Insert(&CarOwner{OwnerId: getUUID(), CarId: carId}))
+
+	results := []bson.M{}
+	throwFail(t, db.FindAcross(&results, []interface{}{&Car{}, &CarOwner{}}, bson.M{"carId": carId}))
+	assert.Equal(t, 2, len(results))
+}
+
+type Category struct {
+	Id       int64  `bson:"_id"`
+	ParentId int64  `bson:"parentId"`
+	Name     string `bson:"name"`
+}
+
+func TestTraverse(t *testing.T) {
+	initDatabase()
+	root := getUUID()
+	child := getUUID()
+	grandchild := getUUID()
+	throwFail(t, db.InsertMany([]interface{}{
+		&Category{Id: root, Name: "root"},
+		&Category{Id: child, ParentId: root, Name: "child"},
+		&Category{Id: grandchild, ParentId: child, Name: "grandchild"},
+	}))
+
+	nodes, err := db.Traverse[Category](bson.M{"_id": root}, "_id", "parentId", -1)
+	throwFail(t, err)
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, child, nodes[0].Doc.Id)
+	assert.Equal(t, 0, nodes[0].Depth)
+	assert.Equal(t, grandchild, nodes[1].Doc.Id)
+	assert.Equal(t, 1, nodes[1].Depth)
+
+	nodes, err = db.Traverse[Category](bson.M{"_id": grandchild}, "parentId", "_id", -1)
+	throwFail(t, err)
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, root, nodes[1].Doc.Id)
+}
+
+func TestFindEach(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("each-%d", getUUID())
+	for i := 0; i < 5; i++ {
+		car := NewCar()
+		car.Name = name
+		throwFail(t, db.Insert(car))
+	}
+
+	iter, err := db.FindIter(&Car{}, bson.M{"name": name}, 2)
+	throwFail(t, err)
+	count := 0
+	for iter.Next() {
+		car := &Car{}
+		throwFail(t, iter.Decode(car))
+		assert.Equal(t, name, car.Name)
+		count++
+	}
+	throwFail(t, iter.Close())
+	assert.Equal(t, 5, count)
+
+	count = 0
+	throwFail(t, db.FindEach(&Car{}, bson.M{"name": name}, func(doc interface{}) error {
+		assert.Equal(t, name, doc.(*Car).Name)
+		count++
+		return nil
+	}))
+	assert.Equal(t, 5, count)
+	assert.Equal(t, 0, db.Cursors().Open)
+}
+
+func TestFindOneOrNil(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+
+	found, err := db.FindOneOrNil(&Car{}, bson.M{"carId": car.CarId})
+	throwFail(t, err)
+	assert.True(t, found)
+
+	found, err = db.FindOneOrNil(&Car{}, bson.M{"carId": -1})
+	throwFail(t, err)
+	assert.False(t, found)
+}
+
+type Ticket struct {
+	TicketId int64     `bson:"ticketId" default:"seq"`
+	Status   string    `bson:"status" default:"open"`
+	Opened   time.Time `bson:"opened" default:"now"`
+}
+
+func TestInsertDefaults(t *testing.T) {
+	initDatabase()
+	first := &Ticket{}
+	throwFail(t, db.Insert(first))
+	second := &Ticket{Status: "closed"}
+	throwFail(t, db.Insert(second))
+
+	assert.Equal(t, first.TicketId+1, second.TicketId)
+	assert.Equal(t, "open", first.Status)
+	assert.Equal(t, "closed", second.Status)
+	assert.False(t, first.Opened.IsZero())
+}
+
+func TestUpsertDefaults(t *testing.T) {
+	initDatabase()
+	first := &Ticket{TicketId: getUUID(), Status: "closed"}
+	throwFail(t, db.UpsertOne(first, bson.M{"ticketId": first.TicketId}))
+	time.Sleep(10 * time.Millisecond)
+	second := &Ticket{TicketId: first.TicketId, Status: "reopened"}
+	throwFail(t, db.UpsertOne(second, bson.M{"ticketId": first.TicketId}))
+
+	// the default only fills the record when it is inserted
+	stored := &Ticket{}
+	throwFail(t, db.FindOne(stored, bson.M{"ticketId": first.TicketId}))
+	assert.Equal(t, "reopened", stored.Status)
+	assert.WithinDuration(t, first.Opened, stored.Opened, time.Millisecond)
+	assert.True(t, second.Opened.After(stored.Opened))
+}
+
+type Parking struct {
+	CarId   int64  `bson:"carId" mgodb:"key"`
+	OwnerId int64  `bson:"ownerId" mgodb:"key"`
+	Slot    string `bson:"slot"`
+}
+
+func TestUpsertByKey(t *testing.T) {
+	initDatabase()
+	throwFail(t, db.EnsureKeyIndex(&Parking{}))
+	parking := &Parking{CarId: getUUID(), OwnerId: getUUID(), Slot: "A1"}
+	throwFail(t, db.UpsertByKey(parking))
+	parking.Slot = "B2"
+	throwFail(t, db.UpsertByKey(parking))
+
+	assert.Equal(t, 1, db.Count(&Parking{}, bson.M{"carId": parking.CarId, "ownerId": parking.OwnerId}))
+	result := &Parking{}
+	throwFail(t, db.FindOne(result, bson.M{"carId": parking.CarId, "ownerId": parking.OwnerId}))
+	assert.Equal(t, "B2", result.Slot)
+}
+
+func TestFindOneAndUpdate(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Price = 100
+	throwFail(t, db.Insert(car))
+
+	before := &Car{}
+	throwFail(t, db.FindOneAndUpdate(before, bson.M{"carId": car.CarId}, bson.M{"$inc": bson.M{"price": 1}}, false))
+	assert.Equal(t, 100, before.Price)
+	after := &Car{}
+	throwFail(t, db.FindOneAndUpdate(after, bson.M{"carId": car.CarId}, bson.M{"$inc": bson.M{"price": 1}}, true))
+	assert.Equal(t, 102, after.Price)
+
+	removed := &Car{}
+	throwFail(t, db.FindOneAndDelete(removed, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.CarId, removed.CarId)
+	assert.Equal(t, mgo.ErrNotFound, db.FindOneAndDelete(&Car{}, bson.M{"carId": car.CarId}))
+}
+
+func TestBulk(t *testing.T) {
+	initDatabase()
+	first, second := NewCar(), NewCar()
+	result, err := db.Bulk(&Car{}).
+		Insert(first, second).
+		Update(bson.M{"carId": first.CarId}, bson.M{"$set": bson.M{"price": 1}}).
+		Remove(bson.M{"carId": second.CarId}).
+		Run()
+	throwFail(t, err)
+	assert.Equal(t, 2, result.Inserted)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Removed)
+
+	// the duplicate insert fails, unordered writes run the rest
+	throwFail(t, db.EnsureKeyIndex(&Parking{}))
+	result, err = db.Bulk(&Parking{}).
+		Unordered().
+		Insert(&Parking{CarId: first.CarId, OwnerId: 1}, &Parking{CarId: first.CarId, OwnerId: 1}, &Parking{CarId: first.CarId, OwnerId: 2}).
+		Run()
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, result.Inserted)
+	assert.Equal(t, 1, len(result.Errors))
+	assert.Equal(t, 1, result.Errors[0].Index)
+}
+
+func TestCountBy(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("count-by-%d", getUUID())
+	for _, price := range []int{1, 1, 2} {
+		car := NewCar()
+		car.Name = name
+		car.Price = price
+		throwFail(t, db.Insert(car))
+	}
+
+	counts, err := db.CountBy(&Car{}, bson.M{"name": name}, "price")
+	throwFail(t, err)
+	assert.Equal(t, map[interface{}]int64{1: 2, 2: 1}, counts)
+}
+
+func TestFirstLast(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("first-%d", getUUID())
+	for _, price := range []int{2, 1, 3} {
+		car := NewCar()
+		car.Name = name
+		car.Price = price
+		throwFail(t, db.Insert(car))
+	}
+
+	first := &Car{}
+	throwFail(t, db.First(first, bson.M{"name": name}, "price"))
+	assert.Equal(t, 1, first.Price)
+	last := &Car{}
+	throwFail(t, db.Last(last, bson.M{"name": name}, "price"))
+	assert.Equal(t, 3, last.Price)
+	assert.Equal(t, mgo.ErrNotFound, db.First(&Car{}, bson.M{"name": "missing-" + name}, "price"))
+}
+
+func TestFindAfter(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("after-%d", getUUID())
+	for _, price := range []int{1, 2, 2, 3, 4} {
+		car := NewCar()
+		car.Name = name
+		car.Price = price
+		throwFail(t, db.Insert(car))
+	}
+
+	prices := []int{}
+	next := ""
+	for {
+		cars := []*Car{}
+		var err error
+		next, err = db.FindAfter(&cars, bson.M{"name": name}, "price", next, 2)
+		throwFail(t, err)
+		for _, car := range cars {
+			prices = append(prices, car.Price)
+		}
+		if next == "" {
+			break
+		}
+	}
+	assert.Equal(t, []int{1, 2, 2, 3, 4}, prices)
+}
+
+func TestPluck(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprintf("pluck-%d", getUUID())
+	carIds := []int64{}
+	for i := 0; i < 3; i++ {
+		car := NewCar()
+		car.Name = name
+		throwFail(t, db.Insert(car))
+		carIds = append(carIds, car.CarId)
+	}
+
+	plucked := []int64{}
+	throwFail(t, db.Pluck(&plucked, &Car{}, bson.M{"name": name}, "carId"))
+	assert.ElementsMatch(t, carIds, plucked)
+}
+
+func TestScanAll(t *testing.T) {
+	initDatabase()
+	truckIds := map[int64]bool{}
+	for i := 0; i < 3; i++ {
+		truck := &Truck{TruckId: getUUID(), Name: "scan"}
+		throwFail(t, db.Insert(truck))
+		truckIds[truck.TruckId] = true
+	}
+
+	visited := map[int64]int{}
+	throwFail(t, db.ScanAll(&Truck{}, func(doc interface{}) error {
+		visited[doc.(*Truck).TruckId]++
+		return nil
+	}))
+	for truckId := range truckIds {
+		assert.Equal(t, 1, visited[truckId])
+	}
+}
+
+func TestFindSelect(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Remark = "a long remark"
+	throwFail(t, db.Insert(car))
+
+	result := &Car{}
+	throwFail(t, db.FindOneSelect(result, bson.M{"carId": car.CarId}, bson.M{"name": 1}))
+	assert.Equal(t, car.Name, result.Name)
+	assert.Nil(t, result.Remark)
+
+	cars := []*Car{}
+	throwFail(t, db.FindWith(&cars, bson.M{"carId": car.CarId}, db.FindOptions{Page: -1, PageSize: -1, Select: bson.M{"carId": 1}}))
+	assert.Equal(t, 1, len(cars))
+	assert.Equal(t, car.CarId, cars[0].CarId)
+	assert.Equal(t, "", cars[0].Name)
+}
+
+func TestDistinct(t *testing.T) {
+	initDatabase()
+	remark := fmt.Sprintf("distinct-%d", getUUID())
+	for _, name := range []string{"bmw", "audi", "bmw"} {
+		car := NewCar()
+		car.Name = name
+		car.Remark = remark
+		throwFail(t, db.Insert(car))
+	}
+
+	names := []string{}
+	throwFail(t, db.Distinct(&Car{}, "name", bson.M{"remark": remark}, &names))
+	assert.ElementsMatch(t, []string{"bmw", "audi"}, names)
+}
+
+func TestGridFS(t *testing.T) {
+	initDatabase()
+	carId := getUUID()
+	id, err := db.PutFile("car.jpg", bytes.NewReader([]byte("image")), bson.M{"carId": carId})
+	throwFail(t, err)
+
+	buf := &bytes.Buffer{}
+	throwFail(t, db.GetFile(id, buf))
+	assert.Equal(t, "image", buf.String())
+
+	files, err := db.ListFiles(bson.M{"metadata.carId": carId})
+	throwFail(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "car.jpg", files[0].Name)
+	assert.Equal(t, int64(5), files[0].Length)
+
+	throwFail(t, db.RemoveFile(id))
+	assert.Equal(t, mgo.ErrNotFound, db.GetFile(id, buf))
+}
+
+func TestWatch(t *testing.T) {
+	initDatabase()
+	events := make(chan db.ChangeEvent, 10)
+	w, err := db.Watch(&Car{}, nil, func(ev db.ChangeEvent) error {
+		events <- ev
+		return nil
+	})
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 40573 {
+		t.Skip("watch needs a replica set")
+	}
+	throwFail(t, err)
+	defer w.Close()
+
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+	throwFail(t, db.UpdateOne(&Car{}, bson.M{"carId": car.CarId}, bson.M{"$set": bson.M{"price": 10}}))
+	throwFail(t, db.RemoveOne(&Car{}, bson.M{"carId": car.CarId}))
+
+	var id interface{}
+	ops := []string{}
+	timeout := time.After(10 * time.Second)
+	for len(ops) < 3 {
+		select {
+		case ev := <-events:
+			found := &Car{}
+			if ev.OperationType == db.ChangeInsert && ev.Decode(found) == nil && found.CarId == car.CarId {
+				id = ev.DocumentKey["_id"]
+			}
+			if id != nil && ev.DocumentKey["_id"] == id {
+				ops = append(ops, ev.OperationType)
+			}
+		case <-timeout:
+			t.Fatalf("watch events missing, got %v", ops)
+		}
+	}
+	assert.Equal(t, []string{db.ChangeInsert, db.ChangeUpdate, db.ChangeDelete}, ops)
+	assert.Nil(t, w.Close())
+	assert.Nil(t, w.Err())
+}
+
+type Shop struct {
+	Id       int64  `bson:"_id"`
+	Name     string `bson:"name"`
+	Location bson.M `bson:"location"`
+}
+
+func TestNear(t *testing.T) {
+	initDatabase()
+	throwFail(t, db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C("shop").EnsureIndexKey("$2dsphere:location")
+	}))
+	name := fmt.Sprint(getUUID())
+	for _, lng := range []float64{116.40, 116.39, 117.50} {
+		shop := &Shop{Id: getUUID(), Name: name, Location: bson.M{"type": "Point", "coordinates": []float64{lng, 39.9}}}
+		throwFail(t, db.Insert(shop))
+	}
+
+	shops, err := db.Near[Shop](db.GeoPoint{Lng: 116.39, Lat: 39.9}, db.NearOptions{MaxDistance: 2000, Query: bson.M{"name": name}})
+	throwFail(t, err)
+	assert.Equal(t, 2, len(shops))
+	assert.Equal(t, 116.39, shops[0].Doc.Location["coordinates"].([]interface{})[0])
+	assert.True(t, shops[0].Distance < 1)
+	assert.True(t, shops[1].Distance > 800 && shops[1].Distance < 900)
+}
+
+func TestReadPreference(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+
+	throwFail(t, db.SetReadPreference("primaryPreferred"))
+	defer db.SetReadMode(mgo.Eventual)
+	found := &Car{}
+	throwFail(t, db.FindOne(found, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.CarId, found.CarId)
+
+	found = &Car{}
+	throwFail(t, db.FindOneContext(db.WithReadMode(context.Background(), mgo.Primary), found, bson.M{"carId": car.CarId}))
+	assert.Equal(t, car.CarId, found.CarId)
+
+	found = &Car{}
+	throwFail(t, db.FindOne(found, bson.M{"carId": car.CarId}, db.ReadSecondary()))
+	assert.Equal(t, car.CarId, found.CarId)
+	assert.Equal(t, 1, db.Count(found, bson.M{"carId": car.CarId}, db.ReadPrimary()))
+}
+
+func TestWriteConcernOverride(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	throwFail(t, db.InsertContext(db.WithWriteConcern(context.Background(), &mgo.Safe{W: 1, J: true}), car))
+	throwFail(t, db.FindOne(&Car{}, bson.M{"carId": car.CarId}))
+	throwFail(t, db.Insert(NewCar(), db.WMajority()))
+
+	// fire-and-forget writes report no error, even a duplicate _id
+	category := &Category{Id: getUUID(), Name: "suv"}
+	throwFail(t, db.Insert(category))
+	throwFail(t, db.Insert(category, db.Unacknowledged()))
+	assert.Error(t, db.Insert(category))
+}
+
+func TestAssert(t *testing.T) {
+	initDatabase()
+	throwFail(t, db.Insert(NewCar()))
+	throwFail(t, db.Assert(&Car{}, db.AssertionSpec{Exists: true, Indexes: [][]string{{"_id"}}, MinCount: 1}))
+
+	err := db.Assert(&Car{}, db.AssertionSpec{Indexes: [][]string{{"missingField"}}, MinCount: 1 << 30})
+	assert.True(t, errors.Is(err, db.ErrAssertionFailed))
+	assert.Equal(t, 2, len(err.(*db.AssertionError).Failures))
+}
+
+func TestDualWriteMgo(t *testing.T) {
+	initDatabase()
+	secondary, err := db.New("mongodb://127.0.0.1:27017/test_dual", 4, 10*time.Second)
+	throwFail(t, err)
+	defer secondary.Close()
+	db.EnableDualWrite(db.MgoBackend(secondary), db.DualWriteOptions{})
+	defer db.EnableDualWrite(nil, db.DualWriteOptions{})
+
+	car := NewCar()
+	throwFail(t, db.Insert(car))
+	throwFail(t, db.UpdateOne(&Car{}, bson.M{"carId": car.CarId}, bson.M{"$set": bson.M{"price": 10}}))
+	mirrored := &Car{}
+	throwFail(t, secondary.FindOne(mirrored, bson.M{"carId": car.CarId}))
+	assert.Equal(t, 10, mirrored.Price)
+
+	throwFail(t, db.RemoveOne(&Car{}, bson.M{"carId": car.CarId}))
+	assert.Equal(t, mgo.ErrNotFound, secondary.FindOne(&Car{}, bson.M{"carId": car.CarId}))
+	assert.Equal(t, int64(0), db.DualWrites().WriteMismatches)
+}
+
+func TestDualWritePinned(t *testing.T) {
+	initDatabase()
+	secondary, err := db.New("mongodb://127.0.0.1:27017/test_dual", 4, 10*time.Second)
+	throwFail(t, err)
+	defer secondary.Close()
+	db.EnableDualWrite(db.MgoBackend(secondary), db.DualWriteOptions{})
+	defer db.EnableDualWrite(nil, db.DualWriteOptions{})
+	ctx, release := db.WithPinning(context.Background())
+	defer release()
+
+	// the pin of ctx belongs to the primary database, the mirrored writes do not use it
+	car := NewCar()
+	throwFail(t, db.InsertContext(ctx, car))
+	throwFail(t, db.UpdateOneContext(ctx, &Car{}, bson.M{"carId": car.CarId}, bson.M{"$inc": bson.M{"price": 10}}))
+	assert.True(t, db.Pinned(ctx))
+	assert.False(t, secondary.Pinned(ctx))
+
+	obj := &Car{}
+	throwFail(t, db.FindOneContext(ctx, obj, bson.M{"carId": car.CarId}))
+	assert.Equal(t, 10, obj.Price)
+	mirrored := &Car{}
+	throwFail(t, secondary.FindOneContext(ctx, mirrored, bson.M{"carId": car.CarId}))
+	assert.Equal(t, 10, mirrored.Price)
+	assert.Equal(t, int64(0), db.DualWrites().WriteMismatches)
+}
+
+type Account struct {
+	AccountId int64      `bson:"accountId"`
+	Name      string     `bson:"name"`
+	Balance   int        `bson:"balance"`
+	DeletedAt *time.Time `bson:"deletedAt" mgodb:"softdelete"`
+}
+
+type AccountName struct {
+	AccountId int64  `bson:"accountId"`
+	Name      string `bson:"name"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	initDatabase()
+	account := &Account{AccountId: getUUID(), Name: fmt.Sprint("soft", getUUID())}
+	throwFail(t, db.Insert(account))
+	selector := bson.M{"accountId": account.AccountId}
+
+	throwFail(t, db.RemoveOne(&Account{}, selector))
+	found := &Account{}
+	throwFail(t, db.FindOne(found, selector))
+	assert.Equal(t, int64(0), found.AccountId)
+	assert.Equal(t, 0, db.Count(&Account{}, selector))
+	accounts := []*Account{}
+	throwFail(t, db.Find(&accounts, selector, 1, 10, nil))
+	assert.Equal(t, 0, len(accounts))
+
+	ctx := db.Unscoped(context.Background())
+	found = &Account{}
+	throwFail(t, db.FindOneContext(ctx, found, selector))
+	assert.NotNil(t, found.DeletedAt)
+	count, err := db.CountContext(ctx, &Account{}, selector)
+	throwFail(t, err)
+	assert.Equal(t, 1, count)
+
+	throwFail(t, db.Restore(&Account{}, selector))
+	found = &Account{}
+	throwFail(t, db.FindOne(found, selector))
+	assert.Nil(t, found.DeletedAt)
+	assert.Equal(t, mgo.ErrNotFound, db.Restore(&Account{}, selector))
+
+	throwFail(t, db.RemoveOneContext(ctx, &Account{}, selector))
+	count, err = db.CountContext(ctx, &Account{}, selector)
+	throwFail(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestSoftDeleteScope(t *testing.T) {
+	initDatabase()
+	name := fmt.Sprint("scope", getUUID())
+	live := &Account{AccountId: getUUID(), Name: name}
+	deleted := &Account{AccountId: getUUID(), Name: name}
+	throwFail(t, db.InsertMany([]interface{}{live, deleted}))
+	throwFail(t, db.RemoveOne(&Account{}, bson.M{"accountId": deleted.AccountId}))
+	query := bson.M{"name": name}
+
+	visited := []int64{}
+	throwFail(t, db.FindEach(&Account{}, query, func(doc interface{}) error {
+		visited = append(visited, doc.(*Account).AccountId)
+		return nil
+	}))
+	assert.Equal(t, []int64{live.AccountId}, visited)
+
+	accounts := []*Account{}
+	_, err := db.FindAfter(&accounts, query, "accountId", "", 10)
+	throwFail(t, err)
+	assert.Equal(t, 1, len(accounts))
+
+	ids := []int64{}
+	throwFail(t, db.Pluck(&ids, &Account{}, query, "accountId"))
+	assert.Equal(t, []int64{live.AccountId}, ids)
+
+	distinct := []int64{}
+	throwFail(t, db.Distinct(&Account{}, "accountId", query, &distinct))
+	assert.Equal(t, []int64{live.AccountId}, distinct)
+
+	counts, err := db.CountMany(&Account{}, map[string]bson.M{"named": query})
+	throwFail(t, err)
+	assert.Equal(t, 1, counts["named"])
+
+	byName, err := db.CountBy(&Account{}, query, "name")
+	throwFail(t, err)
+	assert.Equal(t, int64(1), byName[name])
+
+	scanned := 0
+	throwFail(t, db.ScanAll(&Account{}, func(doc interface{}) error {
+		if doc.(*Account).AccountId == deleted.AccountId {
+			scanned++
+		}
+		return nil
+	}))
+	assert.Equal(t, 0, scanned)
+
+	names := []AccountName{}
+	throwFail(t, db.FindSubset(&names, &Account{}, query, nil))
+	assert.Equal(t, 1, len(names))
+
+	across := []bson.M{}
+	throwFail(t, db.FindAcross(&across, []interface{}{&Account{}}, query))
+	assert.Equal(t, 1, len(across))
+
+	throwFail(t, db.UpdateOne(&Account{}, bson.M{"accountId": live.AccountId}, bson.M{"$inc": bson.M{"balance": 1}}))
+	assert.Equal(t, mgo.ErrNotFound, db.UpdateOne(&Account{}, bson.M{"accountId": deleted.AccountId}, bson.M{"$inc": bson.M{"balance": 1}}))
+	n, err := db.UpdateAll(&Account{}, query, bson.M{"$inc": bson.M{"balance": 1}})
+	throwFail(t, err)
+	assert.Equal(t, 1, n)
+
+	found := &Account{}
+	throwFail(t, db.FindOneContext(db.Unscoped(context.Background()), found, bson.M{"accountId": deleted.AccountId}))
+	assert.Equal(t, 0, found.Balance)
+}
+
+type Plate struct {
+	PlateId int64     `bson:"plateId" mgodb:"immutable"`
+	Number  string    `bson:"number"`
+	Created time.Time `bson:"created" mgodb:"immutable"`
+}
+
+func TestImmutableReplacement(t *testing.T) {
+	initDatabase()
+	plate := &Plate{PlateId: getUUID(), Number: "A"}
+	throwFail(t, db.Insert(plate))
+	selector := bson.M{"plateId": plate.PlateId}
+
+	assert.Equal(t, db.ErrImmutableReplacement, db.UpdateOne(&Plate{}, selector, bson.M{"number": "B"}))
+	assert.Equal(t, db.ErrImmutableReplacement, db.UpdateOne(&Plate{}, selector, &Plate{Number: "B"}))
+	_, err := db.UpdateAll(&Plate{}, selector, bson.M{"number": "B"})
+	assert.Equal(t, db.ErrImmutableReplacement, err)
+
+	throwFail(t, db.UpdateOne(&Plate{}, selector, bson.M{"$set": bson.M{"number": "B"}}))
+	found := &Plate{}
+	throwFail(t, db.FindOne(found, selector))
+	assert.Equal(t, "B", found.Number)
+	assert.Equal(t, plate.PlateId, found.PlateId)
+	assert.False(t, found.Created.IsZero())
+}
+
+type Booking struct {
+	BookingId int64  `bson:"bookingId"`
+	Owner     string `bson:"owner" mgodb:"immutable"`
+	Seats     int64  `bson:"seats" mgodb:"immutable"`
+	Status    string `bson:"status"`
+}
+
+func TestImmutableTransition(t *testing.T) {
+	initDatabase()
+	booking := &Booking{BookingId: getUUID(), Owner: "tom", Seats: 2, Status: "open"}
+	throwFail(t, db.Insert(booking))
+	selector := bson.M{"bookingId": booking.BookingId}
+
+	found := &Booking{}
+	throwFail(t, db.Transition(found, selector, []string{"open"}, "closed", bson.M{"owner": "jerry"}))
+	assert.Equal(t, "closed", found.Status)
+	assert.Equal(t, "tom", found.Owner)
+
+	_, err := db.DecrementIfAtLeast(&Booking{}, selector, "seats", 1)
+	assert.Error(t, err)
+	throwFail(t, db.FindOne(found, selector))
+	assert.Equal(t, int64(2), found.Seats)
+}
+
+func TestFindRows(t *testing.T) {
+	initDatabase()
+	car := NewCar()
+	car.Remark = bson.M{"color": "red", "tires": []bson.M{{"size": 17}}}
+	throwFail(t, db.Insert(car))
+
+	rows, err := db.FindRows("car", bson.M{"carId": car.CarId}, 1, 1, nil)
+	throwFail(t, err)
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, car.CarId, rows[0].Int64("carId"))
+	assert.Equal(t, "red", rows[0].String("remark.color"))
+	assert.Equal(t, "red", rows[0].Row("remark").String("color"))
+	assert.Equal(t, int64(17), rows[0].Rows("remark.tires")[0].Int64("size"))
+}
+
 func throwFail(t *testing.T, err error) {
 	if err != nil {
 		info := fmt.Sprintf("\t\nError: %s", err.Error())
-		t.Errorf(info)
+		t.Error(info)
 		t.Fail()
 	}
 }
@@ -0,0 +1,198 @@
+package mgodb
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// how empty or missing arrays and documents are decoded
+type EmptyMode int
+
+const (
+	// keep what the driver decodes: missing fields stay nil, empty arrays become empty slices
+	EmptyAsIs EmptyMode = iota
+	// nil slices or maps become empty ones, so they serialize to [] or {} in JSON
+	EmptyAsEmpty
+	// empty slices or maps become nil, so they serialize to null in JSON
+	EmptyAsNil
+)
+
+// maximum depth of nested values normalized after decoding
+const decodeMaxDepth = 32
+
+type decodeOptions struct {
+	sync.RWMutex
+	slices   EmptyMode
+	maps     EmptyMode
+	tolerant bool
+}
+
+// SetEmptyDecoding controls how empty or missing arrays (slices) and
+// documents (maps) are decoded by FindOne, Find and Aggregate
+// for example:
+// SetEmptyDecoding(EmptyAsEmpty, EmptyAsEmpty)
+func (db *Database) SetEmptyDecoding(slices EmptyMode, maps EmptyMode) {
+	db.decode.Lock()
+	defer db.decode.Unlock()
+	db.decode.slices = slices
+	db.decode.maps = maps
+}
+
+func SetEmptyDecoding(slices EmptyMode, maps EmptyMode) {
+	_db.SetEmptyDecoding(slices, maps)
+}
+
+// afterDecode normalizes a decoded result according to the decode options
+func (db *Database) afterDecode(result interface{}) {
+	db.localizeTimes(result)
+
+	db.decode.RLock()
+	slices, maps := db.decode.slices, db.decode.maps
+	db.decode.RUnlock()
+	if slices == EmptyAsIs && maps == EmptyAsIs {
+		return
+	}
+	normalizeEmpty(reflect.ValueOf(result), slices, maps, 0)
+}
+
+func normalizeEmpty(val reflect.Value, slices EmptyMode, maps EmptyMode, depth int) {
+	if depth > decodeMaxDepth || !val.IsValid() {
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !val.IsNil() {
+			normalizeEmpty(val.Elem(), slices, maps, depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath == "" {
+				normalizeEmpty(val.Field(i), slices, maps, depth+1)
+			}
+		}
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		if val.CanSet() {
+			if slices == EmptyAsEmpty && val.IsNil() {
+				val.Set(reflect.MakeSlice(val.Type(), 0, 0))
+			} else if slices == EmptyAsNil && !val.IsNil() && val.Len() == 0 {
+				val.Set(reflect.Zero(val.Type()))
+			}
+		}
+		for i := 0; i < val.Len(); i++ {
+			normalizeEmpty(val.Index(i), slices, maps, depth+1)
+		}
+	case reflect.Map:
+		if val.CanSet() {
+			if maps == EmptyAsEmpty && val.IsNil() {
+				val.Set(reflect.MakeMap(val.Type()))
+			} else if maps == EmptyAsNil && !val.IsNil() && val.Len() == 0 {
+				val.Set(reflect.Zero(val.Type()))
+			}
+		}
+	}
+}
+
+// a record Find could not decode
+type DecodeFailure struct {
+	Id  interface{}
+	Err error
+}
+
+// DecodeError is returned by Find in tolerant mode when records failed to decode,
+// the result holds the other records
+type DecodeError struct {
+	Collection string
+	Failures   []DecodeFailure
+}
+
+func (e *DecodeError) Error() string {
+	first := e.Failures[0]
+	return fmt.Sprintf("%d records of %s failed to decode, first %v: %v", len(e.Failures), e.Collection, first.Id, first.Err)
+}
+
+// SetDecodeTolerant lets Find skip the records which fail to decode into the result type,
+// in heterogeneous collections holding legacy records. the result holds the other
+// records and a *DecodeError listing the skipped ones is returned.
+// the driver leaves fields of a mismatched type zero, decode errors come from
+// SetBSON implementations such as Enum, and from schema upgrades
+// for example:
+// SetDecodeTolerant(true)
+// err := Find(&cars, bson.M{}, -1, -1, nil)
+// if decodeErr, ok := err.(*DecodeError); ok { log decodeErr.Failures, use cars }
+func (db *Database) SetDecodeTolerant(tolerant bool) {
+	db.decode.Lock()
+	defer db.decode.Unlock()
+	db.decode.tolerant = tolerant
+}
+
+func SetDecodeTolerant(tolerant bool) {
+	_db.SetDecodeTolerant(tolerant)
+}
+
+// decodeAll runs q into the slice result, upgrading records, written back by writer
+// unless nil, and skipping undecodable records in tolerant mode
+func (db *Database) decodeAll(sess *mgo.Session, collection string, q *mgo.Query, result interface{}, writer *upgradeWriter) error {
+	steps, _ := db.upgradesOf(collection)
+	db.decode.RLock()
+	tolerant := db.decode.tolerant
+	db.decode.RUnlock()
+	if steps == nil && !tolerant {
+		return q.All(result)
+	}
+
+	raws := []bson.Raw{}
+	if err := q.All(&raws); err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(result).Elem()
+	items := reflect.MakeSlice(slice.Type(), 0, len(raws))
+	var failures []DecodeFailure
+	for _, raw := range raws {
+		item := reflect.New(slice.Type().Elem())
+		if err := db.decodeRecord(sess, collection, steps, writer, raw, item.Interface()); err != nil {
+			if !tolerant {
+				return err
+			}
+			id := struct {
+				Id interface{} `bson:"_id"`
+			}{}
+			raw.Unmarshal(&id)
+			failures = append(failures, DecodeFailure{Id: id.Id, Err: err})
+			continue
+		}
+		items = reflect.Append(items, item.Elem())
+	}
+	slice.Set(items)
+	if len(failures) > 0 {
+		return &DecodeError{Collection: collection, Failures: failures}
+	}
+	return nil
+}
+
+// decodeRecord decodes raw into result, through its schema upgrades when steps is set
+func (db *Database) decodeRecord(sess *mgo.Session, collection string, steps map[int]Upgrade, writer *upgradeWriter, raw bson.Raw, result interface{}) error {
+	if steps == nil {
+		return raw.Unmarshal(result)
+	}
+	doc := bson.M{}
+	if err := raw.Unmarshal(&doc); err != nil {
+		return err
+	}
+	if err := db.upgradeRecord(sess, collection, steps, writer, doc); err != nil {
+		return err
+	}
+	return remarshal(doc, result)
+}
+
+func isDecodeError(err error) bool {
+	_, ok := err.(*DecodeError)
+	return ok
+}
@@ -0,0 +1,66 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type decodeCar struct {
+	Tags   []string
+	Remark map[string]interface{}
+	Owners []*decodeCar
+	Data   []byte
+}
+
+func TestEmptyDecoding(t *testing.T) {
+	db := new(Database)
+	cars := []*decodeCar{{Owners: []*decodeCar{{}}}}
+	db.afterDecode(&cars)
+	assert.Nil(t, cars[0].Tags)
+
+	db.SetEmptyDecoding(EmptyAsEmpty, EmptyAsEmpty)
+	db.afterDecode(&cars)
+	assert.NotNil(t, cars[0].Tags)
+	assert.NotNil(t, cars[0].Remark)
+	assert.NotNil(t, cars[0].Owners[0].Tags)
+	assert.Nil(t, cars[0].Data)
+
+	db.SetEmptyDecoding(EmptyAsNil, EmptyAsNil)
+	db.afterDecode(&cars)
+	assert.Nil(t, cars[0].Tags)
+	assert.Nil(t, cars[0].Remark)
+	assert.Nil(t, cars[0].Owners[0].Owners)
+	assert.Equal(t, 1, len(cars[0].Owners))
+}
+
+type strictColor string
+
+func (c *strictColor) SetBSON(raw bson.Raw) error {
+	var s string
+	if err := raw.Unmarshal(&s); err != nil || s == "" {
+		return errors.New("invalid color")
+	}
+	*c = strictColor(s)
+	return nil
+}
+
+func TestDecodeRecord(t *testing.T) {
+	db := new(Database)
+	result := &struct {
+		Color strictColor `bson:"color"`
+	}{}
+
+	data, _ := bson.Marshal(bson.M{"_id": 1, "color": "red"})
+	assert.Nil(t, db.decodeRecord(nil, "car", nil, nil, bson.Raw{Kind: 0x03, Data: data}, result))
+	assert.Equal(t, strictColor("red"), result.Color)
+
+	data, _ = bson.Marshal(bson.M{"_id": 2, "color": 3})
+	assert.NotNil(t, db.decodeRecord(nil, "car", nil, nil, bson.Raw{Kind: 0x03, Data: data}, result))
+
+	err := &DecodeError{Collection: "car", Failures: []DecodeFailure{{Id: 2, Err: errors.New("invalid color")}}}
+	assert.Equal(t, "1 records of car failed to decode, first 2: invalid color", err.Error())
+	assert.True(t, isDecodeError(err))
+}
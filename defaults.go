@@ -0,0 +1,152 @@
+package mgodb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collection of the counters behind the default:"seq" tag, one record per collection and field
+const sequenceCollection = "mgodb_sequence"
+
+// applyDefaults sets the zero fields of model tagged `default:"..."`, returns the bson
+// paths it set. the tag holds a value converted to the field type, or:
+// "now" the current time for a time.Time field,
+// "uuid" a random uuid for a string field,
+// "seq" the next value of a counter per collection and field for an integer field
+// for example:
+// type Car struct {
+// CarId  int64     `bson:"carId" default:"seq"`
+// Color  string    `bson:"color" default:"white"`
+// Listed time.Time `bson:"listed" default:"now"`
+// }
+func (db *Database) applyDefaults(ctx context.Context, model interface{}) ([]string, error) {
+	return db.defaultStruct(ctx, GetCollectionName(model), reflect.ValueOf(model).Elem(), "")
+}
+
+func (db *Database) defaultStruct(ctx context.Context, collection string, val reflect.Value, prefix string) ([]string, error) {
+	var paths []string
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if name == "" && !inline {
+			continue
+		}
+		fieldVal := val.Field(i)
+		path := prefix + name
+		if fieldVal.Kind() == reflect.Struct && fieldVal.Type() != reflect.TypeOf(time.Time{}) {
+			sub := path + "."
+			if inline {
+				sub = prefix
+			}
+			set, err := db.defaultStruct(ctx, collection, fieldVal, sub)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, set...)
+			continue
+		}
+
+		def, ok := field.Tag.Lookup("default")
+		if !ok || !fieldVal.IsZero() {
+			continue
+		}
+		if err := db.defaultValue(ctx, collection, path, fieldVal, def); err != nil {
+			return nil, fmt.Errorf("mgodb: default of %s.%s: %w", collection, path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (db *Database) defaultValue(ctx context.Context, collection string, path string, val reflect.Value, def string) error {
+	switch {
+	case def == "now" && val.Type() == reflect.TypeOf(time.Time{}):
+		val.Set(reflect.ValueOf(time.Now().UTC()))
+		return nil
+	case def == "uuid" && val.Kind() == reflect.String:
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		val.SetString(id)
+		return nil
+	case def == "seq" && (val.Kind() >= reflect.Int && val.Kind() <= reflect.Int64):
+		seq, err := db.nextSequence(ctx, collection+"."+path)
+		if err != nil {
+			return err
+		}
+		val.SetInt(seq)
+		return nil
+	}
+	return defaultScalar(val, def)
+}
+
+// defaultScalar sets a static default given as text
+func defaultScalar(val reflect.Value, text string) error {
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		val.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		val.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		val.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported default %q for type %s", text, val.Type())
+	}
+	return nil
+}
+
+// nextSequence increments the counter named key and returns its new value, starting at 1
+func (db *Database) nextSequence(ctx context.Context, key string) (int64, error) {
+	var doc struct {
+		Seq int64 `bson:"seq"`
+	}
+	change := mgo.Change{Update: bson.M{"$inc": bson.M{"seq": 1}}, Upsert: true, ReturnNew: true}
+	err := db.ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(sequenceCollection).FindId(key).Apply(change, &doc)
+		return err
+	})
+	return doc.Seq, err
+}
+
+// newUUID returns a random (version 4) uuid
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,57 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type defaultedInner struct {
+	Color string `bson:"color" default:"white"`
+}
+
+type defaultedModel struct {
+	defaultedInner `bson:",inline"`
+	Name           string    `bson:"name" default:"uuid"`
+	Price          float64   `bson:"price" default:"9.5"`
+	Listed         time.Time `bson:"listed" default:"now"`
+	Engine         struct {
+		Power int  `bson:"power" default:"100"`
+		Turbo bool `bson:"turbo" default:"true"`
+	} `bson:"engine"`
+}
+
+func TestApplyDefaults(t *testing.T) {
+	db := &Database{}
+	model := &defaultedModel{}
+	model.Price = 1
+	paths, err := db.applyDefaults(context.Background(), model)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"color", "name", "listed", "engine.power", "engine.turbo"}, paths)
+	assert.Equal(t, "white", model.Color)
+	assert.Len(t, model.Name, 36)
+	assert.Equal(t, float64(1), model.Price)
+	assert.False(t, model.Listed.IsZero())
+	assert.Equal(t, 100, model.Engine.Power)
+	assert.True(t, model.Engine.Turbo)
+
+	invalid := &struct {
+		Price int `bson:"price" default:"cheap"`
+	}{}
+	_, err = db.defaultStruct(context.Background(), "car", reflect.ValueOf(invalid).Elem(), "")
+	assert.NotNil(t, err)
+}
+
+func TestMoveOnInsert(t *testing.T) {
+	set := bson.M{"name": "a", "opened": 1, "remark": bson.M{"color": "red", "size": 2}}
+	onInsert := bson.M{}
+	moveOnInsert(set, onInsert, "opened")
+	moveOnInsert(set, onInsert, "remark.color")
+	moveOnInsert(set, onInsert, "missing.path")
+	assert.Equal(t, bson.M{"name": "a", "remark.size": 2}, set)
+	assert.Equal(t, bson.M{"opened": 1, "remark.color": "red"}, onInsert)
+}
@@ -0,0 +1,202 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidDenormRule = errors.New("denormalization rule requires Source, SourceKey, SourceField, Target and TargetField")
+)
+
+// a denormalization rule: SourceField of Source records is copied into
+// TargetField of the Target records whose TargetKey equals the SourceKey
+// for example, owner.name is copied into carOwner.ownerName:
+// DenormRule{Source: &Owner{}, SourceKey: "ownerId", SourceField: "name", Target: &CarOwner{}, TargetField: "ownerName"}
+type DenormRule struct {
+	Source      interface{}
+	SourceKey   string
+	SourceField string
+	Target      interface{}
+	TargetKey   string
+	TargetField string
+}
+
+type denormRules struct {
+	sync.RWMutex
+	rules map[string][]DenormRule
+}
+
+// RegisterDenormRule registers a rule propagated after every UpdateOne, UpdateAll
+// and UpsertOne on the source collection touching SourceField.
+// propagation is best effort: failures are logged and never fail the source write,
+// use SyncDenorm to repair copies
+func (db *Database) RegisterDenormRule(rule DenormRule) error {
+	if rule.Source == nil || rule.Target == nil || rule.SourceKey == "" || rule.SourceField == "" || rule.TargetField == "" {
+		return ErrInvalidDenormRule
+	}
+	if rule.TargetKey == "" {
+		rule.TargetKey = rule.SourceKey
+	}
+
+	collection := GetCollectionName(rule.Source)
+	db.denorm.Lock()
+	defer db.denorm.Unlock()
+	if db.denorm.rules == nil {
+		db.denorm.rules = make(map[string][]DenormRule)
+	}
+	db.denorm.rules[collection] = append(db.denorm.rules[collection], rule)
+	return nil
+}
+
+func RegisterDenormRule(rule DenormRule) error {
+	return _db.RegisterDenormRule(rule)
+}
+
+// denormPending is the propagation of an update, prepared before it runs
+type denormPending struct {
+	collection string
+	rules      []DenormRule
+	ids        []interface{}
+}
+
+// prepareDenorm returns the rules of collection touched by update with the ids of the
+// records matching selector, at most limit when it is positive. the ids are captured
+// before the update, which may change the fields selector matches on.
+// nil when no rule is touched
+func (db *Database) prepareDenorm(ctx context.Context, collection string, selector interface{}, update interface{}, limit int) *denormPending {
+	db.denorm.RLock()
+	registered := db.denorm.rules[collection]
+	db.denorm.RUnlock()
+
+	var rules []DenormRule
+	for _, rule := range registered {
+		if updateTouches(update, rule.SourceField) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var ids []interface{}
+	err := db.execute(WithReadMode(ctx, mgo.Strong), func(sess *mgo.Session) error {
+		var docs []struct {
+			Id interface{} `bson:"_id"`
+		}
+		if err := sess.DB("").C(collection).Find(selector).Select(bson.M{"_id": 1}).Limit(limit).All(&docs); err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			ids = append(ids, doc.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"selector":   selector,
+			"err":        err,
+		}).Error("denormalization sync error: capture ids fail")
+		return nil
+	}
+	return &denormPending{collection: collection, rules: rules, ids: ids}
+}
+
+// propagate runs the rules of pending for the records it captured
+func (db *Database) propagate(ctx context.Context, pending *denormPending) {
+	if pending == nil || len(pending.ids) == 0 {
+		return
+	}
+	selector := bson.M{"_id": bson.M{"$in": pending.ids}}
+	for _, rule := range pending.rules {
+		if _, err := db.syncDenorm(ctx, rule, selector); err != nil {
+			db.logContext(ctx, Fields{
+				"collection": pending.collection,
+				"ids":        pending.ids,
+				"field":      rule.SourceField,
+				"target":     GetCollectionName(rule.Target),
+				"err":        err,
+			}).Error("denormalization sync error: database operate fail")
+		}
+	}
+}
+
+// SyncDenorm copies the source field of the records matching selector
+// into their denormalized copies, returns the number of updated copies
+// for example:
+// SyncDenorm(rule, bson.M{}) // repair all copies
+func (db *Database) SyncDenorm(rule DenormRule, selector interface{}) (int, error) {
+	return db.syncDenorm(context.Background(), rule, selector)
+}
+
+func SyncDenorm(rule DenormRule, selector interface{}) (int, error) {
+	return _db.SyncDenorm(rule, selector)
+}
+
+// syncDenorm is SyncDenorm within ctx, the source is read from the primary
+// to copy the value just written
+func (db *Database) syncDenorm(ctx context.Context, rule DenormRule, selector interface{}) (int, error) {
+	if rule.TargetKey == "" {
+		rule.TargetKey = rule.SourceKey
+	}
+	source := GetCollectionName(rule.Source)
+	target := GetCollectionName(rule.Target)
+
+	updated := 0
+	err := db.executeWrite(WithReadMode(ctx, mgo.Strong), target, func(sess *mgo.Session) error {
+		iter := sess.DB("").C(source).Find(selector).Select(bson.M{rule.SourceKey: 1, rule.SourceField: 1}).Iter()
+		var doc bson.M
+		for iter.Next(&doc) {
+			key := lookupPath(doc, rule.SourceKey)
+			if key == nil {
+				continue
+			}
+			info, err := sess.DB("").C(target).UpdateAll(bson.M{rule.TargetKey: key},
+				bson.M{"$set": bson.M{rule.TargetField: lookupPath(doc, rule.SourceField)}})
+			if err != nil {
+				iter.Close()
+				return err
+			}
+			updated += info.Updated
+			doc = nil
+		}
+		return iter.Close()
+	})
+	return updated, err
+}
+
+// updateTouches reports whether update may modify field,
+// updates which cannot be inspected are assumed to modify it
+func updateTouches(update interface{}, field string) bool {
+	doc, ok := update.(bson.M)
+	if !ok {
+		return true
+	}
+
+	for op, value := range doc {
+		if !strings.HasPrefix(op, "$") {
+			// replacement document
+			return true
+		}
+		keys, ok := value.(bson.M)
+		if !ok {
+			return true
+		}
+		for key, v := range keys {
+			if key == field || strings.HasPrefix(key, field+".") || strings.HasPrefix(field, key+".") {
+				return true
+			}
+			// $rename moves the field to another name
+			if op == "$rename" && v == field {
+				return true
+			}
+		}
+	}
+	return false
+}
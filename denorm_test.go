@@ -0,0 +1,37 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestUpdateTouches(t *testing.T) {
+	assert.True(t, updateTouches(bson.M{"$set": bson.M{"name": "a"}}, "name"))
+	assert.True(t, updateTouches(bson.M{"$set": bson.M{"name.first": "a"}}, "name"))
+	assert.True(t, updateTouches(bson.M{"$unset": bson.M{"name": ""}}, "name.first"))
+	assert.True(t, updateTouches(bson.M{"$rename": bson.M{"nick": "name"}}, "name"))
+	assert.True(t, updateTouches(bson.M{"name": "a"}, "name"))
+	assert.True(t, updateTouches(struct{}{}, "name"))
+	assert.False(t, updateTouches(bson.M{"$set": bson.M{"price": 1}}, "name"))
+	assert.False(t, updateTouches(bson.M{"$set": bson.M{"names": 1}}, "name"))
+}
+
+func TestRegisterDenormRule(t *testing.T) {
+	db := new(Database)
+	assert.Equal(t, ErrInvalidDenormRule, db.RegisterDenormRule(DenormRule{}))
+	err := db.RegisterDenormRule(DenormRule{Source: &fieldsOuter{}, SourceKey: "carId", SourceField: "name", Target: &fieldsInner{}, TargetField: "carName"})
+	assert.Nil(t, err)
+	assert.Equal(t, "carId", db.denorm.rules["fields_outer"][0].TargetKey)
+}
+
+func TestPrepareDenorm(t *testing.T) {
+	db := new(Database)
+	db.RegisterDenormRule(DenormRule{Source: &fieldsOuter{}, SourceKey: "carId", SourceField: "name", Target: &fieldsInner{}, TargetField: "carName"})
+	// untouched rules capture nothing
+	assert.Nil(t, db.prepareDenorm(context.Background(), "fields_outer", bson.M{}, bson.M{"$set": bson.M{"price": 1}}, 0))
+	assert.Nil(t, db.prepareDenorm(context.Background(), "fields_inner", bson.M{}, bson.M{"$set": bson.M{"name": "a"}}, 0))
+	db.propagate(context.Background(), nil)
+}
@@ -0,0 +1,70 @@
+package mgodb
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Distinct finds the distinct values of field among the records of the collection of model
+// matching query into result, the address of a slice of the field type
+// for example:
+// names := []string{}
+// Distinct(&Car{}, "name", bson.M{"price": bson.M{"$gt": 100}}, &names)
+func (db *Database) Distinct(model interface{}, field string, query interface{}, result interface{}) error {
+	return db.DistinctContext(context.Background(), model, field, query, result)
+}
+
+// DistinctContext is like Distinct, ctx bounds the wait for a session and the operation
+func (db *Database) DistinctContext(ctx context.Context, model interface{}, field string, query interface{}, result interface{}) error {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("distinct db error: validate model fail")
+		return err
+	}
+	if err := validateSlice(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("distinct db error: validate result fail")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("distinct db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	start := time.Now()
+	err := db.readHedged(ctx, collection, result, func(sess *mgo.Session, result interface{}) error {
+		q, err := db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		return q.Distinct(field, result)
+	})
+	db.observe(ctx, "distinct", collection, query, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"field":      field,
+			"query":      query,
+			"err":        err,
+		}).Error("distinct db error: database operate fail")
+	}
+	return err
+}
+
+func Distinct(model interface{}, field string, query interface{}, result interface{}) error {
+	return _db.Distinct(model, field, query, result)
+}
+
+func DistinctContext(ctx context.Context, model interface{}, field string, query interface{}, result interface{}) error {
+	return _db.DistinctContext(ctx, model, field, query, result)
+}
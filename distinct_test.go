@@ -0,0 +1,14 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinctValidate(t *testing.T) {
+	db := &Database{}
+	names := []string{}
+	assert.Equal(t, ErrModelNotPtr, db.Distinct(fieldsInner{}, "name", nil, &names))
+	assert.Equal(t, ErrResultNotSliceAddr, db.Distinct(&fieldsInner{}, "name", nil, names))
+}
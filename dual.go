@@ -0,0 +1,205 @@
+package mgodb
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Backend is the secondary store of a dual-write, typically an adapter over
+// another driver during a driver migration. its errors follow mgo: mgo.ErrNotFound
+// when an update, a remove or a FindOne matched nothing
+type Backend interface {
+	Insert(ctx context.Context, collection string, docs ...interface{}) error
+	Update(ctx context.Context, collection string, selector interface{}, update interface{}, multi bool) error
+	Upsert(ctx context.Context, collection string, selector interface{}, update interface{}) error
+	Remove(ctx context.Context, collection string, selector interface{}, multi bool) error
+	FindOne(ctx context.Context, collection string, query interface{}, result *bson.M) error
+}
+
+// DualWriteOptions configures EnableDualWrite
+type DualWriteOptions struct {
+	// fraction of the FindOne reads compared with the secondary, 0 to 1
+	ReadSample float64
+	// called with every divergence, besides the warning logged
+	OnMismatch func(Mismatch)
+}
+
+// a write which failed on the secondary, or a read whose results differ
+type Mismatch struct {
+	Op         string      `json:"op"`
+	Collection string      `json:"collection"`
+	Query      interface{} `json:"query"`
+	// the documents read, nil for writes
+	Primary   bson.M `json:"primary,omitempty"`
+	Secondary bson.M `json:"secondary,omitempty"`
+	// the error of the secondary
+	Err error `json:"err,omitempty"`
+}
+
+// counters of the dual-write
+type DualWriteStats struct {
+	Writes          int64 `json:"writes"`
+	WriteMismatches int64 `json:"writeMismatches"`
+	Reads           int64 `json:"reads"`
+	ReadMismatches  int64 `json:"readMismatches"`
+}
+
+type dualWrite struct {
+	sync.RWMutex
+	backend Backend
+	options DualWriteOptions
+	stats   DualWriteStats
+}
+
+// EnableDualWrite mirrors the writes of Insert, InsertMany, UpdateOne, UpdateAll, UpsertOne,
+// UpsertOneOnInsert, RemoveOne and RemoveAll to backend once they succeeded, and compares
+// a sample of the FindOne reads in the background. the database stays authoritative:
+// a failed mirrored write or a differing read is only logged and counted, see DualWrites.
+// other writes (bulk, find and modify, Execute) are not mirrored.
+// a nil backend turns the dual-write off
+// for example:
+// EnableDualWrite(newDriverBackend, DualWriteOptions{ReadSample: 0.01})
+func (db *Database) EnableDualWrite(backend Backend, opts DualWriteOptions) {
+	db.dual.Lock()
+	defer db.dual.Unlock()
+	db.dual.backend = backend
+	db.dual.options = opts
+	atomic.StoreInt64(&db.dual.stats.Writes, 0)
+	atomic.StoreInt64(&db.dual.stats.WriteMismatches, 0)
+	atomic.StoreInt64(&db.dual.stats.Reads, 0)
+	atomic.StoreInt64(&db.dual.stats.ReadMismatches, 0)
+}
+
+// DualWrites returns the counters of the dual-write since EnableDualWrite
+func (db *Database) DualWrites() DualWriteStats {
+	return DualWriteStats{
+		Writes:          atomic.LoadInt64(&db.dual.stats.Writes),
+		WriteMismatches: atomic.LoadInt64(&db.dual.stats.WriteMismatches),
+		Reads:           atomic.LoadInt64(&db.dual.stats.Reads),
+		ReadMismatches:  atomic.LoadInt64(&db.dual.stats.ReadMismatches),
+	}
+}
+
+func EnableDualWrite(backend Backend, opts DualWriteOptions) {
+	_db.EnableDualWrite(backend, opts)
+}
+
+func DualWrites() DualWriteStats {
+	return _db.DualWrites()
+}
+
+// mirror runs a write which succeeded on the database on the secondary
+func (db *Database) mirror(ctx context.Context, op string, collection string, query interface{}, f func(backend Backend) error) {
+	db.dual.RLock()
+	backend, opts := db.dual.backend, db.dual.options
+	db.dual.RUnlock()
+	if backend == nil {
+		return
+	}
+
+	atomic.AddInt64(&db.dual.stats.Writes, 1)
+	if err := f(backend); err != nil {
+		atomic.AddInt64(&db.dual.stats.WriteMismatches, 1)
+		db.mismatch(opts, Mismatch{Op: op, Collection: collection, Query: query, Err: err})
+	}
+}
+
+// compareRead compares a sample of the documents read by FindOne with the secondary,
+// in the background. model holds the decoded document, before the hooks ran
+func (db *Database) compareRead(collection string, query interface{}, model interface{}) {
+	db.dual.RLock()
+	backend, opts := db.dual.backend, db.dual.options
+	db.dual.RUnlock()
+	if backend == nil || opts.ReadSample <= 0 || rand.Float64() >= opts.ReadSample {
+		return
+	}
+
+	// both documents go through the model type, so fields it ignores do not count
+	primary := bson.M{}
+	if err := remarshal(model, &primary); err != nil {
+		return
+	}
+	typ := reflect.TypeOf(model).Elem()
+	go func() {
+		atomic.AddInt64(&db.dual.stats.Reads, 1)
+		found := bson.M{}
+		err := backend.FindOne(context.Background(), collection, query, &found)
+		secondary := bson.M{}
+		if err == nil {
+			decoded := reflect.New(typ).Interface()
+			if err = remarshal(found, decoded); err == nil {
+				err = remarshal(decoded, &secondary)
+			}
+		}
+		if err != nil || !reflect.DeepEqual(primary, secondary) {
+			atomic.AddInt64(&db.dual.stats.ReadMismatches, 1)
+			db.mismatch(opts, Mismatch{Op: "findOne", Collection: collection, Query: query, Primary: primary, Secondary: secondary, Err: err})
+		}
+	}()
+}
+
+func (db *Database) mismatch(opts DualWriteOptions, m Mismatch) {
+	db.logWith(Fields{
+		"op":         m.Op,
+		"collection": m.Collection,
+		"query":      m.Query,
+		"err":        m.Err,
+	}).Warn("dual write mismatch")
+	if opts.OnMismatch != nil {
+		opts.OnMismatch(m)
+	}
+}
+
+// MgoBackend returns db as a Backend, to dual-write into a second cluster
+func MgoBackend(db *Database) Backend {
+	return mgoBackend{db}
+}
+
+type mgoBackend struct {
+	db *Database
+}
+
+func (b mgoBackend) Insert(ctx context.Context, collection string, docs ...interface{}) error {
+	return b.db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).Insert(docs...)
+	})
+}
+
+func (b mgoBackend) Update(ctx context.Context, collection string, selector interface{}, update interface{}, multi bool) error {
+	return b.db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		if !multi {
+			return sess.DB("").C(collection).Update(selector, update)
+		}
+		_, err := sess.DB("").C(collection).UpdateAll(selector, update)
+		return err
+	})
+}
+
+func (b mgoBackend) Upsert(ctx context.Context, collection string, selector interface{}, update interface{}) error {
+	return b.db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).Upsert(selector, update)
+		return err
+	})
+}
+
+func (b mgoBackend) Remove(ctx context.Context, collection string, selector interface{}, multi bool) error {
+	return b.db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		if !multi {
+			return sess.DB("").C(collection).Remove(selector)
+		}
+		_, err := sess.DB("").C(collection).RemoveAll(selector)
+		return err
+	})
+}
+
+func (b mgoBackend) FindOne(ctx context.Context, collection string, query interface{}, result *bson.M) error {
+	return b.db.ExecuteContext(ctx, func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).Find(query).One(result)
+	})
+}
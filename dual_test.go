@@ -0,0 +1,86 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// in memory secondary, keyed by carId
+type fakeBackend struct {
+	docs map[int64]bson.M
+}
+
+func (b *fakeBackend) Insert(ctx context.Context, collection string, docs ...interface{}) error {
+	for _, doc := range docs {
+		m := bson.M{}
+		remarshal(doc, &m)
+		b.docs[m["carId"].(int64)] = m
+	}
+	return nil
+}
+
+func (b *fakeBackend) Update(ctx context.Context, collection string, selector interface{}, update interface{}, multi bool) error {
+	return mgo.ErrNotFound
+}
+
+func (b *fakeBackend) Upsert(ctx context.Context, collection string, selector interface{}, update interface{}) error {
+	return nil
+}
+
+func (b *fakeBackend) Remove(ctx context.Context, collection string, selector interface{}, multi bool) error {
+	return nil
+}
+
+func (b *fakeBackend) FindOne(ctx context.Context, collection string, query interface{}, result *bson.M) error {
+	doc, ok := b.docs[query.(bson.M)["carId"].(int64)]
+	if !ok {
+		return mgo.ErrNotFound
+	}
+	*result = doc
+	return nil
+}
+
+func TestDualWrite(t *testing.T) {
+	db := &Database{}
+	backend := &fakeBackend{docs: map[int64]bson.M{}}
+	mismatches := make(chan Mismatch, 10)
+	db.EnableDualWrite(backend, DualWriteOptions{ReadSample: 1, OnMismatch: func(m Mismatch) {
+		mismatches <- m
+	}})
+
+	ctx := context.Background()
+	db.mirror(ctx, "insert", "fields_inner", nil, func(b Backend) error {
+		return b.Insert(ctx, "fields_inner", &fieldsInner{CarId: 1})
+	})
+	db.mirror(ctx, "update", "fields_inner", bson.M{"carId": int64(1)}, func(b Backend) error {
+		return b.Update(ctx, "fields_inner", bson.M{"carId": int64(1)}, bson.M{"$set": bson.M{"carId": int64(2)}}, false)
+	})
+	m := <-mismatches
+	assert.Equal(t, "update", m.Op)
+	assert.Equal(t, mgo.ErrNotFound, m.Err)
+
+	// same document, then a document missing on the secondary
+	db.compareRead("fields_inner", bson.M{"carId": int64(1)}, &fieldsInner{CarId: 1})
+	db.compareRead("fields_inner", bson.M{"carId": int64(3)}, &fieldsInner{CarId: 3})
+	select {
+	case m = <-mismatches:
+		assert.Equal(t, "findOne", m.Op)
+		assert.Equal(t, mgo.ErrNotFound, m.Err)
+		assert.Equal(t, int64(3), m.Primary["carId"])
+	case <-time.After(time.Second):
+		t.Fatal("read mismatch not reported")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, DualWriteStats{Writes: 2, WriteMismatches: 1, Reads: 2, ReadMismatches: 1}, db.DualWrites())
+
+	db.EnableDualWrite(nil, DualWriteOptions{})
+	db.mirror(ctx, "insert", "fields_inner", nil, func(b Backend) error {
+		t.Fatal("mirrored with the dual-write off")
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package mgodb
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidEnum = errors.New("invalid enum value")
+)
+
+// EnumSet declares the allowed values of an enum
+type EnumSet interface {
+	Values() []string
+}
+
+// Enum is a string-backed enum whose value is validated against the set S
+// when it is encoded to or decoded from bson, query values included
+// for example:
+// type orderStates struct{}
+// func (orderStates) Values() []string { return []string{"created", "paid"} }
+// type OrderState = Enum[orderStates]
+// FindOne(order, bson.M{"state": OrderState("paid")})
+type Enum[S EnumSet] string
+
+// Valid reports whether e is one of the allowed values
+func (e Enum[S]) Valid() bool {
+	var set S
+	for _, value := range set.Values() {
+		if string(e) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error wrapping ErrInvalidEnum when e is not allowed
+func (e Enum[S]) Validate() error {
+	if !e.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidEnum, string(e))
+	}
+	return nil
+}
+
+func (e Enum[S]) GetBSON() (interface{}, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return string(e), nil
+}
+
+func (e *Enum[S]) SetBSON(raw bson.Raw) error {
+	var value string
+	if err := raw.Unmarshal(&value); err != nil {
+		return err
+	}
+	if err := Enum[S](value).Validate(); err != nil {
+		return err
+	}
+	*e = Enum[S](value)
+	return nil
+}
+
+// EnumValues returns all allowed values of the set S
+func EnumValues[S EnumSet]() []Enum[S] {
+	var set S
+	values := make([]Enum[S], 0, len(set.Values()))
+	for _, value := range set.Values() {
+		values = append(values, Enum[S](value))
+	}
+	return values
+}
+
+// EnumIn returns a validated {"$in": values} query condition
+// for example:
+// query, err := EnumIn[orderStates]("created", "paid")
+// Find(&orders, bson.M{"state": query}, 1, 10, nil)
+func EnumIn[S EnumSet](values ...string) (bson.M, error) {
+	in := make([]string, 0, len(values))
+	for _, value := range values {
+		if err := Enum[S](value).Validate(); err != nil {
+			return nil, err
+		}
+		in = append(in, value)
+	}
+	return bson.M{"$in": in}, nil
+}
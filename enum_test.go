@@ -0,0 +1,44 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type orderStates struct{}
+
+func (orderStates) Values() []string {
+	return []string{"created", "paid"}
+}
+
+type orderState = Enum[orderStates]
+
+func TestEnum(t *testing.T) {
+	assert.True(t, orderState("paid").Valid())
+	assert.False(t, orderState("payed").Valid())
+	assert.True(t, errors.Is(orderState("payed").Validate(), ErrInvalidEnum))
+	assert.Equal(t, []orderState{"created", "paid"}, EnumValues[orderStates]())
+
+	type order struct {
+		State orderState `bson:"state"`
+	}
+	data, err := bson.Marshal(&order{State: "paid"})
+	assert.Nil(t, err)
+	obj := new(order)
+	assert.Nil(t, bson.Unmarshal(data, obj))
+	assert.Equal(t, orderState("paid"), obj.State)
+
+	_, err = bson.Marshal(&order{State: "payed"})
+	assert.True(t, errors.Is(err, ErrInvalidEnum))
+	data, _ = bson.Marshal(bson.M{"state": "payed"})
+	assert.True(t, errors.Is(bson.Unmarshal(data, obj), ErrInvalidEnum))
+
+	query, err := EnumIn[orderStates]("created", "paid")
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$in": []string{"created", "paid"}}, query)
+	_, err = EnumIn[orderStates]("payed")
+	assert.True(t, errors.Is(err, ErrInvalidEnum))
+}
@@ -0,0 +1,433 @@
+package mgodb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	exportMagic     = "MGODBENC1"
+	exportVersion   = 1
+	exportChunkSize = 64 * 1024
+	// high bit of a chunk length marks the last chunk
+	exportFinalFlag = 1 << 31
+)
+
+var (
+	ErrInvalidExportKey = errors.New("export key must be 32 bytes")
+	ErrInvalidExport    = errors.New("export is not a mgodb encrypted export, or the key is wrong")
+	ErrExportTampered   = errors.New("export was modified or truncated")
+	ErrExportChecksum   = errors.New("export content does not match its manifest")
+)
+
+// manifest of an export
+type ExportManifest struct {
+	Version     int                  `json:"version"`
+	Created     time.Time            `json:"created"`
+	Collections []ExportedCollection `json:"collections"`
+}
+
+// an exported collection, SHA256 is the checksum of its extended JSON lines
+type ExportedCollection struct {
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// Export writes the collections of models to w as an encrypted export: extended JSON
+// lines compressed by gzip, followed by a manifest with the count and checksum of every
+// collection, encrypted with AES-256-GCM by chunks authenticated in order, so nothing
+// is ever plaintext at rest and any change or truncation fails the import.
+// key is 32 bytes, keep it apart from the exports
+// for example:
+// f, _ := os.Create("cars.mgodbx")
+// manifest, err := Export(f, key, &Car{}, &Owner{})
+func Export(w io.Writer, key []byte, models ...interface{}) (*ExportManifest, error) {
+	return ExportAnonymized(w, key, nil, models...)
+}
+
+// ExportAnonymized is like Export, with rules applied to every record before it is written,
+// so production data can be loaded into staging
+// for example:
+// ExportAnonymized(f, key, AnonymizeRules{"email": HashValue(salt), "phone": MaskValue(4)}, &User{})
+func ExportAnonymized(w io.Writer, key []byte, rules AnonymizeRules, models ...interface{}) (*ExportManifest, error) {
+	ew, err := newExportWriter(w, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		if err := validateModel(model); err != nil {
+			return nil, err
+		}
+		collection := GetCollectionName(model)
+		if err := ew.begin(collection); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		err := Execute(func(sess *mgo.Session) error {
+			iter := sess.DB("").C(collection).Find(nil).Iter()
+			doc := bson.M{}
+			for iter.Next(&doc) {
+				Anonymize(doc, rules)
+				if err := ew.write(doc); err != nil {
+					iter.Close()
+					return err
+				}
+				doc = bson.M{}
+			}
+			return iter.Close()
+		})
+		_db.observe(context.Background(), "export", collection, nil, start, err)
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"err":        err,
+			}).Error("export db error: database operate fail")
+			return nil, err
+		}
+	}
+	return ew.close()
+}
+
+// Import reads an encrypted export written by Export and upserts its records by _id,
+// so an import can be run again. as records are written while reading, run VerifyExport
+// first when a damaged export must not be partially imported
+func Import(r io.Reader, key []byte) (*ExportManifest, error) {
+	return readExport(r, key, func(collection string, doc bson.M) error {
+		return _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+			_, err := sess.DB("").C(collection).UpsertId(doc["_id"], doc)
+			return err
+		})
+	})
+}
+
+// VerifyExport decrypts an export and checks it against its manifest, without importing it
+func VerifyExport(r io.Reader, key []byte) (*ExportManifest, error) {
+	return readExport(r, key, func(collection string, doc bson.M) error {
+		return nil
+	})
+}
+
+// a section header or the manifest, the lines which are not records
+type exportMarker struct {
+	Collection string          `json:"$collection,omitempty"`
+	Manifest   *ExportManifest `json:"$manifest,omitempty"`
+}
+
+type exportWriter struct {
+	enc      *chunkWriter
+	gz       *gzip.Writer
+	manifest ExportManifest
+	hash     hash.Hash
+}
+
+func newExportWriter(w io.Writer, key []byte) (*exportWriter, error) {
+	enc, err := newChunkWriter(w, key)
+	if err != nil {
+		return nil, err
+	}
+	return &exportWriter{
+		enc:      enc,
+		gz:       gzip.NewWriter(enc),
+		manifest: ExportManifest{Version: exportVersion, Created: time.Now().UTC()},
+	}, nil
+}
+
+func (ew *exportWriter) begin(collection string) error {
+	ew.sum()
+	ew.manifest.Collections = append(ew.manifest.Collections, ExportedCollection{Name: collection})
+	ew.hash = sha256.New()
+	return ew.line(exportMarker{Collection: collection})
+}
+
+func (ew *exportWriter) write(doc bson.M) error {
+	line, err := bson.MarshalJSON(doc)
+	if err != nil {
+		return err
+	}
+	// the encoder already ends the line
+	ew.hash.Write(line)
+	ew.manifest.Collections[len(ew.manifest.Collections)-1].Count++
+	_, err = ew.gz.Write(line)
+	return err
+}
+
+// sum records the checksum of the current collection
+func (ew *exportWriter) sum() {
+	if ew.hash != nil {
+		ew.manifest.Collections[len(ew.manifest.Collections)-1].SHA256 = hex.EncodeToString(ew.hash.Sum(nil))
+	}
+}
+
+func (ew *exportWriter) line(marker exportMarker) error {
+	line, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	_, err = ew.gz.Write(append(line, '\n'))
+	return err
+}
+
+func (ew *exportWriter) close() (*ExportManifest, error) {
+	ew.sum()
+	if err := ew.line(exportMarker{Manifest: &ew.manifest}); err != nil {
+		return nil, err
+	}
+	if err := ew.gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := ew.enc.Close(); err != nil {
+		return nil, err
+	}
+	return &ew.manifest, nil
+}
+
+// readExport decrypts an export, passes every record to fn and checks the content against the manifest
+func readExport(r io.Reader, key []byte, fn func(collection string, doc bson.M) error) (*ExportManifest, error) {
+	dec, err := newChunkReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest *ExportManifest
+	got := []ExportedCollection{}
+	var h hash.Hash
+	sum := func() {
+		if h != nil {
+			got[len(got)-1].SHA256 = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if dec.err != nil {
+			// the scanner still returns the partial line read before a failed chunk
+			return nil, dec.err
+		}
+		line := scanner.Bytes()
+		if manifest != nil {
+			return nil, ErrExportChecksum
+		}
+		if bytes.HasPrefix(line, []byte(`{"$collection":`)) || bytes.HasPrefix(line, []byte(`{"$manifest":`)) {
+			marker := exportMarker{}
+			if err := json.Unmarshal(line, &marker); err != nil {
+				return nil, err
+			}
+			sum()
+			if marker.Manifest != nil {
+				manifest = marker.Manifest
+				continue
+			}
+			got = append(got, ExportedCollection{Name: marker.Collection})
+			h = sha256.New()
+			continue
+		}
+		if h == nil {
+			return nil, ErrExportChecksum
+		}
+		h.Write(line)
+		h.Write([]byte{'\n'})
+		got[len(got)-1].Count++
+		doc := bson.M{}
+		if err := bson.UnmarshalJSON(line, &doc); err != nil {
+			return nil, err
+		}
+		if err := fn(got[len(got)-1].Name, doc); err != nil {
+			return nil, err
+		}
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if manifest == nil || len(manifest.Collections) != len(got) {
+		return nil, ErrExportChecksum
+	}
+	for i, collection := range manifest.Collections {
+		if collection != got[i] {
+			return nil, ErrExportChecksum
+		}
+	}
+	return manifest, nil
+}
+
+// chunkWriter encrypts a stream by chunks, each one sealed with its position
+// in the nonce and the last one flagged, so reordered, dropped or truncated
+// chunks fail authentication
+type chunkWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newExportCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidExportKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newChunkWriter(w io.Writer, key []byte) (*chunkWriter, error) {
+	aead, err := newExportCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize()-4)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(exportMagic), prefix...)); err != nil {
+		return nil, err
+	}
+	return &chunkWriter{w: w, aead: aead, prefix: prefix}, nil
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		room := exportChunkSize - len(cw.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		cw.buf = append(cw.buf, p[:room]...)
+		p = p[room:]
+		if len(cw.buf) == exportChunkSize {
+			if err := cw.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close seals the last chunk, it does not close the underlying writer
+func (cw *chunkWriter) Close() error {
+	return cw.seal(true)
+}
+
+func (cw *chunkWriter) seal(final bool) error {
+	sealed := cw.aead.Seal(nil, chunkNonce(cw.prefix, cw.counter), cw.buf, chunkFlag(final))
+	length := uint32(len(sealed))
+	if final {
+		length |= exportFinalFlag
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, length)
+	if _, err := cw.w.Write(append(header, sealed...)); err != nil {
+		return err
+	}
+	cw.counter++
+	cw.buf = cw.buf[:0]
+	return nil
+}
+
+// chunkNonce returns the nonce of chunk counter
+func chunkNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, len(prefix)+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	return nonce
+}
+
+// chunkFlag returns the additional data authenticating whether a chunk is the last one
+func chunkFlag(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type chunkReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	final   bool
+	err     error
+}
+
+func newChunkReader(r io.Reader, key []byte) (*chunkReader, error) {
+	aead, err := newExportCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(exportMagic)+aead.NonceSize()-4)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:len(exportMagic)]) != exportMagic {
+		return nil, ErrInvalidExport
+	}
+	return &chunkReader{r: r, aead: aead, prefix: head[len(exportMagic):]}, nil
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.final {
+			return 0, io.EOF
+		}
+		if cr.err == nil {
+			cr.err = cr.open()
+		}
+		if cr.err != nil {
+			return 0, cr.err
+		}
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) open() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(cr.r, header); err != nil {
+		return ErrExportTampered
+	}
+	length := binary.BigEndian.Uint32(header)
+	final := length&exportFinalFlag != 0
+	length &^= exportFinalFlag
+	if length > exportChunkSize+uint32(cr.aead.Overhead()) {
+		return ErrExportTampered
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(cr.r, sealed); err != nil {
+		return ErrExportTampered
+	}
+	plain, err := cr.aead.Open(nil, chunkNonce(cr.prefix, cr.counter), sealed, chunkFlag(final))
+	if err != nil {
+		if cr.counter == 0 {
+			return ErrInvalidExport
+		}
+		return ErrExportTampered
+	}
+	cr.counter++
+	cr.buf = plain
+	cr.final = final
+	return nil
+}
@@ -0,0 +1,70 @@
+package mgodb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func writeTestExport(t *testing.T, key []byte, n int) []byte {
+	var buf bytes.Buffer
+	ew, err := newExportWriter(&buf, key)
+	assert.NoError(t, err)
+	assert.NoError(t, ew.begin("car"))
+	for i := 0; i < n; i++ {
+		assert.NoError(t, ew.write(bson.M{"_id": bson.NewObjectId(), "carId": int64(i), "name": bson.NewObjectId().Hex()}))
+	}
+	assert.NoError(t, ew.begin("owner"))
+	assert.NoError(t, ew.write(bson.M{"_id": 1, "name": "owner"}))
+	manifest, err := ew.close()
+	assert.NoError(t, err)
+	assert.Equal(t, n, manifest.Collections[0].Count)
+	assert.Equal(t, 1, manifest.Collections[1].Count)
+	return buf.Bytes()
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	// large enough to span several chunks
+	data := writeTestExport(t, key, 20000)
+	assert.True(t, len(data) > 2*exportChunkSize)
+	assert.False(t, bytes.Contains(data, []byte("owner")))
+
+	counts := map[string]int{}
+	manifest, err := readExport(bytes.NewReader(data), key, func(collection string, doc bson.M) error {
+		counts[collection]++
+		if collection == "car" {
+			assert.IsType(t, bson.ObjectId(""), doc["_id"])
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"car": 20000, "owner": 1}, counts)
+	assert.Len(t, manifest.Collections, 2)
+}
+
+func TestExportTampered(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	data := writeTestExport(t, key, 20000)
+	noop := func(string, bson.M) error { return nil }
+
+	_, err := readExport(bytes.NewReader(data), key[:16], noop)
+	assert.Equal(t, ErrInvalidExportKey, err)
+
+	other := make([]byte, 32)
+	_, err = readExport(bytes.NewReader(data), other, noop)
+	assert.Equal(t, ErrInvalidExport, err)
+
+	_, err = readExport(bytes.NewReader(data[:len(data)-10]), key, noop)
+	assert.Equal(t, ErrExportTampered, err)
+
+	changed := append([]byte(nil), data...)
+	changed[len(changed)-100] ^= 1
+	_, err = readExport(bytes.NewReader(changed), key, noop)
+	assert.Equal(t, ErrExportTampered, err)
+}
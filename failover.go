@@ -0,0 +1,186 @@
+package mgodb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+var (
+	ErrNoURI = errors.New("at least one connection uri is required")
+)
+
+// failover settings of InitFailover
+type FailoverOptions struct {
+	// how long the current cluster must stay unreachable before failing over, default 30s
+	After time.Duration
+	// interval of the reachability checks, default 5s
+	CheckInterval time.Duration
+	// called after failing over, with the redacted uris
+	OnFailover func(from string, to string)
+}
+
+// the failover watch of InitFailover, stopped by Close
+type failoverWatch struct {
+	sync.Mutex
+	done chan struct{}
+}
+
+// start returns the channel closed when the watch must stop
+func (w *failoverWatch) start() <-chan struct{} {
+	w.Lock()
+	defer w.Unlock()
+	w.done = make(chan struct{})
+	return w.done
+}
+
+func (w *failoverWatch) stop() {
+	w.Lock()
+	defer w.Unlock()
+	if w.done != nil {
+		close(w.done)
+		w.done = nil
+	}
+}
+
+// InitFailover is like Init with an ordered list of connection uris (primary cluster, DR cluster...):
+// it connects to the first reachable one, and when the current cluster stays unreachable
+// for opts.After it fails over to the next one, cycling through the list.
+// returns an error when no uri is reachable
+// for example:
+// InitFailover([]string{"mongodb://main/app", "mongodb://dr/app"}, 128, 30*time.Second, FailoverOptions{After: time.Minute})
+func (db *Database) InitFailover(uris []string, concurrent int, timeout time.Duration, opts FailoverOptions) error {
+	if len(uris) == 0 {
+		return ErrNoURI
+	}
+	if opts.After <= 0 {
+		opts.After = 30 * time.Second
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = 5 * time.Second
+	}
+
+	current := -1
+	var sess *mgo.Session
+	var err error
+	for i, uri := range uris {
+		if sess, err = dialFailover(uri, timeout); err == nil {
+			current = i
+			break
+		}
+		db.logWith(Fields{
+			"addr": redactURI(uri),
+			"err":  err,
+		}).Warn("mongodb: cannot connect, try the next uri")
+	}
+	if current < 0 {
+		db.logWith(Fields{
+			"err": err,
+		}).Error("mongodb: cannot connect")
+		return err
+	}
+
+	db.latch = make(chan *mgo.Session, concurrent)
+	db.setup(sess, uris[current], timeout)
+	go db.watchFailover(db.failover.start(), uris, current, timeout, opts)
+	return nil
+}
+
+func InitFailover(uris []string, concurrent int, timeout time.Duration, opts FailoverOptions) error {
+	return _db.InitFailover(uris, concurrent, timeout, opts)
+}
+
+func dialFailover(uri string, timeout time.Duration) (*mgo.Session, error) {
+	sess, err := mgo.DialWithTimeout(uri, timeout)
+	if err != nil {
+		return nil, err
+	}
+	sess.SetMode(mgo.Eventual, true)
+	return sess, nil
+}
+
+// watchFailover pings the current cluster and fails over when it stays unreachable,
+// until done is closed
+func (db *Database) watchFailover(done <-chan struct{}, uris []string, current int, timeout time.Duration, opts FailoverOptions) {
+	ticker := time.NewTicker(opts.CheckInterval)
+	defer ticker.Stop()
+
+	var downSince time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		probe := db.session.Load().Copy()
+		err := probe.Ping()
+		probe.Close()
+		if err == nil {
+			downSince = time.Time{}
+			continue
+		}
+		if downSince.IsZero() {
+			downSince = time.Now()
+		}
+		if time.Since(downSince) < opts.After || len(uris) < 2 {
+			continue
+		}
+
+		// the next reachable uri
+		for k := 1; k < len(uris); k++ {
+			next := (current + k) % len(uris)
+			sess, err := dialFailover(uris[next], timeout)
+			if err != nil {
+				db.logWith(Fields{
+					"addr": redactURI(uris[next]),
+					"err":  err,
+				}).Warn("mongodb: failover target unreachable")
+				continue
+			}
+
+			db.logWith(Fields{
+				"from": redactURI(uris[current]),
+				"to":   redactURI(uris[next]),
+			}).Warn("mongodb: failover")
+			db.switchSession(sess)
+			if opts.OnFailover != nil {
+				opts.OnFailover(redactURI(uris[current]), redactURI(uris[next]))
+			}
+			current = next
+			downSince = time.Time{}
+			break
+		}
+	}
+}
+
+// switchSession replaces the sessions of the pool and the partitions by copies of sess,
+// once the running operations gave the old ones back. sess keeps the read mode and
+// the write concern set on the old session
+func (db *Database) switchSession(sess *mgo.Session) {
+	old := db.session.Load()
+	sess.SetSocketTimeout(db.timeout)
+	sess.SetCursorTimeout(0)
+	sess.SetMode(old.Mode(), true)
+	sess.SetSafe(old.Safe())
+	db.session.Store(sess)
+
+	// no partition takes sessions of the default pool meanwhile
+	db.partitions.Lock()
+	defer db.partitions.Unlock()
+	sizes := map[chan *mgo.Session]int{db.latch: cap(db.latch) - db.partitions.reserved}
+	for _, latch := range db.partitions.latches {
+		sizes[latch] = cap(latch)
+	}
+
+	for latch, size := range sizes {
+		for k := 0; k < size; k++ {
+			(<-latch).Close()
+		}
+		for k := 0; k < size; k++ {
+			latch <- sess.Copy()
+		}
+	}
+	old.Close()
+}
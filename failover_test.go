@@ -0,0 +1,23 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitFailoverNoURI(t *testing.T) {
+	db := new(Database)
+	assert.Equal(t, ErrNoURI, db.InitFailover(nil, 1, time.Second, FailoverOptions{}))
+}
+
+func TestFailoverWatchStop(t *testing.T) {
+	db := new(Database)
+	done := db.failover.start()
+	db.Close()
+	db.failover.stop()
+
+	// returns at once once stopped
+	db.watchFailover(done, []string{"a", "b"}, 0, time.Second, FailoverOptions{CheckInterval: time.Hour})
+}
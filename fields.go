@@ -0,0 +1,80 @@
+package mgodb
+
+import (
+	"reflect"
+	"strings"
+)
+
+// bsonName returns the bson key of a struct field and whether it is inlined,
+// an empty name means the field is skipped by bson
+func bsonName(field reflect.StructField) (name string, inline bool) {
+	tag := field.Tag.Get("bson")
+	if tag == "-" {
+		return "", false
+	}
+	if tag == "" && strings.Index(string(field.Tag), ":") < 0 {
+		tag = string(field.Tag)
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			return "", true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], false
+	}
+	return strings.ToLower(field.Name), false
+}
+
+// fieldByBsonName finds the struct field stored under key name, inlined structs included
+func fieldByBsonName(val reflect.Value, name string) reflect.Value {
+	val = reflect.Indirect(val)
+	if val.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		key, inline := bsonName(field)
+		if inline {
+			if found := fieldByBsonName(val.Field(i), name); found.IsValid() {
+				return found
+			}
+			continue
+		}
+		if key == name {
+			return val.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// mgodbTag parses the `mgodb:"..."` tag of a field,
+// for example `mgodb:"preload,localField=carId"` returns
+// {"preload": "", "localField": "carId"}
+func mgodbTag(field reflect.StructField) map[string]string {
+	tag, ok := field.Tag.Lookup("mgodb")
+	if !ok {
+		return nil
+	}
+
+	opts := make(map[string]string)
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if i := strings.Index(part, "="); i >= 0 {
+			opts[part[:i]] = part[i+1:]
+		} else {
+			opts[part] = ""
+		}
+	}
+	return opts
+}
@@ -0,0 +1,64 @@
+package mgodb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fieldsInner struct {
+	CarId int64 `bson:"carId"`
+}
+
+type fieldsOuter struct {
+	fieldsInner `bson:",inline"`
+	Name        string
+	Cars        []int64 `bson:"cars,omitempty" mgodb:"preload,localField=carId"`
+}
+
+func TestFieldByBsonName(t *testing.T) {
+	obj := &fieldsOuter{Name: "xx"}
+	obj.CarId = 1
+	assert.Equal(t, int64(1), fieldByBsonName(reflect.ValueOf(obj), "carId").Interface())
+	assert.Equal(t, "xx", fieldByBsonName(reflect.ValueOf(obj), "name").Interface())
+	assert.False(t, fieldByBsonName(reflect.ValueOf(obj), "price").IsValid())
+}
+
+func TestMgodbTag(t *testing.T) {
+	field, _ := reflect.TypeOf(fieldsOuter{}).FieldByName("Cars")
+	assert.Equal(t, map[string]string{"preload": "", "localField": "carId"}, mgodbTag(field))
+	field, _ = reflect.TypeOf(fieldsOuter{}).FieldByName("Name")
+	assert.Nil(t, mgodbTag(field))
+}
+
+func (m fieldsOuter) DefaultSort() []string {
+	return []string{"-carId"}
+}
+
+func (m *fieldsOuter) MaxPageSize() int {
+	return 50
+}
+
+func TestModelDefaults(t *testing.T) {
+	assert.Equal(t, []string{"-carId"}, getDefaultSort(&[]*fieldsOuter{}))
+	assert.Equal(t, 50, getMaxPageSize(&[]fieldsOuter{}))
+	assert.Nil(t, getDefaultSort(&[]fieldsInner{}))
+	assert.Equal(t, 0, getMaxPageSize(&[]fieldsInner{}))
+}
+
+func TestCapPage(t *testing.T) {
+	for _, c := range []struct{ page, pageSize, max, wantPage, wantSize int }{
+		{2, 20, 0, 2, 20},
+		{-1, -1, 0, -1, -1},
+		{2, 20, 50, 2, 20},
+		{2, 100, 50, 2, 50},
+		{-1, -1, 50, 1, 50},
+		{1, 0, 50, 1, 50},
+		{0, 10, 50, 1, 10},
+	} {
+		page, pageSize := capPage(c.page, c.pageSize, c.max)
+		assert.Equal(t, c.wantPage, page)
+		assert.Equal(t, c.wantSize, pageSize)
+	}
+}
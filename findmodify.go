@@ -0,0 +1,167 @@
+package mgodb
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// FindOneAndUpdate atomically updates the record matching selector and decodes it into
+// result, as it was before the update or, with returnNew, after it. it returns
+// mgo.ErrNotFound when no record matches, for job-queue style claims
+// for example:
+// job := &Job{}
+// FindOneAndUpdate(job, bson.M{"status": "pending"}, bson.M{"$set": bson.M{"status": "running"}}, true)
+func (db *Database) FindOneAndUpdate(result interface{}, selector interface{}, update interface{}, returnNew bool) error {
+	return db.FindOneAndUpdateContext(context.Background(), result, selector, update, returnNew)
+}
+
+// FindOneAndUpdateContext is like FindOneAndUpdate, ctx bounds the wait for a session and the operation
+func (db *Database) FindOneAndUpdateContext(ctx context.Context, result interface{}, selector interface{}, update interface{}, returnNew bool) error {
+	if err := validateModel(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result":   result,
+			"selector": selector,
+			"err":      err,
+		}).Error("find and update db error: validate model fail")
+		return err
+	}
+	if err := db.checkWritable(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find and update db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, result, ActionUpdate, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find and update db error: policy denied")
+		return err
+	}
+	guarded, err := db.guardImmutable(result, update)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"update": update,
+			"err":    err,
+		}).Error("find and update db error: immutable field")
+		return err
+	}
+	if update, err = db.transformUpdate(result, guarded); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find and update db error: transform fail")
+		return err
+	}
+	if err := beforeUpdate(result, selector, update); err != nil {
+		db.logContext(ctx, Fields{
+			"result":   result,
+			"selector": selector,
+			"update":   update,
+			"err":      err,
+		}).Error("find and update db error: before update hook fail")
+		return err
+	}
+
+	collection := GetCollectionName(result)
+	pending := db.prepareDenorm(ctx, collection, selector, update, 1)
+	change := mgo.Change{Update: update, ReturnNew: returnNew}
+	start := time.Now()
+	err = db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).Find(selector).Apply(change, result)
+		return err
+	})
+	db.observe(ctx, "findAndUpdate", collection, selector, start, err)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			db.logContext(ctx, Fields{
+				"result":     result,
+				"selector":   selector,
+				"update":     update,
+				"collection": collection,
+				"err":        err,
+			}).Error("find and update db error: database operate fail")
+		}
+		return err
+	}
+	db.propagate(ctx, pending)
+	db.afterDecode(result)
+	return afterFind(result)
+}
+
+// FindOneAndDelete atomically removes the record matching selector and decodes it into
+// result, it returns mgo.ErrNotFound when no record matches
+func (db *Database) FindOneAndDelete(result interface{}, selector interface{}) error {
+	return db.FindOneAndDeleteContext(context.Background(), result, selector)
+}
+
+// FindOneAndDeleteContext is like FindOneAndDelete, ctx bounds the wait for a session and the operation
+func (db *Database) FindOneAndDeleteContext(ctx context.Context, result interface{}, selector interface{}) error {
+	if err := validateModel(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result":   result,
+			"selector": selector,
+			"err":      err,
+		}).Error("find and delete db error: validate model fail")
+		return err
+	}
+	if err := db.checkWritable(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find and delete db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(ctx, result, ActionRemove, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find and delete db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(result)
+	change := mgo.Change{Remove: true}
+	start := time.Now()
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).Find(selector).Apply(change, result)
+		return err
+	})
+	db.observe(ctx, "findAndDelete", collection, selector, start, err)
+	if err != nil {
+		if err != mgo.ErrNotFound {
+			db.logContext(ctx, Fields{
+				"result":     result,
+				"selector":   selector,
+				"collection": collection,
+				"err":        err,
+			}).Error("find and delete db error: database operate fail")
+		}
+		return err
+	}
+	db.afterDecode(result)
+	if err := afterFind(result); err != nil {
+		return err
+	}
+	return afterRemove(result, selector)
+}
+
+func FindOneAndUpdate(result interface{}, selector interface{}, update interface{}, returnNew bool) error {
+	return _db.FindOneAndUpdate(result, selector, update, returnNew)
+}
+
+func FindOneAndUpdateContext(ctx context.Context, result interface{}, selector interface{}, update interface{}, returnNew bool) error {
+	return _db.FindOneAndUpdateContext(ctx, result, selector, update, returnNew)
+}
+
+func FindOneAndDelete(result interface{}, selector interface{}) error {
+	return _db.FindOneAndDelete(result, selector)
+}
+
+func FindOneAndDeleteContext(ctx context.Context, result interface{}, selector interface{}) error {
+	return _db.FindOneAndDeleteContext(ctx, result, selector)
+}
@@ -0,0 +1,18 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFindOneAndModifyValidate(t *testing.T) {
+	db := &Database{}
+	assert.Equal(t, ErrModelNotPtr, db.FindOneAndUpdate(fieldsInner{}, bson.M{}, bson.M{"$set": bson.M{"carId": 1}}, true))
+	assert.Equal(t, ErrModelNotPtr, db.FindOneAndDelete(fieldsInner{}, bson.M{}))
+
+	db.SetReadOnly(&fieldsInner{}, true)
+	assert.Equal(t, ErrReadOnlyModel, db.FindOneAndUpdate(&fieldsInner{}, bson.M{}, bson.M{"$set": bson.M{"carId": 1}}, true))
+	assert.Equal(t, ErrReadOnlyModel, db.FindOneAndDelete(&fieldsInner{}, bson.M{}))
+}
@@ -0,0 +1,78 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// First finds into model the first record matching query in the ascending order of
+// sortField, the oldest by a time field, returns mgo.ErrNotFound when none matches
+// for example:
+// car := &Car{}
+// First(car, bson.M{"name": "xx"}, "created")
+func (db *Database) First(model interface{}, query interface{}, sortField string) error {
+	return db.FirstContext(context.Background(), model, query, sortField)
+}
+
+// FirstContext is like First, ctx bounds the wait for a session and the operation
+func (db *Database) FirstContext(ctx context.Context, model interface{}, query interface{}, sortField string) error {
+	return db.findEdge(ctx, model, query, sortField)
+}
+
+// Last is like First in the descending order of sortField, the newest by a time field
+func (db *Database) Last(model interface{}, query interface{}, sortField string) error {
+	return db.LastContext(context.Background(), model, query, sortField)
+}
+
+// LastContext is like Last, ctx bounds the wait for a session and the operation
+func (db *Database) LastContext(ctx context.Context, model interface{}, query interface{}, sortField string) error {
+	return db.findEdge(ctx, model, query, reverseSort(sortField))
+}
+
+// findEdge finds the first record in the order of sort through Find
+func (db *Database) findEdge(ctx context.Context, model interface{}, query interface{}, sort string) error {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"query": query,
+			"err":   err,
+		}).Error("find edge db error: validate model fail")
+		return err
+	}
+	results := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if err := db.FindContext(ctx, results.Interface(), query, 1, 1, []string{sort}); err != nil {
+		return err
+	}
+	if results.Elem().Len() == 0 {
+		return mgo.ErrNotFound
+	}
+	reflect.ValueOf(model).Elem().Set(results.Elem().Index(0).Elem())
+	return nil
+}
+
+// reverseSort returns the opposite order of a sort field
+func reverseSort(field string) string {
+	if strings.HasPrefix(field, "-") {
+		return field[1:]
+	}
+	return "-" + strings.TrimPrefix(field, "+")
+}
+
+func First(model interface{}, query interface{}, sortField string) error {
+	return _db.First(model, query, sortField)
+}
+
+func FirstContext(ctx context.Context, model interface{}, query interface{}, sortField string) error {
+	return _db.FirstContext(ctx, model, query, sortField)
+}
+
+func Last(model interface{}, query interface{}, sortField string) error {
+	return _db.Last(model, query, sortField)
+}
+
+func LastContext(ctx context.Context, model interface{}, query interface{}, sortField string) error {
+	return _db.LastContext(ctx, model, query, sortField)
+}
@@ -0,0 +1,13 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseSort(t *testing.T) {
+	assert.Equal(t, "-created", reverseSort("created"))
+	assert.Equal(t, "created", reverseSort("-created"))
+	assert.Equal(t, "-created", reverseSort("+created"))
+}
@@ -0,0 +1,246 @@
+package mgodb
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const flagCollection = "mgodb_flag"
+
+// flags are reloaded at most this often by default
+const defaultFlagRefresh = 30 * time.Second
+
+// a feature flag
+type Flag struct {
+	Name    string    `bson:"_id" json:"name"`
+	Enabled bool      `bson:"enabled" json:"enabled"`
+	Rollout int       `bson:"rollout" json:"rollout"`                 // percentage of users in [0, 100] when enabled, 0 means nobody
+	Users   []string  `bson:"users,omitempty" json:"users,omitempty"` // users always in, enabled or not
+	Updated time.Time `bson:"updated" json:"updated"`
+}
+
+// CollectionName is the collection of the flags, Watch needs it
+func (f *Flag) CollectionName() string {
+	return flagCollection
+}
+
+// on tells whether the flag is on for userId
+func (f *Flag) on(userId string) bool {
+	for _, user := range f.Users {
+		if user == userId {
+			return true
+		}
+	}
+	if !f.Enabled {
+		return false
+	}
+	if f.Rollout <= 0 {
+		return false
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	// the same user stays in or out of a rollout as it grows
+	h := fnv.New32a()
+	h.Write([]byte(f.Name + ":" + userId))
+	return int(h.Sum32()%100) < f.Rollout
+}
+
+// feature flags kept in the mgodb_flag collection, read from a cache.
+// the first load starts a Watch of the collection, the cache is reloaded after
+// every change, from this process or another one.
+// when the collection cannot be watched, or the watcher stopped, the cache is
+// reloaded once older than the refresh interval instead
+type FlagStore struct {
+	sync.Mutex
+	db      *Database
+	refresh time.Duration
+	loaded  time.Time
+	flags   map[string]*Flag
+	watcher *Watcher
+	watched bool          // a watch was started, or failed to
+	loading chan struct{} // closed once the load in progress ends
+}
+
+// Flags returns the feature flag store
+// for example:
+// db.Flags().Set(db.Flag{Name: "new-checkout", Enabled: true, Rollout: 10})
+// if db.Flags().Enabled("new-checkout", userId) { ... }
+func (db *Database) Flags() *FlagStore {
+	db.flags.Lock()
+	defer db.flags.Unlock()
+	db.flags.db = db
+	return &db.flags
+}
+
+func Flags() *FlagStore {
+	return _db.Flags()
+}
+
+// SetRefresh sets how often the flags are reloaded, 30s by default
+func (s *FlagStore) SetRefresh(interval time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.refresh = interval
+}
+
+// Enabled tells whether flag name is on for userId, an unknown flag is off.
+// when the flags cannot be loaded the last loaded ones are used
+func (s *FlagStore) Enabled(name string, userId string) bool {
+	flag, ok := s.Get(name)
+	return ok && flag.on(userId)
+}
+
+// Get returns flag name from the cache
+func (s *FlagStore) Get(name string) (Flag, bool) {
+	s.load()
+	s.Lock()
+	defer s.Unlock()
+	flag, ok := s.flags[name]
+	if !ok {
+		return Flag{}, false
+	}
+	return *flag, true
+}
+
+// All returns every flag from the cache
+func (s *FlagStore) All() []Flag {
+	s.load()
+	s.Lock()
+	defer s.Unlock()
+	result := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		result = append(result, *flag)
+	}
+	return result
+}
+
+// Set creates or replaces a flag
+func (s *FlagStore) Set(flag Flag) error {
+	flag.Updated = time.Now().UTC()
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(flagCollection).UpsertId(flag.Name, flag)
+		return err
+	})
+	s.invalidate()
+	return err
+}
+
+// Delete removes a flag, which turns it off
+func (s *FlagStore) Delete(name string) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(flagCollection).RemoveId(name)
+	})
+	s.invalidate()
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Refresh reloads the flags at once
+func (s *FlagStore) Refresh() error {
+	flags := []*Flag{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(flagCollection).Find(bson.M{}).All(&flags)
+	})
+	s.Lock()
+	defer s.Unlock()
+	// a failed load is retried after the interval, not on every read
+	s.loaded = time.Now()
+	if err != nil {
+		s.db.logWith(Fields{
+			"err": err,
+		}).Error("flags db error: load fail")
+		return err
+	}
+	s.flags = make(map[string]*Flag, len(flags))
+	for _, flag := range flags {
+		s.flags[flag.Name] = flag
+	}
+	return nil
+}
+
+// load reloads the stale cache, concurrent readers wait for a single reload
+func (s *FlagStore) load() {
+	s.Lock()
+	if s.fresh() {
+		s.Unlock()
+		return
+	}
+	if loading := s.loading; loading != nil {
+		s.Unlock()
+		<-loading
+		return
+	}
+	loading := make(chan struct{})
+	s.loading = loading
+	watch := !s.watched
+	s.watched = true
+	s.Unlock()
+
+	// watch before loading, a change in between reloads again
+	if watch {
+		s.watch()
+	}
+	s.Refresh()
+
+	s.Lock()
+	s.loading = nil
+	s.Unlock()
+	close(loading)
+}
+
+// fresh tells whether the cache is up to date, the lock is held
+func (s *FlagStore) fresh() bool {
+	if s.loaded.IsZero() {
+		return false
+	}
+	if s.watcher != nil && s.watcher.Err() == nil {
+		return true
+	}
+	refresh := s.refresh
+	if refresh <= 0 {
+		refresh = defaultFlagRefresh
+	}
+	return time.Since(s.loaded) < refresh
+}
+
+// watch starts the watcher invalidating the cache on change,
+// the flags fall back to the refresh interval when it fails
+func (s *FlagStore) watch() {
+	watcher, err := s.db.Watch(&Flag{}, nil, func(ChangeEvent) error {
+		s.invalidate()
+		return nil
+	})
+	if err != nil {
+		s.db.logWith(Fields{
+			"err": err,
+		}).Warn("flags watch fail, reload every refresh interval")
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.watcher = watcher
+}
+
+// close stops the watcher of the flags
+func (s *FlagStore) close() {
+	s.Lock()
+	watcher := s.watcher
+	s.watcher = nil
+	s.Unlock()
+	if watcher != nil {
+		watcher.Close()
+	}
+}
+
+func (s *FlagStore) invalidate() {
+	s.Lock()
+	defer s.Unlock()
+	s.loaded = time.Time{}
+}
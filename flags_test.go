@@ -0,0 +1,65 @@
+package mgodb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagOn(t *testing.T) {
+	flag := &Flag{Name: "checkout", Users: []string{"tester"}}
+	assert.True(t, flag.on("tester"))
+	assert.False(t, flag.on("user"))
+
+	// enabled for nobody until rolled out
+	flag.Enabled = true
+	assert.False(t, flag.on("user"))
+	assert.True(t, flag.on("tester"))
+	flag.Rollout = 100
+	assert.True(t, flag.on("user"))
+
+	flag.Rollout = 30
+	in := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if flag.on(user) {
+			in++
+			// the same user stays in
+			assert.True(t, flag.on(user))
+		}
+	}
+	assert.InDelta(t, 300, in, 60)
+}
+
+func TestFlagCache(t *testing.T) {
+	db := new(Database)
+	store := db.Flags()
+	store.SetRefresh(time.Hour)
+	store.loaded = time.Now()
+	store.flags = map[string]*Flag{"checkout": {Name: "checkout", Enabled: true, Rollout: 100}}
+	assert.True(t, store.Enabled("checkout", "user"))
+	assert.False(t, store.Enabled("search", "user"))
+	assert.Len(t, store.All(), 1)
+}
+
+func TestFlagLoadSingleFlight(t *testing.T) {
+	db := new(Database)
+	store := db.Flags()
+	loading := make(chan struct{})
+	store.loading = loading
+	done := make(chan struct{})
+	go func() {
+		// waits for the load in progress instead of loading again
+		store.load()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("load did not wait for the load in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(loading)
+	<-done
+}
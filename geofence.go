@@ -0,0 +1,169 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidFence = errors.New("geo fence requires a name and a polygon of at least 3 points")
+)
+
+// a longitude, latitude pair
+type GeoPoint struct {
+	Lng float64 `json:"lng"`
+	Lat float64 `json:"lat"`
+}
+
+// a named polygon, its last point joins its first
+type GeoFence struct {
+	Name    string     `json:"name"`
+	Polygon []GeoPoint `json:"polygon"`
+}
+
+// contains tells whether p is in the fence, by ray casting
+func (f GeoFence) contains(p GeoPoint) bool {
+	in := false
+	for i, j := 0, len(f.Polygon)-1; i < len(f.Polygon); j, i = i, i+1 {
+		a, b := f.Polygon[i], f.Polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			in = !in
+		}
+	}
+	return in
+}
+
+// a document entering or leaving a fence
+type GeoFenceEvent struct {
+	Fence   string      `json:"fence"`
+	Id      interface{} `json:"id"`
+	Point   GeoPoint    `json:"point"`
+	Entered bool        `json:"entered"` // false when the document left the fence
+}
+
+// GeoFenceWatcher evaluates location updates against registered fences and
+// reports the documents entering and leaving them
+type GeoFenceWatcher struct {
+	sync.Mutex
+	fences  map[string]GeoFence
+	inside  map[string]map[string]bool // fence name -> ids inside
+	handler func(GeoFenceEvent)
+}
+
+// NewGeoFenceWatcher returns a watcher passing the events to handler
+// for example:
+// w := NewGeoFenceWatcher(func(e GeoFenceEvent) { notify(e.Id, e.Fence, e.Entered) })
+// w.AddFence(GeoFence{Name: "depot", Polygon: points})
+// go w.Watch(ctx, &Courier{}, "location")
+func NewGeoFenceWatcher(handler func(GeoFenceEvent)) *GeoFenceWatcher {
+	return &GeoFenceWatcher{
+		fences:  make(map[string]GeoFence),
+		inside:  make(map[string]map[string]bool),
+		handler: handler,
+	}
+}
+
+// AddFence registers or replaces a fence, the documents inside a replaced fence are evaluated anew
+func (w *GeoFenceWatcher) AddFence(fence GeoFence) error {
+	if fence.Name == "" || len(fence.Polygon) < 3 {
+		return ErrInvalidFence
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.fences[fence.Name] = fence
+	w.inside[fence.Name] = make(map[string]bool)
+	return nil
+}
+
+// RemoveFence unregisters a fence, without leave events
+func (w *GeoFenceWatcher) RemoveFence(name string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.fences, name)
+	delete(w.inside, name)
+}
+
+// Observe evaluates a location update of document id, the handler gets
+// an event for every fence it entered or left
+func (w *GeoFenceWatcher) Observe(id interface{}, point GeoPoint) {
+	key := fmt.Sprint(id)
+	events := []GeoFenceEvent{}
+	w.Lock()
+	for name, fence := range w.fences {
+		in := fence.contains(point)
+		if in == w.inside[name][key] {
+			continue
+		}
+		if in {
+			w.inside[name][key] = true
+		} else {
+			delete(w.inside[name], key)
+		}
+		events = append(events, GeoFenceEvent{Fence: name, Id: id, Point: point, Entered: in})
+	}
+	w.Unlock()
+
+	for _, event := range events {
+		w.handler(event)
+	}
+}
+
+// Watch feeds the watcher with the locations, stored in field as a GeoJSON point or
+// a legacy [lng, lat] pair, of the documents of model as they change, through a Watch
+// of the collection, until ctx is done. deleted documents leave their fences without events.
+// it needs a replica set, see Watch.
+// returns ctx.Err(), or the error which stopped the watch
+func (w *GeoFenceWatcher) Watch(ctx context.Context, model interface{}, field string) error {
+	watcher, err := WatchContext(ctx, model, nil, func(ev ChangeEvent) error {
+		if ev.OperationType == ChangeDelete {
+			w.forget(ev.DocumentKey["_id"])
+			return nil
+		}
+		doc := bson.M{}
+		if err := ev.Decode(&doc); err != nil {
+			// removed since, its delete follows
+			return nil
+		}
+		if point, ok := geoPointOf(lookupPath(doc, field)); ok {
+			w.Observe(doc["_id"], point)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	<-watcher.Done()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return watcher.Err()
+}
+
+// forget drops document id from the fences it is in
+func (w *GeoFenceWatcher) forget(id interface{}) {
+	key := fmt.Sprint(id)
+	w.Lock()
+	defer w.Unlock()
+	for _, ids := range w.inside {
+		delete(ids, key)
+	}
+}
+
+// geoPointOf reads a GeoJSON point or a legacy [lng, lat] pair
+func geoPointOf(value interface{}) (GeoPoint, bool) {
+	if doc, ok := value.(bson.M); ok {
+		value = doc["coordinates"]
+	}
+	pair, ok := value.([]interface{})
+	if !ok || len(pair) != 2 {
+		return GeoPoint{}, false
+	}
+	lng, ok1 := pair[0].(float64)
+	lat, ok2 := pair[1].(float64)
+	return GeoPoint{Lng: lng, Lat: lat}, ok1 && ok2
+}
@@ -0,0 +1,41 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGeoFenceWatcher(t *testing.T) {
+	events := []GeoFenceEvent{}
+	w := NewGeoFenceWatcher(func(e GeoFenceEvent) { events = append(events, e) })
+	assert.Equal(t, ErrInvalidFence, w.AddFence(GeoFence{Name: "depot", Polygon: []GeoPoint{{0, 0}, {1, 1}}}))
+	assert.NoError(t, w.AddFence(GeoFence{Name: "depot", Polygon: []GeoPoint{{0, 0}, {10, 0}, {10, 10}, {0, 10}}}))
+
+	w.Observe(1, GeoPoint{Lng: 20, Lat: 5})
+	assert.Empty(t, events)
+	w.Observe(1, GeoPoint{Lng: 5, Lat: 5})
+	w.Observe(1, GeoPoint{Lng: 6, Lat: 5})
+	assert.Equal(t, []GeoFenceEvent{{Fence: "depot", Id: 1, Point: GeoPoint{5, 5}, Entered: true}}, events)
+	w.Observe(1, GeoPoint{Lng: 5, Lat: 11})
+	assert.Len(t, events, 2)
+	assert.False(t, events[1].Entered)
+
+	// a deleted document enters again once back
+	w.Observe(2, GeoPoint{Lng: 5, Lat: 5})
+	w.forget(2)
+	w.Observe(2, GeoPoint{Lng: 5, Lat: 5})
+	assert.Len(t, events, 4)
+	assert.True(t, events[3].Entered)
+}
+
+func TestGeoPointOf(t *testing.T) {
+	point, ok := geoPointOf(bson.M{"type": "Point", "coordinates": []interface{}{1.5, 2.5}})
+	assert.True(t, ok)
+	assert.Equal(t, GeoPoint{1.5, 2.5}, point)
+	_, ok = geoPointOf([]interface{}{1.5, 2.5})
+	assert.True(t, ok)
+	_, ok = geoPointOf("x")
+	assert.False(t, ok)
+}
@@ -0,0 +1,151 @@
+package mgodb
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// depth of traversed records, named to stay clear of model fields
+const traversalDepthField = "_mgodbDepth"
+
+// GraphLookupOptions describes a $graphLookup stage
+type GraphLookupOptions struct {
+	// collection searched recursively
+	From string
+	// expression the search starts with, such as "$parentId"
+	StartWith interface{}
+	// field of found records whose value continues the search
+	ConnectFromField string
+	// field matched against StartWith and ConnectFromField values
+	ConnectToField string
+	// field of the output array
+	As string
+	// recursion limit, 0 returns only the records matching StartWith, negative is unlimited
+	MaxDepth int
+	// when set, the recursion depth of every found record is saved in this field
+	DepthField string
+	// when set, only records matching it are searched
+	RestrictSearchWithMatch interface{}
+}
+
+// GraphLookup returns a $graphLookup stage for opts
+// for example:
+// GraphLookup(GraphLookupOptions{From: "category", StartWith: "$_id", ConnectFromField: "_id",
+// ConnectToField: "parentId", As: "descendants", MaxDepth: -1})
+func GraphLookup(opts GraphLookupOptions) bson.M {
+	stage := bson.M{
+		"from":             opts.From,
+		"startWith":        opts.StartWith,
+		"connectFromField": opts.ConnectFromField,
+		"connectToField":   opts.ConnectToField,
+		"as":               opts.As,
+	}
+	if opts.MaxDepth >= 0 {
+		stage["maxDepth"] = opts.MaxDepth
+	}
+	if opts.DepthField != "" {
+		stage["depthField"] = opts.DepthField
+	}
+	if opts.RestrictSearchWithMatch != nil {
+		stage["restrictSearchWithMatch"] = opts.RestrictSearchWithMatch
+	}
+	return bson.M{"$graphLookup": stage}
+}
+
+// TraversalNode is one record reached by Traverse, Depth 0 is connected directly to a start record
+type TraversalNode[T any] struct {
+	Doc   T
+	Depth int
+}
+
+// Traverse walks the collection of T from the records matching start, following
+// connectFromField of every reached record to the records whose connectToField matches it,
+// up to maxDepth (negative is unlimited). the start records are not part of the result,
+// nodes are ordered by depth, a record reachable from several start records appears once for each
+// for example:
+// category tree, descendants of a category:
+// Traverse[Category](bson.M{"_id": rootId}, "_id", "parentId", -1)
+// referral chain, referrers of a user:
+// Traverse[User](bson.M{"_id": userId}, "referrerId", "_id", -1)
+func Traverse[T any](start interface{}, connectFromField string, connectToField string, maxDepth int) ([]TraversalNode[T], error) {
+	var model T
+	if err := validateModel(&model); err != nil {
+		return nil, err
+	}
+	var selector interface{}
+	if err := _db.applyPolicy(context.Background(), &model, ActionAggregate, &selector); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("traverse db error: policy denied")
+		return nil, err
+	}
+
+	collection := GetCollectionName(&model)
+	piplines := traversePipeline(collection, start, selector, connectFromField, connectToField, maxDepth)
+	rows := []bson.Raw{}
+	begin := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(&rows)
+	})
+	_db.observe(context.Background(), "traverse", collection, piplines, begin, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"start":      start,
+			"err":        err,
+		}).Error("traverse db error: database operate fail")
+		return nil, err
+	}
+
+	nodes := make([]TraversalNode[T], len(rows))
+	for i, row := range rows {
+		depth := struct {
+			Depth int `bson:"_mgodbDepth"`
+		}{}
+		if err := row.Unmarshal(&nodes[i].Doc); err != nil {
+			return nil, err
+		}
+		if err := row.Unmarshal(&depth); err != nil {
+			return nil, err
+		}
+		nodes[i].Depth = depth.Depth
+		_db.afterDecode(&nodes[i].Doc)
+	}
+	return nodes, nil
+}
+
+// traversePipeline matches the start records, looks up the records reachable from them
+// and returns those, restricted by the policy selector
+func traversePipeline(collection string, start interface{}, selector interface{}, connectFromField string, connectToField string, maxDepth int) []bson.M {
+	opts := GraphLookupOptions{
+		From:             collection,
+		StartWith:        "$" + connectFromField,
+		ConnectFromField: connectFromField,
+		ConnectToField:   connectToField,
+		As:               "nodes",
+		MaxDepth:         maxDepth,
+		DepthField:       traversalDepthField,
+	}
+	if start == nil {
+		start = bson.M{}
+	}
+	piplines := []bson.M{{"$match": start}}
+	if match, ok := selector.(bson.M); ok && len(match) > 0 {
+		piplines = append(piplines, bson.M{"$match": match})
+		opts.RestrictSearchWithMatch = match
+	}
+	return append(piplines,
+		GraphLookup(opts),
+		bson.M{"$unwind": "$nodes"},
+		bson.M{"$replaceRoot": bson.M{"newRoot": "$nodes"}},
+		bson.M{"$sort": bson.M{traversalDepthField: 1}},
+	)
+}
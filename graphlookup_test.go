@@ -0,0 +1,45 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGraphLookup(t *testing.T) {
+	stage := GraphLookup(GraphLookupOptions{
+		From:             "category",
+		StartWith:        "$_id",
+		ConnectFromField: "_id",
+		ConnectToField:   "parentId",
+		As:               "descendants",
+		MaxDepth:         -1,
+	})
+	assert.Equal(t, bson.M{"$graphLookup": bson.M{
+		"from":             "category",
+		"startWith":        "$_id",
+		"connectFromField": "_id",
+		"connectToField":   "parentId",
+		"as":               "descendants",
+	}}, stage)
+
+	stage = GraphLookup(GraphLookupOptions{From: "user", StartWith: "$referrerId", MaxDepth: 0, DepthField: "level"})
+	assert.Equal(t, 0, stage["$graphLookup"].(bson.M)["maxDepth"])
+	assert.Equal(t, "level", stage["$graphLookup"].(bson.M)["depthField"])
+}
+
+func TestTraversePipeline(t *testing.T) {
+	piplines := traversePipeline("category", bson.M{"_id": 1}, bson.M{"tenant": "a"}, "_id", "parentId", 2)
+	assert.Equal(t, 6, len(piplines))
+	assert.Equal(t, bson.M{"$match": bson.M{"_id": 1}}, piplines[0])
+	assert.Equal(t, bson.M{"$match": bson.M{"tenant": "a"}}, piplines[1])
+	lookup := piplines[2]["$graphLookup"].(bson.M)
+	assert.Equal(t, "$_id", lookup["startWith"])
+	assert.Equal(t, 2, lookup["maxDepth"])
+	assert.Equal(t, bson.M{"tenant": "a"}, lookup["restrictSearchWithMatch"])
+
+	piplines = traversePipeline("category", nil, nil, "_id", "parentId", -1)
+	assert.Equal(t, 5, len(piplines))
+	assert.Equal(t, bson.M{"$match": bson.M{}}, piplines[0])
+}
@@ -0,0 +1,175 @@
+package mgodb
+
+import (
+	"context"
+	"io"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// prefix of the GridFS collections, <prefix>.files and <prefix>.chunks
+var GridFSPrefix = "fs"
+
+// a file stored in GridFS, as listed by ListFiles
+type FileInfo struct {
+	Id          interface{} `bson:"_id" json:"id"`
+	Name        string      `bson:"filename" json:"name"`
+	Length      int64       `bson:"length" json:"length"`
+	ChunkSize   int         `bson:"chunkSize" json:"chunkSize"`
+	UploadDate  time.Time   `bson:"uploadDate" json:"uploadDate"`
+	MD5         string      `bson:"md5" json:"md5"`
+	ContentType string      `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Metadata    bson.M      `bson:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// PutFile stores the content of r in GridFS under name with the metadata meta (may be nil),
+// on the connection pool of the database, and returns the id of the file
+// for example:
+// id, err := PutFile("car.jpg", f, bson.M{"carId": 1})
+func (db *Database) PutFile(name string, r io.Reader, meta bson.M) (interface{}, error) {
+	return db.PutFileContext(context.Background(), name, r, meta)
+}
+
+// PutFileContext is like PutFile, ctx bounds the wait for a session and the operation
+func (db *Database) PutFileContext(ctx context.Context, name string, r io.Reader, meta bson.M) (interface{}, error) {
+	var id interface{}
+	start := time.Now()
+	err := db.ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+		file, err := sess.DB("").GridFS(GridFSPrefix).Create(name)
+		if err != nil {
+			return err
+		}
+		if meta != nil {
+			file.SetMeta(meta)
+		}
+		if _, err := io.Copy(file, r); err != nil {
+			// a file closed after an error removes its chunks
+			file.Abort()
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		id = file.Id()
+		return nil
+	})
+	db.observe(ctx, "putFile", GridFSPrefix+".files", nil, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"name": name,
+			"err":  err,
+		}).Error("put file db error: database operate fail")
+		return nil, err
+	}
+	return id, nil
+}
+
+// GetFile writes the content of the GridFS file id to w,
+// returns mgo.ErrNotFound when there is no such file
+func (db *Database) GetFile(id interface{}, w io.Writer) error {
+	return db.GetFileContext(context.Background(), id, w)
+}
+
+// GetFileContext is like GetFile, ctx bounds the wait for a session and the operation
+func (db *Database) GetFileContext(ctx context.Context, id interface{}, w io.Writer) error {
+	start := time.Now()
+	err := db.execute(ctx, func(sess *mgo.Session) error {
+		file, err := sess.DB("").GridFS(GridFSPrefix).OpenId(id)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+	db.observe(ctx, "getFile", GridFSPrefix+".files", bson.M{"_id": id}, start, err)
+	if err != nil && err != mgo.ErrNotFound {
+		db.logContext(ctx, Fields{
+			"id":  id,
+			"err": err,
+		}).Error("get file db error: database operate fail")
+	}
+	return err
+}
+
+// RemoveFile removes the GridFS file id and its chunks
+func (db *Database) RemoveFile(id interface{}) error {
+	return db.RemoveFileContext(context.Background(), id)
+}
+
+// RemoveFileContext is like RemoveFile, ctx bounds the wait for a session and the operation
+func (db *Database) RemoveFileContext(ctx context.Context, id interface{}) error {
+	start := time.Now()
+	err := db.ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+		return sess.DB("").GridFS(GridFSPrefix).RemoveId(id)
+	})
+	db.observe(ctx, "removeFile", GridFSPrefix+".files", bson.M{"_id": id}, start, err)
+	if err != nil && err != mgo.ErrNotFound {
+		db.logContext(ctx, Fields{
+			"id":  id,
+			"err": err,
+		}).Error("remove file db error: database operate fail")
+	}
+	return err
+}
+
+// ListFiles returns the GridFS files matching query, on the fields of FileInfo
+// such as bson.M{"metadata.carId": 1}, the latest uploads first
+func (db *Database) ListFiles(query interface{}) ([]FileInfo, error) {
+	return db.ListFilesContext(context.Background(), query)
+}
+
+// ListFilesContext is like ListFiles, ctx bounds the wait for a session and the operation
+func (db *Database) ListFilesContext(ctx context.Context, query interface{}) ([]FileInfo, error) {
+	files := []FileInfo{}
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		return sess.DB("").GridFS(GridFSPrefix).Find(query).Sort("-uploadDate").All(&files)
+	})
+	db.observe(ctx, "listFiles", GridFSPrefix+".files", query, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"query": query,
+			"err":   err,
+		}).Error("list files db error: database operate fail")
+		return nil, err
+	}
+	return files, nil
+}
+
+func PutFile(name string, r io.Reader, meta bson.M) (interface{}, error) {
+	return _db.PutFile(name, r, meta)
+}
+
+func PutFileContext(ctx context.Context, name string, r io.Reader, meta bson.M) (interface{}, error) {
+	return _db.PutFileContext(ctx, name, r, meta)
+}
+
+func GetFile(id interface{}, w io.Writer) error {
+	return _db.GetFile(id, w)
+}
+
+func GetFileContext(ctx context.Context, id interface{}, w io.Writer) error {
+	return _db.GetFileContext(ctx, id, w)
+}
+
+func RemoveFile(id interface{}) error {
+	return _db.RemoveFile(id)
+}
+
+func RemoveFileContext(ctx context.Context, id interface{}) error {
+	return _db.RemoveFileContext(ctx, id)
+}
+
+func ListFiles(query interface{}) ([]FileInfo, error) {
+	return _db.ListFiles(query)
+}
+
+func ListFilesContext(ctx context.Context, query interface{}) ([]FileInfo, error) {
+	return _db.ListFilesContext(ctx, query)
+}
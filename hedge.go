@@ -0,0 +1,106 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type hedging struct {
+	sync.RWMutex
+	delays map[string]time.Duration
+}
+
+// EnableHedging turns on hedged reads for the collection of model: FindOne and Find
+// read from a secondary and, when no response came within delay, send the same read
+// on a second session and take the first response.
+// mgo selects the member of each session, so the hedge usually, not always, reaches another secondary.
+// only use it for replicated data which tolerates secondary reads, delay <= 0 turns hedging off
+// for example:
+// EnableHedging(&Car{}, 20*time.Millisecond)
+func (db *Database) EnableHedging(model interface{}, delay time.Duration) {
+	collection := GetCollectionName(model)
+	db.hedging.Lock()
+	defer db.hedging.Unlock()
+	if delay <= 0 {
+		delete(db.hedging.delays, collection)
+		return
+	}
+	if db.hedging.delays == nil {
+		db.hedging.delays = make(map[string]time.Duration)
+	}
+	db.hedging.delays[collection] = delay
+}
+
+func EnableHedging(model interface{}, delay time.Duration) {
+	_db.EnableHedging(model, delay)
+}
+
+type hedgeResult struct {
+	value reflect.Value
+	err   error
+}
+
+// readHedged runs the read f into result, hedged when the collection enabled it
+func (db *Database) readHedged(ctx context.Context, collection string, result interface{}, f func(sess *mgo.Session, result interface{}) error) error {
+	db.hedging.RLock()
+	delay, ok := db.hedging.delays[collection]
+	db.hedging.RUnlock()
+	// a pinned read goes to the primary, not hedged to secondaries
+	if !ok || db.Pinned(ctx) {
+		return db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+			return f(sess, result)
+		})
+	}
+
+	return db.execute(ctx, func(latched *mgo.Session) error {
+		// every attempt decodes into its own copy, the loser may still be running
+		val := reflect.ValueOf(result)
+		results := make(chan hedgeResult, 2)
+		attempt := func() {
+			sess := latched.Copy()
+			defer sess.Close()
+			sess.SetMode(mgo.Secondary, true)
+			out := reflect.New(val.Elem().Type())
+			out.Elem().Set(val.Elem())
+			results <- hedgeResult{out, f(sess, out.Interface())}
+		}
+
+		go attempt()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		pending := 1
+		hedged := false
+		var res hedgeResult
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				if !hedged {
+					hedged = true
+					pending++
+					go attempt()
+				}
+				continue
+			case res = <-results:
+				pending--
+			}
+			if res.err == nil || res.err == mgo.ErrNotFound || isDecodeError(res.err) {
+				break
+			}
+			// a failed first attempt is hedged at once
+			if !hedged {
+				hedged = true
+				pending++
+				go attempt()
+			}
+		}
+		if res.err == nil || isDecodeError(res.err) {
+			val.Elem().Set(res.value.Elem())
+		}
+		return res.err
+	})
+}
@@ -0,0 +1,18 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableHedging(t *testing.T) {
+	db := new(Database)
+	db.EnableHedging(&fieldsInner{}, 20*time.Millisecond)
+	assert.Equal(t, 20*time.Millisecond, db.hedging.delays["fields_inner"])
+
+	db.EnableHedging(&fieldsInner{}, 0)
+	_, ok := db.hedging.delays["fields_inner"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,78 @@
+package mgodb
+
+import (
+	"reflect"
+)
+
+// models implementing BeforeInsertHook get BeforeInsert called by Insert and InsertMany
+// before the record is written, an error aborts the insert.
+// it is the place for validation and defaults
+type BeforeInsertHook interface {
+	BeforeInsert() error
+}
+
+// models implementing AfterFindHook get AfterFind called on every record
+// decoded by FindOne, Find, FindIter and FindEach, an error is returned by the read
+type AfterFindHook interface {
+	AfterFind() error
+}
+
+// models implementing BeforeUpdateHook get BeforeUpdate called by UpdateOne
+// with its selector and update before the update is written, an error aborts the update
+type BeforeUpdateHook interface {
+	BeforeUpdate(selector interface{}, update interface{}) error
+}
+
+// models implementing AfterRemoveHook get AfterRemove called by RemoveOne
+// with its selector once a record is removed, an error is returned by RemoveOne
+type AfterRemoveHook interface {
+	AfterRemove(selector interface{}) error
+}
+
+func beforeInsert(model interface{}) error {
+	if hook, ok := model.(BeforeInsertHook); ok {
+		return hook.BeforeInsert()
+	}
+	return nil
+}
+
+// afterFind calls the AfterFind hook of result, a model or the address of a slice of models
+func afterFind(result interface{}) error {
+	if hook, ok := result.(AfterFindHook); ok {
+		return hook.AfterFind()
+	}
+	val := reflect.ValueOf(result)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	slice := val.Elem()
+	for i := 0; i < slice.Len(); i++ {
+		item := slice.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		if item.IsNil() {
+			continue
+		}
+		if hook, ok := item.Interface().(AfterFindHook); ok {
+			if err := hook.AfterFind(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func beforeUpdate(model interface{}, selector interface{}, update interface{}) error {
+	if hook, ok := model.(BeforeUpdateHook); ok {
+		return hook.BeforeUpdate(selector, update)
+	}
+	return nil
+}
+
+func afterRemove(model interface{}, selector interface{}) error {
+	if hook, ok := model.(AfterRemoveHook); ok {
+		return hook.AfterRemove(selector)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hookedModel struct {
+	Name  string `bson:"name"`
+	found int
+}
+
+func (m *hookedModel) BeforeInsert() error {
+	if m.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (m *hookedModel) AfterFind() error {
+	m.found++
+	return nil
+}
+
+func TestBeforeInsert(t *testing.T) {
+	assert.NotNil(t, beforeInsert(&hookedModel{}))
+	assert.Nil(t, beforeInsert(&hookedModel{Name: "x"}))
+	assert.Nil(t, beforeInsert(&fieldsInner{}))
+}
+
+func TestAfterFind(t *testing.T) {
+	model := &hookedModel{}
+	assert.Nil(t, afterFind(model))
+	assert.Equal(t, 1, model.found)
+
+	values := []hookedModel{{}, {}}
+	assert.Nil(t, afterFind(&values))
+	assert.Equal(t, 1, values[0].found)
+	assert.Equal(t, 1, values[1].found)
+
+	pointers := []*hookedModel{{}, nil}
+	assert.Nil(t, afterFind(&pointers))
+	assert.Equal(t, 1, pointers[0].found)
+
+	assert.Nil(t, afterFind(&[]fieldsInner{{}}))
+}
@@ -0,0 +1,185 @@
+package mgodb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrImmutableReplacement = errors.New("replacement update of a model with immutable fields")
+)
+
+// ImmutableFieldError is returned in strict mode by an update modifying a field
+// tagged `mgodb:"immutable"`
+type ImmutableFieldError struct {
+	Collection string
+	Field      string
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("field %s of %s is immutable", e.Field, e.Collection)
+}
+
+type immutableGuard struct {
+	sync.RWMutex
+	strict bool
+}
+
+// SetImmutableStrict chooses how UpdateOne and UpdateAll treat updates of fields tagged
+// `mgodb:"immutable"`: stripped from the update with a warning by default,
+// rejected with an *ImmutableFieldError in strict mode.
+// a replacement document, which would erase the immutable fields it leaves out,
+// is always rejected with ErrImmutableReplacement, use $set instead.
+// UpsertOne writes them only when it inserts the record
+// for example:
+// type Car struct {
+// CarId   int64     `bson:"carId" mgodb:"immutable"`
+// Created time.Time `bson:"created" mgodb:"immutable"`
+// }
+func (db *Database) SetImmutableStrict(strict bool) {
+	db.immutable.Lock()
+	defer db.immutable.Unlock()
+	db.immutable.strict = strict
+}
+
+func SetImmutableStrict(strict bool) {
+	_db.SetImmutableStrict(strict)
+}
+
+// immutableFields returns the bson paths of the fields of model tagged immutable
+func immutableFields(model interface{}) []string {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return immutablePaths(typ, "")
+}
+
+func immutablePaths(typ reflect.Type, prefix string) []string {
+	var paths []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			paths = append(paths, immutablePaths(field.Type, prefix)...)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if _, ok := mgodbTag(field)["immutable"]; ok {
+			paths = append(paths, prefix+name)
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			paths = append(paths, immutablePaths(field.Type, prefix+name+".")...)
+		}
+	}
+	return paths
+}
+
+// touches reports whether key updates the field at path, its parent or one of its children
+func touches(key string, path string) bool {
+	return key == path || strings.HasPrefix(key, path+".") || strings.HasPrefix(path, key+".")
+}
+
+func touchesAny(key string, paths []string) (string, bool) {
+	for _, path := range paths {
+		if touches(key, path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// guardImmutable returns update without the keys modifying immutable fields of model,
+// or an *ImmutableFieldError in strict mode or when nothing is left to update,
+// or ErrImmutableReplacement when update replaces the whole record
+func (db *Database) guardImmutable(model interface{}, update interface{}) (interface{}, error) {
+	paths := immutableFields(model)
+	if len(paths) == 0 || update == nil {
+		return update, nil
+	}
+	if isReplacement(update) {
+		return nil, ErrImmutableReplacement
+	}
+	doc, ok := update.(bson.M)
+	if !ok {
+		return update, nil
+	}
+
+	db.immutable.RLock()
+	strict := db.immutable.strict
+	db.immutable.RUnlock()
+
+	collection := GetCollectionName(model)
+	var violation *ImmutableFieldError
+	guarded := bson.M{}
+	for op, value := range doc {
+		fields, ok := value.(bson.M)
+		if !ok {
+			guarded[op] = value
+			continue
+		}
+		kept := bson.M{}
+		for key, v := range fields {
+			path, hit := touchesAny(key, paths)
+			if !hit && op == "$rename" {
+				if target, ok := v.(string); ok {
+					path, hit = touchesAny(target, paths)
+				}
+			}
+			if hit {
+				violation = &ImmutableFieldError{Collection: collection, Field: path}
+				continue
+			}
+			kept[key] = v
+		}
+		if len(kept) > 0 {
+			guarded[op] = kept
+		}
+	}
+
+	if violation == nil {
+		return update, nil
+	}
+	if strict || len(guarded) == 0 {
+		return nil, violation
+	}
+	db.logWith(Fields{
+		"collection": collection,
+		"field":      violation.Field,
+	}).Warn("mongodb: update of immutable field stripped")
+	return guarded, nil
+}
+
+// isReplacement reports whether update is a replacement document rather than update operators
+func isReplacement(update interface{}) bool {
+	switch doc := update.(type) {
+	case bson.M:
+		return !isOperatorDoc(doc)
+	case map[string]interface{}:
+		return !isOperatorDoc(doc)
+	case bson.D:
+		for _, elem := range doc {
+			if !strings.HasPrefix(elem.Name, "$") {
+				return true
+			}
+		}
+		return false
+	}
+	// a struct replaces the record
+	return true
+}
@@ -0,0 +1,71 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type immutableInner struct {
+	CarId int64 `bson:"carId" mgodb:"immutable"`
+}
+
+type immutableModel struct {
+	immutableInner `bson:",inline"`
+	Name           string    `bson:"name"`
+	Created        time.Time `bson:"created" mgodb:"immutable"`
+	Owner          struct {
+		OwnerId int64 `bson:"ownerId" mgodb:"immutable"`
+	} `bson:"owner"`
+}
+
+func TestImmutableFields(t *testing.T) {
+	assert.Equal(t, []string{"carId", "created", "owner.ownerId"}, immutableFields(&immutableModel{}))
+	assert.Nil(t, immutableFields(&fieldsInner{}))
+}
+
+func TestGuardImmutable(t *testing.T) {
+	db := &Database{}
+	model := &immutableModel{}
+
+	update := bson.M{"$set": bson.M{"name": "x"}}
+	guarded, err := db.guardImmutable(model, update)
+	assert.Nil(t, err)
+	assert.Equal(t, update, guarded)
+
+	guarded, err = db.guardImmutable(model, bson.M{"$set": bson.M{"name": "x", "carId": 2}, "$unset": bson.M{"owner": ""}})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$set": bson.M{"name": "x"}}, guarded)
+
+	_, err = db.guardImmutable(model, bson.M{"$rename": bson.M{"name": "created"}})
+	assert.Equal(t, &ImmutableFieldError{Collection: "immutable_model", Field: "created"}, err)
+
+	db.SetImmutableStrict(true)
+	_, err = db.guardImmutable(model, bson.M{"$set": bson.M{"name": "x", "owner.ownerId": 2}})
+	assert.Equal(t, &ImmutableFieldError{Collection: "immutable_model", Field: "owner.ownerId"}, err)
+}
+
+func TestGuardImmutableReplacement(t *testing.T) {
+	db := &Database{}
+	for _, update := range []interface{}{
+		bson.M{"name": "x"},
+		bson.M{},
+		map[string]interface{}{"name": "x"},
+		bson.D{{Name: "name", Value: "x"}},
+		&immutableModel{Name: "x"},
+	} {
+		_, err := db.guardImmutable(&immutableModel{}, update)
+		assert.Equal(t, ErrImmutableReplacement, err)
+	}
+
+	update := bson.D{{Name: "$set", Value: bson.M{"name": "x"}}}
+	guarded, err := db.guardImmutable(&immutableModel{}, update)
+	assert.Nil(t, err)
+	assert.Equal(t, update, guarded)
+
+	guarded, err = db.guardImmutable(&fieldsInner{}, bson.M{"name": "x"})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"name": "x"}, guarded)
+}
@@ -0,0 +1,164 @@
+package mgodb
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// interval of polling the index build progress
+var IndexPollInterval = time.Second
+
+// progress of an index build
+type IndexProgress struct {
+	Collection string `json:"collection"`
+	Index      string `json:"index"`
+	Done       int64  `json:"done"`
+	Total      int64  `json:"total"`
+	Message    string `json:"message"`
+	Finished   bool   `json:"finished"`
+}
+
+// build an index in the background and report the progress to progress (may be nil)
+// until the index is ready, so a deployment can wait for it before switching query paths
+// for example:
+// index := mgo.Index{Key: []string{"name", "-price"}}
+// BuildIndexOnline(&Car{}, index, func(p IndexProgress) {...})
+func (db *Database) BuildIndexOnline(model interface{}, index mgo.Index, progress func(IndexProgress)) error {
+	if err := validateModel(model); err != nil {
+		db.logWith(Fields{
+			"model": model,
+			"index": index,
+			"err":   err,
+		}).Error("build index error: validate model fail")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	index.Background = true
+	name := index.Name
+	if name == "" {
+		name = indexName(index.Key)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Execute(func(sess *mgo.Session) error {
+			return sess.DB("").C(collection).EnsureIndex(index)
+		})
+	}()
+
+	ticker := time.NewTicker(IndexPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				db.logWith(Fields{
+					"collection": collection,
+					"index":      index,
+					"err":        err,
+				}).Error("build index error: database operate fail")
+				return err
+			}
+			if progress != nil {
+				// the server names some kinds of indexes differently, such as text indexes
+				if built, err := db.indexNameOf(collection, index.Key); err == nil && built != "" {
+					name = built
+				}
+				progress(IndexProgress{Collection: collection, Index: name, Finished: true})
+			}
+			return nil
+		case <-ticker.C:
+			if progress == nil {
+				continue
+			}
+			if p, err := db.indexBuildProgress(collection); err == nil && p != nil {
+				p.Index = name
+				progress(*p)
+			}
+		}
+	}
+}
+
+func BuildIndexOnline(model interface{}, index mgo.Index, progress func(IndexProgress)) error {
+	return _db.BuildIndexOnline(model, index, progress)
+}
+
+// indexName returns the default name of an index of keys, as the server and mgo name it:
+// the fields joined with their direction or kind, "name_1_price_-1" for {"name", "-price"}
+func indexName(keys []string) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		field, kind := key, "1"
+		switch {
+		case strings.HasPrefix(key, "-"):
+			field, kind = key[1:], "-1"
+		case strings.HasPrefix(key, "+"):
+			field = key[1:]
+		case strings.HasPrefix(key, "$"):
+			if i := strings.Index(key, ":"); i > 0 {
+				field, kind = key[i+1:], key[1:i]
+			}
+		}
+		parts = append(parts, field+"_"+kind)
+	}
+	return strings.Join(parts, "_")
+}
+
+// indexNameOf returns the name of the index of collection on keys, "" if there is none
+func (db *Database) indexNameOf(collection string, keys []string) (string, error) {
+	var indexes []mgo.Index
+	err := db.Execute(func(sess *mgo.Session) error {
+		var err error
+		indexes, err = sess.DB("").C(collection).Indexes()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, index := range indexes {
+		if reflect.DeepEqual(index.Key, keys) {
+			return index.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// find the running index build of collection in currentOp
+func (db *Database) indexBuildProgress(collection string) (*IndexProgress, error) {
+	var result struct {
+		Inprog []struct {
+			Ns       string `bson:"ns"`
+			Msg      string `bson:"msg"`
+			Progress struct {
+				Done  int64 `bson:"done"`
+				Total int64 `bson:"total"`
+			} `bson:"progress"`
+		} `bson:"inprog"`
+	}
+
+	var ns string
+	err := db.Execute(func(sess *mgo.Session) error {
+		ns = sess.DB("").Name + "." + collection
+		return sess.DB("admin").Run(bson.D{{Name: "currentOp", Value: 1}}, &result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range result.Inprog {
+		if op.Ns == ns && strings.Contains(op.Msg, "Index Build") {
+			return &IndexProgress{
+				Collection: collection,
+				Done:       op.Progress.Done,
+				Total:      op.Progress.Total,
+				Message:    op.Msg,
+			}, nil
+		}
+	}
+	return nil, nil
+}
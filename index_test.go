@@ -0,0 +1,13 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexName(t *testing.T) {
+	assert.Equal(t, "name_1_price_-1", indexName([]string{"name", "-price"}))
+	assert.Equal(t, "carId_1", indexName([]string{"+carId"}))
+	assert.Equal(t, "loc_2dsphere_name_1", indexName([]string{"$2dsphere:loc", "name"}))
+}
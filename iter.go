@@ -0,0 +1,217 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Iter streams the records of a query one at a time, it holds a session
+// of the pool until Close, so always close it
+type Iter struct {
+	db         *Database
+	ctx        context.Context
+	collection string
+	query      interface{}
+	start      time.Time
+	cursor     *trackedCursor
+	release    func()
+	steps      map[int]Upgrade
+	writer     *upgradeWriter
+	sess       *mgo.Session
+	raw        bson.Raw
+	doc        bson.M
+	err        error
+	once       sync.Once
+}
+
+// Next fetches the next record, batches are fetched from the server as needed.
+// returns false when the records are exhausted or on error, see Err
+func (it *Iter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.raw, it.doc = bson.Raw{}, nil
+	if !it.cursor.Next(&it.raw) {
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+		}
+		return false
+	}
+	if it.steps == nil {
+		return true
+	}
+	doc := bson.M{}
+	if err := it.raw.Unmarshal(&doc); err != nil {
+		it.err = err
+		return false
+	}
+	if err := it.db.upgradeRecord(it.sess, it.collection, it.steps, it.writer, doc); err != nil {
+		it.err = err
+		return false
+	}
+	it.doc = doc
+	return true
+}
+
+// Decode decodes the record fetched by Next into result
+func (it *Iter) Decode(result interface{}) error {
+	var err error
+	if it.doc != nil {
+		err = remarshal(it.doc, result)
+	} else {
+		err = it.raw.Unmarshal(result)
+	}
+	if err != nil {
+		return err
+	}
+	it.db.afterDecode(result)
+	return afterFind(result)
+}
+
+// Err returns the error which stopped Next
+func (it *Iter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	if err := it.cursor.Err(); err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Close kills the server side cursor when it is not exhausted, returns the session
+// to the pool and returns the error which stopped Next. closing twice is safe
+func (it *Iter) Close() error {
+	it.once.Do(func() {
+		err := it.cursor.Close()
+		it.release()
+		if it.err == nil {
+			it.err = err
+		}
+		it.db.observe(context.Background(), "findIter", it.collection, it.query, it.start, it.err)
+		if it.err != nil && it.err != context.Canceled {
+			it.db.logWith(Fields{
+				"collection": it.collection,
+				"query":      it.query,
+				"err":        it.err,
+			}).Error("find iter db error: database operate fail")
+		}
+	})
+	return it.err
+}
+
+// FindIter returns an iterator over the records of the collection of model matching query,
+// for results too large to load at once. batchSize is the number of records per round
+// trip, 0 lets the server decide
+// for example:
+// iter, err := FindIter(&Car{}, bson.M{"price": bson.M{"$gt": 100}}, 1000)
+// defer iter.Close()
+// for iter.Next() {
+// car := &Car{}
+// iter.Decode(car) ...
+// }
+// err = iter.Err()
+func (db *Database) FindIter(model interface{}, query interface{}, batchSize int) (*Iter, error) {
+	return db.FindIterContext(context.Background(), model, query, batchSize)
+}
+
+// FindIterContext is like FindIter, when ctx is done the cursor is killed and Next returns false
+func (db *Database) FindIterContext(ctx context.Context, model interface{}, query interface{}, batchSize int) (*Iter, error) {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"query": query,
+			"err":   err,
+		}).Error("find iter db error: validate model fail")
+		return nil, err
+	}
+	if err := db.applyPolicy(ctx, model, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("find iter db error: policy denied")
+		return nil, err
+	}
+
+	sess, release, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sess.Refresh()
+	collection := GetCollectionName(model)
+	q, err := db.query(sess, collection, query)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	q = db.attribute(ctx, q.Sort(getDefaultSort(model)...))
+	if batchSize > 0 {
+		q = q.Batch(batchSize)
+	}
+	steps, _ := db.upgradesOf(collection)
+	return &Iter{
+		db:         db,
+		ctx:        ctx,
+		collection: collection,
+		query:      query,
+		start:      time.Now(),
+		cursor:     db.trackCursor(ctx, collection, q.Iter()),
+		release:    release,
+		steps:      steps,
+		writer:     db.upgradeWriterOf(ctx, model),
+		sess:       sess,
+	}, nil
+}
+
+// FindEach streams the records of the collection of model matching query, decoding every
+// one into a new value of the model type and passing it to fn.
+// an error returned by fn stops the iteration and is returned
+// for example:
+// FindEach(&Car{}, bson.M{}, func(doc interface{}) error {
+// car := doc.(*Car) ...
+// })
+func (db *Database) FindEach(model interface{}, query interface{}, fn func(doc interface{}) error) error {
+	return db.FindEachContext(context.Background(), model, query, fn)
+}
+
+// FindEachContext is like FindEach, when ctx is done the cursor is killed and ctx's error returned
+func (db *Database) FindEachContext(ctx context.Context, model interface{}, query interface{}, fn func(doc interface{}) error) error {
+	iter, err := db.FindIterContext(ctx, model, query, 0)
+	if err != nil {
+		return err
+	}
+	typ := reflect.TypeOf(model).Elem()
+	for iter.Next() {
+		doc := reflect.New(typ).Interface()
+		if err := iter.Decode(doc); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := fn(doc); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+func FindIter(model interface{}, query interface{}, batchSize int) (*Iter, error) {
+	return _db.FindIter(model, query, batchSize)
+}
+
+func FindIterContext(ctx context.Context, model interface{}, query interface{}, batchSize int) (*Iter, error) {
+	return _db.FindIterContext(ctx, model, query, batchSize)
+}
+
+func FindEach(model interface{}, query interface{}, fn func(doc interface{}) error) error {
+	return _db.FindEach(model, query, fn)
+}
+
+func FindEachContext(ctx context.Context, model interface{}, query interface{}, fn func(doc interface{}) error) error {
+	return _db.FindEachContext(ctx, model, query, fn)
+}
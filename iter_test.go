@@ -0,0 +1,23 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestIterDecode(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"carId": 1, "value": 2})
+	assert.Nil(t, err)
+	it := &Iter{db: &Database{}, raw: bson.Raw{Kind: 0x03, Data: data}}
+	result := &fieldsInner{}
+	assert.Nil(t, it.Decode(result))
+	assert.Equal(t, int64(1), result.CarId)
+
+	// upgraded records decode from the upgraded document
+	it.doc = bson.M{"carId": 3}
+	result = &fieldsInner{}
+	assert.Nil(t, it.Decode(result))
+	assert.Equal(t, int64(3), result.CarId)
+}
@@ -0,0 +1,168 @@
+package mgodb
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIdType = reflect.TypeOf(bson.ObjectId(""))
+)
+
+// JSONSchema converts the bson tags of a model into a $jsonSchema document,
+// fields without omitempty which are not pointers or interfaces are required
+// for example:
+// JSONSchema(&Car{})
+// returns bson.M{"bsonType": "object", "required": [...], "properties": {...}}
+func JSONSchema(model interface{}) bson.M {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typeSchema(typ)
+}
+
+func typeSchema(typ reflect.Type) bson.M {
+	nullable := false
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		nullable = true
+	}
+
+	schema := bson.M{}
+	switch {
+	case typ == timeType:
+		schema["bsonType"] = "date"
+	case typ == objectIdType:
+		schema["bsonType"] = "objectId"
+	case typ.Kind() == reflect.Interface:
+		return schema
+	case typ.Kind() == reflect.Struct:
+		properties := bson.M{}
+		required := []string{}
+		structSchema(typ, properties, &required)
+		schema["bsonType"] = "object"
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		schema["bsonType"] = "binData"
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		schema["bsonType"] = "array"
+		if items := typeSchema(typ.Elem()); len(items) > 0 {
+			schema["items"] = items
+		}
+	case typ.Kind() == reflect.Map:
+		schema["bsonType"] = "object"
+	case typ.Kind() == reflect.String:
+		schema["bsonType"] = "string"
+	case typ.Kind() == reflect.Bool:
+		schema["bsonType"] = "bool"
+	case typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Uint32 || typ.Kind() == reflect.Uint64:
+		schema["bsonType"] = "long"
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		// int is stored as int32 when it fits, long otherwise
+		schema["bsonType"] = []string{"int", "long"}
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		schema["bsonType"] = "double"
+	default:
+		return schema
+	}
+
+	if nullable {
+		schema["bsonType"] = appendNull(schema["bsonType"])
+	}
+	return schema
+}
+
+func appendNull(bsonType interface{}) interface{} {
+	switch t := bsonType.(type) {
+	case string:
+		return []string{t, "null"}
+	case []string:
+		return append(t, "null")
+	}
+	return bsonType
+}
+
+func structSchema(typ reflect.Type, properties bson.M, required *[]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			ftyp := field.Type
+			for ftyp.Kind() == reflect.Ptr {
+				ftyp = ftyp.Elem()
+			}
+			if ftyp.Kind() == reflect.Struct {
+				structSchema(ftyp, properties, required)
+			}
+			continue
+		}
+		if name == "" {
+			continue
+		}
+
+		properties[name] = typeSchema(field.Type)
+		omitempty := strings.Contains(field.Tag.Get("bson"), ",omitempty")
+		kind := field.Type.Kind()
+		if !omitempty && kind != reflect.Ptr && kind != reflect.Interface && kind != reflect.Map && kind != reflect.Slice {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// apply the $jsonSchema of a model as the validator of its collection by collMod,
+// creating the collection if it does not exist yet.
+// level is the validationLevel, "strict" or "moderate"
+// for example:
+// ApplyJSONSchema(&Car{}, "moderate")
+func ApplyJSONSchema(model interface{}, level string) error {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("apply json schema error: validate model fail")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	validator := bson.M{"$jsonSchema": JSONSchema(model)}
+	err := Execute(func(sess *mgo.Session) error {
+		names, err := sess.DB("").CollectionNames()
+		if err != nil {
+			return err
+		}
+		if !containsString(names, collection) {
+			return sess.DB("").Run(bson.D{
+				{Name: "create", Value: collection},
+				{Name: "validator", Value: validator},
+				{Name: "validationLevel", Value: level},
+			}, nil)
+		}
+		return sess.DB("").Run(bson.D{
+			{Name: "collMod", Value: collection},
+			{Name: "validator", Value: validator},
+			{Name: "validationLevel", Value: level},
+		}, nil)
+	})
+	if err != nil {
+		logWith(Fields{
+			"model":      model,
+			"collection": collection,
+			"validator":  validator,
+			"err":        err,
+		}).Error("apply json schema error: database operate fail")
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type schemaCar struct {
+	fieldsInner `bson:",inline"`
+	Name        string      `bson:"name"`
+	Price       float64     `bson:"price,omitempty"`
+	Remark      interface{} `bson:"remark"`
+	Tags        []string    `bson:"tags"`
+	Sold        *time.Time  `bson:"sold"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema(&schemaCar{})
+	assert.Equal(t, "object", schema["bsonType"])
+	assert.Equal(t, []string{"carId", "name"}, schema["required"])
+
+	properties := schema["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "long"}, properties["carId"])
+	assert.Equal(t, bson.M{"bsonType": "double"}, properties["price"])
+	assert.Equal(t, bson.M{}, properties["remark"])
+	assert.Equal(t, bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}}, properties["tags"])
+	assert.Equal(t, bson.M{"bsonType": []string{"date", "null"}}, properties["sold"])
+}
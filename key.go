@@ -0,0 +1,137 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrNoBusinessKey = errors.New("model declares no business key")
+)
+
+// BusinessKey returns the bson paths of the composite business key of model, the fields
+// tagged `mgodb:"key"` in declaration order, or those returned by a BusinessKey() []string
+// method of the model
+// for example:
+// type CarOwner struct {
+// CarId   int64 `bson:"carId" mgodb:"key"`
+// OwnerId int64 `bson:"ownerId" mgodb:"key"`
+// }
+func BusinessKey(model interface{}) []string {
+	if vals := callModelMethod(model, "BusinessKey"); len(vals) > 0 {
+		if key, ok := vals[0].Interface().([]string); ok && len(key) > 0 {
+			return key
+		}
+	}
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return keyPaths(typ, "")
+}
+
+func keyPaths(typ reflect.Type, prefix string) []string {
+	var paths []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			paths = append(paths, keyPaths(field.Type, prefix)...)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if _, ok := mgodbTag(field)["key"]; ok {
+			paths = append(paths, prefix+name)
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			paths = append(paths, keyPaths(field.Type, prefix+name+".")...)
+		}
+	}
+	return paths
+}
+
+// keySelector returns the selector matching the business key values of model
+func keySelector(model interface{}) (bson.M, error) {
+	key := BusinessKey(model)
+	if len(key) == 0 {
+		return nil, ErrNoBusinessKey
+	}
+	selector := bson.M{}
+	for _, path := range key {
+		field := reflect.ValueOf(model)
+		for _, name := range strings.Split(path, ".") {
+			field = fieldByBsonName(field, name)
+		}
+		if !field.IsValid() {
+			return nil, ErrNoBusinessKey
+		}
+		selector[path] = field.Interface()
+	}
+	return selector, nil
+}
+
+// UpsertByKey is UpsertOne with the selector built from the business key of model
+// for example:
+// UpsertByKey(&CarOwner{CarId: 1, OwnerId: 2, Remark: "xx"})
+func (db *Database) UpsertByKey(model interface{}) error {
+	return db.UpsertByKeyContext(context.Background(), model)
+}
+
+// UpsertByKeyContext is like UpsertByKey, ctx bounds the wait for a session and the operation
+func (db *Database) UpsertByKeyContext(ctx context.Context, model interface{}) error {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert by key db error: validate model fail")
+		return err
+	}
+	selector, err := keySelector(model)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert by key db error: business key fail")
+		return err
+	}
+	return db.UpsertOneContext(ctx, model, selector)
+}
+
+// EnsureKeyIndex creates the unique index on the business key of model
+func (db *Database) EnsureKeyIndex(model interface{}) error {
+	key := BusinessKey(model)
+	if len(key) == 0 {
+		return ErrNoBusinessKey
+	}
+	collection := GetCollectionName(model)
+	return db.ExecuteWriteContext(context.Background(), func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).EnsureIndex(mgo.Index{Key: key, Unique: true, Background: true})
+	})
+}
+
+func UpsertByKey(model interface{}) error {
+	return _db.UpsertByKey(model)
+}
+
+func UpsertByKeyContext(ctx context.Context, model interface{}) error {
+	return _db.UpsertByKeyContext(ctx, model)
+}
+
+func EnsureKeyIndex(model interface{}) error {
+	return _db.EnsureKeyIndex(model)
+}
@@ -0,0 +1,42 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type keyedModel struct {
+	fieldsInner `bson:",inline"`
+	OwnerId     int64  `bson:"ownerId" mgodb:"key"`
+	Remark      string `bson:"remark"`
+	Plate       struct {
+		Number string `bson:"number" mgodb:"key"`
+	} `bson:"plate"`
+}
+
+type methodKeyedModel struct {
+	Code string `bson:"code"`
+}
+
+func (m *methodKeyedModel) BusinessKey() []string {
+	return []string{"code"}
+}
+
+func TestBusinessKey(t *testing.T) {
+	assert.Equal(t, []string{"ownerId", "plate.number"}, BusinessKey(&keyedModel{}))
+	assert.Equal(t, []string{"code"}, BusinessKey(&methodKeyedModel{}))
+	assert.Nil(t, BusinessKey(&fieldsInner{}))
+}
+
+func TestKeySelector(t *testing.T) {
+	model := &keyedModel{OwnerId: 2, Remark: "xx"}
+	model.Plate.Number = "A1"
+	selector, err := keySelector(model)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"ownerId": int64(2), "plate.number": "A1"}, selector)
+
+	_, err = keySelector(&fieldsInner{})
+	assert.Equal(t, ErrNoBusinessKey, err)
+}
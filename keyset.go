@@ -0,0 +1,177 @@
+package mgodb
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+)
+
+// position of the last record of a page, ties of sortField are broken by _id
+type keysetCursor struct {
+	Value interface{} `bson:"v"`
+	Id    interface{} `bson:"i"`
+}
+
+// FindAfter finds into result up to limit records matching query in the order of sortField
+// ("-" prefixed for descending) after the position after, "" for the first page.
+// it returns the cursor of the next page, "" after the last one.
+// unlike skip pagination every page costs the same, given an index on sortField and _id
+// for example:
+// cars := []*Car{}
+// next, err := FindAfter(&cars, bson.M{}, "-created", "", 20)
+// next, err = FindAfter(&cars, bson.M{}, "-created", next, 20)
+func (db *Database) FindAfter(result interface{}, query interface{}, sortField string, after string, limit int) (string, error) {
+	return db.FindAfterContext(context.Background(), result, query, sortField, after, limit)
+}
+
+// FindAfterContext is like FindAfter, ctx bounds the wait for a session and the operation
+func (db *Database) FindAfterContext(ctx context.Context, result interface{}, query interface{}, sortField string, after string, limit int) (string, error) {
+	if err := validateSlice(result); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"query":  query,
+			"err":    err,
+		}).Error("find after db error: validate model fail")
+		return "", err
+	}
+	if err := db.applyPolicy(ctx, result, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"result": result,
+			"err":    err,
+		}).Error("find after db error: policy denied")
+		return "", err
+	}
+
+	field, desc := strings.TrimPrefix(strings.TrimPrefix(sortField, "-"), "+"), strings.HasPrefix(sortField, "-")
+	selector, err := keysetQuery(query, field, desc, after)
+	if err != nil {
+		return "", err
+	}
+	sorts := []string{field, "_id"}
+	if desc {
+		sorts = []string{"-" + field, "-_id"}
+	}
+
+	collection := GetCollectionName(result)
+	writer := db.upgradeWriterOf(ctx, result)
+	docs := []bson.M{}
+	start := time.Now()
+	err = db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		q, err := db.query(sess, collection, selector)
+		if err != nil {
+			return err
+		}
+		return db.allUpgraded(sess, collection, db.attribute(ctx, q.Sort(sorts...).Limit(limit)), &docs, writer)
+	})
+	db.observe(ctx, "findAfter", collection, selector, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"result":    result,
+			"query":     selector,
+			"sortField": sortField,
+			"err":       err,
+		}).Error("find after db error: database operate fail")
+		return "", err
+	}
+
+	slice := reflect.ValueOf(result).Elem()
+	items := reflect.MakeSlice(slice.Type(), 0, len(docs))
+	for _, doc := range docs {
+		item := reflect.New(slice.Type().Elem())
+		if err := remarshal(doc, item.Interface()); err != nil {
+			return "", err
+		}
+		items = reflect.Append(items, item.Elem())
+	}
+	slice.Set(items)
+	db.afterDecode(result)
+	if err := afterFind(result); err != nil {
+		return "", err
+	}
+
+	if limit <= 0 || len(docs) < limit {
+		return "", nil
+	}
+	last := docs[len(docs)-1]
+	return encodeCursor(keysetCursor{Value: lookupPath(last, field), Id: last["_id"]})
+}
+
+// keysetQuery restricts query to the records after the cursor after
+func keysetQuery(query interface{}, field string, desc bool, after string) (interface{}, error) {
+	if after == "" {
+		if query == nil {
+			return bson.M{}, nil
+		}
+		return query, nil
+	}
+	cursor, err := decodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+	// null and missing values sort before any other, and no comparison operator matches them
+	var next bson.M
+	switch {
+	case cursor.Value == nil && desc:
+		next = bson.M{field: nil, "_id": bson.M{op: cursor.Id}}
+	case cursor.Value == nil:
+		next = bson.M{"$or": []bson.M{
+			{field: bson.M{"$ne": nil}},
+			{field: nil, "_id": bson.M{op: cursor.Id}},
+		}}
+	default:
+		or := []bson.M{
+			{field: bson.M{op: cursor.Value}},
+			{field: cursor.Value, "_id": bson.M{op: cursor.Id}},
+		}
+		if desc {
+			or = append(or, bson.M{field: nil})
+		}
+		next = bson.M{"$or": or}
+	}
+	if query == nil {
+		return next, nil
+	}
+	return bson.M{"$and": []interface{}{query, next}}, nil
+}
+
+func encodeCursor(cursor keysetCursor) (string, error) {
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(token string) (keysetCursor, error) {
+	cursor := keysetCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func FindAfter(result interface{}, query interface{}, sortField string, after string, limit int) (string, error) {
+	return _db.FindAfter(result, query, sortField, after, limit)
+}
+
+func FindAfterContext(ctx context.Context, result interface{}, query interface{}, sortField string, after string, limit int) (string, error) {
+	return _db.FindAfterContext(ctx, result, query, sortField, after, limit)
+}
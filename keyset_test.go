@@ -0,0 +1,49 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestKeysetCursor(t *testing.T) {
+	token, err := encodeCursor(keysetCursor{Value: "bmw", Id: 7})
+	assert.Nil(t, err)
+	cursor, err := decodeCursor(token)
+	assert.Nil(t, err)
+	assert.Equal(t, keysetCursor{Value: "bmw", Id: 7}, cursor)
+
+	_, err = decodeCursor("not a cursor")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestKeysetQuery(t *testing.T) {
+	query, err := keysetQuery(nil, "name", false, "")
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{}, query)
+
+	token, _ := encodeCursor(keysetCursor{Value: "bmw", Id: 7})
+	query, err = keysetQuery(bson.M{"price": 1}, "name", true, token)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$and": []interface{}{
+		bson.M{"price": 1},
+		bson.M{"$or": []bson.M{
+			{"name": bson.M{"$lt": "bmw"}},
+			{"name": "bmw", "_id": bson.M{"$lt": 7}},
+			{"name": nil},
+		}},
+	}}, query)
+
+	// the last record of the page has a null or missing value
+	token, _ = encodeCursor(keysetCursor{Id: 7})
+	query, err = keysetQuery(nil, "name", false, token)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$or": []bson.M{
+		{"name": bson.M{"$ne": nil}},
+		{"name": nil, "_id": bson.M{"$gt": 7}},
+	}}, query)
+	query, err = keysetQuery(nil, "name", true, token)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"name": nil, "_id": bson.M{"$lt": 7}}, query)
+}
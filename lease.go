@@ -0,0 +1,150 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const leaseCollection = "mgodb_lease"
+
+var (
+	ErrLeaseHeld = errors.New("lease is held by another owner")
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// heartbeat document of a lease
+type leaseDoc struct {
+	Key     string    `bson:"_id"`
+	Owner   string    `bson:"owner"`
+	Expires time.Time `bson:"expires"`
+	Renewed time.Time `bson:"renewed"`
+}
+
+// a lease on a key held through a heartbeat document, the base of
+// claims, locks and leader election
+type LeaseHandle struct {
+	Key   string
+	TTL   time.Duration
+	Owner string
+
+	once sync.Once
+	lost chan struct{}
+}
+
+// Lease returns a lease on key with a unique owner, expiring ttl after its last renewal
+// for example, leader election:
+// lease := Lease("report-leader", 10*time.Second)
+// go lease.KeepAlive(ctx)
+// select { case <-lease.Lost(): ... }
+func Lease(key string, ttl time.Duration) *LeaseHandle {
+	return &LeaseHandle{Key: key, TTL: ttl, Owner: bson.NewObjectId().Hex(), lost: make(chan struct{})}
+}
+
+// Acquire takes the lease when it is free, expired or already ours,
+// returns ErrLeaseHeld when another owner holds it
+func (l *LeaseHandle) Acquire() error {
+	now := time.Now().UTC()
+	query := bson.M{"_id": l.Key, "$or": []bson.M{
+		{"owner": l.Owner},
+		{"expires": bson.M{"$lt": now}},
+	}}
+	doc := leaseDoc{Key: l.Key, Owner: l.Owner, Expires: now.Add(l.TTL), Renewed: now}
+	err := Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(leaseCollection).Upsert(query, doc)
+		return err
+	})
+	if mgo.IsDup(err) {
+		return ErrLeaseHeld
+	}
+	return err
+}
+
+// Renew extends the lease by its ttl, returns ErrLeaseLost when it expired or another owner took it
+func (l *LeaseHandle) Renew() error {
+	now := time.Now().UTC()
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(leaseCollection).Update(
+			bson.M{"_id": l.Key, "owner": l.Owner, "expires": bson.M{"$gte": now}},
+			bson.M{"$set": bson.M{"expires": now.Add(l.TTL), "renewed": now}})
+	})
+	if err == mgo.ErrNotFound {
+		l.markLost()
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// Release gives the lease up, if still ours
+func (l *LeaseHandle) Release() error {
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(leaseCollection).Remove(bson.M{"_id": l.Key, "owner": l.Owner})
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Lost is closed once the lease is lost
+func (l *LeaseHandle) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *LeaseHandle) markLost() {
+	l.once.Do(func() {
+		close(l.lost)
+	})
+}
+
+// KeepAlive acquires the lease and renews it every third of its ttl until ctx is done,
+// then releases it and returns ctx.Err().
+// returns ErrLeaseHeld when the lease cannot be acquired, and ErrLeaseLost when it was
+// lost, renewal errors included: once renewals fail for a whole ttl the lease is considered lost
+func (l *LeaseHandle) KeepAlive(ctx context.Context) error {
+	if err := l.Acquire(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := l.Release(); err != nil {
+				_db.logContext(ctx, Fields{
+					"key": l.Key,
+					"err": err,
+				}).Warn("lease release fail")
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := l.Renew()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if err == ErrLeaseLost {
+			_db.logContext(ctx, Fields{
+				"key":   l.Key,
+				"owner": l.Owner,
+			}).Warn("lease lost")
+			return err
+		}
+		_db.logContext(ctx, Fields{
+			"key": l.Key,
+			"err": err,
+		}).Warn("lease renew fail")
+		if time.Since(renewed) >= l.TTL {
+			l.markLost()
+			return ErrLeaseLost
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseLost(t *testing.T) {
+	a, b := Lease("leader", time.Second), Lease("leader", time.Second)
+	assert.NotEqual(t, a.Owner, b.Owner)
+
+	select {
+	case <-a.Lost():
+		t.Fatal("lease lost before use")
+	default:
+	}
+	a.markLost()
+	a.markLost()
+	_, open := <-a.Lost()
+	assert.False(t, open)
+}
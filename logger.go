@@ -0,0 +1,138 @@
+package mgodb
+
+import (
+	"context"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// log levels passed to Logger
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return "unknown"
+}
+
+// structured fields of a log entry
+type Fields map[string]interface{}
+
+// Logger receives all logs of the package, adapt it to zap, zerolog or
+// any other logging stack, the default logger discards everything
+type Logger interface {
+	Log(level Level, msg string, fields Fields)
+}
+
+// LoggerFunc adapts a function to Logger
+type LoggerFunc func(level Level, msg string, fields Fields)
+
+func (f LoggerFunc) Log(level Level, msg string, fields Fields) {
+	f(level, msg, fields)
+}
+
+// NopLogger discards all logs
+type NopLogger struct{}
+
+func (NopLogger) Log(level Level, msg string, fields Fields) {}
+
+// LogrusLogger writes logs to a logrus logger, the standard logger when Logger is nil
+type LogrusLogger struct {
+	Logger *logrus.Logger
+}
+
+func (l LogrusLogger) Log(level Level, msg string, fields Fields) {
+	logger := l.Logger
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	entry := logger.WithFields(logrus.Fields(fields))
+	switch level {
+	case DebugLevel:
+		entry.Debug(msg)
+	case InfoLevel:
+		entry.Info(msg)
+	case WarnLevel:
+		entry.Warn(msg)
+	default:
+		entry.Error(msg)
+	}
+}
+
+// SetLogger replaces the logger of the database, nil restores the no-op logger
+// for example:
+// SetLogger(LogrusLogger{})
+// Init(mongodb, 128, 30*time.Second)
+func (db *Database) SetLogger(logger Logger) {
+	if logger == nil {
+		db.logger.Store(nil)
+		return
+	}
+	db.logger.Store(&logger)
+}
+
+func SetLogger(logger Logger) {
+	_db.SetLogger(logger)
+}
+
+// a log entry with fields, logged by one of its level methods
+type logEntry struct {
+	logger Logger
+	fields Fields
+}
+
+func (db *Database) logWith(fields Fields) *logEntry {
+	var logger Logger = NopLogger{}
+	if p := db.logger.Load(); p != nil {
+		logger = *p
+	}
+	return &logEntry{logger: logger, fields: fields}
+}
+
+func logWith(fields Fields) *logEntry {
+	return _db.logWith(fields)
+}
+
+// logContext is logWith for an operation of ctx, its metadata (see WithMeta)
+// is logged with fields, fields win on a conflict
+func (db *Database) logContext(ctx context.Context, fields Fields) *logEntry {
+	meta := Meta(ctx)
+	if meta == nil {
+		return db.logWith(fields)
+	}
+	for k, v := range fields {
+		meta[k] = v
+	}
+	return db.logWith(meta)
+}
+
+func (e *logEntry) Debug(msg string) {
+	e.logger.Log(DebugLevel, msg, e.fields)
+}
+
+func (e *logEntry) Info(msg string) {
+	e.logger.Log(InfoLevel, msg, e.fields)
+}
+
+func (e *logEntry) Warn(msg string) {
+	e.logger.Log(WarnLevel, msg, e.fields)
+}
+
+func (e *logEntry) Error(msg string) {
+	e.logger.Log(ErrorLevel, msg, e.fields)
+}
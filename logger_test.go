@@ -0,0 +1,53 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	db := new(Database)
+	db.logWith(Fields{"k": "v"}).Error("discarded by the default logger")
+
+	var level Level
+	var msg string
+	var fields Fields
+	db.SetLogger(LoggerFunc(func(l Level, m string, f Fields) {
+		level, msg, fields = l, m, f
+	}))
+	db.logWith(Fields{"k": "v"}).Warn("warn")
+	assert.Equal(t, WarnLevel, level)
+	assert.Equal(t, "warn", msg)
+	assert.Equal(t, Fields{"k": "v"}, fields)
+	assert.Equal(t, "warn", level.String())
+
+	ctx := WithMeta(WithMeta(context.Background(), "requestId", "abc"), "k", "meta")
+	db.logContext(ctx, Fields{"k": "v"}).Info("info")
+	assert.Equal(t, Fields{"requestId": "abc", "k": "v"}, fields)
+	db.logContext(context.Background(), Fields{"k": "v"}).Info("info")
+	assert.Equal(t, Fields{"k": "v"}, fields)
+
+	db.SetLogger(nil)
+	db.logWith(Fields{"k": "other"}).Error("discarded")
+	assert.Equal(t, Fields{"k": "v"}, fields)
+}
+
+func TestSetLoggerConcurrent(t *testing.T) {
+	db := new(Database)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			db.SetLogger(NopLogger{})
+		}()
+		go func() {
+			defer wg.Done()
+			db.logWith(Fields{"k": "v"}).Info("info")
+		}()
+	}
+	wg.Wait()
+}
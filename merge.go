@@ -0,0 +1,168 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// attempts of UpsertMerge before it gives up
+const mergeRetries = 5
+
+var (
+	ErrMergeConflict  = errors.New("record kept changing while merging")
+	ErrNoVersionField = errors.New("model has neither a field tagged `mgodb:\"version\"` nor an Updated field")
+)
+
+// the field guarding a record against concurrent merges: the integer or time field
+// tagged `mgodb:"version"`, the Updated field by default
+func versionField(model interface{}) string {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := mgodbTag(typ.Field(i))["version"]; ok {
+			if name, _ := bsonName(typ.Field(i)); name != "" {
+				return name
+			}
+		}
+	}
+	if field, ok := typ.FieldByName("Updated"); ok {
+		name, _ := bsonName(field)
+		return name
+	}
+	return ""
+}
+
+// bumpVersion increments an integer version, or sets a time one to now
+func bumpVersion(val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.SetInt(val.Int() + 1)
+	default:
+		if val.Type() == reflect.TypeOf(time.Time{}) {
+			val.Set(reflect.ValueOf(time.Now().UTC()))
+		}
+	}
+}
+
+// UpsertMerge inserts model when no record matches selector, otherwise loads the
+// current record, lets merge fold model into it and replaces the record, unless it
+// changed meanwhile, according to its version field. on a concurrent change, or a
+// duplicate key when two inserts raced, it starts over, up to 5 times, then returns
+// ErrMergeConflict. model holds the stored record on success.
+// for idempotent ingestion of overlapping feeds
+// for example:
+// UpsertMerge(price, bson.M{"sku": sku}, func(current interface{}, incoming interface{}) error {
+// cur, in := current.(*Price), incoming.(*Price)
+// if in.Seen.After(cur.Seen) { cur.Amount, cur.Seen = in.Amount, in.Seen }
+// return nil
+// })
+func UpsertMerge(model interface{}, selector bson.M, merge func(current interface{}, incoming interface{}) error) error {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model":    model,
+			"selector": selector,
+			"err":      err,
+		}).Error("upsert merge db error: validate model fail")
+		return err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert merge db error: model is read-only")
+		return err
+	}
+	var query interface{} = selector
+	if err := _db.applyPolicy(context.Background(), model, ActionUpsert, &query); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("upsert merge db error: policy denied")
+		return err
+	}
+	field := versionField(model)
+	if field == "" {
+		return ErrNoVersionField
+	}
+
+	collection := GetCollectionName(model)
+	typ := reflect.TypeOf(model).Elem()
+	for attempt := 0; attempt < mergeRetries; attempt++ {
+		// the version compared on write must be the latest one, read on the primary
+		raw := bson.M{}
+		err := ExecuteContext(WithReadMode(context.Background(), mgo.Strong), func(sess *mgo.Session) error {
+			q, err := _db.query(sess, collection, query)
+			if err != nil {
+				return err
+			}
+			return q.One(&raw)
+		})
+		if err == mgo.ErrNotFound {
+			if version := fieldByBsonName(reflect.ValueOf(model), field); version.IsValid() {
+				bumpVersion(version)
+			}
+			err = Insert(model)
+			if mgo.IsDup(err) {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"selector":   query,
+				"err":        err,
+			}).Error("upsert merge db error: database operate fail")
+			return err
+		}
+
+		current := reflect.New(typ)
+		data, err := bson.Marshal(raw)
+		if err == nil {
+			err = bson.Unmarshal(data, current.Interface())
+		}
+		if err != nil {
+			return err
+		}
+		if err := merge(current.Interface(), model); err != nil {
+			return err
+		}
+		if version := fieldByBsonName(current, field); version.IsValid() {
+			bumpVersion(version)
+		}
+		if err := _db.beforeWrite(collection, current.Interface()); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		cond := bson.M{"_id": raw["_id"], field: raw[field]}
+		err = _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+			return sess.DB("").C(collection).Update(cond, current.Interface())
+		})
+		_db.observe(context.Background(), "upsertMerge", collection, query, start, err)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"selector":   query,
+				"err":        err,
+			}).Error("upsert merge db error: database operate fail")
+			return err
+		}
+		reflect.ValueOf(model).Elem().Set(current.Elem())
+		return nil
+	}
+	return ErrMergeConflict
+}
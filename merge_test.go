@@ -0,0 +1,32 @@
+package mgodb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mergeVersioned struct {
+	Rev     int       `bson:"rev" mgodb:"version"`
+	Updated time.Time `bson:"updated"`
+}
+
+type mergeUpdated struct {
+	Updated time.Time `bson:"updated"`
+}
+
+func TestVersionField(t *testing.T) {
+	assert.Equal(t, "rev", versionField(&mergeVersioned{}))
+	assert.Equal(t, "updated", versionField(&mergeUpdated{}))
+	assert.Equal(t, "", versionField(&fieldsInner{}))
+}
+
+func TestBumpVersion(t *testing.T) {
+	doc := &mergeVersioned{Rev: 2}
+	bumpVersion(reflect.ValueOf(doc).Elem().Field(0))
+	assert.Equal(t, 3, doc.Rev)
+	bumpVersion(reflect.ValueOf(doc).Elem().Field(1))
+	assert.WithinDuration(t, time.Now(), doc.Updated, time.Second)
+}
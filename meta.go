@@ -0,0 +1,84 @@
+package mgodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type metaKey struct{}
+
+// WithMeta returns a copy of ctx carrying key=value as operation metadata
+// (actor id, request id...), which hooks, audit logs and query comments
+// use to attribute operations
+// for example:
+// ctx = WithMeta(ctx, "requestId", requestId)
+// ctx = WithMeta(ctx, "actorId", userId)
+func WithMeta(ctx context.Context, key string, value interface{}) context.Context {
+	parent, _ := ctx.Value(metaKey{}).(Fields)
+	meta := make(Fields, len(parent)+1)
+	for k, v := range parent {
+		meta[k] = v
+	}
+	meta[key] = value
+	return context.WithValue(ctx, metaKey{}, meta)
+}
+
+// Meta returns a copy of the operation metadata of ctx, nil if none
+func Meta(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	meta, _ := ctx.Value(metaKey{}).(Fields)
+	if meta == nil {
+		return nil
+	}
+	result := make(Fields, len(meta))
+	for k, v := range meta {
+		result[k] = v
+	}
+	return result
+}
+
+// MetaValue returns one metadata value of ctx, nil if missing
+func MetaValue(ctx context.Context, key string) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	meta, _ := ctx.Value(metaKey{}).(Fields)
+	return meta[key]
+}
+
+// MetaComment formats the metadata of ctx as a query comment, keys sorted
+// for example: "actorId=1 requestId=abc"
+func MetaComment(ctx context.Context) string {
+	meta := Meta(ctx)
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, meta[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// CommentQuery tags q with the metadata comment of ctx, so the operation
+// can be attributed in the server logs and the profiler. the find queries of
+// mgodb are tagged already, with the app name (see SetAppName), it is meant for Execute
+// for example:
+// Execute(func(sess *mgo.Session) error {
+// return CommentQuery(ctx, sess.DB("").C("car").Find(query)).All(&result)
+// })
+func CommentQuery(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if comment := MetaComment(ctx); comment != "" {
+		return q.Comment(comment)
+	}
+	return q
+}
@@ -0,0 +1,22 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeta(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, Meta(ctx))
+	assert.Equal(t, "", MetaComment(ctx))
+
+	ctx1 := WithMeta(ctx, "requestId", "abc")
+	ctx2 := WithMeta(ctx1, "actorId", 1)
+	assert.Equal(t, Fields{"requestId": "abc"}, Meta(ctx1))
+	assert.Equal(t, Fields{"requestId": "abc", "actorId": 1}, Meta(ctx2))
+	assert.Equal(t, 1, MetaValue(ctx2, "actorId"))
+	assert.Nil(t, MetaValue(ctx1, "actorId"))
+	assert.Equal(t, "actorId=1 requestId=abc", MetaComment(ctx2))
+}
@@ -0,0 +1,94 @@
+package mgodb
+
+import (
+	"math/rand"
+	"path"
+	"sync"
+)
+
+// which collections are instrumented by the query statistics and at what rate.
+// patterns follow path.Match, for example "car_*"
+type MetricsConfig struct {
+	// instrumented collections, all collections when empty
+	Collections []string
+	// collections never instrumented
+	Exclude []string
+	// fraction of operations recorded, 0 means 1 (record all)
+	SampleRate float64
+	// sample rates overriding SampleRate per collection pattern,
+	// the longest pattern matching a collection wins
+	SampleRates map[string]float64
+	// labels replacing collection names matching a pattern,
+	// so dynamically named partitions collapse into one label,
+	// the longest pattern matching a collection wins
+	// for example: {"car_*": "car_partition"}
+	Labels map[string]string
+}
+
+type metricsFilter struct {
+	sync.RWMutex
+	config MetricsConfig
+}
+
+// label returns the collection label and whether this operation should be recorded
+func (m *metricsFilter) label(collection string) (string, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if len(m.config.Collections) > 0 && !matchAny(m.config.Collections, collection) {
+		return "", false
+	}
+	if matchAny(m.config.Exclude, collection) {
+		return "", false
+	}
+
+	rate := m.config.SampleRate
+	if pattern, ok := mostSpecific(m.config.SampleRates, collection); ok {
+		rate = m.config.SampleRates[pattern]
+	}
+	if rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return "", false
+	}
+
+	if pattern, ok := mostSpecific(m.config.Labels, collection); ok {
+		return m.config.Labels[pattern], true
+	}
+	return collection, true
+}
+
+// mostSpecific returns the longest pattern of patterns matching name,
+// the first in order of equally long ones, so overlapping patterns resolve the same way every time
+func mostSpecific[T any](patterns map[string]T, name string) (string, bool) {
+	best, found := "", false
+	for pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); !ok {
+			continue
+		}
+		if !found || len(pattern) > len(best) || len(pattern) == len(best) && pattern < best {
+			best, found = pattern, true
+		}
+	}
+	return best, found
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMetricsConfig configures the collections instrumented by the query statistics
+// for example:
+// SetMetricsConfig(MetricsConfig{Exclude: []string{"tmp_*"}, SampleRate: 0.1, Labels: map[string]string{"car_*": "car_partition"}})
+func (db *Database) SetMetricsConfig(config MetricsConfig) {
+	db.metrics.Lock()
+	defer db.metrics.Unlock()
+	db.metrics.config = config
+}
+
+func SetMetricsConfig(config MetricsConfig) {
+	_db.SetMetricsConfig(config)
+}
@@ -0,0 +1,44 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsLabel(t *testing.T) {
+	m := new(metricsFilter)
+	label, ok := m.label("car")
+	assert.True(t, ok)
+	assert.Equal(t, "car", label)
+
+	m.config = MetricsConfig{
+		Collections: []string{"car*"},
+		Exclude:     []string{"car_tmp"},
+		SampleRates: map[string]float64{"car_debug": 0.000001},
+		Labels:      map[string]string{"car_2*": "car_partition"},
+	}
+	label, ok = m.label("car_2024")
+	assert.True(t, ok)
+	assert.Equal(t, "car_partition", label)
+	_, ok = m.label("owner")
+	assert.False(t, ok)
+	_, ok = m.label("car_tmp")
+	assert.False(t, ok)
+	_, ok = m.label("car_debug")
+	assert.False(t, ok)
+
+	// overlapping patterns resolve to the longest one every time
+	m.config = MetricsConfig{
+		SampleRates: map[string]float64{"part_*": 0.000001, "part_2024*": 1},
+		Labels:      map[string]string{"part_*": "part", "part_2024*": "part_2024", "*": "any"},
+	}
+	for i := 0; i < 100; i++ {
+		label, ok = m.label("part_2024_01")
+		assert.True(t, ok)
+		assert.Equal(t, "part_2024", label)
+	}
+	pattern, ok := mostSpecific(map[string]int{"a?c": 1, "ab*": 2}, "abc")
+	assert.True(t, ok)
+	assert.Equal(t, "a?c", pattern)
+}
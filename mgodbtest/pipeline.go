@@ -0,0 +1,999 @@
+// Package mgodbtest provides helpers to test code built on mgodb without a server.
+package mgodbtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported by the in-memory pipeline")
+)
+
+// Run evaluates pipeline on docs in memory and returns the output documents.
+// it covers the common stages: $match, $project, $addFields, $set, $unset, $group,
+// $sort, $skip, $limit, $count and $unwind, with field paths and the
+// arithmetic, comparison and string expressions most pipelines use.
+// anything else returns an error wrapping ErrUnsupported.
+// use bson.D for $sort with several keys, bson.M has no key order
+// for example:
+// out, err := Run(docs, []bson.M{{"$match": bson.M{"price": bson.M{"$gt": 10}}}, {"$group": bson.M{"_id": "$name", "n": bson.M{"$sum": 1}}}})
+func Run(docs []bson.M, pipeline []bson.M) ([]bson.M, error) {
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("%w: stage with %d keys", ErrUnsupported, len(stage))
+		}
+		var err error
+		for name, spec := range stage {
+			docs, err = runStage(docs, name, spec)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// RunInto is like Run with docs and result of any type encodable to bson:
+// docs a slice of models or documents, result a pointer to a slice
+// for example:
+// result := []*CarOverview{}
+// err := RunInto([]*Car{car1, car2}, pipeline, &result)
+func RunInto(docs interface{}, pipeline []bson.M, result interface{}) error {
+	val := reflect.ValueOf(docs)
+	if val.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: docs must be a slice", ErrUnsupported)
+	}
+	input := make([]bson.M, 0, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		data, err := bson.Marshal(val.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		doc := bson.M{}
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		input = append(input, doc)
+	}
+
+	output, err := Run(input, pipeline)
+	if err != nil {
+		return err
+	}
+	// decode through a wrapper document, bson cannot encode a top level array
+	data, err := bson.Marshal(bson.M{"docs": output})
+	if err != nil {
+		return err
+	}
+	var wrapper struct {
+		Docs bson.Raw `bson:"docs"`
+	}
+	if err := bson.Unmarshal(data, &wrapper); err != nil {
+		return err
+	}
+	return wrapper.Docs.Unmarshal(result)
+}
+
+func runStage(docs []bson.M, name string, spec interface{}) ([]bson.M, error) {
+	switch name {
+	case "$match":
+		query, ok := toDoc(spec)
+		if !ok {
+			return nil, fmt.Errorf("%w: $match %v", ErrUnsupported, spec)
+		}
+		var result []bson.M
+		for _, doc := range docs {
+			ok, err := Match(doc, query)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, doc)
+			}
+		}
+		return result, nil
+	case "$project":
+		return project(docs, spec)
+	case "$addFields", "$set":
+		fields, ok := toDoc(spec)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %v", ErrUnsupported, name, spec)
+		}
+		result := make([]bson.M, 0, len(docs))
+		for _, doc := range docs {
+			out := copyDoc(doc)
+			for _, field := range fields {
+				value, err := eval(doc, field.Value)
+				if err != nil {
+					return nil, err
+				}
+				setPath(out, field.Name, value)
+			}
+			result = append(result, out)
+		}
+		return result, nil
+	case "$unset":
+		var fields []string
+		switch s := spec.(type) {
+		case string:
+			fields = []string{s}
+		case []string:
+			fields = s
+		case []interface{}:
+			for _, f := range s {
+				fields = append(fields, fmt.Sprint(f))
+			}
+		default:
+			return nil, fmt.Errorf("%w: $unset %v", ErrUnsupported, spec)
+		}
+		result := make([]bson.M, 0, len(docs))
+		for _, doc := range docs {
+			out := copyDoc(doc)
+			for _, field := range fields {
+				unsetPath(out, field)
+			}
+			result = append(result, out)
+		}
+		return result, nil
+	case "$group":
+		return group(docs, spec)
+	case "$sort":
+		keys, ok := toDoc(spec)
+		if !ok {
+			return nil, fmt.Errorf("%w: $sort %v", ErrUnsupported, spec)
+		}
+		result := append([]bson.M(nil), docs...)
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, key := range keys {
+				c := compare(lookup(result[i], key.Name), lookup(result[j], key.Name))
+				if c == 0 {
+					continue
+				}
+				if n, _ := toFloat(key.Value); n < 0 {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+		return result, nil
+	case "$skip", "$limit":
+		n, ok := toFloat(spec)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%w: %s %v", ErrUnsupported, name, spec)
+		}
+		count := int(n)
+		if count > len(docs) {
+			count = len(docs)
+		}
+		if name == "$skip" {
+			return docs[count:], nil
+		}
+		return docs[:count], nil
+	case "$count":
+		field, ok := spec.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: $count %v", ErrUnsupported, spec)
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.M{{field: len(docs)}}, nil
+	case "$unwind":
+		return unwind(docs, spec)
+	}
+	return nil, fmt.Errorf("%w: stage %s", ErrUnsupported, name)
+}
+
+func project(docs []bson.M, spec interface{}) ([]bson.M, error) {
+	fields, ok := toDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("%w: $project %v", ErrUnsupported, spec)
+	}
+
+	// exclusion projection, _id excepted
+	exclusion := true
+	for _, field := range fields {
+		if n, ok := toFloat(field.Value); !ok || n != 0 {
+			if b, ok := field.Value.(bool); !ok || b {
+				if field.Name != "_id" {
+					exclusion = false
+				}
+			}
+		}
+	}
+
+	result := make([]bson.M, 0, len(docs))
+	for _, doc := range docs {
+		if exclusion {
+			out := copyDoc(doc)
+			for _, field := range fields {
+				unsetPath(out, field.Name)
+			}
+			result = append(result, out)
+			continue
+		}
+
+		out := bson.M{}
+		if id, ok := doc["_id"]; ok {
+			out["_id"] = id
+		}
+		for _, field := range fields {
+			if n, ok := toFloat(field.Value); ok {
+				if n == 0 {
+					delete(out, field.Name)
+				} else if value := lookup(doc, field.Name); value != nil {
+					setPath(out, field.Name, value)
+				}
+				continue
+			}
+			if b, ok := field.Value.(bool); ok {
+				if !b {
+					delete(out, field.Name)
+				} else if value := lookup(doc, field.Name); value != nil {
+					setPath(out, field.Name, value)
+				}
+				continue
+			}
+			value, err := eval(doc, field.Value)
+			if err != nil {
+				return nil, err
+			}
+			setPath(out, field.Name, value)
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+type groupState struct {
+	id     interface{}
+	values map[string]interface{}
+	counts map[string]int
+}
+
+func group(docs []bson.M, spec interface{}) ([]bson.M, error) {
+	fields, ok := toDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("%w: $group %v", ErrUnsupported, spec)
+	}
+	var idExpr interface{}
+	var accumulators []bson.DocElem
+	for _, field := range fields {
+		if field.Name == "_id" {
+			idExpr = field.Value
+		} else {
+			accumulators = append(accumulators, field)
+		}
+	}
+
+	var groups []*groupState
+	index := map[string]*groupState{}
+	for _, doc := range docs {
+		id, err := eval(doc, idExpr)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%#v", id)
+		state, ok := index[key]
+		if !ok {
+			state = &groupState{id: id, values: map[string]interface{}{}, counts: map[string]int{}}
+			index[key] = state
+			groups = append(groups, state)
+		}
+
+		for _, acc := range accumulators {
+			op, ok := toDoc(acc.Value)
+			if !ok || len(op) != 1 {
+				return nil, fmt.Errorf("%w: accumulator %v", ErrUnsupported, acc.Value)
+			}
+			value, err := eval(doc, op[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			if err := accumulate(state, acc.Name, op[0].Name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]bson.M, 0, len(groups))
+	for _, state := range groups {
+		out := bson.M{"_id": state.id}
+		for _, acc := range accumulators {
+			op, _ := toDoc(acc.Value)
+			value := state.values[acc.Name]
+			if op[0].Name == "$avg" {
+				if state.counts[acc.Name] == 0 {
+					value = nil
+				} else {
+					value = value.(float64) / float64(state.counts[acc.Name])
+				}
+			}
+			if op[0].Name == "$push" || op[0].Name == "$addToSet" {
+				if value == nil {
+					value = []interface{}{}
+				}
+			}
+			out[acc.Name] = value
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+func accumulate(state *groupState, name string, op string, value interface{}) error {
+	current, seen := state.values[name]
+	switch op {
+	case "$sum":
+		n, ok := toFloat(value)
+		if !ok {
+			n = 0
+		}
+		sum, _ := toFloat(current)
+		state.values[name] = numberLike(sum+n, current, value)
+	case "$avg":
+		if n, ok := toFloat(value); ok {
+			sum, _ := toFloat(current)
+			state.values[name] = sum + n
+			state.counts[name]++
+		}
+	case "$min":
+		if value != nil && (!seen || current == nil || compare(value, current) < 0) {
+			state.values[name] = value
+		}
+	case "$max":
+		if value != nil && (!seen || current == nil || compare(value, current) > 0) {
+			state.values[name] = value
+		}
+	case "$first":
+		if !seen {
+			state.values[name] = value
+		}
+	case "$last":
+		state.values[name] = value
+	case "$push":
+		list, _ := current.([]interface{})
+		state.values[name] = append(list, value)
+	case "$addToSet":
+		list, _ := current.([]interface{})
+		for _, item := range list {
+			if compare(item, value) == 0 {
+				return nil
+			}
+		}
+		state.values[name] = append(list, value)
+	default:
+		return fmt.Errorf("%w: accumulator %s", ErrUnsupported, op)
+	}
+	return nil
+}
+
+// numberLike keeps integer sums integers, like the server does
+func numberLike(n float64, values ...interface{}) interface{} {
+	for _, v := range values {
+		switch v.(type) {
+		case float32, float64:
+			return n
+		}
+	}
+	if n == float64(int(n)) {
+		return int(n)
+	}
+	return n
+}
+
+func unwind(docs []bson.M, spec interface{}) ([]bson.M, error) {
+	path, preserve := "", false
+	switch s := spec.(type) {
+	case string:
+		path = s
+	default:
+		fields, ok := toDoc(spec)
+		if !ok {
+			return nil, fmt.Errorf("%w: $unwind %v", ErrUnsupported, spec)
+		}
+		for _, field := range fields {
+			switch field.Name {
+			case "path":
+				path, _ = field.Value.(string)
+			case "preserveNullAndEmptyArrays":
+				preserve, _ = field.Value.(bool)
+			default:
+				return nil, fmt.Errorf("%w: $unwind option %s", ErrUnsupported, field.Name)
+			}
+		}
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: $unwind path %q", ErrUnsupported, path)
+	}
+	path = path[1:]
+
+	var result []bson.M
+	for _, doc := range docs {
+		value := lookup(doc, path)
+		items, isArray := toSlice(value)
+		if !isArray {
+			if value != nil {
+				result = append(result, doc)
+			} else if preserve {
+				result = append(result, doc)
+			}
+			continue
+		}
+		if len(items) == 0 {
+			if preserve {
+				out := copyDoc(doc)
+				unsetPath(out, path)
+				result = append(result, out)
+			}
+			continue
+		}
+		for _, item := range items {
+			out := copyDoc(doc)
+			setPath(out, path, item)
+			result = append(result, out)
+		}
+	}
+	return result, nil
+}
+
+// eval evaluates an aggregation expression against doc
+func eval(doc bson.M, expr interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$$") {
+			if e == "$$ROOT" {
+				return doc, nil
+			}
+			return nil, fmt.Errorf("%w: variable %s", ErrUnsupported, e)
+		}
+		if strings.HasPrefix(e, "$") {
+			return lookup(doc, e[1:]), nil
+		}
+		return e, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(e))
+		for _, item := range e {
+			value, err := eval(doc, item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}
+
+	fields, ok := toDoc(expr)
+	if !ok {
+		return expr, nil
+	}
+	if len(fields) == 1 && strings.HasPrefix(fields[0].Name, "$") {
+		return evalOperator(doc, fields[0].Name, fields[0].Value)
+	}
+	// document literal
+	result := bson.M{}
+	for _, field := range fields {
+		value, err := eval(doc, field.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[field.Name] = value
+	}
+	return result, nil
+}
+
+func evalOperator(doc bson.M, op string, arg interface{}) (interface{}, error) {
+	if op == "$literal" {
+		return arg, nil
+	}
+	// a list literal holds the arguments, anything else is the single argument
+	value, err := eval(doc, arg)
+	if err != nil {
+		return nil, err
+	}
+	args := []interface{}{value}
+	if _, ok := arg.([]interface{}); ok {
+		args = value.([]interface{})
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: %s without arguments", ErrUnsupported, op)
+	}
+
+	switch op {
+	case "$add", "$multiply":
+		result := 0.0
+		if op == "$multiply" {
+			result = 1
+		}
+		for _, a := range args {
+			if t, ok := a.(time.Time); ok && op == "$add" {
+				// date plus milliseconds
+				n := 0.0
+				for _, b := range args {
+					if f, ok := toFloat(b); ok {
+						n += f
+					}
+				}
+				return t.Add(time.Duration(n) * time.Millisecond), nil
+			}
+			n, ok := toFloat(a)
+			if !ok {
+				return nil, nil
+			}
+			if op == "$add" {
+				result += n
+			} else {
+				result *= n
+			}
+		}
+		return numberLike(result, args...), nil
+	case "$subtract", "$divide", "$mod":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%w: %s takes 2 arguments", ErrUnsupported, op)
+		}
+		a, okA := toFloat(args[0])
+		b, okB := toFloat(args[1])
+		if !okA || !okB {
+			return nil, nil
+		}
+		switch op {
+		case "$subtract":
+			return numberLike(a-b, args...), nil
+		case "$divide":
+			if b == 0 {
+				return nil, errors.New("can't $divide by zero")
+			}
+			return a / b, nil
+		default:
+			return numberLike(float64(int64(a)%int64(b)), args...), nil
+		}
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%w: %s takes 2 arguments", ErrUnsupported, op)
+		}
+		c := compare(args[0], args[1])
+		return map[string]bool{
+			"$eq": c == 0, "$ne": c != 0, "$gt": c > 0, "$gte": c >= 0, "$lt": c < 0, "$lte": c <= 0,
+		}[op], nil
+	case "$and", "$or":
+		for _, a := range args {
+			if truthy(a) != (op == "$and") {
+				return op == "$or", nil
+			}
+		}
+		return op == "$and", nil
+	case "$not":
+		return !truthy(args[0]), nil
+	case "$cond":
+		if list, ok := arg.([]interface{}); ok && len(list) == 3 {
+			args = list
+		} else if fields, ok := toDoc(arg); ok {
+			m := bson.M{}
+			for _, f := range fields {
+				m[f.Name] = f.Value
+			}
+			args = []interface{}{m["if"], m["then"], m["else"]}
+		} else {
+			return nil, fmt.Errorf("%w: $cond %v", ErrUnsupported, arg)
+		}
+		cond, err := eval(doc, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return eval(doc, args[1])
+		}
+		return eval(doc, args[2])
+	case "$ifNull":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "$concat":
+		var buf strings.Builder
+		for _, a := range args {
+			s, ok := a.(string)
+			if !ok {
+				return nil, nil
+			}
+			buf.WriteString(s)
+		}
+		return buf.String(), nil
+	case "$toUpper", "$toLower":
+		s := fmt.Sprint(args[0])
+		if args[0] == nil {
+			s = ""
+		}
+		if op == "$toUpper" {
+			return strings.ToUpper(s), nil
+		}
+		return strings.ToLower(s), nil
+	case "$size":
+		items, ok := toSlice(args[0])
+		if !ok {
+			return nil, errors.New("the argument to $size must be an array")
+		}
+		return len(items), nil
+	}
+	return nil, fmt.Errorf("%w: operator %s", ErrUnsupported, op)
+}
+
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return b
+	}
+	if n, ok := toFloat(v); ok {
+		return n != 0
+	}
+	return true
+}
+
+// Match reports whether doc matches the query
+func Match(doc bson.M, query []bson.DocElem) (bool, error) {
+	for _, cond := range query {
+		switch cond.Name {
+		case "$and", "$or", "$nor":
+			items, ok := toSlice(cond.Value)
+			if !ok {
+				return false, fmt.Errorf("%w: %s %v", ErrUnsupported, cond.Name, cond.Value)
+			}
+			matched := 0
+			for _, item := range items {
+				sub, ok := toDoc(item)
+				if !ok {
+					return false, fmt.Errorf("%w: %s %v", ErrUnsupported, cond.Name, item)
+				}
+				m, err := Match(doc, sub)
+				if err != nil {
+					return false, err
+				}
+				if m {
+					matched++
+				}
+			}
+			switch {
+			case cond.Name == "$and" && matched != len(items),
+				cond.Name == "$or" && matched == 0,
+				cond.Name == "$nor" && matched > 0:
+				return false, nil
+			}
+			continue
+		case "$expr":
+			value, err := eval(doc, cond.Value)
+			if err != nil {
+				return false, err
+			}
+			if !truthy(value) {
+				return false, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(cond.Name, "$") {
+			return false, fmt.Errorf("%w: query operator %s", ErrUnsupported, cond.Name)
+		}
+
+		ok, err := matchField(doc, cond.Name, cond.Value)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchField(doc bson.M, field string, cond interface{}) (bool, error) {
+	value, exists := lookupExists(doc, field)
+	ops, isDoc := toDoc(cond)
+	if !isDoc || len(ops) == 0 || !strings.HasPrefix(ops[0].Name, "$") {
+		return equals(value, cond), nil
+	}
+
+	for _, op := range ops {
+		var ok bool
+		switch op.Name {
+		case "$eq":
+			ok = equals(value, op.Value)
+		case "$ne":
+			ok = !equals(value, op.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = compareAny(value, op.Value, op.Name)
+		case "$in", "$nin":
+			items, isList := toSlice(op.Value)
+			if !isList {
+				return false, fmt.Errorf("%w: %s needs an array", ErrUnsupported, op.Name)
+			}
+			for _, item := range items {
+				if equals(value, item) {
+					ok = true
+					break
+				}
+			}
+			if op.Name == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			ok = exists == truthy(op.Value)
+		case "$size":
+			items, isList := toSlice(value)
+			n, _ := toFloat(op.Value)
+			ok = isList && float64(len(items)) == n
+		case "$not":
+			m, err := matchField(doc, field, op.Value)
+			if err != nil {
+				return false, err
+			}
+			ok = !m
+		default:
+			return false, fmt.Errorf("%w: query operator %s", ErrUnsupported, op.Name)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// equals matches a value, or any element of an array value, like the server does
+func equals(value interface{}, want interface{}) bool {
+	if compare(value, want) == 0 {
+		return true
+	}
+	if items, ok := toSlice(value); ok {
+		for _, item := range items {
+			if compare(item, want) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareAny(value interface{}, want interface{}, op string) bool {
+	candidates := []interface{}{value}
+	if items, ok := toSlice(value); ok {
+		candidates = items
+	}
+	for _, item := range candidates {
+		if item == nil || !sameKind(item, want) {
+			continue
+		}
+		c := compare(item, want)
+		if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKind(a, b interface{}) bool {
+	return typeOrder(a) == typeOrder(b)
+}
+
+// order of types when comparing values of different types
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 1
+	case string:
+		return 3
+	case bson.M, map[string]interface{}, bson.D:
+		return 4
+	case []interface{}:
+		return 5
+	case bson.ObjectId:
+		return 7
+	case bool:
+		return 8
+	case time.Time:
+		return 9
+	}
+	if _, ok := toFloat(v); ok {
+		return 2
+	}
+	return 10
+}
+
+// compare returns -1, 0 or 1
+func compare(a, b interface{}) int {
+	ta, tb := typeOrder(a), typeOrder(b)
+	if ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+
+	switch x := a.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	case bson.ObjectId:
+		return strings.Compare(string(x), string(b.(bson.ObjectId)))
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		}
+		if !x {
+			return -1
+		}
+		return 1
+	case time.Time:
+		y := b.(time.Time)
+		if x.Before(y) {
+			return -1
+		}
+		if x.After(y) {
+			return 1
+		}
+		return 0
+	}
+	if x, ok := toFloat(a); ok {
+		y, _ := toFloat(b)
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+		return 0
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprintf("%#v", a), fmt.Sprintf("%#v", b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	if items, ok := v.([]interface{}); ok {
+		return items, true
+	}
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || val.Kind() != reflect.Slice || val.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	if _, ok := v.(bson.D); ok {
+		return nil, false
+	}
+	items := make([]interface{}, 0, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		items = append(items, val.Index(i).Interface())
+	}
+	return items, true
+}
+
+// toDoc returns the fields of a document, bson.M keys sorted
+func toDoc(v interface{}) ([]bson.DocElem, bool) {
+	switch d := v.(type) {
+	case bson.D:
+		return d, true
+	case bson.M:
+		return sortedElems(d), true
+	case map[string]interface{}:
+		return sortedElems(d), true
+	}
+	return nil, false
+}
+
+func sortedElems(m map[string]interface{}) []bson.DocElem {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	elems := make([]bson.DocElem, 0, len(keys))
+	for _, k := range keys {
+		elems = append(elems, bson.DocElem{Name: k, Value: m[k]})
+	}
+	return elems
+}
+
+func lookup(doc bson.M, path string) interface{} {
+	value, _ := lookupExists(doc, path)
+	return value
+}
+
+func lookupExists(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		switch c := current.(type) {
+		case bson.M:
+			value, ok := c[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case map[string]interface{}:
+			value, ok := c[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		default:
+			// a path through an array of documents collects the values
+			items, ok := toSlice(current)
+			if !ok {
+				return nil, false
+			}
+			var values []interface{}
+			for _, item := range items {
+				if sub, ok := item.(bson.M); ok {
+					if value, ok := sub[key]; ok {
+						values = append(values, value)
+					}
+				}
+			}
+			if len(values) == 0 {
+				return nil, false
+			}
+			current = values
+		}
+	}
+	return current, true
+}
+
+func setPath(doc bson.M, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			sub = bson.M{}
+			doc[key] = sub
+		}
+		doc = sub
+	}
+	doc[keys[len(keys)-1]] = value
+}
+
+func unsetPath(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			return
+		}
+		doc = sub
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+// copyDoc copies doc and its sub documents, stages never modify their input
+func copyDoc(doc bson.M) bson.M {
+	out := make(bson.M, len(doc))
+	for k, v := range doc {
+		if sub, ok := v.(bson.M); ok {
+			v = copyDoc(sub)
+		}
+		out[k] = v
+	}
+	return out
+}
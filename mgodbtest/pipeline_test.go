@@ -0,0 +1,74 @@
+package mgodbtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func cars() []bson.M {
+	return []bson.M{
+		{"_id": 1, "name": "bmw", "price": 30, "tags": []interface{}{"a", "b"}},
+		{"_id": 2, "name": "audi", "price": 20, "tags": []interface{}{"b"}},
+		{"_id": 3, "name": "bmw", "price": 50, "tags": []interface{}{}},
+	}
+}
+
+func TestRunMatchGroupSort(t *testing.T) {
+	out, err := Run(cars(), []bson.M{
+		{"$match": bson.M{"price": bson.M{"$gte": 20}, "$or": []bson.M{{"name": "bmw"}, {"tags": "b"}}}},
+		{"$group": bson.M{"_id": "$name", "total": bson.M{"$sum": "$price"}, "avg": bson.M{"$avg": "$price"}, "n": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"total": -1}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{
+		{"_id": "bmw", "total": 80, "avg": 40.0, "n": 2},
+		{"_id": "audi", "total": 20, "avg": 20.0, "n": 1},
+	}, out)
+}
+
+func TestRunProjectUnwind(t *testing.T) {
+	out, err := Run(cars(), []bson.M{
+		{"$unwind": "$tags"},
+		{"$project": bson.M{"_id": 0, "tag": "$tags", "double": bson.M{"$multiply": []interface{}{"$price", 2}}}},
+		{"$skip": 1},
+		{"$limit": 1},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{{"tag": "b", "double": 60}}, out)
+
+	out, err = Run(cars(), []bson.M{
+		{"$addFields": bson.M{"n": bson.M{"$size": "$tags"}}},
+		{"$match": bson.M{"n": bson.M{"$gt": 0}}},
+		{"$count": "count"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{{"count": 2}}, out)
+}
+
+func TestRunUnsupported(t *testing.T) {
+	_, err := Run(cars(), []bson.M{{"$lookup": bson.M{}}})
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	_, err = Run(cars(), []bson.M{{"$match": bson.M{"name": bson.M{"$regex": "b"}}}})
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestRunInto(t *testing.T) {
+	type car struct {
+		Name  string `bson:"name"`
+		Price int    `bson:"price"`
+	}
+	type total struct {
+		Name  string `bson:"_id"`
+		Total int    `bson:"total"`
+	}
+	result := []*total{}
+	err := RunInto([]*car{{"bmw", 1}, {"bmw", 2}}, []bson.M{
+		{"$group": bson.M{"_id": "$name", "total": bson.M{"$sum": "$price"}}},
+	}, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, total{"bmw", 3}, *result[0])
+}
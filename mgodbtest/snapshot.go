@@ -0,0 +1,83 @@
+package mgodbtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/mulansoft/mgodb"
+)
+
+// env var which rewrites the golden files instead of comparing them
+const UpdateGoldenEnv = "MGODB_UPDATE_GOLDEN"
+
+// Snapshot records the operations issued until the end of the test, one
+// "op collection shape" line each, values replaced by placeholders, and compares them
+// with the golden file path, so a changed filter or a new full scan shows up in review.
+// run the tests with MGODB_UPDATE_GOLDEN=1 to write the golden files.
+// tests using Snapshot must not run in parallel, the recorder is global
+// for example:
+// func TestListCars(t *testing.T) {
+// Snapshot(t, "testdata/list_cars.golden")
+// ListCars(ownerId)
+// }
+func Snapshot(t testing.TB, path string) {
+	t.Helper()
+	s := &snapshot{path: path}
+	mgodb.SetRecorder(s.add)
+	t.Cleanup(func() {
+		mgodb.SetRecorder(nil)
+		s.check(t)
+	})
+}
+
+type snapshot struct {
+	sync.Mutex
+	path  string
+	lines []string
+}
+
+func (s *snapshot) add(op string, collection string, query interface{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.lines = append(s.lines, fmt.Sprintf("%s %s %s", op, collection, mgodb.NormalizeQuery(query)))
+}
+
+func (s *snapshot) check(t testing.TB) {
+	s.Lock()
+	got := strings.Join(s.lines, "\n") + "\n"
+	s.Unlock()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		if err := ioutil.WriteFile(s.path, []byte(got), 0644); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		t.Fatalf("snapshot: %v, run with %s=1 to create it", err, UpdateGoldenEnv)
+		return
+	}
+	if string(want) == got {
+		return
+	}
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(want)),
+		B:        difflib.SplitLines(got),
+		FromFile: s.path,
+		ToFile:   "recorded",
+		Context:  2,
+	})
+	t.Errorf("snapshot: operations differ from %s, run with %s=1 to update it\n%s", s.path, UpdateGoldenEnv, diff)
+}
@@ -0,0 +1,39 @@
+package mgodbtest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type recordingT struct {
+	testing.TB
+	errors int
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) { t.errors++ }
+func (t *recordingT) Fatalf(format string, args ...interface{}) { t.errors++ }
+
+func TestSnapshotCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cars.golden")
+	ioutil.WriteFile(path, []byte(`find car {"name":?,"price":{"$gt":?}}`+"\n"), 0644)
+
+	rt := &recordingT{TB: t}
+	s := &snapshot{path: path}
+	s.add("find", "car", bson.M{"name": "bmw", "price": bson.M{"$gt": 1}})
+	s.check(rt)
+	assert.Equal(t, 0, rt.errors)
+
+	s = &snapshot{path: path}
+	s.add("find", "car", bson.M{"name": "bmw"})
+	s.check(rt)
+	assert.Equal(t, 1, rt.errors)
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	s.check(rt)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, `find car {"name":?}`+"\n", string(data))
+}
@@ -0,0 +1,93 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrBatchSize = errors.New("batch size must be positive")
+)
+
+// rename a field of all records by batched $rename updates,
+// the progress is logged per batch and an interrupted rename
+// resumes from the remaining records when called again
+// for example:
+// renamed, err := RenameField(&Car{}, "remark", "remarks", 1000)
+func RenameField(model interface{}, from string, to string, batchSize int) (int, error) {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"from":  from,
+			"to":    to,
+			"err":   err,
+		}).Error("rename field error: validate model fail")
+		return 0, err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("rename field error: model is read-only")
+		return 0, err
+	}
+	if batchSize <= 0 {
+		return 0, ErrBatchSize
+	}
+
+	collection := GetCollectionName(model)
+	query := bson.M{from: bson.M{"$exists": true}}
+	total := Count(model, query)
+	renamed := 0
+	for {
+		var ids []struct {
+			Id interface{} `bson:"_id"`
+		}
+		err := _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+			c := sess.DB("").C(collection)
+			if err := c.Find(query).Select(bson.M{"_id": 1}).Sort("_id").Limit(batchSize).All(&ids); err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+
+			in := make([]interface{}, 0, len(ids))
+			for _, item := range ids {
+				in = append(in, item.Id)
+			}
+			info, err := c.UpdateAll(bson.M{"_id": bson.M{"$in": in}, from: bson.M{"$exists": true}},
+				bson.M{"$rename": bson.M{from: to}})
+			if info != nil {
+				renamed += info.Updated
+			}
+			return err
+		})
+		if err != nil {
+			logWith(Fields{
+				"collection": collection,
+				"from":       from,
+				"to":         to,
+				"renamed":    renamed,
+				"err":        err,
+			}).Error("rename field error: database operate fail")
+			return renamed, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		logWith(Fields{
+			"collection": collection,
+			"from":       from,
+			"to":         to,
+			"renamed":    renamed,
+			"total":      total,
+		}).Info("rename field progress")
+	}
+
+	return renamed, nil
+}
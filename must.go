@@ -0,0 +1,46 @@
+package mgodb
+
+import (
+	"fmt"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// MustFindOne is like FindOne for init-time bootstrap code, it panics when no record
+// matches query or on error, the panic value wraps the error with the collection and the query
+// for example:
+// config := &Config{}
+// MustFindOne(config, bson.M{"name": "default"})
+func (db *Database) MustFindOne(model interface{}, query interface{}) {
+	found, err := db.FindOneOrNil(model, query)
+	if err == nil && !found {
+		err = mgo.ErrNotFound
+	}
+	if err != nil {
+		panic(fmt.Errorf("mgodb: must find one in %s with query %v: %w", mustCollection(model), query, err))
+	}
+}
+
+// MustInsert is like Insert for init-time bootstrap code, it panics on error,
+// the panic value wraps the error with the collection and the record
+func (db *Database) MustInsert(model interface{}) {
+	if err := db.Insert(model); err != nil {
+		panic(fmt.Errorf("mgodb: must insert in %s record %+v: %w", mustCollection(model), model, err))
+	}
+}
+
+func MustFindOne(model interface{}, query interface{}) {
+	_db.MustFindOne(model, query)
+}
+
+func MustInsert(model interface{}) {
+	_db.MustInsert(model)
+}
+
+// mustCollection names the collection of model for a panic, the type for an invalid model
+func mustCollection(model interface{}) string {
+	if validateModel(model) != nil {
+		return fmt.Sprintf("%T", model)
+	}
+	return GetCollectionName(model)
+}
@@ -0,0 +1,24 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMustInsert(t *testing.T) {
+	defer func() {
+		err, ok := recover().(error)
+		assert.True(t, ok)
+		assert.True(t, errors.Is(err, ErrModelNotPtr))
+		assert.Contains(t, err.Error(), "mgodb.fieldsInner")
+	}()
+	db := &Database{}
+	db.MustInsert(fieldsInner{CarId: 1})
+	t.Fatal("MustInsert did not panic")
+}
+
+func TestMustCollection(t *testing.T) {
+	assert.Equal(t, "fields_inner", mustCollection(&fieldsInner{}))
+}
@@ -0,0 +1,126 @@
+package mgodb
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// field the distance is computed into, read apart from the document
+const nearDistanceField = "_mgodbDistance"
+
+// NearOptions bounds a Near search
+type NearOptions struct {
+	// the 2dsphere indexed field, needed when the collection has several geo indexes (mongodb 4.0+)
+	Field string
+	// in meters, 0 is unbounded
+	MinDistance float64
+	MaxDistance float64
+	// filters the documents besides the distance
+	Query interface{}
+	// 0 returns every document within MaxDistance
+	Limit int
+}
+
+// Result is a document found by Near with its distance in meters from the searched point
+type Result[T any] struct {
+	Doc      T
+	Distance float64
+}
+
+// Near returns the documents of T nearest to point first, each with its distance,
+// the collection needs a 2dsphere index on the location field
+// for example, shops within 2km:
+// shops, err := Near[Shop](GeoPoint{Lng: 116.39, Lat: 39.9}, NearOptions{MaxDistance: 2000, Limit: 20})
+// for _, shop := range shops { render(shop.Doc.Name, shop.Distance) }
+func Near[T any](point GeoPoint, opts NearOptions) ([]Result[T], error) {
+	return NearContext[T](context.Background(), point, opts)
+}
+
+// NearContext is like Near, it is abandoned when ctx is done
+func NearContext[T any](ctx context.Context, point GeoPoint, opts NearOptions) ([]Result[T], error) {
+	var model T
+	if err := validateModel(&model); err != nil {
+		return nil, err
+	}
+	var selector interface{}
+	if err := _db.applyPolicy(ctx, &model, ActionAggregate, &selector); err != nil {
+		_db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("near db error: policy denied")
+		return nil, err
+	}
+
+	collection := GetCollectionName(&model)
+	piplines := nearPipeline(point, opts, selector)
+	rows := []bson.Raw{}
+	start := time.Now()
+	err := _db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(&rows)
+	})
+	_db.observe(ctx, "near", collection, piplines, start, err)
+	if err != nil {
+		_db.logContext(ctx, Fields{
+			"collection": collection,
+			"point":      point,
+			"err":        err,
+		}).Error("near db error: database operate fail")
+		return nil, err
+	}
+
+	results := make([]Result[T], len(rows))
+	for i, row := range rows {
+		distance := struct {
+			Distance float64 `bson:"_mgodbDistance"`
+		}{}
+		if err := row.Unmarshal(&results[i].Doc); err != nil {
+			return nil, err
+		}
+		if err := row.Unmarshal(&distance); err != nil {
+			return nil, err
+		}
+		results[i].Distance = distance.Distance
+		_db.afterDecode(&results[i].Doc)
+	}
+	return results, nil
+}
+
+// nearPipeline builds the $geoNear search, selector is the filter of the policy
+func nearPipeline(point GeoPoint, opts NearOptions, selector interface{}) []bson.M {
+	stage := bson.M{
+		"near":          bson.M{"type": "Point", "coordinates": []float64{point.Lng, point.Lat}},
+		"distanceField": nearDistanceField,
+		"spherical":     true,
+	}
+	if opts.Field != "" {
+		stage["key"] = opts.Field
+	}
+	if opts.MinDistance > 0 {
+		stage["minDistance"] = opts.MinDistance
+	}
+	if opts.MaxDistance > 0 {
+		stage["maxDistance"] = opts.MaxDistance
+	}
+	// $geoNear must be the first stage, it takes the filters itself
+	switch {
+	case opts.Query != nil && selector != nil:
+		stage["query"] = bson.M{"$and": []interface{}{opts.Query, selector}}
+	case opts.Query != nil:
+		stage["query"] = opts.Query
+	case selector != nil:
+		stage["query"] = selector
+	}
+
+	piplines := []bson.M{{"$geoNear": stage}}
+	if opts.Limit > 0 {
+		piplines = append(piplines, bson.M{"$limit": opts.Limit})
+	}
+	return piplines
+}
@@ -0,0 +1,27 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNearPipeline(t *testing.T) {
+	piplines := nearPipeline(GeoPoint{Lng: 116.39, Lat: 39.9}, NearOptions{MaxDistance: 2000, Limit: 20}, nil)
+	assert.Equal(t, []bson.M{
+		{"$geoNear": bson.M{
+			"near":          bson.M{"type": "Point", "coordinates": []float64{116.39, 39.9}},
+			"distanceField": nearDistanceField,
+			"spherical":     true,
+			"maxDistance":   float64(2000),
+		}},
+		{"$limit": 20},
+	}, piplines)
+
+	piplines = nearPipeline(GeoPoint{}, NearOptions{Field: "location", Query: bson.M{"open": true}}, bson.M{"tenant": "a"})
+	assert.Equal(t, 1, len(piplines))
+	stage := piplines[0]["$geoNear"].(bson.M)
+	assert.Equal(t, "location", stage["key"])
+	assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"open": true}, bson.M{"tenant": "a"}}}, stage["query"])
+}
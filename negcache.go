@@ -0,0 +1,100 @@
+package mgodb
+
+import (
+	"sync"
+	"time"
+)
+
+// misses kept per collection, beyond it the expired ones are dropped, then all of them
+const negativeCacheSize = 10000
+
+type missCache struct {
+	ttl        time.Duration
+	generation uint64
+	expires    map[string]time.Time
+}
+
+type negativeCache struct {
+	sync.Mutex
+	collections map[string]*missCache
+}
+
+// EnableNegativeCache caches the queries of FindOne which found nothing in the
+// collection of model for ttl, so repeated lookups of nonexistent records (scrapers,
+// retries) stop reaching the database. every write through mgodb
+// drops the cached misses of the collection, writes from elsewhere show up after ttl.
+// ttl <= 0 turns the cache off
+// for example:
+// EnableNegativeCache(&User{}, 5*time.Second)
+func (db *Database) EnableNegativeCache(model interface{}, ttl time.Duration) {
+	collection := GetCollectionName(model)
+	db.negative.Lock()
+	defer db.negative.Unlock()
+	if ttl <= 0 {
+		delete(db.negative.collections, collection)
+		return
+	}
+	if db.negative.collections == nil {
+		db.negative.collections = make(map[string]*missCache)
+	}
+	db.negative.collections[collection] = &missCache{ttl: ttl, expires: make(map[string]time.Time)}
+}
+
+func EnableNegativeCache(model interface{}, ttl time.Duration) {
+	_db.EnableNegativeCache(model, ttl)
+}
+
+// cachedMiss tells whether query is known to find nothing in collection,
+// and returns the generation to pass to cacheMiss otherwise
+func (db *Database) cachedMiss(collection string, query interface{}) (bool, uint64) {
+	db.negative.Lock()
+	defer db.negative.Unlock()
+	cache, ok := db.negative.collections[collection]
+	if !ok {
+		return false, 0
+	}
+	key := cacheKey(query)
+	if expires, ok := cache.expires[key]; ok {
+		if time.Now().Before(expires) {
+			return true, cache.generation
+		}
+		delete(cache.expires, key)
+	}
+	return false, cache.generation
+}
+
+// cacheMiss records that query found nothing, unless a write happened since generation
+func (db *Database) cacheMiss(collection string, query interface{}, generation uint64) {
+	db.negative.Lock()
+	defer db.negative.Unlock()
+	cache, ok := db.negative.collections[collection]
+	if !ok || cache.generation != generation {
+		return
+	}
+	now := time.Now()
+	if len(cache.expires) >= negativeCacheSize {
+		for key, expires := range cache.expires {
+			if !now.Before(expires) {
+				delete(cache.expires, key)
+			}
+		}
+		if len(cache.expires) >= negativeCacheSize {
+			cache.expires = make(map[string]time.Time)
+		}
+	}
+	cache.expires[cacheKey(query)] = now.Add(cache.ttl)
+}
+
+// forgetMisses drops the cached misses of collection after a write
+func (db *Database) forgetMisses(collection string) {
+	db.negative.Lock()
+	defer db.negative.Unlock()
+	cache, ok := db.negative.collections[collection]
+	if !ok {
+		return
+	}
+	cache.generation++
+	if len(cache.expires) > 0 {
+		cache.expires = make(map[string]time.Time)
+	}
+}
@@ -0,0 +1,42 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNegativeCache(t *testing.T) {
+	db := new(Database)
+	query := bson.M{"carId": 1, "name": "xx"}
+	missed, generation := db.cachedMiss("fields_inner", query)
+	assert.False(t, missed)
+	db.cacheMiss("fields_inner", query, generation)
+	missed, _ = db.cachedMiss("fields_inner", query)
+	assert.False(t, missed)
+
+	db.EnableNegativeCache(&fieldsInner{}, time.Minute)
+	missed, generation = db.cachedMiss("fields_inner", query)
+	assert.False(t, missed)
+	db.cacheMiss("fields_inner", query, generation)
+	missed, _ = db.cachedMiss("fields_inner", bson.M{"name": "xx", "carId": 1})
+	assert.True(t, missed)
+
+	// a write drops the misses, and the misses of reads started before it
+	_, generation = db.cachedMiss("fields_inner", bson.M{"carId": 2})
+	db.forgetMisses("fields_inner")
+	missed, _ = db.cachedMiss("fields_inner", query)
+	assert.False(t, missed)
+	db.cacheMiss("fields_inner", bson.M{"carId": 2}, generation)
+	missed, _ = db.cachedMiss("fields_inner", bson.M{"carId": 2})
+	assert.False(t, missed)
+
+	db.EnableNegativeCache(&fieldsInner{}, time.Nanosecond)
+	_, generation = db.cachedMiss("fields_inner", query)
+	db.cacheMiss("fields_inner", query, generation)
+	time.Sleep(time.Millisecond)
+	missed, _ = db.cachedMiss("fields_inner", query)
+	assert.False(t, missed)
+}
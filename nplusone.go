@@ -0,0 +1,95 @@
+package mgodb
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a development mode detector for N+1 queries:
+// the same query shape executed more than threshold times
+// within one request is almost always a loop,
+// which should query with $in or $lookup instead
+type nplusoneDetector struct {
+	sync.Mutex
+	enabled   bool
+	threshold int
+}
+
+// query shapes run by one request, see TrackQueries
+type queryTracker struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+type trackerKey struct{}
+
+// TrackQueries returns a copy of ctx whose operations count as one request for
+// the n+1 detection, typically made by a middleware for every request
+// for example:
+// ctx := TrackQueries(r.Context())
+// FindOneContext(ctx, user, bson.M{"userId": id})
+func TrackQueries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trackerKey{}, &queryTracker{counts: make(map[string]int)})
+}
+
+func (d *nplusoneDetector) isEnabled() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.enabled
+}
+
+// check counts the query shape in the request of ctx, and returns the count
+// once it passed the threshold, 0 otherwise
+func (d *nplusoneDetector) check(ctx context.Context, op, collection, shape string) int {
+	tracker, ok := ctx.Value(trackerKey{}).(*queryTracker)
+	if !ok {
+		return 0
+	}
+	d.Lock()
+	threshold := d.threshold
+	d.Unlock()
+
+	tracker.Lock()
+	defer tracker.Unlock()
+	key := op + " " + collection + " " + shape
+	tracker.counts[key]++
+	// warned once per request and shape
+	if count := tracker.counts[key]; count == threshold+1 {
+		return count
+	}
+	return 0
+}
+
+// EnableNPlusOneDetection warns when one query shape runs more than threshold times
+// within a request, the operations of a ctx made by TrackQueries,
+// threshold <= 0 disables detection.
+// it is meant for development, do not enable it in production
+func (db *Database) EnableNPlusOneDetection(threshold int) {
+	db.nplusone.Lock()
+	defer db.nplusone.Unlock()
+	db.nplusone.enabled = threshold > 0
+	db.nplusone.threshold = threshold
+}
+
+func EnableNPlusOneDetection(threshold int) {
+	_db.EnableNPlusOneDetection(threshold)
+}
+
+// callerSite returns file:line of the first caller outside this package
+func callerSite() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/mulansoft/mgodb.") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNPlusOneDetection(t *testing.T) {
+	db := new(Database)
+	db.EnableNPlusOneDetection(3)
+	ctx := TrackQueries(context.Background())
+	warnings := 0
+	for i := 0; i < 5; i++ {
+		if db.nplusone.check(ctx, "findOne", "car", NormalizeQuery(bson.M{"carId": i})) > 0 {
+			warnings++
+		}
+	}
+	assert.Equal(t, 1, warnings)
+	tracker := ctx.Value(trackerKey{}).(*queryTracker)
+	assert.Equal(t, 1, len(tracker.counts))
+
+	// every request counts apart, untracked operations are not counted
+	other := TrackQueries(context.Background())
+	assert.Equal(t, 0, db.nplusone.check(other, "findOne", "car", "{carId: ?}"))
+	assert.Equal(t, 0, db.nplusone.check(context.Background(), "findOne", "car", "{carId: ?}"))
+	db.observe(ctx, "findOne", "car", bson.M{"carId": 1}, time.Now(), nil)
+	assert.Equal(t, 6, tracker.counts["findOne car "+NormalizeQuery(bson.M{"carId": 1})])
+}
@@ -0,0 +1,182 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+var (
+	ErrOverloaded = errors.New("database overloaded: operation shed")
+)
+
+// limits of the operations waiting for a session once all of them are busy,
+// the number of concurrent operations is the concurrent of Init or the partition size
+type OverloadLimits struct {
+	// maximum waiting operations, more are rejected at once with ErrOverloaded, 0 no limit
+	MaxQueue int
+	// maximum wait for a session before ErrOverloaded, 0 no limit
+	MaxWait time.Duration
+	// free sessions of each pool background operations never take,
+	// kept for user-facing ones
+	Reserved int
+	// maximum waiting background operations, 0 no limit
+	BackgroundMaxQueue int
+}
+
+// priority class of an operation
+type Priority int
+
+const (
+	// user-facing operations, the default
+	PriorityUser Priority = iota
+	// background operations wait and shed first under pool pressure
+	PriorityBackground
+)
+
+// interval a background operation waits before checking the reserved sessions again
+const reservedPollInterval = 5 * time.Millisecond
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx whose operations run with priority p
+// for example:
+// ctx = WithPriority(WithPartition(ctx, "batch"), PriorityBackground)
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityOf returns the priority of ctx, PriorityUser if none
+func PriorityOf(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+type overloadGuard struct {
+	sync.RWMutex
+	limits            OverloadLimits
+	waiting           int64
+	backgroundWaiting int64
+	shed              int64
+}
+
+// SetOverloadLimits bounds the wait for a session, so a slow database sheds
+// operations with ErrOverloaded instead of piling up goroutines
+// for example:
+// SetOverloadLimits(OverloadLimits{MaxQueue: 200, MaxWait: 500 * time.Millisecond})
+func (db *Database) SetOverloadLimits(limits OverloadLimits) {
+	db.overload.Lock()
+	defer db.overload.Unlock()
+	db.overload.limits = limits
+}
+
+func SetOverloadLimits(limits OverloadLimits) {
+	_db.SetOverloadLimits(limits)
+}
+
+// Shed returns the number of operations rejected with ErrOverloaded
+func (db *Database) Shed() int64 {
+	return atomic.LoadInt64(&db.overload.shed)
+}
+
+func Shed() int64 {
+	return _db.Shed()
+}
+
+// wait takes a session from latch within the limits, ctx cancels the wait
+func (g *overloadGuard) wait(ctx context.Context, latch chan *mgo.Session) (*mgo.Session, error) {
+	g.RLock()
+	limits := g.limits
+	g.RUnlock()
+	if PriorityOf(ctx) == PriorityBackground && limits.Reserved > 0 {
+		return g.waitBackground(ctx, latch, limits)
+	}
+
+	// fast path, a session is free
+	select {
+	case sess := <-latch:
+		return sess, nil
+	default:
+	}
+
+	waiting := atomic.AddInt64(&g.waiting, 1)
+	defer atomic.AddInt64(&g.waiting, -1)
+	if limits.MaxQueue > 0 && waiting > int64(limits.MaxQueue) {
+		atomic.AddInt64(&g.shed, 1)
+		return nil, ErrOverloaded
+	}
+	if PriorityOf(ctx) == PriorityBackground {
+		backgroundWaiting := atomic.AddInt64(&g.backgroundWaiting, 1)
+		defer atomic.AddInt64(&g.backgroundWaiting, -1)
+		if limits.BackgroundMaxQueue > 0 && backgroundWaiting > int64(limits.BackgroundMaxQueue) {
+			atomic.AddInt64(&g.shed, 1)
+			return nil, ErrOverloaded
+		}
+	}
+
+	var timeout <-chan time.Time
+	if limits.MaxWait > 0 {
+		timer := time.NewTimer(limits.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case sess := <-latch:
+		return sess, nil
+	case <-timeout:
+		atomic.AddInt64(&g.shed, 1)
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitBackground takes a session only while more than the reserved ones are free
+func (g *overloadGuard) waitBackground(ctx context.Context, latch chan *mgo.Session, limits OverloadLimits) (*mgo.Session, error) {
+	var deadline time.Time
+	if limits.MaxWait > 0 {
+		deadline = time.Now().Add(limits.MaxWait)
+	}
+
+	queued := false
+	for {
+		if len(latch) > limits.Reserved {
+			select {
+			case sess := <-latch:
+				if len(latch) >= limits.Reserved {
+					return sess, nil
+				}
+				// raced with another operation, give the reserved session back
+				latch <- sess
+			default:
+			}
+		}
+
+		if !queued {
+			queued = true
+			waiting := atomic.AddInt64(&g.waiting, 1)
+			defer atomic.AddInt64(&g.waiting, -1)
+			backgroundWaiting := atomic.AddInt64(&g.backgroundWaiting, 1)
+			defer atomic.AddInt64(&g.backgroundWaiting, -1)
+			if (limits.MaxQueue > 0 && waiting > int64(limits.MaxQueue)) ||
+				(limits.BackgroundMaxQueue > 0 && backgroundWaiting > int64(limits.BackgroundMaxQueue)) {
+				atomic.AddInt64(&g.shed, 1)
+				return nil, ErrOverloaded
+			}
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			atomic.AddInt64(&g.shed, 1)
+			return nil, ErrOverloaded
+		}
+
+		select {
+		case <-time.After(reservedPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestOverloadWait(t *testing.T) {
+	db := new(Database)
+	latch := make(chan *mgo.Session, 1)
+	latch <- nil
+
+	_, err := db.overload.wait(context.Background(), latch)
+	assert.Nil(t, err)
+
+	db.SetOverloadLimits(OverloadLimits{MaxWait: 10 * time.Millisecond})
+	_, err = db.overload.wait(context.Background(), latch)
+	assert.Equal(t, ErrOverloaded, err)
+	assert.Equal(t, int64(1), db.Shed())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	db.SetOverloadLimits(OverloadLimits{})
+	_, err = db.overload.wait(ctx, latch)
+	assert.Equal(t, context.Canceled, err)
+
+	// the queue is full
+	db.overload.waiting = 1
+	db.SetOverloadLimits(OverloadLimits{MaxQueue: 1})
+	_, err = db.overload.wait(context.Background(), latch)
+	assert.Equal(t, ErrOverloaded, err)
+	assert.Equal(t, int64(2), db.Shed())
+}
+
+func TestOverloadPriority(t *testing.T) {
+	db := new(Database)
+	latch := make(chan *mgo.Session, 2)
+	latch <- nil
+	latch <- nil
+	db.SetOverloadLimits(OverloadLimits{Reserved: 1, MaxWait: 20 * time.Millisecond})
+
+	background := WithPriority(context.Background(), PriorityBackground)
+	assert.Equal(t, PriorityBackground, PriorityOf(background))
+	assert.Equal(t, PriorityUser, PriorityOf(context.Background()))
+
+	// the last free session is reserved for user-facing operations
+	_, err := db.overload.wait(background, latch)
+	assert.Nil(t, err)
+	_, err = db.overload.wait(background, latch)
+	assert.Equal(t, ErrOverloaded, err)
+	_, err = db.overload.wait(context.Background(), latch)
+	assert.Nil(t, err)
+
+	db.SetOverloadLimits(OverloadLimits{BackgroundMaxQueue: 1})
+	db.overload.backgroundWaiting = 1
+	_, err = db.overload.wait(background, latch)
+	assert.Equal(t, ErrOverloaded, err)
+}
@@ -0,0 +1,147 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+var (
+	ErrNotInitialized    = errors.New("database is not initialized")
+	ErrInvalidPartition  = errors.New("partition requires a name and a positive size")
+	ErrPartitionTooLarge = errors.New("partitions must leave at least one session to the default pool")
+)
+
+type partitionKey struct{}
+
+// named latches carved out of the connection pool
+type partitions struct {
+	sync.RWMutex
+	latches map[string]chan *mgo.Session
+	// sessions of the partitions, taken out of the default pool
+	reserved int
+}
+
+// AddPartition moves size sessions of the default pool to the operations running with
+// WithPartition(ctx, name), so a workload cannot starve the others of sockets.
+// operations without a partition, or with an unknown one, use the default pool of Init.
+// adding a partition again gives its sessions back first.
+// it waits for the running operations to give the sessions back, call it after Init
+// for example:
+// Init(addr, 128, timeout)
+// AddPartition("batch", 28) // 100 sessions are left to the default pool
+// ExecuteContext(WithPartition(ctx, "batch"), export)
+func (db *Database) AddPartition(name string, size int) error {
+	if name == "" || size <= 0 {
+		return ErrInvalidPartition
+	}
+	if db.session.Load() == nil {
+		return ErrNotInitialized
+	}
+
+	db.partitions.Lock()
+	defer db.partitions.Unlock()
+	old := db.partitions.latches[name]
+	if db.partitions.reserved-cap(old)+size >= cap(db.latch) {
+		return ErrPartitionTooLarge
+	}
+	if old != nil {
+		db.returnPartition(old)
+	}
+
+	latch := make(chan *mgo.Session, size)
+	for k := 0; k < size; k++ {
+		latch <- <-db.latch
+	}
+	if db.partitions.latches == nil {
+		db.partitions.latches = make(map[string]chan *mgo.Session)
+	}
+	db.partitions.latches[name] = latch
+	db.partitions.reserved += size
+	return nil
+}
+
+// returnPartition gives the sessions of latch back to the default pool once the
+// running operations released them, db.partitions must be locked
+func (db *Database) returnPartition(latch chan *mgo.Session) {
+	for k := 0; k < cap(latch); k++ {
+		db.latch <- <-latch
+	}
+	db.partitions.reserved -= cap(latch)
+}
+
+// returnPartitions gives the sessions of every partition back to the default pool
+func (db *Database) returnPartitions() {
+	db.partitions.Lock()
+	defer db.partitions.Unlock()
+	for _, latch := range db.partitions.latches {
+		db.returnPartition(latch)
+	}
+	db.partitions.latches = nil
+}
+
+func AddPartition(name string, size int) error {
+	return _db.AddPartition(name, size)
+}
+
+// WithPartition returns a copy of ctx whose operations run in the partition name
+func WithPartition(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, partitionKey{}, name)
+}
+
+// Partition returns the partition of ctx, "" for the default pool
+func Partition(ctx context.Context) string {
+	name, _ := ctx.Value(partitionKey{}).(string)
+	return name
+}
+
+// latchOf returns the latch of the partition of ctx
+func (db *Database) latchOf(ctx context.Context) chan *mgo.Session {
+	if name := Partition(ctx); name != "" {
+		db.partitions.RLock()
+		latch, ok := db.partitions.latches[name]
+		db.partitions.RUnlock()
+		if ok {
+			return latch
+		}
+	}
+	return db.latch
+}
+
+// acquire takes a session from the latch of ctx, release gives it back
+func (db *Database) acquire(ctx context.Context) (*mgo.Session, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	latch := db.latchOf(ctx)
+	sess, err := db.overload.wait(ctx, latch)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.applyReadMode(ctx, sess)
+	db.applyWriteConcern(ctx, sess)
+
+	// mgo cannot cancel an operation in flight, the deadline of ctx
+	// bounds it through the socket timeout instead
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return sess, func() {
+			latch <- sess
+		}, nil
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		latch <- sess
+		return nil, nil, context.DeadlineExceeded
+	}
+	if db.timeout <= 0 || remaining < db.timeout {
+		sess.SetSocketTimeout(remaining)
+	}
+	return sess, func() {
+		sess.SetSocketTimeout(db.timeout)
+		latch <- sess
+	}, nil
+}
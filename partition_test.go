@@ -0,0 +1,70 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestPartition(t *testing.T) {
+	db := new(Database)
+	assert.Equal(t, ErrInvalidPartition, db.AddPartition("", 1))
+	assert.Equal(t, ErrNotInitialized, db.AddPartition("batch", 1))
+
+	db.latch = make(chan *mgo.Session, 1)
+	batch := make(chan *mgo.Session, 1)
+	db.partitions.latches = map[string]chan *mgo.Session{"batch": batch}
+
+	ctx := WithPartition(context.Background(), "batch")
+	assert.Equal(t, "batch", Partition(ctx))
+	assert.Equal(t, batch, db.latchOf(ctx))
+	assert.Equal(t, db.latch, db.latchOf(WithPartition(context.Background(), "online")))
+	assert.Equal(t, db.latch, db.latchOf(context.Background()))
+}
+
+func TestAcquireDeadline(t *testing.T) {
+	db := new(Database)
+	db.latch = make(chan *mgo.Session, 1)
+	db.latch <- &mgo.Session{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := db.acquire(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(time.Minute))
+	defer cancel()
+	sess, release, err := db.acquire(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, sess)
+	assert.Len(t, db.latch, 0)
+	release()
+	assert.Len(t, db.latch, 1)
+}
+
+func TestAddPartition(t *testing.T) {
+	db := new(Database)
+	db.session.Store(&mgo.Session{})
+	db.latch = make(chan *mgo.Session, 4)
+	for k := 0; k < 4; k++ {
+		db.latch <- &mgo.Session{}
+	}
+
+	assert.NoError(t, db.AddPartition("batch", 2))
+	assert.Len(t, db.latch, 2)
+	assert.Len(t, db.latchOf(WithPartition(context.Background(), "batch")), 2)
+
+	// added again, the old sessions are given back first
+	assert.NoError(t, db.AddPartition("batch", 3))
+	assert.Len(t, db.latch, 1)
+	assert.Equal(t, 3, cap(db.latchOf(WithPartition(context.Background(), "batch"))))
+	assert.Equal(t, ErrPartitionTooLarge, db.AddPartition("report", 1))
+	assert.Equal(t, ErrPartitionTooLarge, db.AddPartition("batch", 4))
+
+	db.returnPartitions()
+	assert.Len(t, db.latch, 4)
+	assert.Equal(t, db.latch, db.latchOf(WithPartition(context.Background(), "batch")))
+}
@@ -0,0 +1,125 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidPercentile = errors.New("percentile must be between 0 and 1")
+)
+
+// PercentilePipeline returns the aggregation computing the percentiles ps
+// (between 0 and 1) of the numeric field of the records matching query,
+// one result per value of groupBy, or a single one with _id null when groupBy is empty.
+// each result holds the percentiles in "values", in the order of ps.
+// native uses $percentile (mongodb 7.0), otherwise the values are sorted,
+// pushed into an array and picked by rank
+// for example:
+// PercentilePipeline(bson.M{"status": 200}, "latency", "path", []float64{0.5, 0.99}, false)
+func PercentilePipeline(query bson.M, field string, groupBy string, ps []float64, native bool) ([]bson.M, error) {
+	for _, p := range ps {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPercentile, p)
+		}
+	}
+
+	var group interface{}
+	if groupBy != "" {
+		group = "$" + groupBy
+	}
+	match := bson.M{field: bson.M{"$type": "number"}}
+	if len(query) > 0 {
+		match = bson.M{"$and": []bson.M{query, match}}
+	}
+
+	if native {
+		return []bson.M{
+			{"$match": match},
+			{"$group": bson.M{"_id": group, "values": bson.M{"$percentile": bson.M{
+				"input": "$" + field, "p": ps, "method": "approximate",
+			}}}},
+		}, nil
+	}
+
+	// nearest rank on the sorted values
+	values := make([]bson.M, 0, len(ps))
+	for _, p := range ps {
+		values = append(values, bson.M{"$arrayElemAt": []interface{}{"$values",
+			bson.M{"$floor": bson.M{"$multiply": []interface{}{
+				bson.M{"$subtract": []interface{}{bson.M{"$size": "$values"}, 1}}, p,
+			}}},
+		}})
+	}
+	return []bson.M{
+		{"$match": match},
+		{"$sort": bson.M{field: 1}},
+		{"$group": bson.M{"_id": group, "values": bson.M{"$push": "$" + field}}},
+		{"$project": bson.M{"values": values}},
+	}, nil
+}
+
+// Percentiles returns the percentiles ps of the numeric field of the
+// records matching query, $percentile is used when the server supports it.
+// returns mgo.ErrNotFound when no record matches
+// for example, the median and p99 latency:
+// values, err := Percentiles(&Request{}, bson.M{"path": "/cars"}, "latency", 0.5, 0.99)
+func Percentiles(model interface{}, query bson.M, field string, ps ...float64) ([]float64, error) {
+	var selector interface{} = query
+	if err := _db.applyPolicy(context.Background(), model, ActionAggregate, &selector); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("percentiles db error: policy denied")
+		return nil, err
+	}
+	// the policy and the soft delete scope keep a bson.M
+	query, _ = selector.(bson.M)
+
+	collection := GetCollectionName(model)
+	var result struct {
+		Values []float64 `bson:"values"`
+	}
+
+	start := time.Now()
+	var piplines []bson.M
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		info, err := sess.BuildInfo()
+		if err != nil {
+			return err
+		}
+		piplines, err = PercentilePipeline(query, field, "", ps, info.VersionAtLeast(7, 0))
+		if err != nil {
+			return err
+		}
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.One(&result)
+	})
+	_db.observe(context.Background(), "aggregate", collection, piplines, start, err)
+	if err != nil && err != mgo.ErrNotFound {
+		logWith(Fields{
+			"collection": collection,
+			"query":      query,
+			"field":      field,
+			"err":        err,
+		}).Error("percentiles db error: database operate fail")
+	}
+	return result.Values, err
+}
+
+// Median returns the median of the numeric field of the records matching query
+func Median(model interface{}, query bson.M, field string) (float64, error) {
+	values, err := Percentiles(model, query, field, 0.5)
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	return values[0], nil
+}
@@ -0,0 +1,27 @@
+package mgodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestPercentilePipeline(t *testing.T) {
+	_, err := PercentilePipeline(nil, "price", "", []float64{1.5}, false)
+	assert.True(t, errors.Is(err, ErrInvalidPercentile))
+
+	query := bson.M{"price": bson.M{"$gt": 0}, "name": "a", "$and": []bson.M{{"a": 1}}}
+	piplines, err := PercentilePipeline(query, "price", "name", []float64{0.5}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(piplines))
+	assert.Equal(t, bson.M{"$and": []bson.M{query, {"price": bson.M{"$type": "number"}}}}, piplines[0]["$match"])
+	assert.Equal(t, "$name", piplines[2]["$group"].(bson.M)["_id"])
+
+	piplines, err = PercentilePipeline(nil, "price", "", []float64{0.5, 0.9}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(piplines))
+	assert.Equal(t, bson.M{"price": bson.M{"$type": "number"}}, piplines[0]["$match"])
+	assert.Nil(t, piplines[1]["$group"].(bson.M)["_id"])
+}
@@ -0,0 +1,120 @@
+package mgodb
+
+import (
+	"context"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type pinKey struct{}
+
+// a request scoped session, created by the first write on the database db,
+// the operations of the other databases ignore it
+type pin struct {
+	sync.Mutex
+	db   *Database
+	sess *mgo.Session
+}
+
+// WithPinning returns a copy of ctx which pins its operations to one session
+// after the first write: every read of ctx then runs on the pinned session, on the primary
+// which took the write, so it sees the write even when reads normally go to secondaries.
+// call release when the request is done
+// for example:
+// ctx, release := WithPinning(ctx)
+// defer release()
+func WithPinning(ctx context.Context) (context.Context, func()) {
+	p := new(pin)
+	release := func() {
+		p.Lock()
+		defer p.Unlock()
+		if p.sess != nil {
+			p.sess.Close()
+			p.sess = nil
+			p.db = nil
+		}
+	}
+	return context.WithValue(ctx, pinKey{}, p), release
+}
+
+// Pinned reports whether the operations of ctx on db run on a pinned session
+func (db *Database) Pinned(ctx context.Context) bool {
+	return db.pinnedOf(ctx) != nil
+}
+
+func Pinned(ctx context.Context) bool {
+	return _db.Pinned(ctx)
+}
+
+// pinnedOf returns the pin of ctx once a write on db pinned its session, nil otherwise
+func (db *Database) pinnedOf(ctx context.Context) *pin {
+	p, _ := ctx.Value(pinKey{}).(*pin)
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.sess == nil || p.db != db {
+		return nil
+	}
+	return p
+}
+
+// ExecuteContext is like Execute, but runs f on the pinned session of ctx
+// once a write pinned it
+func (db *Database) ExecuteContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	return db.execute(ctx, f)
+}
+
+// ExecuteWriteContext is like ExecuteContext for writes, the first write
+// pins the session of ctx to db, the writes of ctx on other databases are not pinned
+// for example:
+// ExecuteWriteContext(ctx, func(sess *mgo.Session) error {
+// return sess.DB("").C("car").Insert(car)
+// })
+func (db *Database) ExecuteWriteContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	p, _ := ctx.Value(pinKey{}).(*pin)
+	if p == nil {
+		return db.execute(ctx, f)
+	}
+	return db.executePinned(ctx, p, true, f)
+}
+
+func (db *Database) executePinned(ctx context.Context, p *pin, write bool, f func(sess *mgo.Session) error) error {
+	p.Lock()
+	if p.sess == nil && !write || p.sess != nil && p.db != db {
+		p.Unlock()
+		return db.execute(ctx, f)
+	}
+	p.Unlock()
+
+	// latch control, the pinned session still takes a slot
+	latched, release, err := db.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	p.Lock()
+	defer p.Unlock()
+	if p.sess == nil && !write || p.sess != nil && p.db != db {
+		// released, or pinned by another database meanwhile
+		latched.Refresh()
+		return f(latched)
+	}
+	if p.sess == nil {
+		p.db = db
+		p.sess = db.session.Load().Copy()
+		p.sess.SetMode(mgo.Strong, true)
+	}
+	db.applyWriteConcern(ctx, p.sess)
+	return f(p.sess)
+}
+
+func ExecuteContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	return _db.ExecuteContext(ctx, f)
+}
+
+func ExecuteWriteContext(ctx context.Context, f func(sess *mgo.Session) error) error {
+	return _db.ExecuteWriteContext(ctx, f)
+}
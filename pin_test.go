@@ -0,0 +1,37 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestWithPinning(t *testing.T) {
+	assert.False(t, Pinned(context.Background()))
+
+	ctx, release := WithPinning(context.Background())
+	assert.False(t, Pinned(ctx))
+	release()
+	assert.False(t, Pinned(ctx))
+}
+
+func TestPinnedReadMode(t *testing.T) {
+	db := &Database{}
+	ctx := context.WithValue(context.Background(), pinKey{}, &pin{db: db, sess: &mgo.Session{}})
+	assert.True(t, db.Pinned(ctx))
+	mode, ok := db.readModeOf(WithReadMode(ctx, mgo.SecondaryPreferred))
+	assert.True(t, ok)
+	assert.Equal(t, mgo.Strong, mode)
+}
+
+func TestPinnedOtherDatabase(t *testing.T) {
+	db, other := &Database{}, &Database{}
+	ctx := context.WithValue(context.Background(), pinKey{}, &pin{db: db, sess: &mgo.Session{}})
+	assert.True(t, db.Pinned(ctx))
+	assert.False(t, other.Pinned(ctx))
+	assert.Nil(t, other.pinnedOf(ctx))
+	_, ok := other.readModeOf(ctx)
+	assert.False(t, ok)
+}
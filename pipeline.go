@@ -0,0 +1,136 @@
+package mgodb
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PipelineBuilder builds an aggregation pipeline stage by stage,
+// it can be passed to Aggregate as is
+// for example:
+// piplines := Pipeline().
+// Match(bson.M{"price": bson.M{"$gt": 100}}).
+// Lookup("car_owner", "carId", "carId", "owners").
+// Unwind("$owners").
+// Group("$owners.ownerId", bson.M{"total": bson.M{"$sum": "$price"}}).
+// Sort("-total").
+// Limit(10)
+// Aggregate(&results, piplines)
+type PipelineBuilder struct {
+	stages []bson.M
+}
+
+// Pipeline returns an empty pipeline builder
+func Pipeline() *PipelineBuilder {
+	return &PipelineBuilder{}
+}
+
+// Stage appends a raw stage, such as UnionWith or GraphLookup
+func (p *PipelineBuilder) Stage(stage bson.M) *PipelineBuilder {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Match appends a $match stage
+func (p *PipelineBuilder) Match(query interface{}) *PipelineBuilder {
+	return p.Stage(bson.M{"$match": query})
+}
+
+// Lookup appends a $lookup stage joining the records of from whose foreignField
+// equals localField into the array as
+func (p *PipelineBuilder) Lookup(from string, localField string, foreignField string, as string) *PipelineBuilder {
+	return p.Stage(bson.M{"$lookup": bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": foreignField,
+		"as":           as,
+	}})
+}
+
+// Unwind appends an $unwind stage of the array at path, such as "$owners"
+func (p *PipelineBuilder) Unwind(path string) *PipelineBuilder {
+	return p.Stage(bson.M{"$unwind": path})
+}
+
+// UnwindPreserve is like Unwind, records whose array is missing or empty are kept
+func (p *PipelineBuilder) UnwindPreserve(path string) *PipelineBuilder {
+	return p.Stage(bson.M{"$unwind": bson.M{"path": path, "preserveNullAndEmptyArrays": true}})
+}
+
+// Group appends a $group stage by id with the accumulated fields
+// for example:
+// Group("$ownerId", bson.M{"total": bson.M{"$sum": "$price"}})
+func (p *PipelineBuilder) Group(id interface{}, fields bson.M) *PipelineBuilder {
+	group := bson.M{"_id": id}
+	for key, value := range fields {
+		group[key] = value
+	}
+	return p.Stage(bson.M{"$group": group})
+}
+
+// Project appends a $project stage
+func (p *PipelineBuilder) Project(projection interface{}) *PipelineBuilder {
+	return p.Stage(bson.M{"$project": projection})
+}
+
+// AddFields appends an $addFields stage
+func (p *PipelineBuilder) AddFields(fields bson.M) *PipelineBuilder {
+	return p.Stage(bson.M{"$addFields": fields})
+}
+
+// Sort appends a $sort stage, fields are named as for Find, "-" prefixed for descending order
+func (p *PipelineBuilder) Sort(fields ...string) *PipelineBuilder {
+	sort := bson.D{}
+	for _, field := range fields {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			field, order = field[1:], -1
+		} else if strings.HasPrefix(field, "+") {
+			field = field[1:]
+		}
+		sort = append(sort, bson.DocElem{Name: field, Value: order})
+	}
+	return p.Stage(bson.M{"$sort": sort})
+}
+
+// Skip appends a $skip stage
+func (p *PipelineBuilder) Skip(n int) *PipelineBuilder {
+	return p.Stage(bson.M{"$skip": n})
+}
+
+// Limit appends a $limit stage
+func (p *PipelineBuilder) Limit(n int) *PipelineBuilder {
+	return p.Stage(bson.M{"$limit": n})
+}
+
+// Count appends a $count stage storing the number of records in field
+func (p *PipelineBuilder) Count(field string) *PipelineBuilder {
+	return p.Stage(bson.M{"$count": field})
+}
+
+// Facet appends a $facet stage running every sub pipeline on the same input
+// for example:
+// Facet(map[string]*PipelineBuilder{"total": Pipeline().Count("n"), "page": Pipeline().Skip(20).Limit(10)})
+func (p *PipelineBuilder) Facet(facets map[string]*PipelineBuilder) *PipelineBuilder {
+	facet := bson.M{}
+	for name, sub := range facets {
+		facet[name] = sub.Build()
+	}
+	return p.Stage(bson.M{"$facet": facet})
+}
+
+// Build returns the stages of the pipeline
+func (p *PipelineBuilder) Build() []bson.M {
+	stages := make([]bson.M, len(p.stages))
+	copy(stages, p.stages)
+	return stages
+}
+
+// buildPipeline turns a pipeline builder into its stages, other pipelines are returned as is
+func buildPipeline(piplines interface{}) interface{} {
+	if p, ok := piplines.(*PipelineBuilder); ok {
+		return p.Build()
+	}
+	return piplines
+}
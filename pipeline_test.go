@@ -0,0 +1,39 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestPipelineBuilder(t *testing.T) {
+	piplines := Pipeline().
+		Match(bson.M{"price": bson.M{"$gt": 100}}).
+		Lookup("car_owner", "carId", "carId", "owners").
+		Unwind("$owners").
+		Group("$owners.ownerId", bson.M{"total": bson.M{"$sum": "$price"}}).
+		Sort("-total", "_id").
+		Limit(10)
+
+	assert.Equal(t, []bson.M{
+		{"$match": bson.M{"price": bson.M{"$gt": 100}}},
+		{"$lookup": bson.M{"from": "car_owner", "localField": "carId", "foreignField": "carId", "as": "owners"}},
+		{"$unwind": "$owners"},
+		{"$group": bson.M{"_id": "$owners.ownerId", "total": bson.M{"$sum": "$price"}}},
+		{"$sort": bson.D{{Name: "total", Value: -1}, {Name: "_id", Value: 1}}},
+		{"$limit": 10},
+	}, piplines.Build())
+	assert.Equal(t, piplines.Build(), buildPipeline(piplines))
+}
+
+func TestPipelineFacet(t *testing.T) {
+	piplines := Pipeline().Facet(map[string]*PipelineBuilder{
+		"total": Pipeline().Count("n"),
+		"page":  Pipeline().Skip(20).Limit(10),
+	})
+	assert.Equal(t, []bson.M{{"$facet": bson.M{
+		"total": []bson.M{{"$count": "n"}},
+		"page":  []bson.M{{"$skip": 20}, {"$limit": 10}},
+	}}}, piplines.Build())
+}
@@ -0,0 +1,104 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Pluck finds the values of field (dotted for sub documents) of the records of the
+// collection of model matching query into values, the address of a slice of the field type,
+// only field is fetched. records without field are skipped
+// for example:
+// carIds := []int64{}
+// Pluck(&carIds, &Car{}, bson.M{"price": bson.M{"$gt": 100}}, "carId")
+func (db *Database) Pluck(values interface{}, model interface{}, query interface{}, field string) error {
+	return db.PluckContext(context.Background(), values, model, query, field)
+}
+
+// PluckContext is like Pluck, ctx bounds the wait for a session and the operation
+func (db *Database) PluckContext(ctx context.Context, values interface{}, model interface{}, query interface{}, field string) error {
+	if err := validateSlice(values); err != nil {
+		db.logContext(ctx, Fields{
+			"values": values,
+			"err":    err,
+		}).Error("pluck db error: validate values fail")
+		return err
+	}
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("pluck db error: validate model fail")
+		return err
+	}
+	if err := db.applyPolicy(ctx, model, ActionFind, &query); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("pluck db error: policy denied")
+		return err
+	}
+
+	projection := bson.M{field: 1}
+	if field != "_id" {
+		projection["_id"] = 0
+	}
+	collection := GetCollectionName(model)
+	docs := []bson.M{}
+	start := time.Now()
+	err := db.ExecuteIdempotentContext(ctx, func(sess *mgo.Session) error {
+		q, err := db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		return db.attribute(ctx, q.Select(projection).Sort(getDefaultSort(model)...)).All(&docs)
+	})
+	db.observe(ctx, "pluck", collection, query, start, err)
+	if err != nil {
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"query":      query,
+			"field":      field,
+			"err":        err,
+		}).Error("pluck db error: database operate fail")
+		return err
+	}
+	return pluckInto(values, docs, field)
+}
+
+// pluckInto decodes the value of field of every doc into an element of values
+func pluckInto(values interface{}, docs []bson.M, field string) error {
+	slice := reflect.ValueOf(values).Elem()
+	// a one field struct converts the bson value into the element type
+	holder := reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: slice.Type().Elem(),
+		Tag:  `bson:"v"`,
+	}})
+	items := reflect.MakeSlice(slice.Type(), 0, len(docs))
+	for _, doc := range docs {
+		value := lookupPath(doc, field)
+		if value == nil {
+			continue
+		}
+		item := reflect.New(holder)
+		if err := remarshal(bson.M{"v": value}, item.Interface()); err != nil {
+			return err
+		}
+		items = reflect.Append(items, item.Elem().Field(0))
+	}
+	slice.Set(items)
+	return nil
+}
+
+func Pluck(values interface{}, model interface{}, query interface{}, field string) error {
+	return _db.Pluck(values, model, query, field)
+}
+
+func PluckContext(ctx context.Context, values interface{}, model interface{}, query interface{}, field string) error {
+	return _db.PluckContext(ctx, values, model, query, field)
+}
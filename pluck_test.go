@@ -0,0 +1,20 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestPluckInto(t *testing.T) {
+	docs := []bson.M{{"carId": 1}, {"carId": int64(2)}, {"name": "x"}, {"owner": bson.M{"name": "simi"}}}
+
+	carIds := []int64{}
+	assert.Nil(t, pluckInto(&carIds, docs, "carId"))
+	assert.Equal(t, []int64{1, 2}, carIds)
+
+	names := []string{}
+	assert.Nil(t, pluckInto(&names, docs, "owner.name"))
+	assert.Equal(t, []string{"simi"}, names)
+}
@@ -0,0 +1,155 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrPolicyDenied = errors.New("operation denied by the access policy")
+)
+
+// kind of operation checked by a Policy
+type Action string
+
+const (
+	ActionInsert    Action = "insert"
+	ActionFind      Action = "find"
+	ActionCount     Action = "count"
+	ActionAggregate Action = "aggregate"
+	ActionUpdate    Action = "update"
+	ActionUpsert    Action = "upsert"
+	ActionRemove    Action = "remove"
+)
+
+// Policy centralizes row-level authorization: it is invoked before each operation
+// with the selector of the operation (empty for inserts and aggregations),
+// and returns an error to deny it, or the selector to run, possibly rewritten.
+// a rewritten selector must be a new map, the selector of the caller is shared.
+// operations without a context are checked with context.Background(),
+// FindRows and AggregateRows pass the RowsCollection they read as model
+type Policy interface {
+	Check(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error)
+}
+
+// PolicyFunc adapts a function to Policy
+// for example, restrict cars to their owner:
+// SetPolicy(PolicyFunc(func(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error) {
+// if _, ok := model.(*Car); !ok || action == ActionInsert {
+// return selector, nil
+// }
+// return bson.M{"$and": []bson.M{selector, {"ownerId": MetaValue(ctx, "actorId")}}}, nil
+// }))
+type PolicyFunc func(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error)
+
+func (f PolicyFunc) Check(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error) {
+	return f(ctx, model, action, selector)
+}
+
+type policyHolder struct {
+	sync.RWMutex
+	policy Policy
+}
+
+// SetPolicy sets the access policy of all operations, nil removes it
+func (db *Database) SetPolicy(policy Policy) {
+	db.policy.Lock()
+	defer db.policy.Unlock()
+	db.policy.policy = policy
+}
+
+func SetPolicy(policy Policy) {
+	_db.SetPolicy(policy)
+}
+
+// applyPolicy checks an operation against the policy and replaces *selector
+// (may be nil) with the selector returned by the policy, restricted to the records
+// not soft deleted except for inserts and upserts, see Unscoped.
+// every operation on the records of a model builds its selector through it
+func (db *Database) applyPolicy(ctx context.Context, model interface{}, action Action, selector *interface{}) error {
+	if err := db.checkPolicy(ctx, model, action, selector); err != nil {
+		return err
+	}
+	if selector != nil && action != ActionInsert && action != ActionUpsert {
+		*selector = scopeDeleted(ctx, model, *selector)
+	}
+	return nil
+}
+
+// checkPolicy checks an operation against the policy and replaces *selector
+// (may be nil) with the selector returned by the policy
+func (db *Database) checkPolicy(ctx context.Context, model interface{}, action Action, selector *interface{}) error {
+	db.policy.RLock()
+	policy := db.policy.policy
+	db.policy.RUnlock()
+	if policy == nil {
+		return nil
+	}
+
+	query := bson.M{}
+	if selector != nil && *selector != nil {
+		var err error
+		if query, err = selectorDoc(*selector); err != nil {
+			return err
+		}
+	}
+
+	rewritten, err := policy.Check(ctx, model, action, query)
+	if err != nil {
+		return err
+	}
+	if selector != nil && rewritten != nil {
+		*selector = rewritten
+	}
+	return nil
+}
+
+// selectorDoc returns selector as a bson.M for the policy: a bson.D keeps its
+// values, a struct is encoded with its bson tags
+func selectorDoc(selector interface{}) (bson.M, error) {
+	var d bson.D
+	switch s := selector.(type) {
+	case bson.M:
+		return s, nil
+	case map[string]interface{}:
+		return bson.M(s), nil
+	case bson.D:
+		d = s
+	default:
+		// the embedded documents stay ordered, they are matched as a whole
+		if err := remarshal(selector, &d); err != nil {
+			return nil, err
+		}
+	}
+	doc := make(bson.M, len(d))
+	for _, elem := range d {
+		doc[elem.Name] = elem.Value
+	}
+	return doc, nil
+}
+
+// applyPipelinePolicy checks an aggregation, a selector returned by the
+// policy is prepended to piplines as a $match stage
+func (db *Database) applyPipelinePolicy(ctx context.Context, model interface{}, piplines *interface{}) error {
+	var selector interface{}
+	if err := db.applyPolicy(ctx, model, ActionAggregate, &selector); err != nil {
+		return err
+	}
+	match, ok := selector.(bson.M)
+	if !ok || len(match) == 0 {
+		return nil
+	}
+
+	switch stages := (*piplines).(type) {
+	case []bson.M:
+		*piplines = append([]bson.M{{"$match": match}}, stages...)
+	case []interface{}:
+		*piplines = append([]interface{}{bson.M{"$match": match}}, stages...)
+	default:
+		return ErrPolicyDenied
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	db := new(Database)
+	var selector interface{} = bson.M{"name": "a"}
+	assert.Nil(t, db.applyPolicy(context.Background(), &fieldsInner{}, ActionFind, &selector))
+	assert.Equal(t, bson.M{"name": "a"}, selector)
+
+	db.SetPolicy(PolicyFunc(func(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error) {
+		if action == ActionRemove {
+			return nil, ErrPolicyDenied
+		}
+		return bson.M{"$and": []bson.M{selector, {"ownerId": MetaValue(ctx, "actorId")}}}, nil
+	}))
+	ctx := WithMeta(context.Background(), "actorId", 1)
+	assert.Nil(t, db.applyPolicy(ctx, &fieldsInner{}, ActionFind, &selector))
+	assert.Equal(t, bson.M{"$and": []bson.M{{"name": "a"}, {"ownerId": 1}}}, selector)
+	assert.Equal(t, ErrPolicyDenied, db.applyPolicy(ctx, &fieldsInner{}, ActionRemove, &selector))
+	assert.Nil(t, db.applyPolicy(ctx, &fieldsInner{}, ActionInsert, nil))
+
+	// bson.D and struct selectors reach the policy as documents
+	selector = bson.D{{Name: "name", Value: "a"}, {Name: "cost", Value: bson.D{{Name: "$gt", Value: 1}}}}
+	assert.Nil(t, db.applyPolicy(ctx, &fieldsInner{}, ActionFind, &selector))
+	assert.Equal(t, bson.M{"$and": []bson.M{{"name": "a", "cost": bson.D{{Name: "$gt", Value: 1}}}, {"ownerId": 1}}}, selector)
+	selector = struct {
+		Name string `bson:"name"`
+	}{"a"}
+	assert.Nil(t, db.applyPolicy(ctx, &fieldsInner{}, ActionFind, &selector))
+	assert.Equal(t, bson.M{"$and": []bson.M{{"name": "a"}, {"ownerId": 1}}}, selector)
+
+	var piplines interface{} = []bson.M{{"$group": bson.M{"_id": "$name"}}}
+	assert.Nil(t, db.applyPipelinePolicy(ctx, &fieldsInner{}, &piplines))
+	assert.Equal(t, []bson.M{
+		{"$match": bson.M{"$and": []bson.M{{}, {"ownerId": 1}}}},
+		{"$group": bson.M{"_id": "$name"}},
+	}, piplines)
+}
+
+func TestPolicyDenied(t *testing.T) {
+	SetPolicy(PolicyFunc(func(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error) {
+		return nil, ErrPolicyDenied
+	}))
+	defer SetPolicy(nil)
+
+	query := bson.M{"name": "a"}
+	assert.Equal(t, ErrPolicyDenied, Transition(&fieldsInner{}, query, []string{"a"}, "b", nil))
+	assert.Equal(t, ErrPolicyDenied, FindSlice(&fieldsInner{}, query, "items", 0, 10))
+	_, err := DecrementIfAtLeast(&fieldsInner{}, query, "cost", 1)
+	assert.Equal(t, ErrPolicyDenied, err)
+	_, err = Claim(&[]*fieldsInner{}, &fieldsInner{}, query, 1, "worker", time.Minute)
+	assert.Equal(t, ErrPolicyDenied, err)
+	_, err = Percentiles(&fieldsInner{}, query, "cost", 0.5)
+	assert.Equal(t, ErrPolicyDenied, err)
+	_, err = BackfillNamed("policy", &fieldsInner{}, query, 10, 0, nil)
+	assert.Equal(t, ErrPolicyDenied, err)
+	_, err = FindRows("fields_inner", query, 1, 10, nil)
+	assert.Equal(t, ErrPolicyDenied, err)
+	_, err = AggregateRows("fields_inner", []bson.M{{"$match": query}})
+	assert.Equal(t, ErrPolicyDenied, err)
+	assert.Equal(t, ErrPolicyDenied, AggregateEach(&fieldsInner{}, []bson.M{{"$match": query}}, nil))
+}
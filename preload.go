@@ -0,0 +1,167 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrPreloadField = errors.New("preload field must be a slice tagged with localField")
+)
+
+// populate slice fields tagged with `mgodb:"preload"` by one batched query per field,
+// foreignField defaults to localField and fields are named by their bson key,
+// loading all tagged fields when fields is empty
+// for example, with the field CarOwner.Cars []Car tagged
+// `bson:"cars,omitempty" mgodb:"preload,localField=carId,foreignField=carId"`
+// result := []*CarOwner{}
+// Find(&result, bson.M{...}, 1, 15, nil)
+// Preload(&result, "cars")
+func Preload(result interface{}, fields ...string) error {
+	if err := validateSlice(result); err != nil {
+		logWith(Fields{
+			"result": result,
+			"fields": fields,
+			"err":    err,
+		}).Error("preload db error: validate model fail")
+		return err
+	}
+
+	parents := reflect.ValueOf(result).Elem()
+	typ := parents.Type().Elem()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return ErrResultNotSliceAddr
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		opts := mgodbTag(field)
+		if _, ok := opts["preload"]; !ok {
+			continue
+		}
+		name, _ := bsonName(field)
+		if len(fields) > 0 && !containsString(fields, name) {
+			continue
+		}
+		if err := preloadField(parents, i, opts); err != nil {
+			logWith(Fields{
+				"result": result,
+				"field":  name,
+				"err":    err,
+			}).Error("preload db error: database operate fail")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// find and preload the tagged fields of the result
+// for example:
+// result := []*CarOwner{}
+// FindPreload(&result, bson.M{...}, 1, 15, []string{...}, "cars")
+func FindPreload(result interface{}, query interface{}, page int, pageSize int, sorts []string, fields ...string) error {
+	if err := Find(result, query, page, pageSize, sorts); err != nil {
+		return err
+	}
+	return Preload(result, fields...)
+}
+
+func preloadField(parents reflect.Value, index int, opts map[string]string) error {
+	field := parents.Type().Elem()
+	for field.Kind() == reflect.Ptr {
+		field = field.Elem()
+	}
+	fieldType := field.Field(index).Type
+	localField := opts["localField"]
+	foreignField := opts["foreignField"]
+	if foreignField == "" {
+		foreignField = localField
+	}
+	if fieldType.Kind() != reflect.Slice || localField == "" {
+		return ErrPreloadField
+	}
+
+	// collect the distinct local keys
+	keys := make([]interface{}, 0, parents.Len())
+	seen := make(map[interface{}]bool)
+	for i := 0; i < parents.Len(); i++ {
+		key := fieldByBsonName(parents.Index(i), localField)
+		if !key.IsValid() || !key.Type().Comparable() {
+			continue
+		}
+		if !seen[key.Interface()] {
+			seen[key.Interface()] = true
+			keys = append(keys, key.Interface())
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// load all children by one query
+	childType := fieldType.Elem()
+	for childType.Kind() == reflect.Ptr {
+		childType = childType.Elem()
+	}
+	children := reflect.New(fieldType)
+	child := reflect.New(childType).Interface()
+	collection := GetCollectionName(child)
+	var query interface{} = bson.M{foreignField: bson.M{"$in": keys}}
+	if err := _db.applyPolicy(context.Background(), child, ActionFind, &query); err != nil {
+		return err
+	}
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		q, err := _db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		return q.All(children.Interface())
+	})
+	_db.observe(context.Background(), "find", collection, query, start, err)
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[interface{}][]reflect.Value)
+	for i := 0; i < children.Elem().Len(); i++ {
+		child := children.Elem().Index(i)
+		key := fieldByBsonName(child, foreignField)
+		if key.IsValid() && key.Type().Comparable() {
+			groups[key.Interface()] = append(groups[key.Interface()], child)
+		}
+	}
+
+	for i := 0; i < parents.Len(); i++ {
+		parent := reflect.Indirect(parents.Index(i))
+		if !parent.IsValid() {
+			continue
+		}
+		items := reflect.MakeSlice(fieldType, 0, 0)
+		key := fieldByBsonName(parent, localField)
+		if key.IsValid() && key.Type().Comparable() {
+			items = reflect.Append(items, groups[key.Interface()]...)
+		}
+		parent.Field(index).Set(items)
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Projection returns the projection selecting the fields of the struct of model,
+// inlined structs included, so a subset struct fetches only its fields.
+// _id is excluded when the struct has no field for it
+// for example:
+// Projection(&MinCar{}) returns {"_id": 0, "carId": 1, "name": 1, "price": 1}
+func Projection(model interface{}) bson.M {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	projection := bson.M{}
+	if typ.Kind() != reflect.Struct {
+		return projection
+	}
+	projectFields(typ, projection)
+	if _, ok := projection["_id"]; !ok {
+		projection["_id"] = 0
+	}
+	return projection
+}
+
+// ProjectionOf is Projection of the struct T
+// for example:
+// sess.DB("").C("car").Find(query).Select(ProjectionOf[MinCar]()).All(&cars)
+func ProjectionOf[T any]() bson.M {
+	var model T
+	return Projection(&model)
+}
+
+func projectFields(typ reflect.Type, projection bson.M) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			inner := field.Type
+			for inner.Kind() == reflect.Ptr {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				projectFields(inner, projection)
+			}
+			continue
+		}
+		if name != "" {
+			projection[name] = 1
+		}
+	}
+}
+
+// FindSubset finds the records of the collection of model matching query into result,
+// a slice of a struct holding a subset of the fields of model, fetching only those fields
+// for example:
+// cars := []MinCar{}
+// FindSubset(&cars, &Car{}, bson.M{"price": bson.M{"$lt": 100}}, []string{"-price"})
+func FindSubset(result interface{}, model interface{}, query interface{}, sorts []string) error {
+	if err := validateSlice(result); err != nil {
+		logWith(Fields{
+			"result": result,
+			"query":  query,
+			"err":    err,
+		}).Error("find subset db error: validate model fail")
+		return err
+	}
+	if err := _db.applyPolicy(context.Background(), model, ActionFind, &query); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("find subset db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	projection := Projection(result)
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		q, err := _db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		return q.Select(projection).Sort(sorts...).All(result)
+	})
+	_db.observe(context.Background(), "find", collection, query, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"query":      query,
+			"err":        err,
+		}).Error("find subset db error: database operate fail")
+		return err
+	}
+	_db.afterDecode(result)
+	return nil
+}
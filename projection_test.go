@@ -0,0 +1,20 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type projectionModel struct {
+	Id    bson.ObjectId `bson:"_id"`
+	Price int           `bson:"price"`
+	Skip  string        `bson:"-"`
+}
+
+func TestProjection(t *testing.T) {
+	assert.Equal(t, bson.M{"_id": 0, "carId": 1, "name": 1, "cars": 1}, Projection(&fieldsOuter{}))
+	assert.Equal(t, bson.M{"_id": 0, "carId": 1}, ProjectionOf[fieldsInner]())
+	assert.Equal(t, bson.M{"_id": 1, "price": 1}, Projection(&[]*projectionModel{}))
+}
@@ -0,0 +1,54 @@
+package mgodb
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrReadOnlyModel = errors.New("model is read-only")
+)
+
+type readOnlyModels struct {
+	sync.RWMutex
+	collections map[string]bool
+}
+
+// SetReadOnly marks the collection of model as read-only (analytics replicas, views...),
+// the writes of this package against it return ErrReadOnlyModel.
+// a model can also declare itself read-only with a ReadOnly() bool method
+// for example:
+// SetReadOnly(&CarReport{}, true)
+func (db *Database) SetReadOnly(model interface{}, readOnly bool) {
+	collection := GetCollectionName(model)
+	db.readOnly.Lock()
+	defer db.readOnly.Unlock()
+	if db.readOnly.collections == nil {
+		db.readOnly.collections = make(map[string]bool)
+	}
+	if readOnly {
+		db.readOnly.collections[collection] = true
+	} else {
+		delete(db.readOnly.collections, collection)
+	}
+}
+
+func SetReadOnly(model interface{}, readOnly bool) {
+	_db.SetReadOnly(model, readOnly)
+}
+
+// checkWritable returns ErrReadOnlyModel when model is read-only
+func (db *Database) checkWritable(model interface{}) error {
+	if vals := callModelMethod(model, "ReadOnly"); len(vals) > 0 {
+		if readOnly, ok := vals[0].Interface().(bool); ok && readOnly {
+			return ErrReadOnlyModel
+		}
+	}
+
+	db.readOnly.RLock()
+	defer db.readOnly.RUnlock()
+	if db.readOnly.collections[GetCollectionName(model)] {
+		return ErrReadOnlyModel
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type readOnlyReport struct {
+	Total int `bson:"total"`
+}
+
+func (m *readOnlyReport) ReadOnly() bool {
+	return true
+}
+
+func TestReadOnly(t *testing.T) {
+	db := new(Database)
+	assert.Nil(t, db.checkWritable(&fieldsInner{}))
+	assert.Equal(t, ErrReadOnlyModel, db.checkWritable(&readOnlyReport{}))
+
+	db.SetReadOnly(&fieldsInner{}, true)
+	assert.Equal(t, ErrReadOnlyModel, db.checkWritable(&fieldsInner{}))
+	db.SetReadOnly(&fieldsInner{}, false)
+	assert.Nil(t, db.checkWritable(&fieldsInner{}))
+}
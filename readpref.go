@@ -0,0 +1,112 @@
+package mgodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type readModeKey struct{}
+
+// SetReadMode sets the read preference of the operations of db, Init and New read
+// eventually (secondaryPreferred without consistency between reads).
+// mgo.SecondaryPreferred or mgo.Nearest offload reads to the secondaries of a replica set,
+// mgo.Primary reads the latest writes. writes always go to the primary.
+// call it after Init
+func (db *Database) SetReadMode(mode mgo.Mode) error {
+	sess := db.session.Load()
+	if sess == nil {
+		return ErrNotInitialized
+	}
+	sess.SetMode(mode, true)
+	return nil
+}
+
+// SetReadPreference is like SetReadMode with the name of a mode: primary, primaryPreferred,
+// secondary, secondaryPreferred, nearest, eventual, monotonic or strong
+// for example:
+// SetReadPreference("secondaryPreferred")
+func (db *Database) SetReadPreference(name string) error {
+	mode, ok := readModes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("%w: readMode %q", ErrInvalidConfig, name)
+	}
+	return db.SetReadMode(mode)
+}
+
+func SetReadMode(mode mgo.Mode) error {
+	return _db.SetReadMode(mode)
+}
+
+func SetReadPreference(name string) error {
+	return _db.SetReadPreference(name)
+}
+
+// WithReadMode returns a copy of ctx whose operations read with mode
+// instead of the mode of SetReadMode
+// for example, a report offloaded to the secondaries:
+// err := FindContext(WithReadMode(ctx, mgo.SecondaryPreferred), &rows, query, 1, 1000, nil)
+func WithReadMode(ctx context.Context, mode mgo.Mode) context.Context {
+	return context.WithValue(ctx, readModeKey{}, mode)
+}
+
+// CallOption overrides a setting of the database for one operation,
+// see ReadSecondary, WMajority and WithOptions
+type CallOption func(ctx context.Context) context.Context
+
+// WithOptions returns a copy of ctx whose operations use opts, for the Context variants
+// for example:
+// err := FindContext(WithOptions(ctx, ReadSecondary()), &rows, query, 1, 1000, nil)
+func WithOptions(ctx context.Context, opts ...CallOption) context.Context {
+	for _, opt := range opts {
+		ctx = opt(ctx)
+	}
+	return ctx
+}
+
+// ReadMode reads with mode instead of the mode of SetReadMode, like WithReadMode
+// for example:
+// FindOne(car, bson.M{"carId": 1}, ReadMode(mgo.Nearest))
+func ReadMode(mode mgo.Mode) CallOption {
+	return func(ctx context.Context) context.Context {
+		return WithReadMode(ctx, mode)
+	}
+}
+
+// ReadSecondary offloads the read to a secondary, to the primary when none is available
+// for example:
+// FindOne(car, bson.M{"carId": 1}, ReadSecondary())
+func ReadSecondary() CallOption {
+	return ReadMode(mgo.SecondaryPreferred)
+}
+
+// ReadPrimary reads the latest writes
+func ReadPrimary() CallOption {
+	return ReadMode(mgo.Primary)
+}
+
+// readModeOf returns the read mode of the operations of ctx, false before Init.
+// a pinned ctx reads from the primary
+func (db *Database) readModeOf(ctx context.Context) (mgo.Mode, bool) {
+	if db.Pinned(ctx) {
+		return mgo.Strong, true
+	}
+	if mode, ok := ctx.Value(readModeKey{}).(mgo.Mode); ok {
+		return mode, true
+	}
+	sess := db.session.Load()
+	if sess == nil {
+		return 0, false
+	}
+	return sess.Mode(), true
+}
+
+// applyReadMode sets the read mode of ctx on a latched session,
+// which keeps the mode of the last operation otherwise
+func (db *Database) applyReadMode(ctx context.Context, sess *mgo.Session) {
+	if mode, ok := db.readModeOf(ctx); ok && sess.Mode() != mode {
+		sess.SetMode(mode, true)
+	}
+}
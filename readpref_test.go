@@ -0,0 +1,29 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestReadMode(t *testing.T) {
+	db := &Database{}
+	_, ok := db.readModeOf(context.Background())
+	assert.False(t, ok)
+	mode, ok := db.readModeOf(WithReadMode(context.Background(), mgo.SecondaryPreferred))
+	assert.True(t, ok)
+	assert.Equal(t, mgo.SecondaryPreferred, mode)
+
+	mode, ok = db.readModeOf(WithOptions(context.Background(), ReadSecondary()))
+	assert.True(t, ok)
+	assert.Equal(t, mgo.SecondaryPreferred, mode)
+	mode, ok = db.readModeOf(WithOptions(context.Background(), ReadSecondary(), ReadPrimary()))
+	assert.True(t, ok)
+	assert.Equal(t, mgo.Primary, mode)
+
+	assert.Equal(t, ErrNotInitialized, db.SetReadMode(mgo.Primary))
+	assert.True(t, errors.Is(db.SetReadPreference("farthest"), ErrInvalidConfig))
+}
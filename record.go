@@ -0,0 +1,35 @@
+package mgodb
+
+import (
+	"sync"
+)
+
+// CommandRecorder receives every observed operation with its query
+// (the selector, filter or pipeline)
+type CommandRecorder func(op string, collection string, query interface{})
+
+type recorderHolder struct {
+	sync.RWMutex
+	recorder CommandRecorder
+}
+
+// SetRecorder sets the recorder of all operations, nil removes it,
+// mgodbtest.Snapshot uses it to build golden files of the issued queries
+func (db *Database) SetRecorder(recorder CommandRecorder) {
+	db.recorder.Lock()
+	defer db.recorder.Unlock()
+	db.recorder.recorder = recorder
+}
+
+func SetRecorder(recorder CommandRecorder) {
+	_db.SetRecorder(recorder)
+}
+
+func (db *Database) record(op string, collection string, query interface{}) {
+	db.recorder.RLock()
+	recorder := db.recorder.recorder
+	db.recorder.RUnlock()
+	if recorder != nil {
+		recorder(op, collection, query)
+	}
+}
@@ -0,0 +1,100 @@
+package mgodb
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// error codes returned by a replica set member which is not (or no longer) primary
+var stepdownCodes = map[int]bool{
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+// isStepdownError reports whether err was caused by a primary stepdown,
+// in which case the session topology must be refreshed before retrying
+func isStepdownError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	code := 0
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		code = e.Code
+	case *mgo.LastError:
+		code = e.Code
+	}
+	if stepdownCodes[code] {
+		return true
+	}
+
+	// the old server versions and the socket layer only report a message
+	if err == io.EOF {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "not master") || strings.Contains(msg, "node is recovering")
+}
+
+type retryBudgetKey struct{}
+
+// retries left to the operations of a context
+type retryBudget struct {
+	remaining int32
+}
+
+// WithRetryBudget returns a copy of ctx allowing at most retries internal
+// retries in total across all its operations, so retries layered in the
+// application and the driver do not multiply into long stalls.
+// the deadline of ctx is respected as well: no retry starts after it
+// for example:
+// ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+// defer cancel()
+// ctx = WithRetryBudget(ctx, 1)
+func WithRetryBudget(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, &retryBudget{remaining: int32(retries)})
+}
+
+// RetryBudget returns the retries left in ctx, -1 if it has no budget
+func RetryBudget(ctx context.Context) int {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if budget == nil {
+		return -1
+	}
+	return int(atomic.LoadInt32(&budget.remaining))
+}
+
+// takeRetry reports whether ctx allows one more retry and consumes it
+func takeRetry(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return false
+	}
+
+	budget, _ := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if budget == nil {
+		return true
+	}
+	for {
+		remaining := atomic.LoadInt32(&budget.remaining)
+		if remaining <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&budget.remaining, remaining, remaining-1) {
+			return true
+		}
+	}
+}
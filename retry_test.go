@@ -0,0 +1,37 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestIsStepdownError(t *testing.T) {
+	assert.False(t, isStepdownError(nil))
+	assert.False(t, isStepdownError(mgo.ErrNotFound))
+	assert.False(t, isStepdownError(&mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"}))
+	assert.True(t, isStepdownError(&mgo.QueryError{Code: 10107, Message: "not master"}))
+	assert.True(t, isStepdownError(&mgo.LastError{Code: 189, Err: "primary stepped down"}))
+	assert.True(t, isStepdownError(errors.New("not master and slaveOk=false")))
+	assert.True(t, isStepdownError(io.EOF))
+}
+
+func TestRetryBudget(t *testing.T) {
+	assert.Equal(t, -1, RetryBudget(context.Background()))
+	assert.True(t, takeRetry(context.Background()))
+
+	ctx := WithRetryBudget(context.Background(), 2)
+	assert.True(t, takeRetry(ctx))
+	assert.True(t, takeRetry(ctx))
+	assert.False(t, takeRetry(ctx))
+	assert.Equal(t, 0, RetryBudget(ctx))
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	assert.False(t, takeRetry(ctx))
+}
@@ -0,0 +1,152 @@
+package mgodb
+
+import (
+	"context"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// a generic result document for ad-hoc queries without a Go struct,
+// getters accept dotted paths into embedded documents
+type Row map[string]interface{}
+
+// RowsCollection is the model FindRows and AggregateRows pass to the Policy,
+// the name of the collection they read
+type RowsCollection string
+
+// Get returns the value at path, nil if missing
+func (r Row) Get(path string) interface{} {
+	return lookupPath(bson.M(r), path)
+}
+
+func (r Row) String(path string) string {
+	s, _ := r.Get(path).(string)
+	return s
+}
+
+// Int64 returns any integer or double value at path as int64
+func (r Row) Int64(path string) int64 {
+	return toInt64(r.Get(path))
+}
+
+// Float64 returns any integer or double value at path as float64
+func (r Row) Float64(path string) float64 {
+	switch v := r.Get(path).(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+func (r Row) Bool(path string) bool {
+	b, _ := r.Get(path).(bool)
+	return b
+}
+
+func (r Row) Time(path string) time.Time {
+	t, _ := r.Get(path).(time.Time)
+	return t
+}
+
+// Row returns the embedded document at path
+func (r Row) Row(path string) Row {
+	m, _ := asDoc(r.Get(path))
+	return Row(m)
+}
+
+// Rows returns the array of embedded documents at path
+func (r Row) Rows(path string) []Row {
+	items, _ := r.Get(path).([]interface{})
+	rows := make([]Row, 0, len(items))
+	for _, item := range items {
+		if m, ok := asDoc(item); ok {
+			rows = append(rows, Row(m))
+		}
+	}
+	return rows
+}
+
+// find records of a collection as generic rows, paged like Find
+// for example:
+// rows, err := FindRows("car", bson.M{...}, 1, 15, []string{"-price"})
+// rows[0].String("name")
+func FindRows(collection string, query interface{}, page int, pageSize int, sorts []string) ([]Row, error) {
+	if err := _db.applyPolicy(context.Background(), RowsCollection(collection), ActionFind, &query); err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"err":        err,
+		}).Error("find rows db error: policy denied")
+		return nil, err
+	}
+	var rows []Row
+	skip := (page - 1) * pageSize
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		q, err := _db.query(sess, collection, query)
+		if err != nil {
+			return err
+		}
+		q = q.Sort(sorts...)
+		if page >= 0 || pageSize >= 0 {
+			q = q.Skip(skip).Limit(pageSize)
+		}
+		return q.All(&rows)
+	})
+	_db.observe(context.Background(), "find", collection, query, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"query":      query,
+			"page":       page,
+			"pageSize":   pageSize,
+			"sorts":      sorts,
+			"err":        err,
+		}).Error("find rows db error: database operate fail")
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// aggregate a collection into generic rows
+// for example:
+// rows, err := AggregateRows("car", []bson.M{{"$group": bson.M{"_id": "$name", "total": bson.M{"$sum": "$price"}}}})
+// rows[0].Int64("total")
+func AggregateRows(collection string, piplines interface{}) ([]Row, error) {
+	piplines = buildPipeline(piplines)
+	if err := _db.applyPipelinePolicy(context.Background(), RowsCollection(collection), &piplines); err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"err":        err,
+		}).Error("aggregate rows db error: policy denied")
+		return nil, err
+	}
+	var rows []Row
+	start := time.Now()
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		return pipe.All(&rows)
+	})
+	_db.observe(context.Background(), "aggregate", collection, piplines, start, err)
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"piplines":   piplines,
+			"err":        err,
+		}).Error("aggregate rows db error: database operate fail")
+		return nil, err
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,52 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRow(t *testing.T) {
+	now := time.Now()
+	row := Row{
+		"name":    "car",
+		"price":   100,
+		"total":   2.5,
+		"sold":    true,
+		"created": now,
+		"remark":  bson.M{"color": "red"},
+		"cars":    []interface{}{bson.M{"carId": int64(1)}, "x"},
+	}
+	assert.Equal(t, "car", row.String("name"))
+	assert.Equal(t, int64(100), row.Int64("price"))
+	assert.Equal(t, 2.5, row.Float64("total"))
+	assert.Equal(t, float64(100), row.Float64("price"))
+	assert.True(t, row.Bool("sold"))
+	assert.Equal(t, now, row.Time("created"))
+	assert.Equal(t, "red", row.String("remark.color"))
+	assert.Equal(t, "red", row.Row("remark").String("color"))
+	assert.Equal(t, 1, len(row.Rows("cars")))
+	assert.Equal(t, "", row.String("missing"))
+}
+
+func TestRowDecoded(t *testing.T) {
+	data, err := bson.Marshal(bson.M{
+		"price":  int32(100),
+		"remark": bson.M{"color": "red", "size": bson.M{"width": 2}},
+		"cars":   []interface{}{bson.M{"carId": int64(1)}, bson.M{"carId": int64(2)}},
+	})
+	assert.Nil(t, err)
+	row := Row{}
+	assert.Nil(t, bson.Unmarshal(data, &row))
+
+	assert.Equal(t, int64(100), row.Int64("price"))
+	assert.Equal(t, float64(100), row.Float64("price"))
+	assert.Equal(t, "red", row.String("remark.color"))
+	assert.Equal(t, int64(2), row.Int64("remark.size.width"))
+	assert.Equal(t, "red", row.Row("remark").String("color"))
+	rows := row.Rows("cars")
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, int64(2), rows[1].Int64("carId"))
+}
@@ -0,0 +1,193 @@
+package mgodb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archives are uploaded unsigned, their hash would take a second read of the file
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Sink keeps archives as objects of a bucket of S3, or of a store speaking its API
+// (GCS in interoperability mode, MinIO, Ceph), requests are signed with AWS signature v4
+// for example:
+// sink := S3Sink{Endpoint: "https://s3.eu-west-1.amazonaws.com", Region: "eu-west-1",
+// Bucket: "archives", AccessKey: key, SecretKey: secret}
+// Archive(&Order{}, bson.M{"created": bson.M{"$lt": cutoff}}, sink, "order/2020-01.json.gz")
+type S3Sink struct {
+	Endpoint  string // scheme and host, objects are addressed path style
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client // http.DefaultClient when nil
+}
+
+// Create returns a writer spooling the archive to a temporary file,
+// uploaded when it is closed
+func (s S3Sink) Create(name string) (io.WriteCloser, error) {
+	file, err := ioutil.TempFile("", "mgodb-archive")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Upload{sink: s, name: name, file: file}, nil
+}
+
+// Open returns the body of the archive object
+func (s S3Sink) Open(name string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(req, resp)
+	}
+	return resp.Body, nil
+}
+
+func (s S3Sink) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// request returns the signed request of the object name
+func (s S3Sink) request(method string, name string, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	// the signature covers the path encoded as S3 does, stricter than url does
+	base := u.Path
+	u.Path = base + "/" + s.Bucket + "/" + name
+	u.RawPath = base + "/" + s3Escape(s.Bucket+"/"+name)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-amz-content-sha256", s3UnsignedPayload)
+	s.sign(req, time.Now())
+	return req, nil
+}
+
+// sign adds the AWS signature v4 of the host and the headers of req
+func (s S3Sink) sign(req *http.Request, now time.Time) {
+	now = now.UTC()
+	stamp := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", stamp)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signed,
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+// s3Escape percent-encodes every byte of path but the unreserved ones and slashes
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(req *http.Request, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// an archive spooled to a temporary file until it is closed
+type s3Upload struct {
+	sink S3Sink
+	name string
+	file *os.File
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	return u.file.Write(p)
+}
+
+// Close uploads the archive, it is durable once Close returns nil
+func (u *s3Upload) Close() error {
+	defer os.Remove(u.file.Name())
+	defer u.file.Close()
+	size, err := u.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := u.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := u.sink.request(http.MethodPut, u.name, ioutil.NopCloser(u.file))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := u.sink.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(req, resp)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// consecutive cursor failures without progress ScanAll survives
+	scanRetries = 3
+	// wait before re-establishing a failed cursor, doubled on every retry
+	scanRetryDelay = 100 * time.Millisecond
+)
+
+// errors of fn stop a scan as they are, wrapped to tell them from cursor errors
+type scanStop struct {
+	err error
+}
+
+func (e *scanStop) Error() string {
+	return e.err.Error()
+}
+
+// ScanAll passes every record of the collection of model to fn, decoded into a new value
+// of the model type, in _id order. a failed cursor, a timeout for example, is
+// re-established after the last visited _id, so each record is visited once.
+// an error returned by fn stops the scan and is returned
+// for example:
+// ScanAll(&Car{}, func(doc interface{}) error {
+// car := doc.(*Car) ...
+// })
+func (db *Database) ScanAll(model interface{}, fn func(doc interface{}) error) error {
+	return db.ScanAllContext(context.Background(), model, fn)
+}
+
+// ScanAllContext is like ScanAll, when ctx is done the cursor is killed and ctx's error returned
+func (db *Database) ScanAllContext(ctx context.Context, model interface{}, fn func(doc interface{}) error) error {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("scan db error: validate model fail")
+		return err
+	}
+	var selector interface{}
+	if err := db.applyPolicy(ctx, model, ActionFind, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("scan db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	typ := reflect.TypeOf(model).Elem()
+	writer := db.upgradeWriterOf(ctx, model)
+	var last interface{}
+	failures := 0
+	start := time.Now()
+	for {
+		progressed := false
+		err := db.execute(ctx, func(sess *mgo.Session) error {
+			query := scanQuery(selector, last)
+			q, err := db.query(sess, collection, query)
+			if err != nil {
+				return &scanStop{err}
+			}
+			iter := db.trackCursor(ctx, collection, db.attribute(ctx, q.Sort("_id")).Iter())
+			steps, _ := db.upgradesOf(collection)
+			raw := bson.Raw{}
+			for iter.Next(&raw) {
+				id := struct {
+					Id interface{} `bson:"_id"`
+				}{}
+				if err := raw.Unmarshal(&id); err != nil {
+					iter.Close()
+					return err
+				}
+				doc := reflect.New(typ).Interface()
+				if err := db.decodeScanned(sess, collection, steps, writer, raw, doc); err != nil {
+					iter.Close()
+					return &scanStop{err}
+				}
+				if err := fn(doc); err != nil {
+					iter.Close()
+					return &scanStop{err}
+				}
+				last, progressed = id.Id, true
+			}
+			if err := ctx.Err(); err != nil {
+				iter.Close()
+				return &scanStop{err}
+			}
+			return iter.Close()
+		})
+		if err == nil {
+			db.observe(ctx, "scan", collection, selector, start, nil)
+			return nil
+		}
+		if stop, ok := err.(*scanStop); ok {
+			db.observe(ctx, "scan", collection, selector, start, stop.err)
+			return stop.err
+		}
+
+		if progressed {
+			failures = 0
+		}
+		failures++
+		if failures > scanRetries || ctx.Err() != nil {
+			db.observe(ctx, "scan", collection, selector, start, err)
+			db.logContext(ctx, Fields{
+				"collection": collection,
+				"last":       last,
+				"err":        err,
+			}).Error("scan db error: database operate fail")
+			return err
+		}
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"last":       last,
+			"err":        err,
+		}).Warn("mongodb: scan cursor failed, re-established")
+		time.Sleep(scanRetryDelay << uint(failures-1))
+	}
+}
+
+// scanQuery restricts selector to the records after the _id last, nil before the first one
+func scanQuery(selector interface{}, last interface{}) interface{} {
+	if last == nil {
+		if selector == nil {
+			return bson.M{}
+		}
+		return selector
+	}
+	after := bson.M{"_id": bson.M{"$gt": last}}
+	if selector == nil {
+		return after
+	}
+	return bson.M{"$and": []interface{}{selector, after}}
+}
+
+// decodeScanned decodes a scanned record into doc, upgrading it on the way
+func (db *Database) decodeScanned(sess *mgo.Session, collection string, steps map[int]Upgrade, writer *upgradeWriter, raw bson.Raw, doc interface{}) error {
+	if steps == nil {
+		if err := raw.Unmarshal(doc); err != nil {
+			return err
+		}
+	} else {
+		upgraded := bson.M{}
+		if err := raw.Unmarshal(&upgraded); err != nil {
+			return err
+		}
+		if err := db.upgradeRecord(sess, collection, steps, writer, upgraded); err != nil {
+			return err
+		}
+		if err := remarshal(upgraded, doc); err != nil {
+			return err
+		}
+	}
+	db.afterDecode(doc)
+	return afterFind(doc)
+}
+
+func ScanAll(model interface{}, fn func(doc interface{}) error) error {
+	return _db.ScanAll(model, fn)
+}
+
+func ScanAllContext(ctx context.Context, model interface{}, fn func(doc interface{}) error) error {
+	return _db.ScanAllContext(ctx, model, fn)
+}
@@ -0,0 +1,16 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestScanQuery(t *testing.T) {
+	assert.Equal(t, bson.M{}, scanQuery(nil, nil))
+	assert.Equal(t, bson.M{"tenant": "a"}, scanQuery(bson.M{"tenant": "a"}, nil))
+	assert.Equal(t, bson.M{"_id": bson.M{"$gt": 3}}, scanQuery(nil, 3))
+	assert.Equal(t, bson.M{"$and": []interface{}{bson.M{"tenant": "a"}, bson.M{"_id": bson.M{"$gt": 3}}}},
+		scanQuery(bson.M{"tenant": "a"}, 3))
+}
@@ -0,0 +1,180 @@
+package mgodb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// distinct values counted per field, the cardinality is capped at it
+const schemaCardinalityLimit = 1000
+
+// the schema of a collection inferred from sampled documents
+type Schema struct {
+	Collection string         `json:"collection"`
+	Sampled    int            `json:"sampled"`
+	Fields     []*SchemaField `json:"fields"`
+}
+
+// one field of an inferred schema, embedded fields use dotted paths
+type SchemaField struct {
+	Path        string         `json:"path"`
+	Types       map[string]int `json:"types"`
+	Count       int            `json:"count"`
+	Optional    bool           `json:"optional"`
+	Cardinality int            `json:"cardinality"`
+	values      map[string]bool
+}
+
+// sample documents of collection and report field names, types, optionality and cardinality
+// for example:
+// schema, err := InferSchema("car", 1000)
+// fmt.Println(schema.GoStruct("Car"))
+func InferSchema(collection string, sampleSize int) (*Schema, error) {
+	if sampleSize <= 0 {
+		return nil, ErrBatchSize
+	}
+
+	var docs []bson.M
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).Pipe([]bson.M{{"$sample": bson.M{"size": sampleSize}}}).All(&docs)
+	})
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"sampleSize": sampleSize,
+			"err":        err,
+		}).Error("infer schema error: database operate fail")
+		return nil, err
+	}
+
+	fields := make(map[string]*SchemaField)
+	for _, doc := range docs {
+		inferDocument(fields, "", doc)
+	}
+
+	schema := &Schema{Collection: collection, Sampled: len(docs)}
+	for _, field := range fields {
+		field.Optional = field.Count < len(docs) || field.Types["null"] > 0
+		field.Cardinality = len(field.values)
+		schema.Fields = append(schema.Fields, field)
+	}
+	sort.Slice(schema.Fields, func(i, j int) bool { return schema.Fields[i].Path < schema.Fields[j].Path })
+	return schema, nil
+}
+
+func inferDocument(fields map[string]*SchemaField, prefix string, doc bson.M) {
+	for key, value := range doc {
+		path := prefix + key
+		field, ok := fields[path]
+		if !ok {
+			field = &SchemaField{Path: path, Types: make(map[string]int), values: make(map[string]bool)}
+			fields[path] = field
+		}
+		field.Count++
+		field.Types[bsonTypeName(value)]++
+		if isComparable(value) && len(field.values) < schemaCardinalityLimit {
+			field.values[fmt.Sprintf("%T:%v", value, value)] = true
+		}
+		if sub, ok := value.(bson.M); ok {
+			inferDocument(fields, path+".", sub)
+		}
+	}
+}
+
+func bsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case bson.ObjectId:
+		return "objectId"
+	case bson.M:
+		return "object"
+	case []interface{}:
+		return "array"
+	case []byte, bson.Binary:
+		return "binData"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+var goTypeNames = map[string]string{
+	"string":   "string",
+	"int":      "int",
+	"long":     "int64",
+	"double":   "float64",
+	"bool":     "bool",
+	"date":     "time.Time",
+	"objectId": "bson.ObjectId",
+	"object":   "bson.M",
+	"array":    "[]interface{}",
+	"binData":  "[]byte",
+}
+
+// GoStruct emits a Go struct with the top level fields of the schema
+func (s *Schema) GoStruct(name string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type %s struct {\n", name)
+	for _, field := range s.Fields {
+		if strings.Contains(field.Path, ".") {
+			continue
+		}
+
+		typ := "interface{}"
+		var found []string
+		for t := range field.Types {
+			if t != "null" {
+				found = append(found, t)
+			}
+		}
+		if len(found) == 1 && goTypeNames[found[0]] != "" {
+			typ = goTypeNames[found[0]]
+		}
+
+		tag := field.Path
+		if field.Optional {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&buf, "\t%s %s `json:\"%s\" bson:\"%s\"`\n", goFieldName(field.Path), typ, field.Path, tag)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// carId to CarId, _id to Id, car_name to CarName
+func goFieldName(key string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, c := range key {
+		if c == '_' || c == '-' || c == ' ' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		buf.WriteRune(c)
+	}
+	if buf.Len() == 0 {
+		return "Field"
+	}
+	return buf.String()
+}
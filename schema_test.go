@@ -0,0 +1,31 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestInferDocument(t *testing.T) {
+	fields := make(map[string]*SchemaField)
+	inferDocument(fields, "", bson.M{"carId": int64(1), "name": "a", "remark": bson.M{"color": "red"}})
+	inferDocument(fields, "", bson.M{"carId": int64(2), "name": "a"})
+
+	assert.Equal(t, 2, fields["carId"].Count)
+	assert.Equal(t, 2, len(fields["carId"].values))
+	assert.Equal(t, 1, len(fields["name"].values))
+	assert.Equal(t, 1, fields["remark.color"].Types["string"])
+
+	schema := &Schema{Sampled: 2}
+	for _, path := range []string{"carId", "name", "remark"} {
+		field := fields[path]
+		field.Optional = field.Count < 2
+		schema.Fields = append(schema.Fields, field)
+	}
+	assert.Equal(t, "type Car struct {\n"+
+		"\tCarId int64 `json:\"carId\" bson:\"carId\"`\n"+
+		"\tName string `json:\"name\" bson:\"name\"`\n"+
+		"\tRemark bson.M `json:\"remark\" bson:\"remark,omitempty\"`\n"+
+		"}\n", schema.GoStruct("Car"))
+}
@@ -0,0 +1,208 @@
+package mgodb
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// records inserted per InsertMany by Seed
+	seedBatchSize = 500
+	// sub documents deeper than this are left empty, which ends recursive types
+	seedMaxDepth = 4
+)
+
+// SeedRules overrides the generated value of fields, by bson name (dotted for
+// sub documents): a fixed value, a []interface{} to pick from, or a
+// func(i int) interface{} called with the index of the record
+type SeedRules map[string]interface{}
+
+// Seed generates n records of the type of model and inserts them, for load tests
+// and demo environments. values follow the field types and the tag hints
+// `mgodb:"min=1,max=100"` for numbers, string lengths and slice lengths,
+// and `mgodb:"enum=red|blue"` for values picked from a list, rules take precedence.
+// returns the number of inserted records
+// for example:
+// Seed(&Car{}, 1000, SeedRules{"carId": func(i int) interface{} { return int64(i) }, "name": []interface{}{"bmw", "audi"}})
+func Seed(model interface{}, n int, rules SeedRules) (int, error) {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("seed error: validate model fail")
+		return 0, err
+	}
+
+	typ := reflect.TypeOf(model).Elem()
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	inserted := 0
+	for inserted < n {
+		size := n - inserted
+		if size > seedBatchSize {
+			size = seedBatchSize
+		}
+		docs := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			doc := reflect.New(typ)
+			seedStruct(r, doc.Elem(), "", inserted+i, rules)
+			docs = append(docs, doc.Interface())
+		}
+		if err := InsertMany(docs); err != nil {
+			return inserted, err
+		}
+		inserted += size
+	}
+	return inserted, nil
+}
+
+func seedStruct(r *rand.Rand, val reflect.Value, prefix string, i int, rules SeedRules) {
+	typ := val.Type()
+	for k := 0; k < typ.NumField(); k++ {
+		field := typ.Field(k)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, inline := bsonName(field)
+		if name == "" && !inline {
+			continue
+		}
+		path := prefix
+		if !inline {
+			path = prefix + name
+		}
+		if inline && val.Field(k).Kind() == reflect.Struct {
+			seedStruct(r, val.Field(k), prefix, i, rules)
+			continue
+		}
+		seedValue(r, val.Field(k), path, mgodbTag(field), i, rules)
+	}
+}
+
+func seedValue(r *rand.Rand, val reflect.Value, path string, hints map[string]string, i int, rules SeedRules) {
+	if rule, ok := rules[path]; ok {
+		var value interface{}
+		switch v := rule.(type) {
+		case func(int) interface{}:
+			value = v(i)
+		case []interface{}:
+			if len(v) > 0 {
+				value = v[r.Intn(len(v))]
+			}
+		default:
+			value = v
+		}
+		if value != nil {
+			rv := reflect.ValueOf(value)
+			if rv.Type().ConvertibleTo(val.Type()) {
+				val.Set(rv.Convert(val.Type()))
+			}
+		}
+		return
+	}
+
+	if enum, ok := hints["enum"]; ok && enum != "" {
+		values := strings.Split(enum, "|")
+		seedScalar(val, values[r.Intn(len(values))])
+		return
+	}
+
+	min, max := seedRange(hints, 0, 1000)
+	switch val.Interface().(type) {
+	case time.Time:
+		// within the last year
+		val.Set(reflect.ValueOf(time.Now().UTC().Add(-time.Duration(r.Int63n(int64(365 * 24 * time.Hour))))))
+		return
+	case bson.ObjectId:
+		val.Set(reflect.ValueOf(bson.NewObjectId()))
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		min, max = seedRange(hints, 6, 12)
+		val.SetString(seedWord(r, min+r.Intn(max-min+1)))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.SetInt(int64(min) + r.Int63n(int64(max-min+1)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if min < 0 {
+			min = 0
+		}
+		val.SetUint(uint64(min) + uint64(r.Int63n(int64(max-min+1))))
+	case reflect.Float32, reflect.Float64:
+		val.SetFloat(float64(min) + r.Float64()*float64(max-min))
+	case reflect.Bool:
+		val.SetBool(r.Intn(2) == 1)
+	case reflect.Struct:
+		seedStruct(r, val, path+".", i, rules)
+	case reflect.Ptr:
+		if val.Type().Elem().Kind() == reflect.Struct && strings.Count(path, ".") >= seedMaxDepth {
+			return
+		}
+		item := reflect.New(val.Type().Elem())
+		seedValue(r, item.Elem(), path, hints, i, rules)
+		val.Set(item)
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		min, max = seedRange(hints, 0, 3)
+		n := min + r.Intn(max-min+1)
+		slice := reflect.MakeSlice(val.Type(), n, n)
+		for k := 0; k < n; k++ {
+			seedValue(r, slice.Index(k), path, nil, i, rules)
+		}
+		val.Set(slice)
+	}
+}
+
+// seedRange reads the min and max hints, def when missing
+func seedRange(hints map[string]string, defMin int, defMax int) (int, int) {
+	min, max := defMin, defMax
+	if v, err := strconv.Atoi(hints["min"]); err == nil {
+		min = v
+	}
+	if v, err := strconv.Atoi(hints["max"]); err == nil {
+		max = v
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// seedScalar sets a value given as text
+func seedScalar(val reflect.Value, text string) {
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, _ := strconv.ParseInt(text, 10, 64)
+		val.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, _ := strconv.ParseUint(text, 10, 64)
+		val.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, _ := strconv.ParseFloat(text, 64)
+		val.SetFloat(f)
+	case reflect.Bool:
+		b, _ := strconv.ParseBool(text)
+		val.SetBool(b)
+	default:
+		panic(fmt.Sprintf("mgodb: enum hint on unsupported field type %s", val.Type()))
+	}
+}
+
+func seedWord(r *rand.Rand, n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, n)
+	for k := range b {
+		b[k] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
@@ -0,0 +1,62 @@
+package mgodb
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type seedNode struct {
+	Name  string `mgodb:"min=3,max=3"`
+	Child *seedNode
+}
+
+type seedModel struct {
+	Id      bson.ObjectId `bson:"_id"`
+	Price   int           `bson:"price" mgodb:"min=10,max=20"`
+	Rate    float64       `bson:"rate" mgodb:"min=1,max=2"`
+	Color   string        `bson:"color" mgodb:"enum=red|blue"`
+	Level   uint8         `bson:"level" mgodb:"enum=1|2"`
+	Tags    []string      `bson:"tags" mgodb:"min=2,max=2"`
+	Created time.Time     `bson:"created"`
+	Serial  int64         `bson:"serial"`
+	Brand   string        `bson:"brand"`
+	Node    seedNode      `bson:"node"`
+	Skipped string        `bson:"-"`
+}
+
+func TestSeedStruct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	rules := SeedRules{
+		"serial": func(i int) interface{} { return i * 2 },
+		"brand":  []interface{}{"bmw"},
+	}
+	for i := 0; i < 50; i++ {
+		doc := seedModel{}
+		seedStruct(r, reflect.ValueOf(&doc).Elem(), "", i, rules)
+		assert.True(t, doc.Id.Valid())
+		assert.True(t, doc.Price >= 10 && doc.Price <= 20)
+		assert.True(t, doc.Rate >= 1 && doc.Rate <= 2)
+		assert.Contains(t, []string{"red", "blue"}, doc.Color)
+		assert.Contains(t, []uint8{1, 2}, doc.Level)
+		assert.Len(t, doc.Tags, 2)
+		assert.True(t, doc.Created.Before(time.Now()) && doc.Created.After(time.Now().AddDate(-1, 0, -1)))
+		assert.Equal(t, int64(i*2), doc.Serial)
+		assert.Equal(t, "bmw", doc.Brand)
+		assert.Len(t, doc.Node.Name, 3)
+		assert.Empty(t, doc.Skipped)
+	}
+
+	// recursive types stop at the max depth
+	doc := seedModel{}
+	seedStruct(r, reflect.ValueOf(&doc).Elem(), "", 0, nil)
+	depth := 0
+	for node := &doc.Node; node != nil; node = node.Child {
+		depth++
+	}
+	assert.Equal(t, seedMaxDepth, depth)
+}
@@ -0,0 +1,62 @@
+package mgodb
+
+import (
+	"context"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// options of FindWith, Page and PageSize -1 fetch every record as for Find
+type FindOptions struct {
+	Page     int
+	PageSize int
+	// sort fields, the model default sort when empty
+	Sorts []string
+	// projection of the fetched fields, such as bson.M{"name": 1}, every field when nil
+	Select interface{}
+}
+
+// FindOneSelect is like FindOne, only the fields of projection are fetched
+// for example:
+// car := &Car{}
+// FindOneSelect(car, bson.M{"carId": 1}, bson.M{"name": 1, "price": 1})
+func (db *Database) FindOneSelect(model interface{}, query interface{}, projection interface{}) error {
+	_, err := db.findOne(context.Background(), model, query, projection)
+	return err
+}
+
+// FindOneSelectContext is like FindOneSelect, ctx bounds the wait for a session and the operation
+func (db *Database) FindOneSelectContext(ctx context.Context, model interface{}, query interface{}, projection interface{}) error {
+	_, err := db.findOne(ctx, model, query, projection)
+	return err
+}
+
+func FindOneSelect(model interface{}, query interface{}, projection interface{}) error {
+	return _db.FindOneSelect(model, query, projection)
+}
+
+func FindOneSelectContext(ctx context.Context, model interface{}, query interface{}, projection interface{}) error {
+	return _db.FindOneSelectContext(ctx, model, query, projection)
+}
+
+// oneSelected is oneUpgraded for a projected record, upgraded without writing it back
+func (db *Database) oneSelected(sess *mgo.Session, collection string, q *mgo.Query, result interface{}) error {
+	steps, _ := db.upgradesOf(collection)
+	if steps == nil {
+		return q.One(result)
+	}
+	doc := bson.M{}
+	if err := q.One(&doc); err != nil {
+		return err
+	}
+	if err := db.upgradeRecord(sess, collection, steps, nil, doc); err != nil {
+		return err
+	}
+	return remarshal(doc, result)
+}
+
+// allSelected is allUpgraded for projected records, upgraded without writing them back
+func (db *Database) allSelected(sess *mgo.Session, collection string, q *mgo.Query, result interface{}) error {
+	return db.decodeAll(sess, collection, q, result, nil)
+}
@@ -0,0 +1,217 @@
+package mgodb
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// longest function body accepted in a pipeline
+const serverJSMaxBody = 16 * 1024
+
+var (
+	ErrServerJSDisabled    = errors.New("server-side javascript is disabled, see EnableServerJS")
+	ErrServerJSUnsupported = errors.New("$function and $accumulator require mongodb 4.4 or later")
+	ErrServerJSTooLarge    = errors.New("server-side javascript function body is too large")
+)
+
+type serverJS struct {
+	sync.RWMutex
+	enabled bool
+}
+
+// EnableServerJS allows pipelines to run javascript on the server through $function and
+// $accumulator. it is off by default: javascript is slow, runs in the server's process,
+// and is disabled by servers started with security.javascriptEnabled false.
+// keep it to the few aggregations which cannot be written with operators
+func (db *Database) EnableServerJS(enabled bool) {
+	db.serverJS.Lock()
+	defer db.serverJS.Unlock()
+	db.serverJS.enabled = enabled
+}
+
+func EnableServerJS(enabled bool) {
+	_db.EnableServerJS(enabled)
+}
+
+// Function returns a $function expression running body on args
+// for example:
+// {"$addFields": bson.M{"slug": Function(`function(name) { return name.toLowerCase().replace(/ /g, "-") }`, "$name")}}
+func Function(body string, args ...interface{}) bson.M {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return bson.M{"$function": bson.M{"body": body, "args": args, "lang": "js"}}
+}
+
+// functions of a custom accumulator, Merge combines two states, Finalize is optional
+type AccumulatorSpec struct {
+	Init           string
+	InitArgs       []interface{}
+	Accumulate     string
+	AccumulateArgs []interface{}
+	Merge          string
+	Finalize       string
+}
+
+// Accumulator returns a $accumulator expression for $group
+// for example:
+// {"$group": bson.M{"_id": "$ownerId", "names": Accumulator(AccumulatorSpec{
+// Init: `function() { return [] }`,
+// Accumulate: `function(state, name) { return state.concat(name) }`, AccumulateArgs: []interface{}{"$name"},
+// Merge: `function(a, b) { return a.concat(b) }`,
+// })}}
+func Accumulator(spec AccumulatorSpec) bson.M {
+	acc := bson.M{
+		"init":           spec.Init,
+		"accumulate":     spec.Accumulate,
+		"accumulateArgs": spec.AccumulateArgs,
+		"merge":          spec.Merge,
+		"lang":           "js",
+	}
+	if spec.AccumulateArgs == nil {
+		acc["accumulateArgs"] = []interface{}{}
+	}
+	if spec.InitArgs != nil {
+		acc["initArgs"] = spec.InitArgs
+	}
+	if spec.Finalize != "" {
+		acc["finalize"] = spec.Finalize
+	}
+	return bson.M{"$accumulator": acc}
+}
+
+// javascript found in a pipeline or a query
+type jsUse int
+
+const (
+	// $where of a query
+	jsWhere jsUse = 1 << iota
+	// $function or $accumulator, mongodb 4.4 or later
+	jsFunction
+)
+
+// pipe returns the aggregation of piplines on collection once checkServerJS accepts it,
+// aggregations are run through it
+func (db *Database) pipe(sess *mgo.Session, collection string, piplines interface{}) (*mgo.Pipe, error) {
+	if err := db.checkServerJS(sess, piplines); err != nil {
+		return nil, err
+	}
+	return sess.DB("").C(collection).Pipe(piplines), nil
+}
+
+// query is pipe for the queries of find, count and distinct,
+// which run javascript through $where or $function in $expr
+func (db *Database) query(sess *mgo.Session, collection string, query interface{}) (*mgo.Query, error) {
+	if err := db.checkServerJS(sess, query); err != nil {
+		return nil, err
+	}
+	return sess.DB("").C(collection).Find(query), nil
+}
+
+// checkServerJS rejects pipelines and queries running javascript unless it is enabled,
+// the server supports it and the function bodies are not too large
+func (db *Database) checkServerJS(sess *mgo.Session, piplines interface{}) error {
+	uses, err := findServerJS(reflect.ValueOf(piplines))
+	if err != nil || uses == 0 {
+		return err
+	}
+	db.serverJS.RLock()
+	enabled := db.serverJS.enabled
+	db.serverJS.RUnlock()
+	if !enabled {
+		return ErrServerJSDisabled
+	}
+	if uses&jsFunction == 0 {
+		return nil
+	}
+	info, err := sess.BuildInfo()
+	if err != nil {
+		return err
+	}
+	if !info.VersionAtLeast(4, 4) {
+		return ErrServerJSUnsupported
+	}
+	return nil
+}
+
+// findServerJS tells whether a pipeline or a query uses $where, $function or $accumulator
+func findServerJS(val reflect.Value) (jsUse, error) {
+	for val.IsValid() && (val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr) {
+		if val.IsNil() {
+			return 0, nil
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return 0, nil
+	}
+
+	var uses jsUse
+	switch val.Kind() {
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return 0, nil
+		}
+		for _, key := range val.MapKeys() {
+			switch key.String() {
+			case "$function", "$accumulator":
+				uses |= jsFunction
+				if err := checkJSBodies(val.MapIndex(key)); err != nil {
+					return uses, err
+				}
+			case "$where":
+				uses |= jsWhere
+				if err := checkJSBodies(val.MapIndex(key)); err != nil {
+					return uses, err
+				}
+			}
+			inner, err := findServerJS(val.MapIndex(key))
+			if err != nil {
+				return uses, err
+			}
+			uses |= inner
+		}
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return 0, nil
+		}
+		// bson.D
+		if val.Type() == reflect.TypeOf(bson.D{}) {
+			m := bson.M{}
+			for _, elem := range val.Interface().(bson.D) {
+				m[elem.Name] = elem.Value
+			}
+			return findServerJS(reflect.ValueOf(m))
+		}
+		for i := 0; i < val.Len(); i++ {
+			inner, err := findServerJS(val.Index(i))
+			if err != nil {
+				return uses, err
+			}
+			uses |= inner
+		}
+	}
+	return uses, nil
+}
+
+// checkJSBodies checks the length of the functions of a $function or $accumulator,
+// or of a $where
+func checkJSBodies(val reflect.Value) error {
+	if body, ok := val.Interface().(string); ok && len(body) > serverJSMaxBody {
+		return ErrServerJSTooLarge
+	}
+	spec, ok := val.Interface().(bson.M)
+	if !ok {
+		return nil
+	}
+	for _, key := range []string{"body", "init", "accumulate", "merge", "finalize"} {
+		if body, ok := spec[key].(string); ok && len(body) > serverJSMaxBody {
+			return ErrServerJSTooLarge
+		}
+	}
+	return nil
+}
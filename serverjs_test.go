@@ -0,0 +1,58 @@
+package mgodb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFindServerJS(t *testing.T) {
+	uses, err := findServerJS(reflect.ValueOf([]bson.M{{"$match": bson.M{"name": "xx"}}}))
+	assert.NoError(t, err)
+	assert.Equal(t, jsUse(0), uses)
+
+	slug := Function(`function(name) { return name.toLowerCase() }`, "$name")
+	uses, err = findServerJS(reflect.ValueOf([]bson.M{{"$addFields": bson.M{"slug": slug}}}))
+	assert.NoError(t, err)
+	assert.Equal(t, jsFunction, uses)
+
+	names := Accumulator(AccumulatorSpec{
+		Init:       `function() { return [] }`,
+		Accumulate: `function(state, name) { return state.concat(name) }`,
+		Merge:      `function(a, b) { return a.concat(b) }`,
+	})
+	assert.Equal(t, []interface{}{}, names["$accumulator"].(bson.M)["accumulateArgs"])
+	uses, err = findServerJS(reflect.ValueOf([]interface{}{bson.D{{Name: "$group", Value: bson.M{"_id": 1, "names": names}}}}))
+	assert.NoError(t, err)
+	assert.Equal(t, jsFunction, uses)
+
+	uses, err = findServerJS(reflect.ValueOf(bson.M{"$or": []interface{}{bson.M{"$where": "this.a > 1"}, bson.M{"$expr": slug}}}))
+	assert.NoError(t, err)
+	assert.Equal(t, jsWhere|jsFunction, uses)
+
+	large := Function("function() {" + strings.Repeat(" ", serverJSMaxBody) + "}")
+	_, err = findServerJS(reflect.ValueOf([]bson.M{{"$addFields": bson.M{"x": large}}}))
+	assert.Equal(t, ErrServerJSTooLarge, err)
+	_, err = findServerJS(reflect.ValueOf(bson.M{"$where": "function() {" + strings.Repeat(" ", serverJSMaxBody) + "}"}))
+	assert.Equal(t, ErrServerJSTooLarge, err)
+}
+
+func TestCheckServerJSDisabled(t *testing.T) {
+	db := new(Database)
+	pipeline := []bson.M{{"$addFields": bson.M{"x": Function("function() { return 1 }")}}}
+	assert.Equal(t, ErrServerJSDisabled, db.checkServerJS(nil, pipeline))
+	assert.NoError(t, db.checkServerJS(nil, []bson.M{{"$match": bson.M{}}}))
+	assert.Equal(t, ErrServerJSDisabled, db.checkServerJS(nil, bson.M{"$where": "this.a > 1"}))
+
+	_, err := db.query(nil, "car", bson.M{"$expr": Function("function() { return true }")})
+	assert.Equal(t, ErrServerJSDisabled, err)
+	_, err = db.pipe(nil, "car", pipeline)
+	assert.Equal(t, ErrServerJSDisabled, err)
+
+	// $where runs on any server
+	db.EnableServerJS(true)
+	assert.NoError(t, db.checkServerJS(nil, bson.M{"$where": "this.a > 1"}))
+}
@@ -0,0 +1,100 @@
+package mgodb
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the maximum bson document size accepted by the server
+const MaxDocumentSize = 16 * 1024 * 1024
+
+var (
+	ErrDocumentTooLarge = errors.New("document exceeds the configured size limit")
+)
+
+// size of one top level field of a document
+type FieldSize struct {
+	Field string `json:"field"`
+	Size  int    `json:"size"`
+}
+
+type sizeGuard struct {
+	sync.RWMutex
+	warn   int
+	reject int
+}
+
+// SetSizeGuard checks the bson size of documents before they are written:
+// documents larger than warn bytes are logged with their largest fields,
+// documents larger than reject bytes fail with ErrDocumentTooLarge.
+// zero disables the check, both are disabled by default
+// for example:
+// SetSizeGuard(12*1024*1024, MaxDocumentSize)
+func (db *Database) SetSizeGuard(warn int, reject int) {
+	db.size.Lock()
+	defer db.size.Unlock()
+	db.size.warn = warn
+	db.size.reject = reject
+}
+
+func SetSizeGuard(warn int, reject int) {
+	_db.SetSizeGuard(warn, reject)
+}
+
+// checkSize runs the size guard on one document
+func (db *Database) checkSize(collection string, doc interface{}) error {
+	db.size.RLock()
+	warn, reject := db.size.warn, db.size.reject
+	db.size.RUnlock()
+	if warn <= 0 && reject <= 0 {
+		return nil
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	size := len(data)
+	tooLarge := reject > 0 && size > reject
+	if !tooLarge && (warn <= 0 || size <= warn) {
+		return nil
+	}
+
+	fields := LargestFields(doc, 3)
+	entry := db.logWith(Fields{
+		"collection": collection,
+		"size":       size,
+		"largest":    fields,
+	})
+	if tooLarge {
+		entry.Error("document size guard: document rejected")
+		return ErrDocumentTooLarge
+	}
+	entry.Warn("document size guard: document is approaching the size limit")
+	return nil
+}
+
+// LargestFields returns the n largest top level fields of doc by bson size
+func LargestFields(doc interface{}, n int) []FieldSize {
+	m := bson.M{}
+	if err := convertToBsonM(doc, &m); err != nil {
+		return nil
+	}
+
+	fields := make([]FieldSize, 0, len(m))
+	for key, value := range m {
+		data, err := bson.Marshal(bson.M{key: value})
+		if err != nil {
+			continue
+		}
+		fields = append(fields, FieldSize{Field: key, Size: len(data)})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Size > fields[j].Size })
+	if n > 0 && len(fields) > n {
+		fields = fields[:n]
+	}
+	return fields
+}
@@ -0,0 +1,24 @@
+package mgodb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSizeGuard(t *testing.T) {
+	doc := bson.M{"name": "a", "remark": strings.Repeat("x", 1024), "notes": strings.Repeat("x", 100)}
+	fields := LargestFields(doc, 2)
+	assert.Equal(t, 2, len(fields))
+	assert.Equal(t, "remark", fields[0].Field)
+	assert.Equal(t, "notes", fields[1].Field)
+
+	db := new(Database)
+	assert.Nil(t, db.checkSize("car", doc))
+	db.SetSizeGuard(512, 0)
+	assert.Nil(t, db.checkSize("car", doc))
+	db.SetSizeGuard(512, 1024)
+	assert.Equal(t, ErrDocumentTooLarge, db.checkSize("car", doc))
+}
@@ -0,0 +1,200 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrNotSoftDelete = errors.New("model has no field tagged softdelete")
+)
+
+type unscopedKey struct{}
+
+// bson name of the soft delete field by model type, "" for none
+var softDeleteFields sync.Map
+
+// Unscoped returns a copy of ctx whose operations ignore soft deletes: reads, counts,
+// aggregations and updates see the soft deleted records, RemoveOne and RemoveAll delete records for good
+// for example:
+// FindContext(Unscoped(ctx), &users, bson.M{"deletedAt": bson.M{"$ne": nil}}, 1, 20, nil)
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+func isUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
+
+// softDeleteField returns the bson name of the field of model, or of the elements
+// of a slice model, tagged softdelete, "" if none
+// for example:
+// type User struct {
+// DeletedAt *time.Time `bson:"deletedAt" mgodb:"softdelete"`
+// }
+func softDeleteField(model interface{}) string {
+	typ := reflect.TypeOf(model)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return ""
+	}
+	if name, ok := softDeleteFields.Load(typ); ok {
+		return name.(string)
+	}
+	name := softDeletePath(typ)
+	softDeleteFields.Store(typ, name)
+	return name
+}
+
+func softDeletePath(typ reflect.Type) string {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline && field.Type.Kind() == reflect.Struct {
+			if name := softDeletePath(field.Type); name != "" {
+				return name
+			}
+			continue
+		}
+		if _, ok := mgodbTag(field)["softdelete"]; ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// scopeDeleted restricts query to the records of model not soft deleted,
+// unless ctx is unscoped or query already filters on the soft delete field
+func scopeDeleted(ctx context.Context, model interface{}, query interface{}) interface{} {
+	field := softDeleteField(model)
+	if field == "" || isUnscoped(ctx) {
+		return query
+	}
+	live := bson.M{field: nil}
+	var m bson.M
+	switch q := query.(type) {
+	case nil:
+		return live
+	case bson.M:
+		m = q
+	case map[string]interface{}:
+		m = bson.M(q)
+	default:
+		return bson.M{"$and": []interface{}{query, live}}
+	}
+	if _, ok := m[field]; ok {
+		return query
+	}
+	// the query of the caller is shared
+	scoped := bson.M{field: nil}
+	for key, value := range m {
+		scoped[key] = value
+	}
+	return scoped
+}
+
+// softRemove marks the records of model matching selector, scoped by applyPolicy,
+// deleted instead of removing them
+func (db *Database) softRemove(ctx context.Context, model interface{}, selector interface{}, field string, multi bool) error {
+	collection := GetCollectionName(model)
+	update := bson.M{"$set": bson.M{field: time.Now().UTC()}}
+	start := time.Now()
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		if !multi {
+			return sess.DB("").C(collection).Update(selector, update)
+		}
+		_, err := sess.DB("").C(collection).UpdateAll(selector, update)
+		return err
+	})
+	db.observe(ctx, "softRemove", collection, selector, start, err)
+	if err != nil {
+		return err
+	}
+	db.mirror(ctx, "softRemove", collection, selector, func(backend Backend) error {
+		return backend.Update(ctx, collection, selector, update, multi)
+	})
+	return nil
+}
+
+// Restore brings back the soft deleted record of model matching selector,
+// returns mgo.ErrNotFound when none matches and ErrNotSoftDelete when model
+// has no field tagged softdelete
+// for example:
+// Restore(&User{}, bson.M{"userId": 1})
+func (db *Database) Restore(model interface{}, selector interface{}) error {
+	return db.RestoreContext(context.Background(), model, selector)
+}
+
+// RestoreContext is like Restore, ctx bounds the wait for a session and the operation
+func (db *Database) RestoreContext(ctx context.Context, model interface{}, selector interface{}) error {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model":    model,
+			"selector": selector,
+			"err":      err,
+		}).Error("restore db error: validate model fail")
+		return err
+	}
+	field := softDeleteField(model)
+	if field == "" {
+		return ErrNotSoftDelete
+	}
+	if err := db.checkWritable(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("restore db error: model is read-only")
+		return err
+	}
+	if err := db.applyPolicy(Unscoped(ctx), model, ActionUpdate, &selector); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("restore db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	selector = bson.M{"$and": []interface{}{selector, bson.M{field: bson.M{"$ne": nil}}}}
+	update := bson.M{"$unset": bson.M{field: ""}}
+	start := time.Now()
+	err := db.executeWrite(ctx, collection, func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).Update(selector, update)
+	})
+	db.observe(ctx, "restore", collection, selector, start, err)
+	if err != nil && err != mgo.ErrNotFound {
+		db.logContext(ctx, Fields{
+			"model":      model,
+			"selector":   selector,
+			"collection": collection,
+			"err":        err,
+		}).Error("restore db error: database operate fail")
+	}
+	if err == nil {
+		db.mirror(ctx, "restore", collection, selector, func(backend Backend) error {
+			return backend.Update(ctx, collection, selector, update, false)
+		})
+	}
+
+	return err
+}
+
+func Restore(model interface{}, selector interface{}) error {
+	return _db.Restore(model, selector)
+}
+
+func RestoreContext(ctx context.Context, model interface{}, selector interface{}) error {
+	return _db.RestoreContext(ctx, model, selector)
+}
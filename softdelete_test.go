@@ -0,0 +1,59 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type softDeleted struct {
+	fieldsInner `bson:",inline"`
+	DeletedAt   *time.Time `bson:"deletedAt" mgodb:"softdelete"`
+}
+
+func TestSoftDeleteField(t *testing.T) {
+	assert.Equal(t, "deletedAt", softDeleteField(&softDeleted{}))
+	assert.Equal(t, "deletedAt", softDeleteField(&[]*softDeleted{}))
+	assert.Equal(t, "", softDeleteField(&fieldsInner{}))
+}
+
+func TestScopeDeleted(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, bson.M{"deletedAt": nil}, scopeDeleted(ctx, &softDeleted{}, nil))
+
+	query := bson.M{"carId": 1}
+	assert.Equal(t, bson.M{"carId": 1, "deletedAt": nil}, scopeDeleted(ctx, &softDeleted{}, query))
+	assert.Equal(t, bson.M{"carId": 1}, query)
+
+	deleted := bson.M{"deletedAt": bson.M{"$ne": nil}}
+	assert.Equal(t, deleted, scopeDeleted(ctx, &softDeleted{}, deleted))
+	d := bson.D{{Name: "carId", Value: 1}}
+	assert.Equal(t, bson.M{"$and": []interface{}{d, bson.M{"deletedAt": nil}}}, scopeDeleted(ctx, &softDeleted{}, d))
+
+	assert.Equal(t, query, scopeDeleted(Unscoped(ctx), &softDeleted{}, query))
+	assert.Equal(t, query, scopeDeleted(ctx, &fieldsInner{}, query))
+}
+
+func TestApplyPolicyScope(t *testing.T) {
+	db := &Database{}
+	ctx := context.Background()
+	for _, action := range []Action{ActionFind, ActionCount, ActionAggregate, ActionUpdate, ActionRemove} {
+		var selector interface{}
+		assert.Nil(t, db.applyPolicy(ctx, &softDeleted{}, action, &selector))
+		assert.Equal(t, bson.M{"deletedAt": nil}, selector)
+	}
+
+	var selector interface{} = bson.M{"carId": 1}
+	assert.Nil(t, db.applyPolicy(ctx, &softDeleted{}, ActionUpsert, &selector))
+	assert.Equal(t, bson.M{"carId": 1}, selector)
+	assert.Nil(t, db.applyPolicy(Unscoped(ctx), &softDeleted{}, ActionFind, &selector))
+	assert.Equal(t, bson.M{"carId": 1}, selector)
+	assert.Nil(t, db.applyPolicy(ctx, &softDeleted{}, ActionInsert, nil))
+
+	var piplines interface{} = []bson.M{{"$group": bson.M{"_id": "$carId"}}}
+	assert.Nil(t, db.applyPipelinePolicy(ctx, &[]*softDeleted{}, &piplines))
+	assert.Equal(t, []bson.M{{"$match": bson.M{"deletedAt": nil}}, {"$group": bson.M{"_id": "$carId"}}}, piplines)
+}
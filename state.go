@@ -0,0 +1,133 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInvalidTransition = errors.New("record is not in an allowed source state")
+)
+
+// the state field of a model: the field tagged `mgodb:"state"`, "status" by default
+func stateField(model interface{}) string {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			if _, ok := mgodbTag(typ.Field(i))["state"]; ok {
+				if name, _ := bsonName(typ.Field(i)); name != "" {
+					return name
+				}
+			}
+		}
+	}
+	return "status"
+}
+
+// move one record from one of fromStates to toState atomically by findAndModify
+// and load the updated record into model.
+// returns ErrInvalidTransition when the record is in another state,
+// or mgo.ErrNotFound when no record matches selector
+// for example:
+// order := &Order{}
+// Transition(order, bson.M{"orderId": 1}, []string{"created", "paying"}, "paid", bson.M{"paidAt": now})
+func Transition(model interface{}, selector bson.M, fromStates []string, toState string, extraSet bson.M) error {
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model":    model,
+			"selector": selector,
+			"err":      err,
+		}).Error("transition db error: validate model fail")
+		return err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("transition db error: model is read-only")
+		return err
+	}
+
+	var scoped interface{} = selector
+	if err := _db.applyPolicy(context.Background(), model, ActionUpdate, &scoped); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("transition db error: policy denied")
+		return err
+	}
+
+	field := stateField(model)
+	query := bson.M{"$and": []interface{}{scoped, bson.M{field: bson.M{"$in": fromStates}}}}
+
+	set := bson.M{}
+	for key, value := range extraSet {
+		set[key] = value
+	}
+	set[field] = toState
+	if f, ok := reflect.TypeOf(model).Elem().FieldByName("Updated"); ok {
+		if name, _ := bsonName(f); name != "" {
+			set[name] = time.Now().UTC()
+		}
+	}
+
+	// extraSet is written like any update, immutable fields guarded and values transformed
+	guarded, err := _db.guardImmutable(model, bson.M{"$set": set})
+	if err != nil {
+		logWith(Fields{
+			"model":    model,
+			"extraSet": extraSet,
+			"err":      err,
+		}).Error("transition db error: immutable field")
+		return err
+	}
+	update, err := _db.transformUpdate(model, guarded)
+	if err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("transition db error: transform fail")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	change := mgo.Change{Update: update, ReturnNew: true}
+	start := time.Now()
+	err = _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+		c := sess.DB("").C(collection)
+		_, err := c.Find(query).Apply(change, model)
+		if err != mgo.ErrNotFound {
+			return err
+		}
+		// tell a missing record from a record in another state
+		n, err := c.Find(scoped).Count()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return mgo.ErrNotFound
+		}
+		return ErrInvalidTransition
+	})
+	_db.observe(context.Background(), "transition", collection, query, start, err)
+	if err != nil && err != mgo.ErrNotFound && err != ErrInvalidTransition {
+		logWith(Fields{
+			"model":      model,
+			"selector":   selector,
+			"from":       fromStates,
+			"to":         toState,
+			"collection": collection,
+			"err":        err,
+		}).Error("transition db error: database operate fail")
+	}
+
+	return err
+}
@@ -0,0 +1,272 @@
+package mgodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// latency samples kept per query shape
+const statsSampleSize = 1024
+
+// statistics of one query shape
+type QueryStat struct {
+	Op         string        `json:"op"`
+	Collection string        `json:"collection"`
+	Shape      string        `json:"shape"`
+	Count      int64         `json:"count"`
+	Errors     int64         `json:"errors"`
+	Total      time.Duration `json:"total"`
+	Max        time.Duration `json:"max"`
+	P50        time.Duration `json:"p50"`
+	P95        time.Duration `json:"p95"`
+	P99        time.Duration `json:"p99"`
+}
+
+type shapeStat struct {
+	QueryStat
+	samples []time.Duration
+	next    int
+}
+
+type queryStats struct {
+	sync.Mutex
+	enabled bool
+	shapes  map[string]*shapeStat
+}
+
+func (s *queryStats) record(op, collection, shape string, elapsed time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.enabled {
+		return
+	}
+
+	key := op + " " + collection + " " + shape
+	stat, ok := s.shapes[key]
+	if !ok {
+		stat = &shapeStat{QueryStat: QueryStat{Op: op, Collection: collection, Shape: shape}}
+		s.shapes[key] = stat
+	}
+
+	stat.Count++
+	if err != nil && err != mgo.ErrNotFound {
+		stat.Errors++
+	}
+	stat.Total += elapsed
+	if elapsed > stat.Max {
+		stat.Max = elapsed
+	}
+
+	// ring buffer of the latest samples
+	if len(stat.samples) < statsSampleSize {
+		stat.samples = append(stat.samples, elapsed)
+	} else {
+		stat.samples[stat.next] = elapsed
+		stat.next = (stat.next + 1) % statsSampleSize
+	}
+}
+
+func (s *queryStats) snapshot() []QueryStat {
+	s.Lock()
+	defer s.Unlock()
+
+	result := make([]QueryStat, 0, len(s.shapes))
+	for _, stat := range s.shapes {
+		item := stat.QueryStat
+		samples := append([]time.Duration(nil), stat.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		item.P50 = percentile(samples, 50)
+		item.P95 = percentile(samples, 95)
+		item.P99 = percentile(samples, 99)
+		result = append(result, item)
+	}
+
+	// hottest shapes first
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Total > result[j].Total
+	})
+	return result
+}
+
+// percentile of sorted samples, p in [0, 100]
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted)*p + 99) / 100
+	if idx > 0 {
+		idx--
+	}
+	return sorted[idx]
+}
+
+// EnableQueryStats turns query shape statistics on or off, turning it off drops collected data
+func (db *Database) EnableQueryStats(enabled bool) {
+	db.stats.Lock()
+	defer db.stats.Unlock()
+	db.stats.enabled = enabled
+	db.stats.shapes = make(map[string]*shapeStat)
+}
+
+// QueryStats returns per query shape statistics, the hottest shapes first
+func (db *Database) QueryStats() []QueryStat {
+	return db.stats.snapshot()
+}
+
+// observe records one finished operation
+func (db *Database) observe(ctx context.Context, op, collection string, query interface{}, start time.Time, err error) {
+	elapsed := time.Since(start)
+	db.record(op, collection, query)
+	db.stats.Lock()
+	enabled := db.stats.enabled
+	db.stats.Unlock()
+	detect := db.nplusone.isEnabled()
+	if !enabled && !detect {
+		return
+	}
+
+	label := ""
+	if enabled {
+		label, enabled = db.metrics.label(collection)
+	}
+	if !enabled && !detect {
+		return
+	}
+
+	shape := NormalizeQuery(query)
+	if enabled {
+		db.stats.record(op, label, shape, elapsed, err)
+	}
+	if detect {
+		if count := db.nplusone.check(ctx, op, collection, shape); count > 0 {
+			db.logContext(ctx, Fields{
+				"site":       callerSite(),
+				"op":         op,
+				"collection": collection,
+				"shape":      shape,
+				"count":      count,
+			}).Warn("n+1 query detected: query with $in or $lookup instead of a loop")
+		}
+	}
+}
+
+func EnableQueryStats(enabled bool) {
+	_db.EnableQueryStats(enabled)
+}
+
+func QueryStats() []QueryStat {
+	return _db.QueryStats()
+}
+
+// NormalizeQuery returns the shape of query, values replaced by placeholders
+// for example:
+// NormalizeQuery(bson.M{"name": "xx", "price": bson.M{"$gt": 100}})
+// returns {"name":?,"price":{"$gt":?}}
+func NormalizeQuery(query interface{}) string {
+	var buf bytes.Buffer
+	writeShape(&buf, reflect.ValueOf(query))
+	return buf.String()
+}
+
+func writeShape(buf *bytes.Buffer, val reflect.Value) {
+	for val.IsValid() && (val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr) {
+		if val.IsNil() {
+			buf.WriteString("?")
+			return
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		buf.WriteString("?")
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			buf.WriteString("?")
+			return
+		}
+		keys := make([]string, 0, val.Len())
+		for _, key := range val.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		buf.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(strconv.Quote(key))
+			buf.WriteString(":")
+			writeShape(buf, val.MapIndex(reflect.ValueOf(key).Convert(val.Type().Key())))
+		}
+		buf.WriteString("}")
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			buf.WriteString("?")
+			return
+		}
+		// bson.D keeps the order of its elements
+		if val.Type().Elem().Kind() == reflect.Struct && val.Type().Elem().NumField() == 2 &&
+			val.Type().Elem().Field(0).Name == "Name" {
+			buf.WriteString("{")
+			for i := 0; i < val.Len(); i++ {
+				if i > 0 {
+					buf.WriteString(",")
+				}
+				buf.WriteString(strconv.Quote(fmt.Sprint(val.Index(i).Field(0).Interface())))
+				buf.WriteString(":")
+				writeShape(buf, val.Index(i).Field(1))
+			}
+			buf.WriteString("}")
+			return
+		}
+		// array of documents ($or, $and, pipeline) keeps every element,
+		// array of values ($in, $nin) collapses into one placeholder
+		if !isDocumentSlice(val) {
+			buf.WriteString("[?]")
+			return
+		}
+		buf.WriteString("[")
+		for i := 0; i < val.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			writeShape(buf, val.Index(i))
+		}
+		buf.WriteString("]")
+	default:
+		buf.WriteString("?")
+	}
+}
+
+func isDocumentSlice(val reflect.Value) bool {
+	if val.Len() == 0 {
+		return false
+	}
+	for i := 0; i < val.Len(); i++ {
+		item := reflect.Indirect(val.Index(i))
+		for item.IsValid() && item.Kind() == reflect.Interface && !item.IsNil() {
+			item = reflect.Indirect(item.Elem())
+		}
+		if !item.IsValid() {
+			return false
+		}
+		if item.Kind() != reflect.Map && item.Kind() != reflect.Slice {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, `{"name":?,"price":{"$gt":?}}`, NormalizeQuery(bson.M{"price": bson.M{"$gt": 100}, "name": "xx"}))
+	assert.Equal(t, `{"carId":{"$in":[?]}}`, NormalizeQuery(bson.M{"carId": bson.M{"$in": []int64{1, 2, 3}}}))
+	assert.Equal(t, `{"$or":[{"name":?},{"price":?}]}`, NormalizeQuery(bson.M{"$or": []bson.M{{"name": "a"}, {"price": 1}}}))
+	assert.Equal(t, `{"b":?,"a":?}`, NormalizeQuery(bson.D{{Name: "b", Value: 1}, {Name: "a", Value: 2}}))
+	assert.Equal(t, `?`, NormalizeQuery(nil))
+	assert.Equal(t, NormalizeQuery(bson.M{"name": "a"}), NormalizeQuery(bson.M{"name": "b"}))
+}
+
+func TestQueryStats(t *testing.T) {
+	db := new(Database)
+	db.EnableQueryStats(true)
+	start := time.Now()
+	db.observe(context.Background(), "findOne", "car", bson.M{"name": "a"}, start, nil)
+	db.observe(context.Background(), "findOne", "car", bson.M{"name": "b"}, start, nil)
+	db.observe(context.Background(), "count", "car", bson.M{"price": 1}, start, nil)
+
+	stats := db.QueryStats()
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, "findOne", stats[0].Op)
+	assert.Equal(t, int64(2), stats[0].Count)
+	assert.Equal(t, `{"name":?}`, stats[0].Shape)
+
+	db.EnableQueryStats(false)
+	db.observe(context.Background(), "findOne", "car", bson.M{"name": "a"}, start, nil)
+	assert.Equal(t, 0, len(db.QueryStats()))
+}
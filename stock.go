@@ -0,0 +1,159 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrInsufficient  = errors.New("field value is less than the amount")
+	ErrInvalidAmount = errors.New("amount must be positive")
+)
+
+// decrement field by amount atomically unless it would go negative,
+// load the updated record into model and return the remaining value.
+// returns ErrInsufficient when the value is less than amount, ErrInvalidAmount
+// when amount is not positive, or mgo.ErrNotFound when no record matches selector
+// for example:
+// car := &Car{}
+// remaining, err := DecrementIfAtLeast(car, bson.M{"carId": 1}, "stock", 2)
+func DecrementIfAtLeast(model interface{}, selector bson.M, field string, amount int64) (int64, error) {
+	// a negative amount would increment the field
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	if err := validateModel(model); err != nil {
+		logWith(Fields{
+			"model":    model,
+			"selector": selector,
+			"field":    field,
+			"err":      err,
+		}).Error("decrement db error: validate model fail")
+		return 0, err
+	}
+	if err := _db.checkWritable(model); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("decrement db error: model is read-only")
+		return 0, err
+	}
+
+	var scoped interface{} = selector
+	if err := _db.applyPolicy(context.Background(), model, ActionUpdate, &scoped); err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("decrement db error: policy denied")
+		return 0, err
+	}
+	query := bson.M{"$and": []interface{}{scoped, bson.M{field: bson.M{"$gte": amount}}}}
+
+	guarded, err := _db.guardImmutable(model, bson.M{"$inc": bson.M{field: -amount}})
+	if err != nil {
+		logWith(Fields{
+			"model": model,
+			"field": field,
+			"err":   err,
+		}).Error("decrement db error: immutable field")
+		return 0, err
+	}
+	update, err := _db.transformUpdate(model, guarded)
+	if err != nil {
+		logWith(Fields{
+			"model": model,
+			"err":   err,
+		}).Error("decrement db error: transform fail")
+		return 0, err
+	}
+
+	var remaining int64
+	collection := GetCollectionName(model)
+	change := mgo.Change{Update: update, ReturnNew: true}
+	start := time.Now()
+	err = _db.executeWrite(context.Background(), collection, func(sess *mgo.Session) error {
+		c := sess.DB("").C(collection)
+		var raw bson.Raw
+		_, err := c.Find(query).Apply(change, &raw)
+		if err == mgo.ErrNotFound {
+			// tell a missing record from an insufficient value
+			n, err := c.Find(scoped).Count()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return mgo.ErrNotFound
+			}
+			return ErrInsufficient
+		}
+		if err != nil {
+			return err
+		}
+
+		var doc bson.M
+		if err := raw.Unmarshal(&doc); err != nil {
+			return err
+		}
+		remaining = toInt64(lookupPath(doc, field))
+		return raw.Unmarshal(model)
+	})
+	_db.observe(context.Background(), "decrement", collection, query, start, err)
+	if err != nil && err != mgo.ErrNotFound && err != ErrInsufficient {
+		logWith(Fields{
+			"model":      model,
+			"selector":   selector,
+			"field":      field,
+			"amount":     amount,
+			"collection": collection,
+			"err":        err,
+		}).Error("decrement db error: database operate fail")
+	}
+
+	return remaining, err
+}
+
+// value of a dotted path in a document, nil if missing
+func lookupPath(doc bson.M, path string) interface{} {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := asDoc(value)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// asDoc returns value as a document, mgo decodes the embedded documents
+// into the map type of the document holding them
+func asDoc(value interface{}) (bson.M, bool) {
+	switch m := value.(type) {
+	case bson.M:
+		return m, true
+	case Row:
+		return bson.M(m), true
+	case map[string]interface{}:
+		return bson.M(m), true
+	}
+	return nil, false
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,23 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestLookupPath(t *testing.T) {
+	doc := bson.M{"stock": 3, "remark": bson.M{"seats": int64(2)}}
+	assert.Equal(t, int64(3), toInt64(lookupPath(doc, "stock")))
+	assert.Equal(t, int64(2), toInt64(lookupPath(doc, "remark.seats")))
+	assert.Nil(t, lookupPath(doc, "remark.missing"))
+	assert.Nil(t, lookupPath(doc, "stock.seats"))
+}
+
+func TestDecrementInvalidAmount(t *testing.T) {
+	for _, amount := range []int64{0, -1} {
+		_, err := DecrementIfAtLeast(&fieldsInner{}, bson.M{}, "price", amount)
+		assert.Equal(t, ErrInvalidAmount, err)
+	}
+}
@@ -0,0 +1,107 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+// stream the pipeline output through a cursor, decoding every document
+// into a new value of the model type and passing it to fn.
+// an error returned by fn stops the iteration
+// for example:
+// AggregateEach(&CarOwner{}, pipeline, func(doc interface{}) error {
+// co := doc.(*CarOwner) ...
+// })
+func AggregateEach(model interface{}, piplines interface{}, fn func(doc interface{}) error) error {
+	return AggregateEachContext(context.Background(), model, piplines, fn)
+}
+
+// AggregateEachContext is like AggregateEach, when ctx is done mid-iteration the
+// server side cursor is killed and ctx's error returned
+func AggregateEachContext(ctx context.Context, model interface{}, piplines interface{}, fn func(doc interface{}) error) error {
+	piplines = buildPipeline(piplines)
+	if err := validateModel(model); err != nil {
+		_db.logContext(ctx, Fields{
+			"model":    model,
+			"piplines": piplines,
+			"err":      err,
+		}).Error("aggregate each db error: validate model fail")
+		return err
+	}
+	if err := _db.applyPipelinePolicy(ctx, model, &piplines); err != nil {
+		_db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("aggregate each db error: policy denied")
+		return err
+	}
+
+	collection := GetCollectionName(model)
+	typ := reflect.TypeOf(model).Elem()
+	start := time.Now()
+	err := _db.execute(ctx, func(sess *mgo.Session) error {
+		pipe, err := _db.pipe(sess, collection, piplines)
+		if err != nil {
+			return err
+		}
+		iter := _db.trackCursor(ctx, collection, pipe.AllowDiskUse().Iter())
+		for {
+			doc := reflect.New(typ).Interface()
+			if !iter.Next(doc) {
+				break
+			}
+			if err := fn(doc); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return err
+		}
+		return iter.Close()
+	})
+	_db.observe(ctx, "aggregate", collection, piplines, start, err)
+	// a cancelled iteration is not a failure
+	if err != nil && err != ctx.Err() {
+		_db.logContext(ctx, Fields{
+			"model":    model,
+			"piplines": piplines,
+			"err":      err,
+		}).Error("aggregate each db error: database operate fail")
+	}
+
+	return err
+}
+
+// stream the pipeline output into a channel, the channel is closed
+// when the cursor is exhausted, when ctx is done or on error,
+// then the error channel receives the result of the iteration.
+// a consumer which stops reading early must cancel ctx, the producer waits for it otherwise
+// for example:
+// ctx, cancel := context.WithCancel(ctx)
+// defer cancel()
+// docs, errc := AggregateChan(ctx, &CarOwner{}, pipeline)
+// for doc := range docs {...}
+// err := <-errc
+func AggregateChan(ctx context.Context, model interface{}, piplines interface{}) (<-chan interface{}, <-chan error) {
+	docs := make(chan interface{})
+	errc := make(chan error, 1)
+	go func() {
+		err := AggregateEachContext(ctx, model, piplines, func(doc interface{}) error {
+			select {
+			case docs <- doc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(docs)
+		errc <- err
+		close(errc)
+	}()
+	return docs, errc
+}
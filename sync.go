@@ -0,0 +1,119 @@
+package mgodb
+
+import (
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// records written per bulk by CopyCollection and SyncCollections
+const copyBatchSize = 500
+
+// SyncCollections copies the records of model updated since the checkpoint since
+// from the cluster of src to the one of dst, replacing the records with the same _id,
+// for a gradual migration between clusters: run it repeatedly, passing back the
+// returned checkpoint, until the switch over.
+// changes are found by the updated field which Insert and UpsertOne maintain,
+// writers must set it on every change, and removed records are not synced;
+// SyncWatch follows the changes themselves, removals included, once caught up.
+// the checkpoint is the latest updated value copied, the records updated at that
+// very time are copied again on the next run, which is harmless.
+// returns the new checkpoint and the number of copied records
+// for example:
+// checkpoint, n, err := SyncCollections(oldSess, newSess, &Order{}, checkpoint)
+func SyncCollections(src *mgo.Session, dst *mgo.Session, model interface{}, since time.Time) (time.Time, int, error) {
+	if err := validateModel(model); err != nil {
+		return since, 0, err
+	}
+
+	collection := GetCollectionName(model)
+	sess := src.Copy()
+	defer sess.Close()
+	checkpoint := since
+	query := bson.M{"updated": bson.M{"$gte": since}}
+	iter := sess.DB("").C(collection).Find(query).Sort("updated").Iter()
+	copied, err := bulkCopy(iter, dst.DB("").C(collection), func(doc bson.M) {
+		if updated, ok := doc["updated"].(time.Time); ok && updated.After(checkpoint) {
+			checkpoint = updated
+		}
+	})
+	if err != nil {
+		logWith(Fields{
+			"collection": collection,
+			"since":      since,
+			"copied":     copied,
+			"err":        err,
+		}).Error("sync collections db error: database operate fail")
+		return since, copied, err
+	}
+	return checkpoint, copied, nil
+}
+
+// SyncWatch replays the changes of the collection of model on the cluster of dst, through
+// a Watch of db: inserted, updated and replaced records are upserted by _id and removed
+// ones removed, so writers need not maintain the updated field.
+// start it before the last SyncCollections run, no change falls in between then;
+// events delivered again are replayed again, which is harmless.
+// returns the watcher, close it at the switch over
+// for example:
+// w, err := oldDb.SyncWatch(newSess, &Order{})
+// checkpoint, n, err := SyncCollections(oldSess, newSess, &Order{}, checkpoint)
+func (db *Database) SyncWatch(dst *mgo.Session, model interface{}) (*Watcher, error) {
+	collection := GetCollectionName(model)
+	return db.Watch(model, nil, func(ev ChangeEvent) error {
+		sess := dst.Copy()
+		defer sess.Close()
+		c := sess.DB("").C(collection)
+		id := ev.DocumentKey["_id"]
+		if ev.OperationType == ChangeDelete {
+			if err := c.RemoveId(id); err != nil && err != mgo.ErrNotFound {
+				return err
+			}
+			return nil
+		}
+		doc := bson.M{}
+		if err := ev.Decode(&doc); err != nil {
+			// removed since, its delete follows
+			return nil
+		}
+		_, err := c.UpsertId(id, doc)
+		return err
+	})
+}
+
+func SyncWatch(dst *mgo.Session, model interface{}) (*Watcher, error) {
+	return _db.SyncWatch(dst, model)
+}
+
+// bulkCopy upserts the records of iter into target by _id, after fn changed them
+func bulkCopy(iter *mgo.Iter, target *mgo.Collection, fn func(doc bson.M)) (int, error) {
+	copied := 0
+	bulk := target.Bulk()
+	pending := 0
+	doc := bson.M{}
+	for iter.Next(&doc) {
+		fn(doc)
+		bulk.Upsert(bson.M{"_id": doc["_id"]}, doc)
+		pending++
+		if pending == copyBatchSize {
+			if _, err := bulk.Run(); err != nil {
+				iter.Close()
+				return copied, err
+			}
+			copied += pending
+			bulk, pending = target.Bulk(), 0
+		}
+		doc = bson.M{}
+	}
+	if err := iter.Close(); err != nil {
+		return copied, err
+	}
+	if pending > 0 {
+		if _, err := bulk.Run(); err != nil {
+			return copied, err
+		}
+		copied += pending
+	}
+	return copied, nil
+}
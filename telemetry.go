@@ -0,0 +1,119 @@
+package mgodb
+
+import (
+	"strings"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// the server topology discovered from the connected cluster
+type Topology struct {
+	ReplicaSet string   `json:"replicaSet" bson:"setName"`
+	Primary    string   `json:"primary" bson:"primary"`
+	Me         string   `json:"me" bson:"me"`
+	Hosts      []string `json:"hosts" bson:"hosts"`
+	Passives   []string `json:"passives" bson:"passives"`
+	Arbiters   []string `json:"arbiters" bson:"arbiters"`
+	Msg        string   `json:"msg" bson:"msg"`
+	Version    string   `json:"version" bson:"-"`
+	Members    []Member `json:"members" bson:"-"`
+}
+
+// a replica set member reported by replSetGetStatus
+type Member struct {
+	Name   string `json:"name" bson:"name"`
+	State  string `json:"state" bson:"stateStr"`
+	Health int    `json:"health" bson:"health"`
+}
+
+// EnableInitTelemetry logs the resolved configuration and the discovered topology on Init,
+// call it before Init
+func (db *Database) EnableInitTelemetry(enabled bool) {
+	db.telemetry = enabled
+}
+
+func EnableInitTelemetry(enabled bool) {
+	_db.EnableInitTelemetry(enabled)
+}
+
+// DiscoverTopology discovers the replica set name, members and server version
+func (db *Database) DiscoverTopology() (*Topology, error) {
+	topology := new(Topology)
+	err := db.Execute(func(sess *mgo.Session) error {
+		if err := sess.Run("isMaster", topology); err != nil {
+			return err
+		}
+		info, err := sess.BuildInfo()
+		if err != nil {
+			return err
+		}
+		topology.Version = info.Version
+
+		// standalone servers do not support replSetGetStatus
+		if topology.ReplicaSet != "" {
+			var status struct {
+				Members []Member `bson:"members"`
+			}
+			if err := sess.DB("admin").Run(bson.M{"replSetGetStatus": 1}, &status); err == nil {
+				topology.Members = status.Members
+			}
+		}
+		return nil
+	})
+	return topology, err
+}
+
+func DiscoverTopology() (*Topology, error) {
+	return _db.DiscoverTopology()
+}
+
+func (db *Database) logTelemetry(addr string) {
+	db.logWith(Fields{
+		"addr":          redactURI(addr),
+		"poolSize":      cap(db.latch),
+		"socketTimeout": db.timeout.String(),
+		"mode":          db.session.Load().Mode(),
+		"safe":          db.session.Load().Safe(),
+	}).Info("mongodb: configuration")
+
+	topology, err := db.DiscoverTopology()
+	if err != nil {
+		db.logWith(Fields{
+			"err": err,
+		}).Warn("mongodb: discover topology fail")
+		return
+	}
+	db.logWith(Fields{
+		"replicaSet": topology.ReplicaSet,
+		"primary":    topology.Primary,
+		"hosts":      topology.Hosts,
+		"members":    topology.Members,
+		"version":    topology.Version,
+	}).Info("mongodb: topology")
+}
+
+// hide the password of a connection uri, with or without the mongodb:// scheme
+// mgo accepts, such as "user:secret@h1,h2/db". the password may contain an unescaped
+// '/' or '@', the userinfo ends at the last '@' before the options
+func redactURI(addr string) string {
+	scheme, rest := "", addr
+	if i := strings.Index(addr, "://"); i >= 0 {
+		scheme, rest = addr[:i+3], addr[i+3:]
+	}
+	end := len(rest)
+	if slash := strings.LastIndex(rest, "/"); slash >= 0 {
+		if i := strings.Index(rest[slash:], "?"); i >= 0 {
+			end = slash + i
+		}
+	}
+	at := strings.LastIndex(rest[:end], "@")
+	if at < 0 {
+		return addr
+	}
+	user := rest[:at]
+	if i := strings.Index(user, ":"); i >= 0 {
+		user = user[:i+1] + "xxxxx"
+	}
+	return scheme + user + rest[at:]
+}
@@ -0,0 +1,121 @@
+package mgodb
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// how time.Time values are written and decoded
+type TimeOptions struct {
+	// convert times to UTC before they are written
+	UTC bool
+	// truncate times before they are written, BSON dates keep milliseconds,
+	// so time.Millisecond makes in-memory values equal to the stored ones
+	Precision time.Duration
+	// convert decoded times into this location, the driver decodes into time.Local
+	Location *time.Location
+}
+
+type timeOptions struct {
+	sync.RWMutex
+	options TimeOptions
+}
+
+// SetTimeOptions configures the time handling of written and decoded records
+// for example:
+// SetTimeOptions(TimeOptions{UTC: true, Precision: time.Millisecond, Location: time.UTC})
+func (db *Database) SetTimeOptions(options TimeOptions) {
+	db.times.Lock()
+	defer db.times.Unlock()
+	db.times.options = options
+}
+
+func SetTimeOptions(options TimeOptions) {
+	_db.SetTimeOptions(options)
+}
+
+// normalizeTimes applies UTC and Precision to the times of a document or an update
+// document before it is written, in place
+func (db *Database) normalizeTimes(doc interface{}) {
+	db.times.RLock()
+	options := db.times.options
+	db.times.RUnlock()
+	if !options.UTC && options.Precision <= 0 {
+		return
+	}
+	walkTimes(reflect.ValueOf(doc), 0, func(t time.Time) time.Time {
+		if options.Precision > 0 {
+			t = t.Truncate(options.Precision)
+		}
+		if options.UTC {
+			t = t.UTC()
+		}
+		return t
+	})
+}
+
+// localizeTimes converts the times of a decoded result into Location
+func (db *Database) localizeTimes(result interface{}) {
+	db.times.RLock()
+	loc := db.times.options.Location
+	db.times.RUnlock()
+	if loc == nil {
+		return
+	}
+	walkTimes(reflect.ValueOf(result), 0, func(t time.Time) time.Time {
+		return t.In(loc)
+	})
+}
+
+// walkTimes replaces every time.Time reachable from val by fn(t), values held by maps
+// and interfaces are not settable, they are replaced by an updated copy
+func walkTimes(val reflect.Value, depth int, fn func(time.Time) time.Time) {
+	if depth > decodeMaxDepth || !val.IsValid() {
+		return
+	}
+
+	if val.Type() == timeType {
+		if val.CanSet() {
+			val.Set(reflect.ValueOf(fn(val.Interface().(time.Time))))
+		}
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr:
+		if !val.IsNil() {
+			walkTimes(val.Elem(), depth+1, fn)
+		}
+	case reflect.Interface:
+		if val.IsNil() {
+			return
+		}
+		elem := val.Elem()
+		if elem.Kind() == reflect.Ptr || !val.CanSet() {
+			walkTimes(elem, depth+1, fn)
+			return
+		}
+		copied := reflect.New(elem.Type()).Elem()
+		copied.Set(elem)
+		walkTimes(copied, depth+1, fn)
+		val.Set(copied)
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			copied := reflect.New(val.Type().Elem()).Elem()
+			copied.Set(val.MapIndex(key))
+			walkTimes(copied, depth+1, fn)
+			val.SetMapIndex(key, copied)
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath == "" {
+				walkTimes(val.Field(i), depth+1, fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			walkTimes(val.Index(i), depth+1, fn)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type timesCar struct {
+	Created time.Time
+	Sold    *time.Time
+	History []time.Time
+}
+
+func TestTimeOptions(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 678901234, loc)
+	sold := now
+	car := &timesCar{Created: now, Sold: &sold, History: []time.Time{now}}
+
+	db := new(Database)
+	db.normalizeTimes(car)
+	assert.Equal(t, now, car.Created)
+
+	db.SetTimeOptions(TimeOptions{UTC: true, Precision: time.Millisecond, Location: loc})
+	db.normalizeTimes(car)
+	expect := time.Date(2020, 1, 1, 19, 4, 5, 678000000, time.UTC)
+	assert.Equal(t, expect, car.Created)
+	assert.Equal(t, expect, *car.Sold)
+	assert.Equal(t, expect, car.History[0])
+
+	db.afterDecode(car)
+	assert.Equal(t, loc, car.Created.Location())
+	assert.True(t, expect.Equal(car.Created))
+}
+
+func TestNormalizeTimesDocuments(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 678901234, loc)
+	expect := time.Date(2020, 1, 1, 19, 4, 5, 678000000, time.UTC)
+	db := new(Database)
+	db.SetTimeOptions(TimeOptions{UTC: true, Precision: time.Millisecond})
+
+	var doc interface{} = bson.M{"at": now, "history": []interface{}{now}, "sub": map[string]interface{}{"at": now}}
+	db.normalizeTimes(doc)
+	assert.Equal(t, bson.M{"at": expect, "history": []interface{}{expect}, "sub": map[string]interface{}{"at": expect}}, doc)
+
+	update := bson.M{"$set": bson.M{"at": now}, "$push": bson.M{"history": now}}
+	transformed, err := db.transformUpdate(&timesCar{}, update)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$set": bson.M{"at": expect}, "$push": bson.M{"history": expect}}, transformed)
+
+	ordered := bson.D{{Name: "$set", Value: bson.D{{Name: "at", Value: now}}}}
+	db.normalizeTimes(ordered)
+	assert.Equal(t, bson.D{{Name: "$set", Value: bson.D{{Name: "at", Value: expect}}}}, ordered)
+}
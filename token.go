@@ -0,0 +1,163 @@
+package mgodb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const tokenCollection = "mgodb_token"
+
+var (
+	ErrInvalidToken = errors.New("token is unknown, revoked or expired")
+)
+
+// a session or api token, the store keeps the sha256 of Id only,
+// a leak of the collection gives away no usable token
+type Token struct {
+	Id      string    `bson:"_id" json:"id"`
+	Subject string    `bson:"subject" json:"subject"`
+	Data    bson.M    `bson:"data,omitempty" json:"data,omitempty"`
+	Created time.Time `bson:"created" json:"created"`
+	Expires time.Time `bson:"expires" json:"expires"`
+}
+
+// options of a token store
+type TokenOptions struct {
+	Collection string        // mgodb_token by default
+	TTL        time.Duration // lifetime of a token, 24h by default
+	Sliding    bool          // every successful Validate extends the token by TTL
+}
+
+// a session and token store: Create, Validate and Revoke, expired tokens
+// are removed by a ttl index
+type TokenStore struct {
+	opts TokenOptions
+}
+
+// Tokens returns a token store, call EnsureIndexes once before use
+// for example:
+// sessions := Tokens(TokenOptions{TTL: 30 * time.Minute, Sliding: true})
+// token, err := sessions.Create(userId, bson.M{"role": "admin"})
+// token, err = sessions.Validate(cookie)
+func Tokens(opts TokenOptions) *TokenStore {
+	if opts.Collection == "" {
+		opts.Collection = tokenCollection
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	return &TokenStore{opts: opts}
+}
+
+// EnsureIndexes creates the ttl index removing expired tokens, and the index on subject used by RevokeAll
+func (s *TokenStore) EnsureIndexes() error {
+	err := Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(s.opts.Collection)
+		// mongodb treats ExpireAfter as seconds after the expires field
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"expires"}, ExpireAfter: time.Second, Background: true}); err != nil {
+			return err
+		}
+		return c.EnsureIndex(mgo.Index{Key: []string{"subject"}, Background: true})
+	})
+	if err != nil {
+		logWith(Fields{
+			"collection": s.opts.Collection,
+			"err":        err,
+		}).Error("token db error: ensure indexes fail")
+	}
+	return err
+}
+
+// tokenKey returns the stored _id of the token of id
+func tokenKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a token of subject carrying data, its id is 32 random bytes hex encoded
+func (s *TokenStore) Create(subject string, data bson.M) (*Token, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	token := &Token{Id: hex.EncodeToString(buf), Subject: subject, Data: data, Created: now, Expires: now.Add(s.opts.TTL)}
+	stored := *token
+	stored.Id = tokenKey(token.Id)
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(s.opts.Collection).Insert(&stored)
+	})
+	if err != nil {
+		logWith(Fields{
+			"subject": subject,
+			"err":     err,
+		}).Error("token db error: create fail")
+		return nil, err
+	}
+	return token, nil
+}
+
+// Validate returns the token of id, ErrInvalidToken when it is unknown, revoked or expired.
+// the ttl index removes expired tokens about once a minute, so the expiry is checked here.
+// it reads from the primary, a token just revoked is never accepted by a lagging secondary.
+// with sliding expiry the token is extended by TTL
+func (s *TokenStore) Validate(id string) (*Token, error) {
+	if id == "" {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now().UTC()
+	query := bson.M{"_id": tokenKey(id), "expires": bson.M{"$gt": now}}
+	token := &Token{}
+	err := ExecuteContext(WithReadMode(context.Background(), mgo.Strong), func(sess *mgo.Session) error {
+		c := sess.DB("").C(s.opts.Collection)
+		if !s.opts.Sliding {
+			return c.Find(query).One(token)
+		}
+		change := mgo.Change{Update: bson.M{"$set": bson.M{"expires": now.Add(s.opts.TTL)}}, ReturnNew: true}
+		_, err := c.Find(query).Apply(change, token)
+		return err
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		logWith(Fields{
+			"err": err,
+		}).Error("token db error: validate fail")
+		return nil, err
+	}
+	token.Id = id
+	return token, nil
+}
+
+// Revoke removes the token of id, revoking an unknown token is not an error
+func (s *TokenStore) Revoke(id string) error {
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(s.opts.Collection).RemoveId(tokenKey(id))
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// RevokeAll removes every token of subject, for a logout everywhere or a password change,
+// returns the number of revoked tokens
+func (s *TokenStore) RevokeAll(subject string) (int, error) {
+	removed := 0
+	err := Execute(func(sess *mgo.Session) error {
+		info, err := sess.DB("").C(s.opts.Collection).RemoveAll(bson.M{"subject": subject})
+		if info != nil {
+			removed = info.Removed
+		}
+		return err
+	})
+	return removed, err
+}
@@ -0,0 +1,21 @@
+package mgodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	store := Tokens(TokenOptions{})
+	assert.Equal(t, tokenCollection, store.opts.Collection)
+	assert.Equal(t, 24*time.Hour, store.opts.TTL)
+
+	store = Tokens(TokenOptions{Collection: "session", TTL: time.Minute, Sliding: true})
+	assert.Equal(t, "session", store.opts.Collection)
+	assert.Equal(t, time.Minute, store.opts.TTL)
+
+	_, err := store.Validate("")
+	assert.Equal(t, ErrInvalidToken, err)
+}
@@ -0,0 +1,210 @@
+package mgodb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Transformer normalizes the value of a field before it is written,
+// values it does not handle are returned as is
+type Transformer func(value interface{}) interface{}
+
+type transformers struct {
+	sync.RWMutex
+	named map[string]Transformer
+}
+
+// builtin transformers, available to every database
+var builtinTransformers = map[string]Transformer{
+	"lower": stringTransformer(strings.ToLower),
+	"upper": stringTransformer(strings.ToUpper),
+	"trim":  stringTransformer(strings.TrimSpace),
+	"phone": stringTransformer(normalizePhone),
+}
+
+// RegisterTransformer registers fn under name for the `mgodb:"transform=..."` tag,
+// transformers of a field are separated by "|" and applied in order by Insert,
+// InsertMany, UpsertOne, UpsertOneOnInsert, and by UpdateOne and UpdateAll to
+// the fields of $set, $setOnInsert and replacement documents.
+// lower, upper, trim and phone (digits and a leading +) are builtin
+// for example:
+// type User struct {
+// Email string `bson:"email" mgodb:"transform=trim|lower"`
+// }
+func (db *Database) RegisterTransformer(name string, fn Transformer) {
+	db.transforms.Lock()
+	defer db.transforms.Unlock()
+	if db.transforms.named == nil {
+		db.transforms.named = make(map[string]Transformer)
+	}
+	db.transforms.named[name] = fn
+}
+
+func RegisterTransformer(name string, fn Transformer) {
+	_db.RegisterTransformer(name, fn)
+}
+
+func stringTransformer(fn func(string) string) Transformer {
+	return func(value interface{}) interface{} {
+		if s, ok := value.(string); ok {
+			return fn(s)
+		}
+		return value
+	}
+}
+
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		if unicode.IsDigit(r) || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (db *Database) transformer(name string) (Transformer, error) {
+	db.transforms.RLock()
+	fn, ok := db.transforms.named[name]
+	db.transforms.RUnlock()
+	if !ok {
+		fn, ok = builtinTransformers[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("mgodb: unknown transformer %q", name)
+	}
+	return fn, nil
+}
+
+// transformValue applies the transformers names to value
+func (db *Database) transformValue(names string, value interface{}) (interface{}, error) {
+	for _, name := range strings.Split(names, "|") {
+		fn, err := db.transformer(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		value = fn(value)
+	}
+	return value, nil
+}
+
+// fieldTransforms returns the transformers of the fields of model by bson path
+func fieldTransforms(model interface{}) map[string]string {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	paths := make(map[string]string)
+	if typ.Kind() == reflect.Struct {
+		collectTransforms(typ, "", paths)
+	}
+	return paths
+}
+
+func collectTransforms(typ reflect.Type, prefix string, paths map[string]string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, inline := bsonName(field)
+		if inline {
+			collectTransforms(field.Type, prefix, paths)
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if names, ok := mgodbTag(field)["transform"]; ok && names != "" {
+			paths[prefix+name] = names
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			collectTransforms(field.Type, prefix+name+".", paths)
+		}
+	}
+}
+
+// transformModel applies the transformers of the fields of model in place
+func (db *Database) transformModel(model interface{}) error {
+	val := reflect.Indirect(reflect.ValueOf(model))
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	for path, names := range fieldTransforms(model) {
+		field := val
+		for _, name := range strings.Split(path, ".") {
+			field = fieldByBsonName(field, name)
+		}
+		if !field.IsValid() || !field.CanSet() {
+			continue
+		}
+		value, err := db.transformValue(names, field.Interface())
+		if err != nil {
+			return err
+		}
+		if v := reflect.ValueOf(value); v.IsValid() && v.Type().ConvertibleTo(field.Type()) {
+			field.Set(v.Convert(field.Type()))
+		}
+	}
+	return nil
+}
+
+// transformUpdate returns update with the transformers of model applied to the fields of
+// $set, $setOnInsert and replacement documents, update itself is left unchanged
+// but for its times, normalized in place like the documents written (see SetTimeOptions)
+func (db *Database) transformUpdate(model interface{}, update interface{}) (interface{}, error) {
+	db.normalizeTimes(update)
+	doc, ok := update.(bson.M)
+	if !ok {
+		return update, nil
+	}
+	paths := fieldTransforms(model)
+	if len(paths) == 0 {
+		return update, nil
+	}
+
+	transformed := bson.M{}
+	replacement := bson.M{}
+	for key, value := range doc {
+		switch {
+		case key == "$set" || key == "$setOnInsert":
+			fields, ok := value.(bson.M)
+			if !ok {
+				transformed[key] = value
+				continue
+			}
+			set := bson.M{}
+			for field, v := range fields {
+				if names, ok := paths[field]; ok {
+					var err error
+					if v, err = db.transformValue(names, v); err != nil {
+						return nil, err
+					}
+				}
+				set[field] = v
+			}
+			transformed[key] = set
+		case strings.HasPrefix(key, "$"):
+			transformed[key] = value
+		default:
+			replacement[key] = value
+		}
+	}
+	for field, v := range replacement {
+		if names, ok := paths[field]; ok {
+			var err error
+			if v, err = db.transformValue(names, v); err != nil {
+				return nil, err
+			}
+		}
+		transformed[field] = v
+	}
+	return transformed, nil
+}
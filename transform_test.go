@@ -0,0 +1,51 @@
+package mgodb
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type transformedModel struct {
+	Email   string `bson:"email" mgodb:"transform=trim|lower"`
+	Phone   string `bson:"phone" mgodb:"transform=phone"`
+	Name    string `bson:"name"`
+	Address struct {
+		City string `bson:"city" mgodb:"transform=upper"`
+	} `bson:"address"`
+}
+
+func TestTransformModel(t *testing.T) {
+	db := &Database{}
+	model := &transformedModel{Email: " Foo@Example.COM ", Phone: "+1 (555) 010-2030", Name: " Foo "}
+	model.Address.City = "paris"
+	assert.Nil(t, db.transformModel(model))
+	assert.Equal(t, "foo@example.com", model.Email)
+	assert.Equal(t, "+15550102030", model.Phone)
+	assert.Equal(t, " Foo ", model.Name)
+	assert.Equal(t, "PARIS", model.Address.City)
+
+	assert.NotNil(t, db.transformModel(&struct {
+		Name string `bson:"name" mgodb:"transform=missing"`
+	}{}))
+}
+
+func TestTransformUpdate(t *testing.T) {
+	db := &Database{}
+	db.RegisterTransformer("quote", stringTransformer(strconv.Quote))
+	update := bson.M{"$set": bson.M{"email": "A@B.C", "name": "x"}, "$inc": bson.M{"n": 1}}
+	transformed, err := db.transformUpdate(&transformedModel{}, update)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"$set": bson.M{"email": "a@b.c", "name": "x"}, "$inc": bson.M{"n": 1}}, transformed)
+	assert.Equal(t, "A@B.C", update["$set"].(bson.M)["email"])
+
+	transformed, err = db.transformUpdate(&transformedModel{}, bson.M{"address.city": "rome"})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"address.city": "ROME"}, transformed)
+
+	value, err := db.transformValue("quote|upper", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, `"HELLO"`, value)
+}
@@ -0,0 +1,287 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Two-phase commit for clusters without multi-document transactions,
+// following the pattern of the MongoDB manual:
+//
+// 1. the transaction is stored in the pending transactions collection as "initial"
+// 2. it moves to "pending" and every operation is applied to its record,
+// which remembers the transaction id in pendingTransactions so it is applied once
+// 3. it moves to "applied" and the id is pulled from the records
+// 4. it moves to "done"
+//
+// a failure while applying moves it to "canceling", the rollback updates of
+// the applied operations are run and it ends as "cancelled".
+// RecoverTwoPhase finishes or rolls back transactions left behind by a crash.
+// the atomicity is best effort: other writers can observe intermediate states
+
+const (
+	twoPhaseCollection = "mgodb_transaction"
+	pendingField       = "pendingTransactions"
+)
+
+// states of a two-phase transaction
+const (
+	TwoPhaseInitial   = "initial"
+	TwoPhasePending   = "pending"
+	TwoPhaseApplied   = "applied"
+	TwoPhaseDone      = "done"
+	TwoPhaseCanceling = "canceling"
+	TwoPhaseCancelled = "cancelled"
+)
+
+var (
+	ErrTwoPhaseCancelled = errors.New("two-phase transaction cancelled")
+)
+
+// one operation of a two-phase transaction, Selector must match a single record,
+// before and after Update, Update and Rollback are update documents with operators,
+// Rollback undoes Update
+// for example:
+// TwoPhaseOp{Model: &Account{}, Selector: bson.M{"accountId": 1}, Update: bson.M{"$inc": bson.M{"balance": -100}}, Rollback: bson.M{"$inc": bson.M{"balance": 100}}}
+type TwoPhaseOp struct {
+	Model    interface{}
+	Selector bson.M
+	Update   bson.M
+	Rollback bson.M
+}
+
+// operations are stored as raw bson, field names starting with $ cannot be stored
+type twoPhaseOp struct {
+	Collection string `bson:"collection"`
+	Selector   []byte `bson:"selector"`
+	Update     []byte `bson:"update"`
+	Rollback   []byte `bson:"rollback"`
+}
+
+type twoPhaseTx struct {
+	Id           bson.ObjectId `bson:"_id"`
+	State        string        `bson:"state"`
+	Ops          []twoPhaseOp  `bson:"ops"`
+	LastModified time.Time     `bson:"lastModified"`
+}
+
+// run ops as one two-phase transaction, returns the transaction id,
+// and ErrTwoPhaseCancelled when an operation failed and the applied ones were rolled back
+// for example:
+// id, err := TwoPhaseCommit(debit, credit)
+func TwoPhaseCommit(ops ...TwoPhaseOp) (bson.ObjectId, error) {
+	tx := &twoPhaseTx{Id: bson.NewObjectId(), State: TwoPhaseInitial, LastModified: time.Now().UTC()}
+	for _, op := range ops {
+		if err := _db.checkWritable(op.Model); err != nil {
+			return "", err
+		}
+		stored := twoPhaseOp{Collection: GetCollectionName(op.Model)}
+		var err error
+		if stored.Selector, err = bson.Marshal(op.Selector); err != nil {
+			return "", err
+		}
+		if stored.Update, err = bson.Marshal(op.Update); err != nil {
+			return "", err
+		}
+		if op.Rollback != nil {
+			if stored.Rollback, err = bson.Marshal(op.Rollback); err != nil {
+				return "", err
+			}
+		}
+		tx.Ops = append(tx.Ops, stored)
+	}
+
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(twoPhaseCollection).Insert(tx)
+	})
+	if err != nil {
+		logWith(Fields{
+			"tx":  tx.Id,
+			"err": err,
+		}).Error("two-phase commit error: database operate fail")
+		return "", err
+	}
+
+	return tx.Id, runTwoPhase(tx)
+}
+
+// RecoverTwoPhase finishes the transactions which have been pending or applied for
+// longer than olderThan and rolls back the ones left canceling
+func RecoverTwoPhase(olderThan time.Duration) error {
+	var txs []*twoPhaseTx
+	err := ExecuteIdempotent(func(sess *mgo.Session) error {
+		return sess.DB("").C(twoPhaseCollection).Find(bson.M{
+			"state":        bson.M{"$in": []string{TwoPhaseInitial, TwoPhasePending, TwoPhaseApplied, TwoPhaseCanceling}},
+			"lastModified": bson.M{"$lt": time.Now().UTC().Add(-olderThan)},
+		}).All(&txs)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		if err := runTwoPhase(tx); err != nil && err != ErrTwoPhaseCancelled {
+			logWith(Fields{
+				"tx":    tx.Id,
+				"state": tx.State,
+				"err":   err,
+			}).Error("two-phase recover error: database operate fail")
+			return err
+		}
+	}
+	return nil
+}
+
+// runTwoPhase drives tx from its current state to done or cancelled
+func runTwoPhase(tx *twoPhaseTx) error {
+	for {
+		var err error
+		switch tx.State {
+		case TwoPhaseInitial:
+			err = setTwoPhaseState(tx, TwoPhaseInitial, TwoPhasePending)
+		case TwoPhasePending:
+			if err = applyTwoPhase(tx); err != nil {
+				logWith(Fields{
+					"tx":  tx.Id,
+					"err": err,
+				}).Warn("two-phase commit: apply fail, rolling back")
+				err = setTwoPhaseState(tx, TwoPhasePending, TwoPhaseCanceling)
+			} else {
+				err = setTwoPhaseState(tx, TwoPhasePending, TwoPhaseApplied)
+			}
+		case TwoPhaseApplied:
+			if err = pullTwoPhase(tx); err == nil {
+				err = setTwoPhaseState(tx, TwoPhaseApplied, TwoPhaseDone)
+			}
+		case TwoPhaseCanceling:
+			if err = rollbackTwoPhase(tx); err == nil {
+				err = setTwoPhaseState(tx, TwoPhaseCanceling, TwoPhaseCancelled)
+			}
+		case TwoPhaseDone:
+			return nil
+		case TwoPhaseCancelled:
+			return ErrTwoPhaseCancelled
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func setTwoPhaseState(tx *twoPhaseTx, from string, to string) error {
+	now := time.Now().UTC()
+	err := Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(twoPhaseCollection).Update(
+			bson.M{"_id": tx.Id, "state": from},
+			bson.M{"$set": bson.M{"state": to, "lastModified": now}})
+	})
+	if err != nil {
+		return err
+	}
+	tx.State = to
+	return nil
+}
+
+// apply every operation once, guarded by the pending transaction id
+func applyTwoPhase(tx *twoPhaseTx) error {
+	for _, op := range tx.Ops {
+		err := _db.executeWrite(context.Background(), op.Collection, func(sess *mgo.Session) error {
+			selector, update := bson.M{}, bson.M{}
+			if err := bson.Unmarshal(op.Selector, &selector); err != nil {
+				return err
+			}
+			if err := bson.Unmarshal(op.Update, &update); err != nil {
+				return err
+			}
+			selector[pendingField] = bson.M{"$ne": tx.Id}
+			addUpdateOp(update, "$push", pendingField, tx.Id)
+
+			err := sess.DB("").C(op.Collection).Update(selector, update)
+			if err == mgo.ErrNotFound {
+				// applied before a crash, or no such record
+				selector[pendingField] = tx.Id
+				n, cerr := sess.DB("").C(op.Collection).Find(selector).Count()
+				if cerr != nil {
+					return cerr
+				}
+				if n > 0 {
+					return nil
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pullTwoPhase(tx *twoPhaseTx) error {
+	for _, op := range tx.Ops {
+		selector, err := twoPhaseSelector(op, tx.Id)
+		if err != nil {
+			return err
+		}
+		err = _db.executeWrite(context.Background(), op.Collection, func(sess *mgo.Session) error {
+			_, err := sess.DB("").C(op.Collection).UpdateAll(selector, bson.M{"$pull": bson.M{pendingField: tx.Id}})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undo the operations which were applied, in reverse order
+func rollbackTwoPhase(tx *twoPhaseTx) error {
+	for i := len(tx.Ops) - 1; i >= 0; i-- {
+		op := tx.Ops[i]
+		update := bson.M{}
+		if op.Rollback != nil {
+			if err := bson.Unmarshal(op.Rollback, &update); err != nil {
+				return err
+			}
+		}
+		addUpdateOp(update, "$pull", pendingField, tx.Id)
+		selector, err := twoPhaseSelector(op, tx.Id)
+		if err != nil {
+			return err
+		}
+
+		err = _db.executeWrite(context.Background(), op.Collection, func(sess *mgo.Session) error {
+			_, err := sess.DB("").C(op.Collection).UpdateAll(selector, update)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// twoPhaseSelector matches the record of op if the transaction id was applied to it,
+// the other records of the transaction may share its collection
+func twoPhaseSelector(op twoPhaseOp, id bson.ObjectId) (bson.M, error) {
+	selector := bson.M{}
+	if err := bson.Unmarshal(op.Selector, &selector); err != nil {
+		return nil, err
+	}
+	selector[pendingField] = id
+	return selector, nil
+}
+
+// addUpdateOp adds field: value to the operator op of an update document
+func addUpdateOp(update bson.M, op string, field string, value interface{}) {
+	fields, ok := update[op].(bson.M)
+	if !ok {
+		fields = bson.M{}
+		update[op] = fields
+	}
+	fields[field] = value
+}
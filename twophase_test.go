@@ -0,0 +1,26 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestAddUpdateOp(t *testing.T) {
+	update := bson.M{"$inc": bson.M{"price": 1}}
+	addUpdateOp(update, "$push", "pendingTransactions", "tx")
+	assert.Equal(t, bson.M{"$inc": bson.M{"price": 1}, "$push": bson.M{"pendingTransactions": "tx"}}, update)
+
+	addUpdateOp(update, "$inc", "count", 1)
+	assert.Equal(t, bson.M{"price": 1, "count": 1}, update["$inc"])
+}
+
+func TestTwoPhaseSelector(t *testing.T) {
+	id := bson.NewObjectId()
+	raw, err := bson.Marshal(bson.M{"carId": "a"})
+	assert.Nil(t, err)
+	selector, err := twoPhaseSelector(twoPhaseOp{Collection: "car", Selector: raw}, id)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"carId": "a", pendingField: id}, selector)
+}
@@ -0,0 +1,97 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrNoModels = errors.New("at least one model is required")
+)
+
+// UnionWith returns a $unionWith stage appending the output of pipeline run on collection,
+// requires mongodb 4.4 or later
+// for example:
+// []bson.M{{"$match": query}, UnionWith("order_2019", bson.M{"$match": query})}
+func UnionWith(collection string, pipeline ...bson.M) bson.M {
+	if len(pipeline) == 0 {
+		return bson.M{"$unionWith": collection}
+	}
+	return bson.M{"$unionWith": bson.M{"coll": collection, "pipeline": pipeline}}
+}
+
+// unionPipeline matches query in the collection of the first model and appends the
+// records matching it in the collections of the other models
+func unionPipeline(collections []string, queries []interface{}) []bson.M {
+	pipeline := []bson.M{{"$match": queries[0]}}
+	for i := 1; i < len(collections); i++ {
+		pipeline = append(pipeline, UnionWith(collections[i], bson.M{"$match": queries[i]}))
+	}
+	return pipeline
+}
+
+// FindAcross finds the records matching query in the collections of models into result,
+// for one logical entity spread across partitioned collections, requires mongodb 4.4 or later
+// for example:
+// orders := []*Order{}
+// FindAcross(&orders, []interface{}{&Order2019{}, &Order2020{}}, bson.M{"userId": 1})
+func (db *Database) FindAcross(result interface{}, models []interface{}, query interface{}) error {
+	if err := validateSlice(result); err != nil {
+		db.logWith(Fields{
+			"result": result,
+			"query":  query,
+			"err":    err,
+		}).Error("find across db error: validate model fail")
+		return err
+	}
+	if len(models) == 0 {
+		return ErrNoModels
+	}
+
+	collections := make([]string, len(models))
+	queries := make([]interface{}, len(models))
+	for i, model := range models {
+		selector := query
+		if selector == nil {
+			selector = bson.M{}
+		}
+		if err := db.applyPolicy(context.Background(), model, ActionFind, &selector); err != nil {
+			db.logWith(Fields{
+				"model": model,
+				"err":   err,
+			}).Error("find across db error: policy denied")
+			return err
+		}
+		collections[i] = GetCollectionName(model)
+		queries[i] = selector
+	}
+
+	pipeline := unionPipeline(collections, queries)
+	start := time.Now()
+	err := db.ExecuteIdempotent(func(sess *mgo.Session) error {
+		pipe, err := db.pipe(sess, collections[0], pipeline)
+		if err != nil {
+			return err
+		}
+		return pipe.All(result)
+	})
+	db.observe(context.Background(), "findAcross", collections[0], pipeline, start, err)
+	if err != nil {
+		db.logWith(Fields{
+			"collections": collections,
+			"query":       query,
+			"err":         err,
+		}).Error("find across db error: database operate fail")
+		return err
+	}
+	db.afterDecode(result)
+	return nil
+}
+
+func FindAcross(result interface{}, models []interface{}, query interface{}) error {
+	return _db.FindAcross(result, models, query)
+}
@@ -0,0 +1,20 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestUnionWith(t *testing.T) {
+	assert.Equal(t, bson.M{"$unionWith": "car"}, UnionWith("car"))
+	assert.Equal(t, bson.M{"$unionWith": bson.M{"coll": "car", "pipeline": []bson.M{{"$match": bson.M{"a": 1}}}}},
+		UnionWith("car", bson.M{"$match": bson.M{"a": 1}}))
+
+	query := bson.M{"userId": 1}
+	assert.Equal(t, []bson.M{
+		{"$match": query},
+		UnionWith("order_2020", bson.M{"$match": query}),
+	}, unionPipeline([]string{"order_2019", "order_2020"}, []interface{}{query, query}))
+}
@@ -0,0 +1,226 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// field holding the schema version of a record, a record without it is at version 0
+const SchemaVersionField = "schemaVersion"
+
+// Upgrade changes a raw record from one schema version to the next
+type Upgrade func(doc bson.M) error
+
+type upgradeChain struct {
+	steps     map[int]Upgrade
+	writeBack bool
+}
+
+type schemaUpgrades struct {
+	sync.RWMutex
+	chains map[string]*upgradeChain
+}
+
+// RegisterUpgrade registers the upgrade of the records of model from schema version
+// from to from+1. FindOne and Find run the upgrades of old records on read, before
+// they are decoded, so document shapes evolve without big-bang migrations.
+// new records should be written at the latest version
+// for example:
+// RegisterUpgrade(&User{}, 0, func(doc bson.M) error {
+// doc["name"] = bson.M{"full": doc["name"]}
+// return nil
+// })
+func (db *Database) RegisterUpgrade(model interface{}, from int, fn Upgrade) {
+	chain := db.upgradeChain(GetCollectionName(model))
+	db.upgrades.Lock()
+	defer db.upgrades.Unlock()
+	chain.steps[from] = fn
+}
+
+// SetUpgradeWriteBack makes reads of model write the upgraded records back, so old
+// records are upgraded once. only the fields the upgrades changed are written, unless
+// the record changed meanwhile (its schemaVersion or updated field), and not when the model
+// is read-only or the policy denies the reader the update
+func (db *Database) SetUpgradeWriteBack(model interface{}, enabled bool) {
+	chain := db.upgradeChain(GetCollectionName(model))
+	db.upgrades.Lock()
+	defer db.upgrades.Unlock()
+	chain.writeBack = enabled
+}
+
+func RegisterUpgrade(model interface{}, from int, fn Upgrade) {
+	_db.RegisterUpgrade(model, from, fn)
+}
+
+func SetUpgradeWriteBack(model interface{}, enabled bool) {
+	_db.SetUpgradeWriteBack(model, enabled)
+}
+
+func (db *Database) upgradeChain(collection string) *upgradeChain {
+	db.upgrades.Lock()
+	defer db.upgrades.Unlock()
+	if db.upgrades.chains == nil {
+		db.upgrades.chains = make(map[string]*upgradeChain)
+	}
+	chain, ok := db.upgrades.chains[collection]
+	if !ok {
+		chain = &upgradeChain{steps: make(map[int]Upgrade)}
+		db.upgrades.chains[collection] = chain
+	}
+	return chain
+}
+
+// upgradesOf returns the upgrade steps of collection and whether they are written back, nil without any
+func (db *Database) upgradesOf(collection string) (map[int]Upgrade, bool) {
+	db.upgrades.RLock()
+	defer db.upgrades.RUnlock()
+	chain, ok := db.upgrades.chains[collection]
+	if !ok || len(chain.steps) == 0 {
+		return nil, false
+	}
+	steps := make(map[int]Upgrade, len(chain.steps))
+	for from, fn := range chain.steps {
+		steps[from] = fn
+	}
+	return steps, chain.writeBack
+}
+
+// upgradeDoc runs the upgrades of doc from its version, returns its version before them
+func upgradeDoc(steps map[int]Upgrade, doc bson.M) (int, error) {
+	version := int(toInt64(doc[SchemaVersionField]))
+	from := version
+	for {
+		fn, ok := steps[version]
+		if !ok {
+			return from, nil
+		}
+		if err := fn(doc); err != nil {
+			return from, err
+		}
+		version++
+		doc[SchemaVersionField] = version
+	}
+}
+
+// upgradeWriter writes the upgraded records back for a read
+type upgradeWriter struct {
+	// the selector of the policy for the reader, nil without policy
+	selector interface{}
+}
+
+// upgradeWriterOf returns the writer of the records of model upgraded by a read of ctx,
+// nil when they are not written back
+func (db *Database) upgradeWriterOf(ctx context.Context, model interface{}) *upgradeWriter {
+	if _, writeBack := db.upgradesOf(GetCollectionName(model)); !writeBack {
+		return nil
+	}
+	if db.checkWritable(model) != nil {
+		return nil
+	}
+	var selector interface{}
+	if db.applyPolicy(ctx, model, ActionUpdate, &selector) != nil {
+		return nil
+	}
+	return &upgradeWriter{selector: selector}
+}
+
+// oneUpgraded decodes the record q finds into result, upgraded, written back by writer unless nil
+func (db *Database) oneUpgraded(sess *mgo.Session, collection string, q *mgo.Query, result interface{}, writer *upgradeWriter) error {
+	steps, _ := db.upgradesOf(collection)
+	if steps == nil {
+		return q.One(result)
+	}
+	doc := bson.M{}
+	if err := q.One(&doc); err != nil {
+		return err
+	}
+	if err := db.upgradeRecord(sess, collection, steps, writer, doc); err != nil {
+		return err
+	}
+	return remarshal(doc, result)
+}
+
+// allUpgraded decodes the records q finds into the slice result, upgraded, written back by writer unless nil
+func (db *Database) allUpgraded(sess *mgo.Session, collection string, q *mgo.Query, result interface{}, writer *upgradeWriter) error {
+	return db.decodeAll(sess, collection, q, result, writer)
+}
+
+func (db *Database) upgradeRecord(sess *mgo.Session, collection string, steps map[int]Upgrade, writer *upgradeWriter, doc bson.M) error {
+	var original bson.M
+	if writer != nil {
+		// the upgrades may change nested documents in place
+		if err := remarshal(doc, &original); err != nil {
+			return err
+		}
+	}
+	from, err := upgradeDoc(steps, doc)
+	if err != nil {
+		db.logWith(Fields{
+			"collection": collection,
+			"id":         doc["_id"],
+			"version":    from,
+			"err":        err,
+		}).Error("upgrade record error: upgrade fail")
+		return err
+	}
+	if writer == nil || toInt64(doc[SchemaVersionField]) == int64(from) {
+		return nil
+	}
+
+	// a record changed meanwhile is upgraded again on its next read
+	cond, update := upgradeWriteBack(original, doc, from)
+	if writer.selector != nil {
+		cond = bson.M{"$and": []interface{}{writer.selector, cond}}
+	}
+	err = sess.DB("").C(collection).Update(cond, update)
+	if err != nil && err != mgo.ErrNotFound {
+		db.logWith(Fields{
+			"collection": collection,
+			"id":         doc["_id"],
+			"err":        err,
+		}).Warn("upgrade record error: write back fail")
+	}
+	return nil
+}
+
+// upgradeWriteBack returns the update writing the changes of the upgrades of original
+// into upgraded back, and its condition that the record did not change meanwhile
+func upgradeWriteBack(original bson.M, upgraded bson.M, from int) (bson.M, bson.M) {
+	cond := bson.M{"_id": original["_id"], SchemaVersionField: from}
+	if from == 0 {
+		cond[SchemaVersionField] = bson.M{"$in": []interface{}{nil, 0}}
+	}
+	if updated, ok := original["updated"]; ok {
+		cond["updated"] = updated
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	for key, value := range upgraded {
+		if old, ok := original[key]; !ok || !reflect.DeepEqual(old, value) {
+			set[key] = value
+		}
+	}
+	for key := range original {
+		if _, ok := upgraded[key]; !ok {
+			unset[key] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return cond, update
+}
+
+// remarshal decodes doc into result through bson
+func remarshal(doc interface{}, result interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
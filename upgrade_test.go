@@ -0,0 +1,86 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestUpgradeDoc(t *testing.T) {
+	db := new(Database)
+	steps, _ := db.upgradesOf("fields_inner")
+	assert.Nil(t, steps)
+
+	db.RegisterUpgrade(&fieldsInner{}, 0, func(doc bson.M) error {
+		doc["carId"] = doc["id"]
+		delete(doc, "id")
+		return nil
+	})
+	db.RegisterUpgrade(&fieldsInner{}, 1, func(doc bson.M) error {
+		doc["carId"] = toInt64(doc["carId"]) * 10
+		return nil
+	})
+	db.SetUpgradeWriteBack(&fieldsInner{}, true)
+	steps, writeBack := db.upgradesOf("fields_inner")
+	assert.Len(t, steps, 2)
+	assert.True(t, writeBack)
+
+	doc := bson.M{"id": 1}
+	from, err := upgradeDoc(steps, doc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, from)
+	assert.Equal(t, bson.M{"carId": int64(10), SchemaVersionField: 2}, doc)
+
+	result := &fieldsInner{}
+	assert.NoError(t, remarshal(doc, result))
+	assert.Equal(t, int64(10), result.CarId)
+
+	// up to date records are left as they are
+	from, err = upgradeDoc(steps, doc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, from)
+
+	fail := errors.New("bad record")
+	_, err = upgradeDoc(map[int]Upgrade{0: func(bson.M) error { return fail }}, bson.M{})
+	assert.Equal(t, fail, err)
+}
+
+func TestUpgradeWriteBack(t *testing.T) {
+	updated := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := bson.M{"_id": 1, "id": 1, "name": "x", "owner": bson.M{"name": "y"}, "updated": updated}
+	upgraded := bson.M{"_id": 1, "carId": 1, "name": "x", "owner": bson.M{"name": "y"}, "updated": updated, SchemaVersionField: 1}
+	cond, update := upgradeWriteBack(original, upgraded, 0)
+	assert.Equal(t, bson.M{"_id": 1, SchemaVersionField: bson.M{"$in": []interface{}{nil, 0}}, "updated": updated}, cond)
+	// the fields the upgrades left alone are not written
+	assert.Equal(t, bson.M{"$set": bson.M{"carId": 1, SchemaVersionField: 1}, "$unset": bson.M{"id": ""}}, update)
+
+	cond, update = upgradeWriteBack(bson.M{"_id": 1, "n": 1, SchemaVersionField: 1}, bson.M{"_id": 1, "n": 2, SchemaVersionField: 2}, 1)
+	assert.Equal(t, bson.M{"_id": 1, SchemaVersionField: 1}, cond)
+	assert.Equal(t, bson.M{"$set": bson.M{"n": 2, SchemaVersionField: 2}}, update)
+}
+
+func TestUpgradeWriterOf(t *testing.T) {
+	db := new(Database)
+	assert.Nil(t, db.upgradeWriterOf(context.Background(), &fieldsInner{}))
+
+	db.RegisterUpgrade(&fieldsInner{}, 0, func(doc bson.M) error { return nil })
+	db.SetUpgradeWriteBack(&fieldsInner{}, true)
+	assert.NotNil(t, db.upgradeWriterOf(context.Background(), &fieldsInner{}))
+	assert.NotNil(t, db.upgradeWriterOf(context.Background(), &[]*fieldsInner{}))
+
+	db.SetPolicy(PolicyFunc(func(ctx context.Context, model interface{}, action Action, selector bson.M) (bson.M, error) {
+		if action == ActionUpdate {
+			return nil, ErrPolicyDenied
+		}
+		return selector, nil
+	}))
+	assert.Nil(t, db.upgradeWriterOf(context.Background(), &fieldsInner{}))
+
+	db.SetPolicy(nil)
+	db.SetReadOnly(&fieldsInner{}, true)
+	assert.Nil(t, db.upgradeWriterOf(context.Background(), &fieldsInner{}))
+}
@@ -0,0 +1,85 @@
+package mgodb
+
+import (
+	"reflect"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Warmup reduces the latency spike of the first requests after a deploy:
+// it opens a socket for every session of the pool, runs a trivial query on
+// the collection of each model and primes the bson reflection cache of the models.
+// call it after Init
+// for example:
+// Warmup(&Car{}, &CarOwner{})
+func (db *Database) Warmup(models ...interface{}) error {
+	if db.session.Load() == nil {
+		return ErrNotInitialized
+	}
+
+	// hold every session of the default pool at once, so each one opens its own socket,
+	// the partitions hold the others
+	db.partitions.RLock()
+	defer db.partitions.RUnlock()
+	size := cap(db.latch) - db.partitions.reserved
+	sessions := make([]*mgo.Session, 0, size)
+	for k := 0; k < size; k++ {
+		sessions = append(sessions, <-db.latch)
+	}
+	defer func() {
+		for _, sess := range sessions {
+			sess.Refresh()
+			db.latch <- sess
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(sessions))
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess *mgo.Session) {
+			defer wg.Done()
+			if err := sess.Ping(); err != nil {
+				errs <- err
+			}
+		}(sess)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		db.logWith(Fields{
+			"err": err,
+		}).Error("warmup error: ping fail")
+		return err
+	}
+
+	for _, model := range models {
+		// encoding a zero value caches the struct info of the model type
+		if typ := reflect.TypeOf(model); typ != nil && typ.Kind() == reflect.Ptr {
+			bson.Marshal(reflect.New(typ.Elem()).Interface())
+		}
+
+		collection := GetCollectionName(model)
+		var doc bson.M
+		err := sessions[0].DB("").C(collection).Find(nil).Select(bson.M{"_id": 1}).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			db.logWith(Fields{
+				"collection": collection,
+				"err":        err,
+			}).Error("warmup error: database operate fail")
+			return err
+		}
+	}
+
+	db.logWith(Fields{
+		"sessions":    len(sessions),
+		"collections": len(models),
+	}).Info("mongodb: warmed up")
+	return nil
+}
+
+func Warmup(models ...interface{}) error {
+	return _db.Warmup(models...)
+}
@@ -0,0 +1,12 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmupNotInitialized(t *testing.T) {
+	db := new(Database)
+	assert.Equal(t, ErrNotInitialized, db.Warmup(&fieldsInner{}))
+}
@@ -0,0 +1,555 @@
+package mgodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// resume positions of watchers, by watcher name
+	watchCollection = "mgodb_watch"
+	// a read waits this long for new changes before checking for close
+	watchAwait = time.Second
+	// reconnection backoff bounds
+	watchMinBackoff = 100 * time.Millisecond
+	watchMaxBackoff = 30 * time.Second
+)
+
+// operation types of a ChangeEvent
+const (
+	ChangeInsert  = "insert"
+	ChangeUpdate  = "update"
+	ChangeReplace = "replace"
+	ChangeDelete  = "delete"
+)
+
+var (
+	ErrWatchPipeline    = errors.New("watch pipeline needs change streams, mongodb 3.6+")
+	ErrWatchInvalidated = errors.New("watched collection was dropped or renamed")
+
+	// the tailable oplog cursor died, reopened at once
+	errOplogCursorDead = errors.New("oplog cursor dead")
+)
+
+// server error codes which end a watch instead of reconnecting
+var watchFatalCodes = map[int]bool{
+	// not a replica set
+	40573: true,
+	// ChangeStreamFatalError
+	280: true,
+	// ChangeStreamHistoryLost, the resume position left the oplog
+	286: true,
+}
+
+// fields set by an update, and fields it removed
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// a change of a watched collection
+type ChangeEvent struct {
+	// resume token, empty when tailing the oplog
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	// _id of the changed document
+	DocumentKey bson.M `bson:"documentKey"`
+	// the inserted or replaced document, or the updated document as of the read
+	// of the event, empty for deletes and for documents removed since
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+	ClusterTime       bson.MongoTimestamp `bson:"clusterTime"`
+}
+
+// Decode unmarshals the full document into out, returns mgo.ErrNotFound when the event has none
+func (e *ChangeEvent) Decode(out interface{}) error {
+	// 0x03 embedded document
+	if e.FullDocument.Kind != 0x03 {
+		return mgo.ErrNotFound
+	}
+	return e.FullDocument.Unmarshal(out)
+}
+
+// resume position of a watcher
+type watchState struct {
+	Name    string              `bson:"_id"`
+	Token   bson.Raw            `bson:"token,omitempty"`
+	Ts      bson.MongoTimestamp `bson:"ts,omitempty"`
+	Updated time.Time           `bson:"updated"`
+}
+
+// source of change events, a change stream or the tailed oplog
+type changeSource interface {
+	// next returns the events read within watchAwait, possibly none,
+	// and the resume token reported with them, if any
+	next() ([]ChangeEvent, bson.Raw, error)
+	close()
+}
+
+// Watcher delivers the changes of a collection to a handler until it is closed
+type Watcher struct {
+	// key of the persisted resume position
+	Name       string
+	Collection string
+
+	db       *Database
+	pipeline []bson.M
+	handler  func(ChangeEvent) error
+	oplog    bool
+	state    watchState
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// Watch tails the changes of the collection of model and calls handler with every
+// insert, update, replace and delete, in order, until the watcher is closed.
+// it reads a change stream on mongodb 3.6+, where pipeline stages (typically $match on
+// operationType or fullDocument fields) filter the events, and tails the oplog on older
+// servers, where pipeline must be empty. both need a replica set.
+// the position after each handled event is persisted in the mgodb_watch collection,
+// under the collection name and a hash of pipeline, so a restarted watcher resumes
+// where it stopped and events are delivered at least once. lost connections are
+// reopened with backoff. an error returned by handler stops the watcher, see Err
+// for example:
+// w, err := Watch(&Car{}, []bson.M{{"$match": bson.M{"operationType": "insert"}}}, func(ev ChangeEvent) error {
+// car := &Car{}
+// return ev.Decode(car)
+// })
+// defer w.Close()
+func (db *Database) Watch(model interface{}, pipeline []bson.M, handler func(ChangeEvent) error) (*Watcher, error) {
+	return db.WatchContext(context.Background(), model, pipeline, handler)
+}
+
+// WatchContext is like Watch, the watcher also stops when ctx is done
+func (db *Database) WatchContext(ctx context.Context, model interface{}, pipeline []bson.M, handler func(ChangeEvent) error) (*Watcher, error) {
+	if err := validateModel(model); err != nil {
+		db.logContext(ctx, Fields{
+			"model": model,
+			"err":   err,
+		}).Error("watch db error: validate model fail")
+		return nil, err
+	}
+	// row filters of the policy cannot apply to change events, soft deletes are events too
+	var selector interface{}
+	if err := db.applyPolicy(Unscoped(ctx), model, ActionFind, &selector); err != nil {
+		return nil, err
+	}
+	if match, ok := selector.(bson.M); ok && len(match) > 0 {
+		return nil, ErrPolicyDenied
+	}
+
+	collection := GetCollectionName(model)
+	w := &Watcher{
+		Name:       watchName(collection, pipeline),
+		Collection: collection,
+		db:         db,
+		pipeline:   pipeline,
+		handler:    handler,
+		done:       make(chan struct{}),
+	}
+
+	// the first source is opened before returning, so that configuration errors surface here
+	sess := db.watchSession()
+	info, err := sess.BuildInfo()
+	if err == nil {
+		w.oplog = !info.VersionAtLeast(3, 6)
+		if w.oplog && len(pipeline) > 0 {
+			err = ErrWatchPipeline
+		}
+	}
+	if err == nil {
+		err = sess.DB("").C(watchCollection).FindId(w.Name).One(&w.state)
+		if err == mgo.ErrNotFound {
+			w.state = watchState{Name: w.Name}
+			err = nil
+		}
+	}
+	var source changeSource
+	if err == nil {
+		source, err = w.open(sess)
+	}
+	if err != nil {
+		sess.Close()
+		db.logContext(ctx, Fields{
+			"collection": collection,
+			"err":        err,
+		}).Error("watch db error: open fail")
+		return nil, err
+	}
+
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	go w.run(sess, source)
+	return w, nil
+}
+
+func Watch(model interface{}, pipeline []bson.M, handler func(ChangeEvent) error) (*Watcher, error) {
+	return _db.Watch(model, pipeline, handler)
+}
+
+func WatchContext(ctx context.Context, model interface{}, pipeline []bson.M, handler func(ChangeEvent) error) (*Watcher, error) {
+	return _db.WatchContext(ctx, model, pipeline, handler)
+}
+
+// Close stops the watcher and waits for the handler in progress,
+// returns the error which stopped it before, if any
+func (w *Watcher) Close() error {
+	w.cancel()
+	<-w.done
+	return w.err
+}
+
+// Done is closed once the watcher stopped
+func (w *Watcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// Err returns the handler or server error which stopped the watcher,
+// nil while it runs and when it was closed
+func (w *Watcher) Err() error {
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+// watchName keys the resume position of a watch, distinct pipelines resume apart
+func watchName(collection string, pipeline []bson.M) string {
+	if len(pipeline) == 0 {
+		return collection
+	}
+	return collection + "." + cacheKey(pipeline)[:8]
+}
+
+// watchSession is a session of its own, a watcher would hold a latched one forever
+func (db *Database) watchSession() *mgo.Session {
+	sess := db.session.Load().Copy()
+	sess.SetMode(mgo.Strong, true)
+	sess.SetSocketTimeout(db.timeout + watchAwait)
+	return sess
+}
+
+func (w *Watcher) run(sess *mgo.Session, source changeSource) {
+	defer close(w.done)
+	defer func() {
+		sess.Close()
+	}()
+
+	backoff := watchMinBackoff
+	var err error
+	for {
+		if source != nil {
+			var delivered bool
+			delivered, err = w.tail(source)
+			source.close()
+			source = nil
+			if delivered {
+				backoff = watchMinBackoff
+			}
+		}
+		if w.ctx.Err() != nil {
+			return
+		}
+		if fatal, ok := err.(watchFatal); ok {
+			w.err = fatal.err
+			w.db.logWith(Fields{
+				"collection": w.Collection,
+				"err":        w.err,
+			}).Error("watch db error: watcher stopped")
+			return
+		}
+
+		if err != errOplogCursorDead {
+			w.db.logWith(Fields{
+				"collection": w.Collection,
+				"backoff":    backoff,
+				"err":        err,
+			}).Warn("watch reconnect")
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > watchMaxBackoff {
+				backoff = watchMaxBackoff
+			}
+		}
+		sess.Close()
+		sess = w.db.watchSession()
+		source, err = w.open(sess)
+		if isWatchFatal(err) {
+			err = watchFatal{err}
+		}
+	}
+}
+
+// watchFatal wraps errors which stop the watcher
+type watchFatal struct {
+	err error
+}
+
+func (e watchFatal) Error() string {
+	return e.err.Error()
+}
+
+func isWatchFatal(err error) bool {
+	if qerr, ok := err.(*mgo.QueryError); ok {
+		return watchFatalCodes[qerr.Code]
+	}
+	return false
+}
+
+// tail delivers the events of source until it fails or the watcher is closed,
+// reports whether any event was delivered
+func (w *Watcher) tail(source changeSource) (bool, error) {
+	delivered := false
+	for w.ctx.Err() == nil {
+		events, token, err := source.next()
+		if err != nil {
+			if isWatchFatal(err) {
+				err = watchFatal{err}
+			}
+			return delivered, err
+		}
+		for _, ev := range events {
+			switch ev.OperationType {
+			case ChangeInsert, ChangeUpdate, ChangeReplace, ChangeDelete:
+			case "invalidate":
+				return delivered, watchFatal{ErrWatchInvalidated}
+			default:
+				continue
+			}
+			if err := w.handler(ev); err != nil {
+				return delivered, watchFatal{err}
+			}
+			delivered = true
+			w.state.Token, w.state.Ts = ev.ID, ev.ClusterTime
+			w.save()
+		}
+		// the position moves past filtered out events too,
+		// so that a quiet watch does not fall off the oplog
+		if len(events) == 0 && token.Kind != 0 && !rawEqual(token, w.state.Token) {
+			w.state.Token = token
+			w.save()
+		}
+	}
+	return delivered, nil
+}
+
+func rawEqual(a, b bson.Raw) bool {
+	return a.Kind == b.Kind && string(a.Data) == string(b.Data)
+}
+
+// save persists the resume position, a failure only means replayed events after a restart
+func (w *Watcher) save() {
+	w.state.Updated = time.Now().UTC()
+	err := w.db.ExecuteContext(w.ctx, func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(watchCollection).UpsertId(w.state.Name, w.state)
+		return err
+	})
+	if err != nil && w.ctx.Err() == nil {
+		w.db.logWith(Fields{
+			"collection": w.Collection,
+			"name":       w.Name,
+			"err":        err,
+		}).Warn("watch save position fail")
+	}
+}
+
+func (w *Watcher) open(sess *mgo.Session) (changeSource, error) {
+	if w.oplog {
+		return w.openOplog(sess)
+	}
+	return w.openChangeStream(sess)
+}
+
+// reply of the aggregate and getMore commands
+type changeStreamReply struct {
+	Cursor struct {
+		ID                   int64         `bson:"id"`
+		FirstBatch           []ChangeEvent `bson:"firstBatch"`
+		NextBatch            []ChangeEvent `bson:"nextBatch"`
+		PostBatchResumeToken bson.Raw      `bson:"postBatchResumeToken"`
+	} `bson:"cursor"`
+}
+
+// changeStream reads a $changeStream aggregation through raw commands,
+// mgo predates change streams
+type changeStream struct {
+	sess       *mgo.Session
+	collection string
+	id         int64
+	first      []ChangeEvent
+	token      bson.Raw
+}
+
+func (w *Watcher) openChangeStream(sess *mgo.Session) (changeSource, error) {
+	spec := bson.M{"fullDocument": "updateLookup"}
+	if w.state.Token.Kind != 0 {
+		spec["resumeAfter"] = w.state.Token
+	}
+	stages := append([]bson.M{{"$changeStream": spec}}, w.pipeline...)
+	var reply changeStreamReply
+	err := sess.DB("").Run(bson.D{
+		{Name: "aggregate", Value: w.Collection},
+		{Name: "pipeline", Value: stages},
+		{Name: "cursor", Value: bson.M{}},
+	}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &changeStream{
+		sess:       sess,
+		collection: w.Collection,
+		id:         reply.Cursor.ID,
+		first:      reply.Cursor.FirstBatch,
+		token:      reply.Cursor.PostBatchResumeToken,
+	}, nil
+}
+
+func (s *changeStream) next() ([]ChangeEvent, bson.Raw, error) {
+	if s.first != nil {
+		events := s.first
+		s.first = nil
+		return events, s.token, nil
+	}
+	if s.id == 0 {
+		return nil, bson.Raw{}, watchFatal{ErrWatchInvalidated}
+	}
+	var reply changeStreamReply
+	err := s.sess.DB("").Run(bson.D{
+		{Name: "getMore", Value: s.id},
+		{Name: "collection", Value: s.collection},
+		{Name: "maxTimeMS", Value: int64(watchAwait / time.Millisecond)},
+	}, &reply)
+	if err != nil {
+		return nil, bson.Raw{}, err
+	}
+	s.id = reply.Cursor.ID
+	return reply.Cursor.NextBatch, reply.Cursor.PostBatchResumeToken, nil
+}
+
+func (s *changeStream) close() {
+	if s.id == 0 {
+		return
+	}
+	s.sess.DB("").Run(bson.D{
+		{Name: "killCursors", Value: s.collection},
+		{Name: "cursors", Value: []int64{s.id}},
+	}, nil)
+	s.id = 0
+}
+
+// one entry of the replica set oplog
+type oplogEntry struct {
+	Ts bson.MongoTimestamp `bson:"ts"`
+	Op string              `bson:"op"`
+	O  bson.M              `bson:"o"`
+	O2 bson.M              `bson:"o2"`
+}
+
+// oplogTail turns oplog entries of a collection into change events,
+// for servers without change streams
+type oplogTail struct {
+	sess       *mgo.Session
+	collection string
+	iter       *mgo.Iter
+}
+
+func (w *Watcher) openOplog(sess *mgo.Session) (changeSource, error) {
+	oplog := sess.DB("local").C("oplog.rs")
+	if w.state.Ts == 0 {
+		// start at the latest entry
+		var last oplogEntry
+		err := oplog.Find(nil).Sort("-$natural").Select(bson.M{"ts": 1}).One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		w.state.Ts = last.Ts
+	}
+	query := bson.M{
+		"ns": sess.DB("").Name + "." + w.Collection,
+		"ts": bson.M{"$gt": w.state.Ts},
+		"op": bson.M{"$in": []string{"i", "u", "d"}},
+	}
+	return &oplogTail{
+		sess:       sess,
+		collection: w.Collection,
+		iter:       oplog.Find(query).LogReplay().Tail(watchAwait),
+	}, nil
+}
+
+func (t *oplogTail) next() ([]ChangeEvent, bson.Raw, error) {
+	var entry oplogEntry
+	if !t.iter.Next(&entry) {
+		if t.iter.Timeout() {
+			return nil, bson.Raw{}, nil
+		}
+		if err := t.iter.Err(); err != nil {
+			return nil, bson.Raw{}, err
+		}
+		return nil, bson.Raw{}, errOplogCursorDead
+	}
+	ev, err := t.event(entry)
+	if err != nil {
+		return nil, bson.Raw{}, err
+	}
+	return []ChangeEvent{ev}, bson.Raw{}, nil
+}
+
+// event maps an oplog entry to the change stream event of the same change
+func (t *oplogTail) event(entry oplogEntry) (ChangeEvent, error) {
+	ev := ChangeEvent{ClusterTime: entry.Ts}
+	switch entry.Op {
+	case "i":
+		ev.OperationType = ChangeInsert
+		ev.DocumentKey = bson.M{"_id": entry.O["_id"]}
+		return ev, setRawDocument(&ev.FullDocument, entry.O)
+	case "d":
+		ev.OperationType = ChangeDelete
+		ev.DocumentKey = bson.M{"_id": entry.O["_id"]}
+		return ev, nil
+	}
+
+	ev.DocumentKey = bson.M{"_id": entry.O2["_id"]}
+	set, hasSet := entry.O["$set"].(bson.M)
+	unset, hasUnset := entry.O["$unset"].(bson.M)
+	if !hasSet && !hasUnset {
+		ev.OperationType = ChangeReplace
+		return ev, setRawDocument(&ev.FullDocument, entry.O)
+	}
+	ev.OperationType = ChangeUpdate
+	ev.UpdateDescription = &UpdateDescription{UpdatedFields: set, RemovedFields: []string{}}
+	if ev.UpdateDescription.UpdatedFields == nil {
+		ev.UpdateDescription.UpdatedFields = bson.M{}
+	}
+	for field := range unset {
+		ev.UpdateDescription.RemovedFields = append(ev.UpdateDescription.RemovedFields, field)
+	}
+	// like updateLookup of change streams, the document as of now
+	err := t.sess.DB("").C(t.collection).FindId(ev.DocumentKey["_id"]).One(&ev.FullDocument)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return ev, err
+}
+
+func (t *oplogTail) close() {
+	t.iter.Close()
+}
+
+func setRawDocument(raw *bson.Raw, doc bson.M) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	*raw = bson.Raw{Kind: 0x03, Data: data}
+	return nil
+}
@@ -0,0 +1,52 @@
+package mgodb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestWatchName(t *testing.T) {
+	assert.Equal(t, "fields_inner", watchName("fields_inner", nil))
+
+	pipeline := []bson.M{{"$match": bson.M{"operationType": "insert", "fullDocument.carId": 1}}}
+	name := watchName("fields_inner", pipeline)
+	assert.NotEqual(t, "fields_inner", name)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, name, watchName("fields_inner", []bson.M{{"$match": bson.M{"fullDocument.carId": 1, "operationType": "insert"}}}))
+	}
+	assert.NotEqual(t, name, watchName("fields_inner", []bson.M{{"$match": bson.M{"operationType": "delete"}}}))
+}
+
+func TestOplogEvent(t *testing.T) {
+	tail := &oplogTail{collection: "fields_inner"}
+
+	ev, err := tail.event(oplogEntry{Ts: 7, Op: "i", O: bson.M{"_id": 1, "carId": int64(3)}})
+	assert.Nil(t, err)
+	assert.Equal(t, ChangeInsert, ev.OperationType)
+	assert.Equal(t, bson.M{"_id": 1}, ev.DocumentKey)
+	assert.Equal(t, bson.MongoTimestamp(7), ev.ClusterTime)
+	doc := &fieldsInner{}
+	assert.Nil(t, ev.Decode(doc))
+	assert.Equal(t, int64(3), doc.CarId)
+
+	ev, err = tail.event(oplogEntry{Op: "u", O: bson.M{"_id": 1, "carId": int64(4)}, O2: bson.M{"_id": 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, ChangeReplace, ev.OperationType)
+	assert.Nil(t, ev.Decode(doc))
+	assert.Equal(t, int64(4), doc.CarId)
+
+	ev, err = tail.event(oplogEntry{Op: "d", O: bson.M{"_id": 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, ChangeDelete, ev.OperationType)
+	assert.Equal(t, bson.M{"_id": 1}, ev.DocumentKey)
+	assert.Equal(t, mgo.ErrNotFound, ev.Decode(doc))
+}
+
+func TestWatchFatal(t *testing.T) {
+	assert.True(t, isWatchFatal(&mgo.QueryError{Code: 286}))
+	assert.False(t, isWatchFatal(&mgo.QueryError{Code: 6}))
+	assert.False(t, isWatchFatal(nil))
+}
@@ -0,0 +1,81 @@
+package mgodb
+
+import (
+	"context"
+	"reflect"
+
+	mgo "gopkg.in/mgo.v2"
+)
+
+type writeConcernKey struct{}
+
+// SetWriteConcern sets the write concern of the writes of db, Init and New wait for
+// the acknowledgment of the primary. nil makes writes fire-and-forget, unchecked.
+// call it after Init
+// for example:
+// SetWriteConcern(&mgo.Safe{WMode: "majority", J: true, WTimeout: 5000})
+func (db *Database) SetWriteConcern(safe *mgo.Safe) error {
+	sess := db.session.Load()
+	if sess == nil {
+		return ErrNotInitialized
+	}
+	sess.SetSafe(safe)
+	return nil
+}
+
+func SetWriteConcern(safe *mgo.Safe) error {
+	return _db.SetWriteConcern(safe)
+}
+
+// WithWriteConcern returns a copy of ctx whose writes use safe instead of
+// the write concern of SetWriteConcern
+// for example, a payment acknowledged by a majority, and a bulk import unchecked:
+// err := InsertContext(WithWriteConcern(ctx, &mgo.Safe{WMode: "majority", J: true}), payment)
+// err = InsertManyContext(WithOptions(ctx, Unacknowledged()), rows)
+func WithWriteConcern(ctx context.Context, safe *mgo.Safe) context.Context {
+	return context.WithValue(ctx, writeConcernKey{}, safe)
+}
+
+// WriteConcern writes with safe instead of the write concern of SetWriteConcern,
+// like WithWriteConcern
+// for example:
+// UpdateOne(car, bson.M{"carId": 1}, update, WriteConcern(&mgo.Safe{W: 2, WTimeout: 5000}))
+func WriteConcern(safe *mgo.Safe) CallOption {
+	return func(ctx context.Context) context.Context {
+		return WithWriteConcern(ctx, safe)
+	}
+}
+
+// WMajority waits for the acknowledgment of a majority of the replica set, journaled
+// for example:
+// Insert(payment, WMajority())
+func WMajority() CallOption {
+	return WriteConcern(&mgo.Safe{WMode: "majority", J: true})
+}
+
+// Unacknowledged writes fire-and-forget, write errors go unnoticed
+// for example:
+// InsertMany(rows, Unacknowledged())
+func Unacknowledged() CallOption {
+	return WriteConcern(nil)
+}
+
+// writeConcernOf returns the write concern of the writes of ctx, false before Init
+func (db *Database) writeConcernOf(ctx context.Context) (*mgo.Safe, bool) {
+	if safe, ok := ctx.Value(writeConcernKey{}).(*mgo.Safe); ok {
+		return safe, true
+	}
+	sess := db.session.Load()
+	if sess == nil {
+		return nil, false
+	}
+	return sess.Safe(), true
+}
+
+// applyWriteConcern sets the write concern of ctx on a latched session,
+// which keeps the write concern of the last operation otherwise
+func (db *Database) applyWriteConcern(ctx context.Context, sess *mgo.Session) {
+	if safe, ok := db.writeConcernOf(ctx); ok && !reflect.DeepEqual(sess.Safe(), safe) {
+		sess.SetSafe(safe)
+	}
+}
@@ -0,0 +1,29 @@
+package mgodb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func TestWriteConcern(t *testing.T) {
+	db := &Database{}
+	_, ok := db.writeConcernOf(context.Background())
+	assert.False(t, ok)
+
+	safe, ok := db.writeConcernOf(WithOptions(context.Background(), WMajority()))
+	assert.True(t, ok)
+	assert.Equal(t, &mgo.Safe{WMode: "majority", J: true}, safe)
+
+	safe, ok = db.writeConcernOf(WithOptions(context.Background(), WriteConcern(&mgo.Safe{W: 2})))
+	assert.True(t, ok)
+	assert.Equal(t, &mgo.Safe{W: 2}, safe)
+
+	safe, ok = db.writeConcernOf(WithOptions(context.Background(), Unacknowledged()))
+	assert.True(t, ok)
+	assert.Nil(t, safe)
+
+	assert.Equal(t, ErrNotInitialized, db.SetWriteConcern(&mgo.Safe{WMode: "majority", J: true}))
+}